@@ -1,15 +1,29 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/swaggo/files"
 	"github.com/swaggo/gin-swagger"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	_ "notes-api/docs"
 	"notes-api/internal/config"
 	"notes-api/internal/database"
+	"notes-api/internal/handlers"
+	"notes-api/internal/logging"
+	"notes-api/internal/metrics"
 	"notes-api/internal/routes"
+	"notes-api/internal/services"
+	"notes-api/internal/tracing"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 )
 
 // Notes RESTful API
@@ -19,20 +33,181 @@ import (
 // @Param Authorization header string true "Bearer {token}"
 
 func main() {
+	// SIGINT и SIGTERM прерывают подключение к базе данных и запускают плавную остановку
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	// Загрузка конфигурации
-	config.LoadConfig()
+	cfg, err := config.Load()
+	if err != nil {
+		fatal("Ошибка загрузки конфигурации", err)
+	}
+	// Команда config print выводит итоговые настройки со скрытыми секретами
+	if command(1) == "config" {
+		if command(2) != "print" {
+			fmt.Fprintln(os.Stderr, "Использование: notes-api config print")
+			os.Exit(2)
+		}
+		if err := cfg.Print(os.Stdout); err != nil {
+			fatal("Ошибка вывода конфигурации", err)
+		}
+		if err := cfg.Validate(); err != nil {
+			fatal("Ошибка в конфигурации", err)
+		}
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		fatal("Ошибка в конфигурации", err)
+	}
+	level, _ := cfg.Log.SlogLevel()
+	logging.Setup(os.Stderr, cfg.Log.Format, level)
+	// Трассировка до подключения к базе данных, чтобы запросы к ней попадали в спаны
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing.Endpoint, cfg.Tracing.ServiceName)
+	if err != nil {
+		fatal("Ошибка настройки трассировки", err)
+	}
+	// Перед выходом отправляются накопленные спаны
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Warn("Ошибка при остановке трассировки", "error", err)
+		}
+	}()
 	// Инициализация базы данных
-	db := database.InitDB()
+	db, err := database.InitDB(ctx, cfg.Database)
+	if err != nil {
+		fatal("Ошибка подключения к базе данных", err)
+	}
 	defer db.Close()
-	database.InitSchema(db)
+	metrics.RegisterDB(db)
+	if err := database.InitSchema(db); err != nil {
+		db.Close()
+		fatal("Ошибка при создании схемы базы данных", err)
+	}
+	// Назначение администраторов из настроек (ADMIN_USERNAMES через запятую)
+	if len(cfg.Auth.AdminUsernames) > 0 {
+		adminService := services.AdminService{DB: db, Ctx: ctx}
+		if err := adminService.PromoteAdmins(cfg.Auth.AdminUsernames); err != nil {
+			db.Close()
+			fatal("Ошибка при назначении администраторов", err)
+		}
+	}
+	worker := &services.Worker{DB: db, Concurrency: cfg.Jobs.Workers, PollInterval: time.Second, SMTP: cfg.SMTP}
+	// Команда worker запускает только обработку очереди задач, без HTTP-сервера
+	if command(1) == "worker" {
+		if worker.Concurrency == 0 {
+			db.Close()
+			fatal("Ошибка в конфигурации", errors.New("для команды worker JOB_WORKERS должна быть больше нуля"))
+		}
+		slog.Info("Обработчик очереди задач запущен", "concurrency", worker.Concurrency)
+		if err := worker.Run(ctx); err != nil {
+			db.Close()
+			fatal("Ошибка при обработке очереди задач", err)
+		}
+		slog.Info("Обработчик очереди задач остановлен")
+		return
+	}
+	// Обработка очереди задач вместе с сервером; JOB_WORKERS=0 отключает ее, если запущена команда worker.
+	// Очередь останавливается после сервера, чтобы задачи, поставленные последними запросами, не ждали.
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		if worker.Concurrency == 0 {
+			return
+		}
+		if err := worker.Run(workerCtx); err != nil {
+			slog.Error("Ошибка при обработке очереди задач", "error", err)
+		}
+	}()
 	// Настройка маршрутизатора
-	router := gin.Default()
+	// Вместо журнала gin - записи log/slog с номером запроса; спан запроса начинается до записи в журнал,
+	// чтобы записи получили trace_id
+	router := gin.New()
+	router.Use(gin.Recovery(), handlers.Trace(), handlers.RequestLogger(), handlers.RecordMetrics())
 
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	// Проверки состояния для оркестратора; регистрируются до проверки сессии
+	router.GET("/healthz", handlers.Healthz())
+	router.GET("/readyz", handlers.Readyz(ctx, db, worker))
+	// Метрики Prometheus: отдельным сервером или основным, но с токеном
+	var metricsServer *http.Server
+	if cfg.Metrics.Port > 0 {
+		metricsRouter := gin.New()
+		metricsRouter.GET("/metrics", handlers.Metrics(cfg.Metrics.Token))
+		metricsServer = &http.Server{
+			Addr:              net.JoinHostPort(cfg.Metrics.Host, strconv.Itoa(cfg.Metrics.Port)),
+			Handler:           metricsRouter,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			slog.Info("Метрики доступны", "address", metricsServer.Addr)
+			if err := metricsServer.ListenAndServe(); err != http.ErrServerClosed {
+				slog.Error("Ошибка сервера метрик", "error", err)
+			}
+		}()
+	} else if cfg.Metrics.Token != "" {
+		router.GET("/metrics", handlers.Metrics(cfg.Metrics.Token))
+	}
 	// Настройка маршрутов
-	routes.SetupRoutes(router, db)
-	log.Println("Сервер запущен на порту 8080")
-	if err := http.ListenAndServe(":8080", router); err != nil {
-		log.Fatalf("Ошибка при запуске сервера: %v", err)
+	routes.SetupRoutes(router, db, cfg)
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Server.Port),
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	var serverErr error
+	serverDone := make(chan struct{})
+	go func() {
+		slog.Info("Сервер запущен", "port", cfg.Server.Port)
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			serverErr = err
+		}
+		close(serverDone)
+	}()
+	select {
+	case <-serverDone:
+	case <-ctx.Done():
+		slog.Info("Получен сигнал остановки, завершаем обработку запросов и задач")
+	}
+	// Плавная остановка: сервер перестает принимать соединения и дожидается текущих запросов,
+	// затем обработчики очереди доводят до конца выполняемые задачи
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Ошибка при остановке сервера", "error", err)
+	}
+	if metricsServer != nil {
+		metricsServer.Close()
+	}
+	stopWorker()
+	select {
+	case <-workerDone:
+	case <-shutdownCtx.Done():
+		// Незавершенные задачи заберут другие обработчики после истечения закрепления
+		slog.Warn("Задачи очереди не завершились за отведенное время")
+	}
+	<-serverDone
+	if serverErr != nil {
+		db.Close()
+		fatal("Ошибка при запуске сервера", serverErr)
+	}
+	slog.Info("Сервер остановлен")
+}
+
+// fatal записывает ошибку в журнал и завершает процесс
+func fatal(message string, err error) {
+	slog.Error(message, "error", err)
+	os.Exit(1)
+}
+
+// command возвращает i-й аргумент командной строки или пустую строку
+func command(i int) string {
+	if len(os.Args) > i {
+		return os.Args[i]
 	}
+	return ""
 }
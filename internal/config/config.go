@@ -1,12 +1,314 @@
 package config
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"github.com/joho/godotenv"
-	"log"
+	"gopkg.in/yaml.v3"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func LoadConfig() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Ошибка загрузки .env файла")
+// defaultConfigFile - YAML-файл, который читается, если он есть и не задан CONFIG_FILE
+const defaultConfigFile = "config.yaml"
+
+// redacted заменяет секреты при выводе конфигурации
+const redacted = "***"
+
+// Config - настройки сервиса. Значения берутся по возрастанию приоритета: значения по умолчанию,
+// YAML-файл, файл .env, переменные окружения.
+type Config struct {
+	Server   ServerConfig   `yaml:"server"`
+	Database DatabaseConfig `yaml:"database"`
+	Auth     AuthConfig     `yaml:"auth"`
+	Jobs     JobsConfig     `yaml:"jobs"`
+	SMTP     SMTPConfig     `yaml:"smtp"`
+	Metrics  MetricsConfig  `yaml:"metrics"`
+	Log      LogConfig      `yaml:"log"`
+	Tracing  TracingConfig  `yaml:"tracing"`
+}
+
+// ServerConfig - настройки HTTP-сервера
+type ServerConfig struct {
+	Port            int           `yaml:"port"`
+	CookieDomain    string        `yaml:"cookie_domain"`    // Домен cookie с токеном
+	CookieSecure    bool          `yaml:"cookie_secure"`    // Передавать cookie только по HTTPS
+	ReadTimeout     time.Duration `yaml:"read_timeout"`     // Наибольшее время чтения запроса вместе с телом
+	WriteTimeout    time.Duration `yaml:"write_timeout"`    // Наибольшее время формирования и отправки ответа
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`     // Сколько держать открытым простаивающее соединение
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"` // Сколько ждать завершения запросов и задач при остановке
+}
+
+// DatabaseConfig - параметры подключения к PostgreSQL
+type DatabaseConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+	SSLMode  string `yaml:"sslmode"`
+	// Подключение при запуске повторяется ConnectAttempts раз с задержкой от ConnectBackoff,
+	// удваивающейся до ConnectMaxBackoff
+	ConnectAttempts   int           `yaml:"connect_attempts"`
+	ConnectBackoff    time.Duration `yaml:"connect_backoff"`
+	ConnectMaxBackoff time.Duration `yaml:"connect_max_backoff"`
+}
+
+// AuthConfig - настройки аутентификации
+type AuthConfig struct {
+	JWTSecret      string   `yaml:"jwt_secret"`
+	AdminUsernames []string `yaml:"admin_usernames"` // Пользователи, назначаемые администраторами при запуске
+}
+
+// JobsConfig - настройки очереди задач
+type JobsConfig struct {
+	Workers int `yaml:"workers"` // Число обработчиков вместе с сервером; 0 - только командой worker
+}
+
+// SMTPConfig - SMTP-сервер для отправки писем. Без Host письма не отправляются.
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"` // Адрес отправителя, по умолчанию Username
+}
+
+// MetricsConfig - выдача метрик Prometheus. С Port метрики отдаются отдельным сервером на адресе Host,
+// по умолчанию доступном только с этой машины; без Port - основным сервером по /metrics, и только
+// если задан Token. Без Port и Token метрики не отдаются.
+type MetricsConfig struct {
+	Host  string `yaml:"host"` // Адрес отдельного сервера метрик; 0.0.0.0 открывает его для всех сетей
+	Port  int    `yaml:"port"`
+	Token string `yaml:"token"` // Токен, который нужно передать в Authorization: Bearer
+}
+
+// LogConfig - настройки журнала
+type LogConfig struct {
+	Level  string `yaml:"level"`  // debug, info, warn или error
+	Format string `yaml:"format"` // json или text
+}
+
+// SlogLevel возвращает уровень журнала для log/slog
+func (l LogConfig) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(l.Level))
+	return level, err
+}
+
+// TracingConfig - трассировка OpenTelemetry. Без Endpoint трассировка выключена.
+type TracingConfig struct {
+	Endpoint    string `yaml:"endpoint"`     // Адрес коллектора OTLP/HTTP, например http://localhost:4318
+	ServiceName string `yaml:"service_name"` // Имя сервиса в спанах
+}
+
+// Default возвращает настройки по умолчанию
+func Default() Config {
+	return Config{
+		Server: ServerConfig{Port: 8080, CookieDomain: "localhost", ReadTimeout: 30 * time.Second,
+			WriteTimeout: 2 * time.Minute, IdleTimeout: 2 * time.Minute, ShutdownTimeout: 30 * time.Second},
+		Database: DatabaseConfig{Host: "localhost", Port: 5432, SSLMode: "disable", ConnectAttempts: 10,
+			ConnectBackoff: time.Second, ConnectMaxBackoff: 30 * time.Second},
+		Jobs:    JobsConfig{Workers: 4},
+		SMTP:    SMTPConfig{Port: 587},
+		Metrics: MetricsConfig{Host: "127.0.0.1"},
+		Log:     LogConfig{Level: "info", Format: "json"},
+		Tracing: TracingConfig{ServiceName: "notes-api"},
+	}
+}
+
+// Load читает настройки из YAML-файла (CONFIG_FILE или config.yaml), файла .env и переменных окружения.
+// Отсутствие .env и config.yaml не считается ошибкой: в контейнере настройки обычно задаются окружением.
+func Load() (Config, error) {
+	cfg := Default()
+	// godotenv не перезаписывает уже заданные переменные, поэтому окружение важнее .env
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return cfg, fmt.Errorf("ошибка загрузки .env файла: %w", err)
+	}
+	path, required := os.LookupEnv("CONFIG_FILE")
+	if !required {
+		path = defaultConfigFile
+	}
+	if err := cfg.loadFile(path, required); err != nil {
+		return cfg, err
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) loadFile(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка чтения файла конфигурации: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && err != io.EOF {
+		return fmt.Errorf("ошибка в файле конфигурации %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv переносит в настройки заданные переменные окружения
+func (cfg *Config) loadEnv() error {
+	vars := []struct {
+		name  string
+		value interface{}
+	}{
+		{"PORT", &cfg.Server.Port},
+		{"COOKIE_DOMAIN", &cfg.Server.CookieDomain},
+		{"COOKIE_SECURE", &cfg.Server.CookieSecure},
+		{"HTTP_READ_TIMEOUT", &cfg.Server.ReadTimeout},
+		{"HTTP_WRITE_TIMEOUT", &cfg.Server.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", &cfg.Server.IdleTimeout},
+		{"SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout},
+		{"DB_HOST", &cfg.Database.Host},
+		{"DB_PORT", &cfg.Database.Port},
+		{"DB_USER", &cfg.Database.User},
+		{"DB_PASSWORD", &cfg.Database.Password},
+		{"DB_NAME", &cfg.Database.Name},
+		{"DB_SSLMODE", &cfg.Database.SSLMode},
+		{"DB_CONNECT_ATTEMPTS", &cfg.Database.ConnectAttempts},
+		{"DB_CONNECT_BACKOFF", &cfg.Database.ConnectBackoff},
+		{"DB_CONNECT_MAX_BACKOFF", &cfg.Database.ConnectMaxBackoff},
+		{"JWT_SECRET", &cfg.Auth.JWTSecret},
+		{"ADMIN_USERNAMES", &cfg.Auth.AdminUsernames},
+		{"JOB_WORKERS", &cfg.Jobs.Workers},
+		{"SMTP_HOST", &cfg.SMTP.Host},
+		{"SMTP_PORT", &cfg.SMTP.Port},
+		{"SMTP_USERNAME", &cfg.SMTP.Username},
+		{"SMTP_PASSWORD", &cfg.SMTP.Password},
+		{"SMTP_FROM", &cfg.SMTP.From},
+		{"METRICS_HOST", &cfg.Metrics.Host},
+		{"METRICS_PORT", &cfg.Metrics.Port},
+		{"METRICS_TOKEN", &cfg.Metrics.Token},
+		{"LOG_LEVEL", &cfg.Log.Level},
+		{"LOG_FORMAT", &cfg.Log.Format},
+		{"OTEL_EXPORTER_OTLP_ENDPOINT", &cfg.Tracing.Endpoint},
+		{"OTEL_SERVICE_NAME", &cfg.Tracing.ServiceName},
+	}
+	var errs []error
+	for _, v := range vars {
+		value, ok := os.LookupEnv(v.name)
+		if !ok {
+			continue
+		}
+		if err := setValue(v.value, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", v.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setValue разбирает значение переменной окружения в поле настроек
+func setValue(target interface{}, value string) error {
+	switch target := target.(type) {
+	case *string:
+		*target = value
+	case *int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return errors.New("ожидается целое число")
+		}
+		*target = n
+	case *time.Duration:
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return errors.New("ожидается длительность, например 30s или 2m")
+		}
+		*target = d
+	case *bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return errors.New("ожидается true или false")
+		}
+		*target = b
+	case *[]string:
+		// Список задается через запятую
+		*target = nil
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*target = append(*target, item)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate проверяет настройки и возвращает все найденные ошибки
+func (cfg Config) Validate() error {
+	var errs []error
+	check := func(ok bool, message string) {
+		if !ok {
+			errs = append(errs, errors.New(message))
+		}
+	}
+	check(cfg.Auth.JWTSecret != "", "не задан JWT_SECRET")
+	check(validPort(cfg.Server.Port), "PORT должен быть от 1 до 65535")
+	check(cfg.Server.ReadTimeout > 0 && cfg.Server.WriteTimeout > 0 && cfg.Server.IdleTimeout > 0,
+		"HTTP_READ_TIMEOUT, HTTP_WRITE_TIMEOUT и HTTP_IDLE_TIMEOUT должны быть больше нуля")
+	check(cfg.Server.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT должен быть больше нуля")
+	check(cfg.Database.Host != "", "не задан DB_HOST")
+	check(validPort(cfg.Database.Port), "DB_PORT должен быть от 1 до 65535")
+	check(cfg.Database.User != "", "не задан DB_USER")
+	check(cfg.Database.Name != "", "не задан DB_NAME")
+	switch cfg.Database.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		errs = append(errs, fmt.Errorf("недопустимый DB_SSLMODE %q", cfg.Database.SSLMode))
+	}
+	check(cfg.Database.ConnectAttempts > 0, "DB_CONNECT_ATTEMPTS должен быть больше нуля")
+	check(cfg.Database.ConnectBackoff > 0 && cfg.Database.ConnectMaxBackoff >= cfg.Database.ConnectBackoff,
+		"DB_CONNECT_BACKOFF должен быть больше нуля и не больше DB_CONNECT_MAX_BACKOFF")
+	check(cfg.Jobs.Workers >= 0, "JOB_WORKERS не может быть отрицательным")
+	check(cfg.SMTP.Host == "" || validPort(cfg.SMTP.Port), "SMTP_PORT должен быть от 1 до 65535")
+	check(cfg.Metrics.Port == 0 || (validPort(cfg.Metrics.Port) && cfg.Metrics.Port != cfg.Server.Port),
+		"METRICS_PORT должен быть от 1 до 65535 и отличаться от PORT")
+	check(cfg.Metrics.Port == 0 || cfg.Metrics.Host != "", "не задан METRICS_HOST")
+	if _, err := cfg.Log.SlogLevel(); err != nil {
+		errs = append(errs, fmt.Errorf("недопустимый LOG_LEVEL %q", cfg.Log.Level))
+	}
+	check(cfg.Log.Format == "json" || cfg.Log.Format == "text", "LOG_FORMAT должен быть json или text")
+	if cfg.Tracing.Endpoint != "" {
+		u, err := url.Parse(cfg.Tracing.Endpoint)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"OTEL_EXPORTER_OTLP_ENDPOINT должен быть адресом вида http://host:port")
+	}
+	check(cfg.Tracing.ServiceName != "", "не задан OTEL_SERVICE_NAME")
+	return errors.Join(errs...)
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+// Redacted возвращает копию настроек, в которой заданные секреты заменены на ***
+func (cfg Config) Redacted() Config {
+	for _, secret := range []*string{&cfg.Database.Password, &cfg.Auth.JWTSecret, &cfg.SMTP.Password, &cfg.Metrics.Token} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+	return cfg
+}
+
+// Print выводит настройки в формате YAML со скрытыми секретами
+func (cfg Config) Print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(cfg.Redacted()); err != nil {
+		return err
 	}
+	return encoder.Close()
 }
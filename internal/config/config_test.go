@@ -0,0 +1,172 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// envNames - переменные окружения, которые читает Load
+var envNames = []string{"CONFIG_FILE", "PORT", "COOKIE_DOMAIN", "COOKIE_SECURE", "HTTP_READ_TIMEOUT", "HTTP_WRITE_TIMEOUT",
+	"HTTP_IDLE_TIMEOUT", "SHUTDOWN_TIMEOUT", "DB_HOST", "DB_PORT", "DB_USER", "DB_PASSWORD", "DB_NAME", "DB_SSLMODE",
+	"DB_CONNECT_ATTEMPTS", "DB_CONNECT_BACKOFF", "DB_CONNECT_MAX_BACKOFF", "JWT_SECRET", "ADMIN_USERNAMES", "JOB_WORKERS",
+	"SMTP_HOST", "SMTP_PORT", "SMTP_USERNAME", "SMTP_PASSWORD", "SMTP_FROM", "METRICS_HOST", "METRICS_PORT", "METRICS_TOKEN",
+	"LOG_LEVEL", "LOG_FORMAT", "OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_SERVICE_NAME"}
+
+// clearEnv убирает переменные настроек на время теста. Load переносит в окружение значения из .env,
+// поэтому они тоже восстанавливаются после теста.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range envNames {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string // Файлы в рабочей папке
+		env     map[string]string
+		want    func(cfg *Config) // Изменения относительно Default
+		wantErr []string          // Фрагменты текста ошибки
+	}{
+		{name: "по умолчанию", want: func(cfg *Config) {}},
+		{
+			name: "YAML-файл",
+			files: map[string]string{"config.yaml": "server:\n  port: 9000\n  read_timeout: 10s\n" +
+				"database:\n  user: notes\nauth:\n  admin_usernames: [alice, bob]\njobs:\n  workers: 0\n"},
+			want: func(cfg *Config) {
+				cfg.Server.Port, cfg.Server.ReadTimeout = 9000, 10*time.Second
+				cfg.Database.User, cfg.Auth.AdminUsernames, cfg.Jobs.Workers = "notes", []string{"alice", "bob"}, 0
+			},
+		},
+		{name: "пустой YAML-файл", files: map[string]string{"config.yaml": ""}, want: func(cfg *Config) {}},
+		{
+			name: "приоритет окружения",
+			files: map[string]string{
+				"config.yaml": "server:\n  port: 9000\ndatabase:\n  user: yaml\n  name: yaml\n",
+				".env":        "PORT=7000\nDB_USER=dotenv\n",
+			},
+			env: map[string]string{"PORT": "7100"},
+			want: func(cfg *Config) {
+				cfg.Server.Port, cfg.Database.User, cfg.Database.Name = 7100, "dotenv", "yaml"
+			},
+		},
+		{
+			name: "типы переменных",
+			env: map[string]string{"COOKIE_SECURE": "true", "HTTP_WRITE_TIMEOUT": " 5m ", "DB_PORT": "6432",
+				"ADMIN_USERNAMES": " alice, ,bob ", "OTEL_SERVICE_NAME": "notes"},
+			want: func(cfg *Config) {
+				cfg.Server.CookieSecure, cfg.Server.WriteTimeout, cfg.Database.Port = true, 5*time.Minute, 6432
+				cfg.Auth.AdminUsernames, cfg.Tracing.ServiceName = []string{"alice", "bob"}, "notes"
+			},
+		},
+		{
+			name:  "CONFIG_FILE",
+			files: map[string]string{"config.yaml": "server:\n  port: 9000\n", "prod.yaml": "server:\n  port: 9100\n"},
+			env:   map[string]string{"CONFIG_FILE": "prod.yaml"},
+			want:  func(cfg *Config) { cfg.Server.Port = 9100 },
+		},
+		{name: "CONFIG_FILE не найден", env: map[string]string{"CONFIG_FILE": "missing.yaml"},
+			wantErr: []string{"ошибка чтения файла конфигурации"}},
+		{name: "неизвестный ключ", files: map[string]string{"config.yaml": "server:\n  prot: 9000\n"},
+			wantErr: []string{"config.yaml", "prot"}},
+		{name: "некорректные переменные", env: map[string]string{"PORT": "abc", "HTTP_READ_TIMEOUT": "10", "COOKIE_SECURE": "да"},
+			wantErr: []string{"PORT: ожидается целое число", "HTTP_READ_TIMEOUT: ожидается длительность", "COOKIE_SECURE"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			t.Chdir(dir)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			cfg, err := Load()
+			if len(tt.wantErr) > 0 {
+				if err == nil {
+					t.Fatalf("Load() error = nil, want %q", tt.wantErr)
+				}
+				for _, fragment := range tt.wantErr {
+					if !strings.Contains(err.Error(), fragment) {
+						t.Errorf("Load() error = %q, want it to contain %q", err, fragment)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			want := Default()
+			tt.want(&want)
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("Load() = %+v, want %+v", cfg, want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(cfg *Config)
+		wantErr []string // Фрагменты текста ошибки; пусто - настройки верны
+	}{
+		{name: "верные настройки", change: func(cfg *Config) {}},
+		{name: "метрики и трассировка", change: func(cfg *Config) {
+			cfg.Metrics.Port, cfg.Tracing.Endpoint, cfg.SMTP.Host = 9090, "https://otel.example.com:4318", "smtp.example.com"
+		}},
+		{name: "нет JWT_SECRET", change: func(cfg *Config) { cfg.Auth.JWTSecret = "" }, wantErr: []string{"JWT_SECRET"}},
+		{name: "порт вне диапазона", change: func(cfg *Config) { cfg.Server.Port = 70000 }, wantErr: []string{"PORT должен"}},
+		{name: "нулевой таймаут", change: func(cfg *Config) { cfg.Server.IdleTimeout = 0 }, wantErr: []string{"HTTP_IDLE_TIMEOUT"}},
+		{name: "DB_SSLMODE", change: func(cfg *Config) { cfg.Database.SSLMode = "on" }, wantErr: []string{`DB_SSLMODE "on"`}},
+		{name: "задержка подключения больше наибольшей", change: func(cfg *Config) {
+			cfg.Database.ConnectBackoff, cfg.Database.ConnectMaxBackoff = time.Minute, time.Second
+		}, wantErr: []string{"DB_CONNECT_BACKOFF"}},
+		{name: "отрицательное число обработчиков", change: func(cfg *Config) { cfg.Jobs.Workers = -1 }, wantErr: []string{"JOB_WORKERS"}},
+		{name: "SMTP без порта", change: func(cfg *Config) { cfg.SMTP.Host, cfg.SMTP.Port = "smtp.example.com", 0 },
+			wantErr: []string{"SMTP_PORT"}},
+		{name: "порт метрик совпадает с PORT", change: func(cfg *Config) { cfg.Metrics.Port = cfg.Server.Port },
+			wantErr: []string{"METRICS_PORT"}},
+		{name: "пустой адрес метрик", change: func(cfg *Config) { cfg.Metrics.Host, cfg.Metrics.Port = "", 9090 },
+			wantErr: []string{"METRICS_HOST"}},
+		{name: "уровень журнала", change: func(cfg *Config) { cfg.Log.Level = "verbose" }, wantErr: []string{`LOG_LEVEL "verbose"`}},
+		{name: "формат журнала", change: func(cfg *Config) { cfg.Log.Format = "xml" }, wantErr: []string{"LOG_FORMAT"}},
+		{name: "адрес коллектора без схемы", change: func(cfg *Config) { cfg.Tracing.Endpoint = "localhost:4318" },
+			wantErr: []string{"OTEL_EXPORTER_OTLP_ENDPOINT"}},
+		{name: "все ошибки сразу", change: func(cfg *Config) {
+			cfg.Auth.JWTSecret, cfg.Database.User, cfg.Database.Name, cfg.Tracing.ServiceName = "", "", "", ""
+		}, wantErr: []string{"JWT_SECRET", "DB_USER", "DB_NAME", "OTEL_SERVICE_NAME"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Auth.JWTSecret, cfg.Database.User, cfg.Database.Name = "secret", "notes", "notes"
+			tt.change(&cfg)
+			err := cfg.Validate()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() error = nil, want %q", tt.wantErr)
+			}
+			for _, fragment := range tt.wantErr {
+				if !strings.Contains(err.Error(), fragment) {
+					t.Errorf("Validate() error = %q, want it to contain %q", err, fragment)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+package database
+
+// Ключи рекомендательных блокировок PostgreSQL. Все блокировки приложения объявлены здесь, чтобы ключ
+// новой блокировки не совпал с уже занятым. Значения менять нельзя: при обновлении экземпляры старой
+// и новой версии должны брать одну и ту же блокировку.
+const (
+	// MigrationsLock - ключ блокировки, под которой применяются миграции: экземпляры сервиса,
+	// запущенные одновременно, применяют их по очереди
+	MigrationsLock int64 = 47
+	// DailyNoteLock - первый ключ блокировки, под которой создается ежедневная заметка;
+	// второй ключ - ID пользователя
+	DailyNoteLock int32 = 39
+)
@@ -1,45 +1,94 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
-	"log"
-	"os"
+	"github.com/XSAM/otelsql"
+	"github.com/lib/pq" // Драйвер PostgreSQL
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"notes-api/internal/config"
+	"notes-api/internal/tracing"
+	"strings"
 	"time"
-
-	_ "github.com/lib/pq" // Драйвер PostgreSQL
 )
 
-func InitDB() *sql.DB {
-	//Используем переменные окружения для подключения к БД
-	dbURL := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"))
-	var db *sql.DB
-	var err error
-	// Попытка подключиться к базе данных с задержкой
-	for retries := 0; retries < 5; retries++ {
-		db, err = sql.Open("postgres", dbURL)
-		if err != nil {
-			log.Printf("Ошибка при подключении к базе данных: %v", err)
-			time.Sleep(2 * time.Second) // Задержка перед следующей попыткой
-			continue
+// InitDB подключается к базе данных. Если база недоступна, например еще запускается рядом в контейнере,
+// подключение повторяется с удваивающейся задержкой; отмена ctx прекращает попытки.
+func InitDB(ctx context.Context, cfg config.DatabaseConfig) (*sql.DB, error) {
+	dbURL := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		dsnValue(cfg.Host), cfg.Port, dsnValue(cfg.User), dsnValue(cfg.Password), dsnValue(cfg.Name), cfg.SSLMode)
+	connector, err := pq.NewConnector(dbURL)
+	if err != nil {
+		return nil, err
+	}
+	db := otelsql.OpenDB(connector, tracingOptions()...)
+	delay := cfg.ConnectBackoff
+	attempt := 1
+	for ; ; attempt++ {
+		if err = db.PingContext(ctx); err == nil {
+			slog.InfoContext(ctx, "Успешно подключено к базе данных", "attempts", attempt)
+			return db, nil
+		}
+		if attempt >= cfg.ConnectAttempts || ctx.Err() != nil {
+			break
+		}
+		slog.WarnContext(ctx, "Ошибка при проверке соединения с базой данных",
+			"attempt", attempt, "attempts", cfg.ConnectAttempts, "retry_in", delay.String(), "error", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
 		}
-		if err = db.Ping(); err == nil {
-			log.Println("Успешно подключено к базе данных")
-			return db
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			break
 		}
-		log.Printf("Ошибка при проверке соединения с базой данных: %v", err)
-		time.Sleep(2 * time.Second) // Задержка перед следующей попыткой
+		delay = min(delay*2, cfg.ConnectMaxBackoff)
 	}
-	log.Fatalf("Не удалось подключиться к базе данных после нескольких попыток: %v", err)
-	return nil
+	db.Close()
+	return nil, fmt.Errorf("не удалось подключиться к базе данных после %d попыток: %w", attempt, err)
+}
+
+// tracingOptions задают спаны запросов к базе данных. Спан создается только для запроса с родительским спаном,
+// то есть выполняемого при обработке HTTP-запроса или задачи, и хранит текст запроса без литералов.
+func tracingOptions() []otelsql.Option {
+	return []otelsql.Option{
+		otelsql.WithAttributes(attribute.String("db.system", "postgresql")),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableQuery:         true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+			SpanFilter: func(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+				return trace.SpanContextFromContext(ctx).IsValid()
+			},
+		}),
+		otelsql.WithSpanNameFormatter(func(_ context.Context, method otelsql.Method, query string) string {
+			// Спан называется операцией запроса: SELECT, UPDATE, ... Запрос может начинаться с перевода строки
+			// или табуляции, поэтому первое слово выделяется по любым пробельным символам
+			if words := strings.Fields(query); len(words) > 0 {
+				return strings.ToUpper(words[0])
+			}
+			return string(method)
+		}),
+		otelsql.WithAttributesGetter(func(_ context.Context, _ otelsql.Method, query string, _ []driver.NamedValue) []attribute.KeyValue {
+			if query == "" {
+				return nil
+			}
+			return []attribute.KeyValue{attribute.String("db.statement", tracing.SanitizeQuery(query))}
+		}),
+	}
+}
+
+// dsnValue экранирует значение строки подключения, чтобы пароль с пробелами или кавычками не ломал ее
+func dsnValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
 }
 
-func InitSchema(db *sql.DB) {
+func InitSchema(db *sql.DB) error {
 	// Проверка и создание таблицы пользователей
 	createUsersTable := `
     CREATE TABLE IF NOT EXISTS users (
@@ -58,12 +107,15 @@ func InitSchema(db *sql.DB) {
         created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
         updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
     );`
-	// Создание функции триггера для обновления поля updated_at
+	// Создание функции триггера для обновления поля updated_at.
+	// Явно заданное время изменения сохраняется: так импорт переносит даты из других сервисов.
 	createUpdateTimestampFunction := `
     CREATE OR REPLACE FUNCTION update_timestamp()
     RETURNS TRIGGER AS $$
     BEGIN
-        NEW.updated_at = CURRENT_TIMESTAMP;
+        IF NEW.updated_at IS NOT DISTINCT FROM OLD.updated_at THEN
+            NEW.updated_at = CURRENT_TIMESTAMP;
+        END IF;
         RETURN NEW;
     END;
     $$ LANGUAGE plpgsql;`
@@ -96,22 +148,531 @@ func InitSchema(db *sql.DB) {
         user_id INT REFERENCES users(id) ON DELETE CASCADE,
         PRIMARY KEY (note_id, user_id)
     );`
-	// Выполнение SQL-запросов для создания таблиц и триггеров
-	tables := []string{
-		createUsersTable,
-		createNotesTable,
-		createTagsTable,
-		createNoteTagsTable,
-		createNoteAccessTable,
-		createUpdateTimestampFunction,
-		dropUpdateTimestampTrigger,
-		createUpdateTimestampTrigger,
+	// Поля для удаления аккаунта с отложенным сроком
+	alterUsersDeletion := `
+    ALTER TABLE users
+        ADD COLUMN IF NOT EXISTS deletion_scheduled_at TIMESTAMP,
+        ADD COLUMN IF NOT EXISTS deletion_shared_policy VARCHAR(20);`
+	// Проверка и создание таблицы выгрузок данных пользователей
+	createUserExportsTable := `
+    CREATE TABLE IF NOT EXISTS user_exports (
+        id SERIAL PRIMARY KEY,
+        user_id INT REFERENCES users(id) ON DELETE CASCADE,
+        status VARCHAR(20) NOT NULL DEFAULT 'pending',
+        error TEXT NOT NULL DEFAULT '',
+        archive BYTEA,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        completed_at TIMESTAMP,
+        expires_at TIMESTAMP NOT NULL
+    );`
+	// Роль пользователя, блокировка и принудительный выход из всех сессий
+	alterUsersAdmin := `
+    ALTER TABLE users
+        ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user',
+        ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMP,
+        ADD COLUMN IF NOT EXISTS tokens_valid_after TIMESTAMP;`
+	// Проверка и создание журнала экстренного доступа администраторов к заметкам
+	createBreakGlassLogTable := `
+    CREATE TABLE IF NOT EXISTS break_glass_log (
+        id SERIAL PRIMARY KEY,
+        admin_id INT REFERENCES users(id) ON DELETE SET NULL,
+        note_id INT NOT NULL,
+        owner_id INT NOT NULL,
+        reason TEXT NOT NULL,
+        ip VARCHAR(64) NOT NULL DEFAULT '',
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );`
+	// Проверка и создание таблицы команд
+	createTeamsTable := `
+    CREATE TABLE IF NOT EXISTS teams (
+        id SERIAL PRIMARY KEY,
+        name VARCHAR(100) NOT NULL,
+        created_by INT REFERENCES users(id) ON DELETE SET NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );`
+	// Проверка и создание таблицы участников команд
+	createTeamMembersTable := `
+    CREATE TABLE IF NOT EXISTS team_members (
+        team_id INT REFERENCES teams(id) ON DELETE CASCADE,
+        user_id INT REFERENCES users(id) ON DELETE CASCADE,
+        role VARCHAR(20) NOT NULL DEFAULT 'member',
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (team_id, user_id)
+    );`
+	// Проверка и создание таблицы блокнотов
+	createNotebooksTable := `
+    CREATE TABLE IF NOT EXISTS notebooks (
+        id SERIAL PRIMARY KEY,
+        name VARCHAR(255) NOT NULL,
+        user_id INT REFERENCES users(id) ON DELETE CASCADE,
+        team_id INT REFERENCES teams(id) ON DELETE CASCADE,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );`
+	// Заметки могут принадлежать команде и находиться в блокноте
+	alterNotesTeams := `
+    ALTER TABLE notes
+        ADD COLUMN IF NOT EXISTS team_id INT REFERENCES teams(id) ON DELETE CASCADE,
+        ADD COLUMN IF NOT EXISTS notebook_id INT REFERENCES notebooks(id) ON DELETE SET NULL;`
+	// Уровень доступа пользователя к чужой заметке
+	alterNoteAccessPermission := `
+    ALTER TABLE note_access
+        ADD COLUMN IF NOT EXISTS permission VARCHAR(20) NOT NULL DEFAULT 'viewer';`
+	// Проверка и создание таблицы доступа команд к заметкам
+	createTeamNoteAccessTable := `
+    CREATE TABLE IF NOT EXISTS team_note_access (
+        note_id INT REFERENCES notes(id) ON DELETE CASCADE,
+        team_id INT REFERENCES teams(id) ON DELETE CASCADE,
+        permission VARCHAR(20) NOT NULL DEFAULT 'viewer',
+        PRIMARY KEY (note_id, team_id)
+    );`
+	// Теги команды живут в собственном пространстве имен
+	alterTagsTeams := `
+    ALTER TABLE tags
+        ADD COLUMN IF NOT EXISTS team_id INT REFERENCES teams(id) ON DELETE CASCADE;
+    ALTER TABLE tags DROP CONSTRAINT IF EXISTS tags_name_key;
+    CREATE UNIQUE INDEX IF NOT EXISTS tags_namespace_name_idx ON tags ((COALESCE(team_id, 0)), name);`
+	// Email пользователя для приглашений
+	alterUsersEmail := `
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS email VARCHAR(255);
+    CREATE UNIQUE INDEX IF NOT EXISTS users_email_idx ON users (LOWER(email));`
+	// Проверка и создание таблицы приглашений к заметкам
+	createNoteInvitationsTable := `
+    CREATE TABLE IF NOT EXISTS note_invitations (
+        id SERIAL PRIMARY KEY,
+        note_id INT REFERENCES notes(id) ON DELETE CASCADE,
+        inviter_id INT REFERENCES users(id) ON DELETE CASCADE,
+        invitee_id INT REFERENCES users(id) ON DELETE CASCADE,
+        email VARCHAR(255),
+        permission VARCHAR(20) NOT NULL DEFAULT 'viewer',
+        status VARCHAR(20) NOT NULL DEFAULT 'pending',
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        responded_at TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS note_invitations_invitee_idx ON note_invitations (invitee_id, status);
+    CREATE INDEX IF NOT EXISTS note_invitations_email_idx ON note_invitations (LOWER(email)) WHERE invitee_id IS NULL;`
+	// Проверка и создание таблицы передачи права владения заметками
+	createNoteTransfersTable := `
+    CREATE TABLE IF NOT EXISTS note_transfers (
+        id SERIAL PRIMARY KEY,
+        note_id INT REFERENCES notes(id) ON DELETE CASCADE,
+        from_user_id INT REFERENCES users(id) ON DELETE CASCADE,
+        to_user_id INT REFERENCES users(id) ON DELETE CASCADE,
+        status VARCHAR(20) NOT NULL DEFAULT 'pending',
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        responded_at TIMESTAMP
+    );
+    CREATE UNIQUE INDEX IF NOT EXISTS note_transfers_pending_idx ON note_transfers (note_id) WHERE status = 'pending';`
+	// Проверка и создание таблицы комментариев к заметкам
+	createCommentsTable := `
+    CREATE TABLE IF NOT EXISTS comments (
+        id SERIAL PRIMARY KEY,
+        note_id INT REFERENCES notes(id) ON DELETE CASCADE,
+        user_id INT REFERENCES users(id) ON DELETE CASCADE,
+        parent_id INT REFERENCES comments(id) ON DELETE CASCADE,
+        content TEXT NOT NULL,
+        anchor_start INT,
+        anchor_end INT,
+        anchor_text TEXT NOT NULL DEFAULT '',
+        resolved_at TIMESTAMP,
+        resolved_by INT REFERENCES users(id) ON DELETE SET NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS comments_note_idx ON comments (note_id);`
+	// Проверка и создание таблицы уведомлений
+	createNotificationsTable := `
+    CREATE TABLE IF NOT EXISTS notifications (
+        id SERIAL PRIMARY KEY,
+        user_id INT REFERENCES users(id) ON DELETE CASCADE,
+        type VARCHAR(50) NOT NULL,
+        actor_id INT REFERENCES users(id) ON DELETE SET NULL,
+        note_id INT REFERENCES notes(id) ON DELETE CASCADE,
+        comment_id INT REFERENCES comments(id) ON DELETE CASCADE,
+        message TEXT NOT NULL,
+        read_at TIMESTAMP,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS notifications_user_idx ON notifications (user_id, created_at DESC);`
+	// Проверка и создание таблицы настроек уведомлений
+	createNotificationPreferencesTable := `
+    CREATE TABLE IF NOT EXISTS notification_preferences (
+        user_id INT REFERENCES users(id) ON DELETE CASCADE,
+        type VARCHAR(50) NOT NULL,
+        enabled BOOLEAN NOT NULL,
+        PRIMARY KEY (user_id, type)
+    );`
+	// Проверка и создание таблицы подписок на изменения заметок
+	createNoteFollowsTable := `
+    CREATE TABLE IF NOT EXISTS note_follows (
+        note_id INT REFERENCES notes(id) ON DELETE CASCADE,
+        user_id INT REFERENCES users(id) ON DELETE CASCADE,
+        PRIMARY KEY (note_id, user_id)
+    );`
+	// Вебхуки принадлежат либо пользователю, либо команде
+	createWebhooksTable := `
+    CREATE TABLE IF NOT EXISTS webhooks (
+        id SERIAL PRIMARY KEY,
+        user_id INT REFERENCES users(id) ON DELETE CASCADE,
+        team_id INT REFERENCES teams(id) ON DELETE CASCADE,
+        url TEXT NOT NULL,
+        secret VARCHAR(64) NOT NULL,
+        events TEXT[] NOT NULL,
+        active BOOLEAN NOT NULL DEFAULT TRUE,
+        created_by INT REFERENCES users(id) ON DELETE SET NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        CHECK ((user_id IS NULL) <> (team_id IS NULL))
+    );`
+	// Очередь и журнал доставки вебхуков
+	createWebhookDeliveriesTable := `
+    CREATE TABLE IF NOT EXISTS webhook_deliveries (
+        id SERIAL PRIMARY KEY,
+        webhook_id INT REFERENCES webhooks(id) ON DELETE CASCADE,
+        event VARCHAR(50) NOT NULL,
+        payload JSONB NOT NULL,
+        status VARCHAR(20) NOT NULL DEFAULT 'pending',
+        attempts INT NOT NULL DEFAULT 0,
+        next_attempt_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        status_code INT,
+        error TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        delivered_at TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_pending ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+    CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries (webhook_id, created_at DESC);`
+	// Журнал аудита. Внешних ключей нет, чтобы записи переживали удаление пользователей и объектов.
+	createAuditLogTable := `
+    CREATE TABLE IF NOT EXISTS audit_log (
+        id BIGSERIAL PRIMARY KEY,
+        actor_id INT,
+        actor_name VARCHAR(255) NOT NULL DEFAULT '',
+        action VARCHAR(50) NOT NULL,
+        target_type VARCHAR(20) NOT NULL,
+        target_id INT,
+        ip VARCHAR(45) NOT NULL DEFAULT '',
+        user_agent TEXT NOT NULL DEFAULT '',
+        details JSONB,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log (actor_id, created_at DESC);
+    CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log (target_type, target_id, created_at DESC);
+    CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log (action, created_at DESC);`
+	// Журнал аудита доступен только для добавления записей
+	createAuditLogGuard := `
+    CREATE OR REPLACE FUNCTION audit_log_append_only()
+    RETURNS TRIGGER AS $$
+    BEGIN
+        RAISE EXCEPTION 'audit_log доступен только для добавления записей';
+    END;
+    $$ LANGUAGE plpgsql;
+    DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+    CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();`
+	// Формат содержимого заметки: plain или markdown
+	alterNotesContentFormat := `
+    ALTER TABLE notes
+        ADD COLUMN IF NOT EXISTS content_format VARCHAR(10) NOT NULL DEFAULT 'plain';`
+	// Пункты списков задач в заметках
+	createChecklistItemsTable := `
+    CREATE TABLE IF NOT EXISTS checklist_items (
+        id SERIAL PRIMARY KEY,
+        note_id INT REFERENCES notes(id) ON DELETE CASCADE,
+        text TEXT NOT NULL,
+        checked BOOLEAN NOT NULL DEFAULT FALSE,
+        position INT NOT NULL DEFAULT 0,
+        due_date DATE,
+        assignee_id INT REFERENCES users(id) ON DELETE SET NULL,
+        created_by INT REFERENCES users(id) ON DELETE SET NULL,
+        checked_at TIMESTAMP,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_checklist_items_note ON checklist_items (note_id, position);
+    CREATE INDEX IF NOT EXISTS idx_checklist_items_open ON checklist_items (assignee_id, due_date) WHERE NOT checked;`
+	// Срок заметки
+	alterNotesDue := `
+    ALTER TABLE notes ADD COLUMN IF NOT EXISTS due_at TIMESTAMPTZ;
+    CREATE INDEX IF NOT EXISTS idx_notes_due ON notes (due_at) WHERE due_at IS NOT NULL;`
+	// Напоминания о заметках и пунктах списков задач. next_at пуст у сработавшего напоминания без повторения;
+	// планировщик выбирает наступившие напоминания через FOR UPDATE SKIP LOCKED
+	createRemindersTable := `
+    CREATE TABLE IF NOT EXISTS reminders (
+        id SERIAL PRIMARY KEY,
+        user_id INT REFERENCES users(id) ON DELETE CASCADE,
+        note_id INT REFERENCES notes(id) ON DELETE CASCADE,
+        checklist_item_id INT REFERENCES checklist_items(id) ON DELETE CASCADE,
+        message TEXT NOT NULL DEFAULT '',
+        remind_at TIMESTAMPTZ NOT NULL,
+        rrule TEXT NOT NULL DEFAULT '',
+        channels TEXT[] NOT NULL,
+        next_at TIMESTAMPTZ,
+        last_fired_at TIMESTAMPTZ,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_reminders_next ON reminders (next_at) WHERE next_at IS NOT NULL;
+    CREATE INDEX IF NOT EXISTS idx_reminders_user ON reminders (user_id, next_at);`
+	// Вики-ссылки между заметками; target_id пуст у битой ссылки
+	createNoteLinksTable := `
+    CREATE TABLE IF NOT EXISTS note_links (
+        source_id INT REFERENCES notes(id) ON DELETE CASCADE,
+        target_id INT REFERENCES notes(id) ON DELETE SET NULL,
+        link_text TEXT NOT NULL,
+        position INT NOT NULL DEFAULT 0,
+        PRIMARY KEY (source_id, link_text)
+    );
+    CREATE INDEX IF NOT EXISTS idx_note_links_target ON note_links (target_id);
+    CREATE INDEX IF NOT EXISTS idx_note_links_broken ON note_links (LOWER(link_text)) WHERE target_id IS NULL;`
+	// Шаблоны заметок: личные (user_id) или команды (team_id)
+	createNoteTemplatesTable := `
+    CREATE TABLE IF NOT EXISTS note_templates (
+        id SERIAL PRIMARY KEY,
+        name VARCHAR(255) NOT NULL,
+        user_id INT REFERENCES users(id) ON DELETE CASCADE,
+        team_id INT REFERENCES teams(id) ON DELETE CASCADE,
+        title TEXT NOT NULL DEFAULT '',
+        content TEXT NOT NULL DEFAULT '',
+        content_format VARCHAR(16) NOT NULL DEFAULT 'plain',
+        tags TEXT[] NOT NULL DEFAULT '{}',
+        notebook_id INT REFERENCES notebooks(id) ON DELETE SET NULL,
+        created_by INT REFERENCES users(id) ON DELETE SET NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        CHECK ((user_id IS NULL) <> (team_id IS NULL))
+    );`
+	// Дата ежедневной заметки; у пользователя одна ежедневная заметка на дату
+	alterNotesDaily := `
+    ALTER TABLE notes ADD COLUMN IF NOT EXISTS daily_date DATE;
+    CREATE UNIQUE INDEX IF NOT EXISTS notes_daily_idx ON notes (user_id, daily_date) WHERE daily_date IS NOT NULL;`
+	// Закрепление и архивация заметок
+	alterNotesState := `
+    ALTER TABLE notes ADD COLUMN IF NOT EXISTS pinned BOOLEAN NOT NULL DEFAULT FALSE;
+    ALTER TABLE notes ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT FALSE;`
+	// Избранные заметки пользователей, в том числе чужие доступные
+	createNoteStarsTable := `
+    CREATE TABLE IF NOT EXISTS note_stars (
+        user_id INT REFERENCES users(id) ON DELETE CASCADE,
+        note_id INT REFERENCES notes(id) ON DELETE CASCADE,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (user_id, note_id)
+    );`
+	// Фоновые групповые операции над заметками
+	createBatchJobsTable := `
+    CREATE TABLE IF NOT EXISTS batch_jobs (
+        id SERIAL PRIMARY KEY,
+        user_id INT REFERENCES users(id) ON DELETE CASCADE,
+        status VARCHAR(16) NOT NULL,
+        request JSONB NOT NULL,
+        result JSONB,
+        error TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        completed_at TIMESTAMP
+    );`
+	// Вложения заметок
+	createNoteAttachmentsTable := `
+    CREATE TABLE IF NOT EXISTS note_attachments (
+        id SERIAL PRIMARY KEY,
+        note_id INT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+        filename VARCHAR(255) NOT NULL,
+        mime_type VARCHAR(255) NOT NULL,
+        size INT NOT NULL,
+        data BYTEA NOT NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_note_attachments_note ON note_attachments (note_id);`
+	// Фоновый импорт заметок из Evernote и Google Keep
+	createImportJobsTable := `
+    CREATE TABLE IF NOT EXISTS import_jobs (
+        id SERIAL PRIMARY KEY,
+        user_id INT REFERENCES users(id) ON DELETE CASCADE,
+        source VARCHAR(16) NOT NULL,
+        status VARCHAR(16) NOT NULL,
+        options JSONB NOT NULL,
+        data BYTEA,
+        total INT NOT NULL DEFAULT 0,
+        processed INT NOT NULL DEFAULT 0,
+        report JSONB,
+        error TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        completed_at TIMESTAMP
+    );`
+	// Очередь фоновых задач. Рабочие процессы забирают задачи через FOR UPDATE SKIP LOCKED;
+	// выполняемая задача продлевает locked_until, а задачу с истекшей блокировкой может забрать другой процесс.
+	// У периодической задачи unique_key не дает поставить в очередь вторую копию.
+	createJobsTable := `
+    CREATE TABLE IF NOT EXISTS jobs (
+        id SERIAL PRIMARY KEY,
+        kind VARCHAR(32) NOT NULL,
+        user_id INT REFERENCES users(id) ON DELETE CASCADE,
+        payload JSONB NOT NULL DEFAULT '{}',
+        status VARCHAR(16) NOT NULL DEFAULT 'pending',
+        attempts INT NOT NULL DEFAULT 0,
+        max_attempts INT NOT NULL DEFAULT 1,
+        run_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        locked_until TIMESTAMP,
+        unique_key VARCHAR(64),
+        last_error TEXT NOT NULL DEFAULT '',
+        result JSONB,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        started_at TIMESTAMP,
+        completed_at TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_jobs_pending ON jobs (run_at) WHERE status = 'pending';
+    CREATE INDEX IF NOT EXISTS idx_jobs_running ON jobs (locked_until) WHERE status = 'running';
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_unique ON jobs (unique_key) WHERE unique_key IS NOT NULL;`
+	// Доступ к заметкам команды выдается только командам: личные доступы и приглашения к ним больше не действуют
+	deleteTeamNoteShares := `
+    DELETE FROM note_access WHERE note_id IN (SELECT id FROM notes WHERE team_id IS NOT NULL);
+    DELETE FROM note_invitations WHERE status = 'pending' AND note_id IN (SELECT id FROM notes WHERE team_id IS NOT NULL);`
+	// Подтверждение email: приглашения по email переходят к пользователю только после подтверждения адреса.
+	// Хранится хеш кода, а не сам код.
+	createEmailVerificationsTable := `
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP;
+    CREATE TABLE IF NOT EXISTS email_verifications (
+        token_hash CHAR(64) PRIMARY KEY,
+        user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        email VARCHAR(255) NOT NULL,
+        expires_at TIMESTAMP NOT NULL
+    );`
+	// Прежняя таблица версии схемы: ее заменил журнал примененных миграций schema_migrations
+	dropSchemaVersionTable := `DROP TABLE IF EXISTS schema_version;`
+	// Номер поколения токенов пользователя: принудительный выход увеличивает его, и токены с прежним
+	// номером отклоняются. Пользователи, чьи токены уже отзывались, начинают с 1, чтобы токены без номера
+	// тоже стали недействительными.
+	alterUsersTokenVersion := `
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS token_version INT NOT NULL DEFAULT 0;
+    UPDATE users SET token_version = 1 WHERE token_version = 0 AND tokens_valid_after IS NOT NULL;`
+	// Метка рабочего процесса, закрепившего задачу: продлить и завершить задачу может только он
+	alterJobsLockedBy := `ALTER TABLE jobs ADD COLUMN IF NOT EXISTS locked_by VARCHAR(32);`
+	// Миграции применяются по возрастанию номера. Номер примененной миграции и ее SQL не меняются:
+	// новое изменение схемы добавляется в конец списка миграцией со следующим номером
+	migrations := []migration{
+		{1, "create_users_table", createUsersTable},
+		{2, "create_notes_table", createNotesTable},
+		{3, "create_tags_table", createTagsTable},
+		{4, "create_note_tags_table", createNoteTagsTable},
+		{5, "create_note_access_table", createNoteAccessTable},
+		{6, "alter_users_deletion", alterUsersDeletion},
+		{7, "create_user_exports_table", createUserExportsTable},
+		{8, "alter_users_admin", alterUsersAdmin},
+		{9, "create_break_glass_log_table", createBreakGlassLogTable},
+		{10, "create_teams_table", createTeamsTable},
+		{11, "create_team_members_table", createTeamMembersTable},
+		{12, "create_notebooks_table", createNotebooksTable},
+		{13, "alter_notes_teams", alterNotesTeams},
+		{14, "alter_note_access_permission", alterNoteAccessPermission},
+		{15, "create_team_note_access_table", createTeamNoteAccessTable},
+		{16, "alter_tags_teams", alterTagsTeams},
+		{17, "alter_users_email", alterUsersEmail},
+		{18, "create_note_invitations_table", createNoteInvitationsTable},
+		{19, "create_note_transfers_table", createNoteTransfersTable},
+		{20, "create_comments_table", createCommentsTable},
+		{21, "create_notifications_table", createNotificationsTable},
+		{22, "create_notification_preferences_table", createNotificationPreferencesTable},
+		{23, "create_note_follows_table", createNoteFollowsTable},
+		{24, "create_webhooks_table", createWebhooksTable},
+		{25, "create_webhook_deliveries_table", createWebhookDeliveriesTable},
+		{26, "create_audit_log_table", createAuditLogTable},
+		{27, "create_audit_log_guard", createAuditLogGuard},
+		{28, "alter_notes_content_format", alterNotesContentFormat},
+		{29, "create_checklist_items_table", createChecklistItemsTable},
+		{30, "alter_notes_due", alterNotesDue},
+		{31, "create_reminders_table", createRemindersTable},
+		{32, "create_note_links_table", createNoteLinksTable},
+		{33, "create_note_templates_table", createNoteTemplatesTable},
+		{34, "alter_notes_daily", alterNotesDaily},
+		{35, "alter_notes_state", alterNotesState},
+		{36, "create_note_stars_table", createNoteStarsTable},
+		{37, "create_batch_jobs_table", createBatchJobsTable},
+		{38, "create_note_attachments_table", createNoteAttachmentsTable},
+		{39, "create_import_jobs_table", createImportJobsTable},
+		{40, "create_jobs_table", createJobsTable},
+		{41, "create_update_timestamp_function", createUpdateTimestampFunction},
+		{42, "create_update_timestamp_trigger", dropUpdateTimestampTrigger + createUpdateTimestampTrigger},
+		{43, "delete_team_note_shares", deleteTeamNoteShares},
+		{44, "create_email_verifications_table", createEmailVerificationsTable},
+		{45, "drop_schema_version", dropSchemaVersionTable},
+		{46, "alter_users_token_version", alterUsersTokenVersion},
+		{47, "alter_jobs_locked_by", alterJobsLockedBy},
+	}
+	version, err := applyMigrations(db, migrations)
+	if err != nil {
+		return err
+	}
+	schemaVersion = version
+	slog.Info("Схема базы данных обновлена", "schema_version", schemaVersion)
+	return nil
+}
+
+// migration - пронумерованное изменение схемы базы данных
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// applyMigrations применяет миграции, которых нет в журнале schema_migrations, каждую в своей транзакции,
+// и возвращает номер последней миграции. Миграции написаны так, чтобы их повторное применение ничего
+// не меняло: база, созданная до появления журнала, проходит их все один раз.
+func applyMigrations(db *sql.DB, migrations []migration) (int, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+        version INT PRIMARY KEY,
+        name VARCHAR(100) NOT NULL,
+        applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );`)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при создании журнала миграций: %w", err)
 	}
-	for _, table := range tables {
-		_, err := db.Exec(table)
-		if err != nil {
-			log.Fatalf("Ошибка при создании таблицы или триггера: %v", err)
+	latest := 0
+	for _, m := range migrations {
+		if m.version <= latest {
+			return 0, fmt.Errorf("миграция %d (%s) нарушает порядок номеров", m.version, m.name)
 		}
+		latest = m.version
+		if err := applyMigration(db, m); err != nil {
+			return 0, fmt.Errorf("ошибка при применении миграции %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return latest, nil
+}
+
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, MigrationsLock); err != nil {
+		return err
+	}
+	var applied bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, m.version).Scan(&applied); err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+	if _, err := tx.Exec(m.sql); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.version, m.name); err != nil {
+		return err
+	}
+	slog.Info("Применена миграция схемы", "version", m.version, "name", m.name)
+	return tx.Commit()
+}
+
+// schemaVersion - номер последней миграции, известной этому процессу
+var schemaVersion int
+
+var ErrSchemaOutdated = errors.New("схема базы данных не обновлена")
+
+// CheckSchema проверяет, что все миграции, известные этому процессу, применены
+func CheckSchema(ctx context.Context, db *sql.DB) error {
+	var applied bool
+	err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, schemaVersion).
+		Scan(&applied)
+	if err == nil && (schemaVersion == 0 || !applied) {
+		return ErrSchemaOutdated
 	}
-	log.Println("Таблицы и триггеры успешно созданы или уже существуют")
+	return err
 }
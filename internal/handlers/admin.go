@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"notes-api/internal/models"
+	"notes-api/internal/services"
+	"strconv"
+)
+
+// AdminListUsers @Summary Список пользователей
+// @Description Возвращает пользователей с количеством заметок и объемом хранилища. Поддерживает поиск по имени.
+// @Tags admin
+// @Produce json
+// @Param q query string false "Поиск по имени пользователя"
+// @Param page query int false "Номер страницы"
+// @Param limit query int false "Количество пользователей на странице"
+// @Success 200 {array} models.AdminUser "Список пользователей"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 403 {object} models.ErrorResponse "Требуются права администратора"
+// @Router /admin/users [get]
+// @Security Bearer
+func AdminListUsers(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, limit := getPagination(c)
+		adminService := services.AdminService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		users, err := adminService.ListUsers(c.Query("q"), page, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении пользователей"})
+			return
+		}
+		c.JSON(http.StatusOK, users)
+	}
+}
+
+// AdminGetUserUsage @Summary Использование сервиса пользователем
+// @Description Возвращает количество заметок, тегов, доступов и объем хранилища пользователя
+// @Tags admin
+// @Produce json
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} models.UserUsage "Статистика использования"
+// @Failure 400 {object} models.ErrorResponse "id пользователя должен быть формата int"
+// @Failure 403 {object} models.ErrorResponse "Требуются права администратора"
+// @Failure 404 {object} models.ErrorResponse "Пользователь не найден"
+// @Router /admin/users/{id}/usage [get]
+// @Security Bearer
+func AdminGetUserUsage(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := adminTargetUserID(c)
+		if !ok {
+			return
+		}
+		adminService := services.AdminService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		usage, err := adminService.GetUsage(userID)
+		if err != nil {
+			respondAdminError(c, err, "Ошибка при получении статистики")
+			return
+		}
+		c.JSON(http.StatusOK, usage)
+	}
+}
+
+// AdminDisableUser @Summary Блокировка пользователя
+// @Description Блокирует пользователя и завершает все его сессии
+// @Tags admin
+// @Produce json
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} models.SuccessResponse "Пользователь заблокирован"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 403 {object} models.ErrorResponse "Требуются права администратора"
+// @Failure 404 {object} models.ErrorResponse "Пользователь не найден"
+// @Router /admin/users/{id}/disable [post]
+// @Security Bearer
+func AdminDisableUser(db *sql.DB) gin.HandlerFunc {
+	return adminSetDisabled(db, true, "Пользователь заблокирован")
+}
+
+// AdminEnableUser @Summary Разблокировка пользователя
+// @Description Снимает блокировку с пользователя
+// @Tags admin
+// @Produce json
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} models.SuccessResponse "Пользователь разблокирован"
+// @Failure 400 {object} models.ErrorResponse "id пользователя должен быть формата int"
+// @Failure 403 {object} models.ErrorResponse "Требуются права администратора"
+// @Failure 404 {object} models.ErrorResponse "Пользователь не найден"
+// @Router /admin/users/{id}/enable [post]
+// @Security Bearer
+func AdminEnableUser(db *sql.DB) gin.HandlerFunc {
+	return adminSetDisabled(db, false, "Пользователь разблокирован")
+}
+
+func adminSetDisabled(db *sql.DB, disabled bool, message string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := adminTargetUserID(c)
+		if !ok {
+			return
+		}
+		adminID, _ := getUserIDFromToken(c)
+		adminService := services.AdminService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := adminService.SetDisabled(adminID, userID, disabled); err != nil {
+			respondAdminError(c, err, "Ошибка при изменении блокировки пользователя")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": message})
+	}
+}
+
+// AdminLogoutUser @Summary Принудительный выход пользователя
+// @Description Делает недействительными все выданные пользователю токены
+// @Tags admin
+// @Produce json
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} models.SuccessResponse "Сессии пользователя завершены"
+// @Failure 400 {object} models.ErrorResponse "id пользователя должен быть формата int"
+// @Failure 403 {object} models.ErrorResponse "Требуются права администратора"
+// @Failure 404 {object} models.ErrorResponse "Пользователь не найден"
+// @Router /admin/users/{id}/logout [post]
+// @Security Bearer
+func AdminLogoutUser(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := adminTargetUserID(c)
+		if !ok {
+			return
+		}
+		adminID, _ := getUserIDFromToken(c)
+		adminService := services.AdminService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := adminService.ForceLogout(adminID, userID); err != nil {
+			respondAdminError(c, err, "Ошибка при завершении сессий пользователя")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Сессии пользователя завершены"})
+	}
+}
+
+// AdminResetPassword @Summary Сброс пароля пользователя
+// @Description Устанавливает пользователю новый пароль и завершает все его сессии
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "ID пользователя"
+// @Param input body models.SetPasswordRequest true "Новый пароль"
+// @Success 200 {object} models.SuccessResponse "Пароль изменен"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 403 {object} models.ErrorResponse "Требуются права администратора"
+// @Failure 404 {object} models.ErrorResponse "Пользователь не найден"
+// @Router /admin/users/{id}/password [post]
+// @Security Bearer
+func AdminResetPassword(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := adminTargetUserID(c)
+		if !ok {
+			return
+		}
+		var request models.SetPasswordRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		adminID, _ := getUserIDFromToken(c)
+		adminService := services.AdminService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := adminService.ResetPassword(adminID, userID, request.Password); err != nil {
+			respondAdminError(c, err, "Ошибка при смене пароля")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Пароль изменен"})
+	}
+}
+
+// AdminSetRole @Summary Смена роли пользователя
+// @Description Назначает пользователю роль user или admin
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "ID пользователя"
+// @Param input body models.SetRoleRequest true "Новая роль"
+// @Success 200 {object} models.SuccessResponse "Роль изменена"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 403 {object} models.ErrorResponse "Требуются права администратора"
+// @Failure 404 {object} models.ErrorResponse "Пользователь не найден"
+// @Router /admin/users/{id}/role [put]
+// @Security Bearer
+func AdminSetRole(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := adminTargetUserID(c)
+		if !ok {
+			return
+		}
+		var request models.SetRoleRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		adminID, _ := getUserIDFromToken(c)
+		adminService := services.AdminService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := adminService.SetRole(adminID, userID, request.Role); err != nil {
+			respondAdminError(c, err, "Ошибка при смене роли")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Роль изменена"})
+	}
+}
+
+// AdminBreakGlassNote @Summary Экстренный доступ к заметке
+// @Description Возвращает любую заметку администратору. Каждое обращение с указанной причиной записывается в журнал.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Param input body models.BreakGlassRequest true "Причина доступа"
+// @Success 200 {object} models.Note "Заметка"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 403 {object} models.ErrorResponse "Требуются права администратора"
+// @Failure 404 {object} models.ErrorResponse "Заметка не найдена"
+// @Router /admin/notes/{id}/break-glass [post]
+// @Security Bearer
+func AdminBreakGlassNote(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		var request models.BreakGlassRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		adminID, _ := getUserIDFromToken(c)
+		adminService := services.AdminService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		note, err := adminService.BreakGlassNote(adminID, noteID, request.Reason, c.ClientIP())
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Заметка не найдена"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении заметки"})
+			return
+		}
+		c.JSON(http.StatusOK, note)
+	}
+}
+
+// AdminGetBreakGlassLog @Summary Журнал экстренного доступа
+// @Description Возвращает журнал обращений администраторов к чужим заметкам
+// @Tags admin
+// @Produce json
+// @Param page query int false "Номер страницы"
+// @Param limit query int false "Количество записей на странице"
+// @Success 200 {array} models.BreakGlassRecord "Журнал доступа"
+// @Failure 403 {object} models.ErrorResponse "Требуются права администратора"
+// @Router /admin/break-glass [get]
+// @Security Bearer
+func AdminGetBreakGlassLog(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, limit := getPagination(c)
+		adminService := services.AdminService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		records, err := adminService.GetBreakGlassLog(page, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении журнала"})
+			return
+		}
+		c.JSON(http.StatusOK, records)
+	}
+}
+
+// adminTargetUserID извлекает ID пользователя из пути, при ошибке отвечает клиенту
+func adminTargetUserID(c *gin.Context) (int, bool) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id пользователя должен быть формата int"})
+		return 0, false
+	}
+	return userID, true
+}
+
+func respondAdminError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidRole), errors.Is(err, services.ErrSelfDemotion):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"mime"
+	"net/http"
+	"notes-api/internal/services"
+	"strconv"
+)
+
+// GetNoteAttachments @Summary Вложения заметки
+// @Description Возвращает список файлов, прикрепленных к заметке, со ссылками на скачивание
+// @Tags attachments
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Success 200 {array} models.Attachment "Вложения"
+// @Failure 400 {object} models.ErrorResponse "id заметки должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Заметка не найдена"
+// @Router /notes/{id}/attachments [get]
+// @Security Bearer
+func GetNoteAttachments(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		attachmentService := services.AttachmentService{DB: db, Ctx: c.Request.Context()}
+		attachments, err := attachmentService.GetAttachments(noteID, userID)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при получении вложений")
+			return
+		}
+		c.JSON(http.StatusOK, attachments)
+	}
+}
+
+// DownloadAttachment @Summary Скачивание вложения
+// @Description Возвращает содержимое вложения. Изображения PNG, JPEG, GIF и WebP отдаются для показа в браузере,
+// @Description остальные файлы - для сохранения.
+// @Tags attachments
+// @Produce octet-stream
+// @Param id path int true "ID вложения"
+// @Success 200 {file} file "Содержимое вложения"
+// @Failure 400 {object} models.ErrorResponse "id вложения должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Вложение не найдено"
+// @Router /attachments/{id} [get]
+// @Security Bearer
+func DownloadAttachment(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		attachmentID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id вложения должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		attachmentService := services.AttachmentService{DB: db, Ctx: c.Request.Context()}
+		attachment, data, err := attachmentService.GetAttachment(attachmentID, userID)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при получении вложения")
+			return
+		}
+		disposition := "attachment"
+		if services.IsInlineImage(attachment.MimeType) {
+			disposition = "inline"
+		}
+		c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}))
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Data(http.StatusOK, attachment.MimeType, data)
+	}
+}
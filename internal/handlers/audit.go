@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"notes-api/internal/models"
+	"notes-api/internal/services"
+	"strconv"
+	"time"
+)
+
+// GetProfileActivity @Summary История безопасности
+// @Description Возвращает события безопасности текущего пользователя: регистрацию, входы и неудачные попытки входа,
+// @Description запросы удаления аккаунта и выгрузки данных, а также действия администраторов над аккаунтом
+// @Tags users
+// @Produce json
+// @Param page query int false "Номер страницы"
+// @Param limit query int false "Количество записей на странице"
+// @Success 200 {array} models.AuditEntry "События"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 500 {object} models.ErrorResponse "Ошибка при получении истории"
+// @Router /profile/activity [get]
+// @Security Bearer
+func GetProfileActivity(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		page, limit := getPagination(c)
+		auditService := services.AuditService{DB: db, Ctx: c.Request.Context()}
+		entries, err := auditService.GetUserActivity(userID, page, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении истории"})
+			return
+		}
+		c.JSON(http.StatusOK, entries)
+	}
+}
+
+// AdminGetAuditLog @Summary Журнал аудита
+// @Description Возвращает записи журнала аудита, новые первыми, с фильтрами по автору, действию, объекту и времени
+// @Tags admin
+// @Produce json
+// @Param actor_id query int false "ID автора действия"
+// @Param action query string false "Действие, например note.deleted или user.login_failed"
+// @Param target_type query string false "Тип объекта: user, note, team, invitation, transfer, webhook"
+// @Param target_id query int false "ID объекта"
+// @Param from query string false "Начало периода (RFC 3339 или YYYY-MM-DD)"
+// @Param to query string false "Конец периода, не включительно (RFC 3339 или YYYY-MM-DD)"
+// @Param page query int false "Номер страницы"
+// @Param limit query int false "Количество записей на странице"
+// @Success 200 {array} models.AuditEntry "Записи журнала"
+// @Failure 400 {object} models.ErrorResponse "Некорректный фильтр"
+// @Failure 403 {object} models.ErrorResponse "Требуются права администратора"
+// @Router /admin/audit [get]
+// @Security Bearer
+func AdminGetAuditLog(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, err := parseAuditFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		page, limit := getPagination(c)
+		auditService := services.AuditService{DB: db, Ctx: c.Request.Context()}
+		entries, err := auditService.Query(filter, page, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении журнала"})
+			return
+		}
+		c.JSON(http.StatusOK, entries)
+	}
+}
+
+// AdminExportAuditLog @Summary Выгрузка журнала аудита
+// @Description Выгружает записи журнала аудита в CSV с теми же фильтрами, что и /admin/audit
+// @Tags admin
+// @Produce text/csv
+// @Param actor_id query int false "ID автора действия"
+// @Param action query string false "Действие"
+// @Param target_type query string false "Тип объекта"
+// @Param target_id query int false "ID объекта"
+// @Param from query string false "Начало периода (RFC 3339 или YYYY-MM-DD)"
+// @Param to query string false "Конец периода, не включительно (RFC 3339 или YYYY-MM-DD)"
+// @Success 200 {file} file "CSV-файл"
+// @Failure 400 {object} models.ErrorResponse "Некорректный фильтр"
+// @Failure 403 {object} models.ErrorResponse "Требуются права администратора"
+// @Router /admin/audit/export [get]
+// @Security Bearer
+func AdminExportAuditLog(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, err := parseAuditFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="audit-log.csv"`)
+		auditService := services.AuditService{DB: db, Ctx: c.Request.Context()}
+		if err := auditService.ExportCSV(filter, c.Writer); err != nil {
+			// Заголовки могли быть уже отправлены, поэтому ошибка только записывается в лог
+			c.Error(err)
+		}
+	}
+}
+
+// parseAuditFilter читает фильтр журнала аудита из параметров запроса
+func parseAuditFilter(c *gin.Context) (models.AuditFilter, error) {
+	filter := models.AuditFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+	}
+	var err error
+	if filter.ActorID, err = queryID(c, "actor_id"); err != nil {
+		return filter, err
+	}
+	if filter.TargetID, err = queryID(c, "target_id"); err != nil {
+		return filter, err
+	}
+	if filter.From, err = queryTime(c, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = queryTime(c, "to"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+func queryID(c *gin.Context, name string) (*int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, errors.New(name + " должен быть формата int")
+	}
+	return &id, nil
+}
+
+func queryTime(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, errors.New(name + " должен быть в формате RFC 3339 или YYYY-MM-DD")
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"net/http"
+	"notes-api/internal/config"
+	"notes-api/internal/logging"
+	"notes-api/internal/services"
+)
+
+var errInvalidToken = errors.New("неверный токен")
+
+// userIDKey - ключ контекста gin, под которым CheckSession сохраняет ID пользователя из проверенного токена
+const userIDKey = "user_id"
+
+// Session - настройки токена сессии: ключ подписи и cookie, в которой токен передается клиенту
+type Session struct {
+	Secret       []byte
+	CookieDomain string
+	CookieSecure bool
+}
+
+// NewSession собирает настройки сессии из конфигурации
+func NewSession(cfg config.Config) Session {
+	return Session{Secret: []byte(cfg.Auth.JWTSecret), CookieDomain: cfg.Server.CookieDomain, CookieSecure: cfg.Server.CookieSecure}
+}
+
+// setCookie записывает токен в cookie; maxAge меньше нуля удаляет cookie
+func (s Session) setCookie(c *gin.Context, token string, maxAge int) {
+	c.SetCookie("tokenJWT", token, maxAge, "/", s.CookieDomain, s.CookieSecure, true)
+}
+
+// parseTokenClaims проверяет JWT из cookie и возвращает его claims
+func (s Session) parseTokenClaims(c *gin.Context) (jwt.MapClaims, error) {
+	tokenString, err := c.Cookie("tokenJWT")
+	if err != nil {
+		return nil, err
+	}
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, http.ErrNotSupported
+		}
+		return s.Secret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errInvalidToken
+	}
+	if _, ok := claims["sub"].(float64); !ok {
+		return nil, errInvalidToken
+	}
+	return claims, nil
+}
+
+// CheckSession отклоняет запросы с токенами заблокированных пользователей
+// и токенами, отозванными принудительным выходом. Запросы без токена пропускаются дальше,
+// их обрабатывают сами обработчики. ID пользователя из действующего токена возвращает getUserIDFromToken.
+func CheckSession(db *sql.DB, session Session) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := session.parseTokenClaims(c)
+		if err != nil {
+			c.Next()
+			return
+		}
+		userID := int(claims["sub"].(float64))
+		// Записи журнала и спан этого запроса получают ID пользователя
+		c.Request = c.Request.WithContext(logging.With(c.Request.Context(), slog.Int("user_id", userID)))
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.Int("enduser.id", userID))
+		// Токены, выданные до появления номера поколения, относятся к поколению 0
+		tokenVersion, _ := claims["ver"].(float64)
+		userService := services.UserService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := userService.ValidateSession(userID, int(tokenVersion)); err != nil {
+			if errors.Is(err, services.ErrUserDisabled) || errors.Is(err, services.ErrSessionRevoked) {
+				session.setCookie(c, "", -1)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			slog.ErrorContext(c.Request.Context(), "Ошибка при проверке сессии", "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при проверке сессии"})
+			return
+		}
+		c.Set(userIDKey, userID)
+		c.Next()
+	}
+}
+
+// RequireAdmin пропускает к обработчику только администраторов
+func RequireAdmin(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		adminService := services.AdminService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		isAdmin, err := adminService.IsAdmin(userID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при проверке прав доступа"})
+			return
+		}
+		if !isAdmin {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Требуются права администратора"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"notes-api/internal/models"
+	"notes-api/internal/services"
+	"strconv"
+)
+
+// GetChecklist @Summary Список задач заметки
+// @Description Возвращает пункты списка задач заметки по порядку
+// @Tags checklist
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Success 200 {array} models.ChecklistItem "Пункты списка задач"
+// @Failure 400 {object} models.ErrorResponse "id заметки должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Заметка не найдена"
+// @Router /notes/{id}/checklist [get]
+// @Security Bearer
+func GetChecklist(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		checklistService := services.ChecklistService{DB: db, Ctx: c.Request.Context()}
+		items, err := checklistService.GetItems(noteID, userID)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при получении списка задач")
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	}
+}
+
+// CreateChecklistItem @Summary Добавление пункта списка задач
+// @Description Добавляет пункт в список задач заметки. Исполнитель должен иметь доступ к заметке.
+// @Description Требуется доступ к заметке не ниже editor.
+// @Tags checklist
+// @Accept json
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Param item body models.CreateChecklistItemRequest true "Пункт"
+// @Success 201 {object} models.ChecklistItem "Созданный пункт"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Заметка не найдена"
+// @Router /notes/{id}/checklist [post]
+// @Security Bearer
+func CreateChecklistItem(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		var request models.CreateChecklistItemRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		checklistService := services.ChecklistService{DB: db, Ctx: c.Request.Context()}
+		item, err := checklistService.CreateItem(noteID, userID, request)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при добавлении пункта")
+			return
+		}
+		c.JSON(http.StatusCreated, item)
+	}
+}
+
+// ReorderChecklist @Summary Изменение порядка пунктов
+// @Description Задает новый порядок пунктов списка задач; item_ids должен содержать все пункты заметки
+// @Tags checklist
+// @Accept json
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Param order body models.ReorderChecklistRequest true "ID пунктов в новом порядке"
+// @Success 200 {array} models.ChecklistItem "Пункты в новом порядке"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Заметка не найдена"
+// @Router /notes/{id}/checklist/order [put]
+// @Security Bearer
+func ReorderChecklist(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		var request models.ReorderChecklistRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		checklistService := services.ChecklistService{DB: db, Ctx: c.Request.Context()}
+		items, err := checklistService.Reorder(noteID, userID, request.ItemIDs)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при изменении порядка пунктов")
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	}
+}
+
+// UpdateChecklistItem @Summary Изменение пункта списка задач
+// @Description Меняет текст, отметку выполнения, срок или исполнителя пункта. Пустой due_date снимает срок,
+// @Description assignee_id = 0 снимает исполнителя. Требуется доступ к заметке не ниже editor.
+// @Tags checklist
+// @Accept json
+// @Produce json
+// @Param id path int true "ID пункта"
+// @Param item body models.UpdateChecklistItemRequest true "Изменяемые поля"
+// @Success 200 {object} models.ChecklistItem "Обновленный пункт"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Пункт не найден"
+// @Router /checklist/{id} [patch]
+// @Security Bearer
+func UpdateChecklistItem(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		itemID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id пункта должен быть формата int"})
+			return
+		}
+		var request models.UpdateChecklistItemRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		checklistService := services.ChecklistService{DB: db, Ctx: c.Request.Context()}
+		item, err := checklistService.UpdateItem(itemID, userID, request)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при изменении пункта")
+			return
+		}
+		c.JSON(http.StatusOK, item)
+	}
+}
+
+// DeleteChecklistItem @Summary Удаление пункта списка задач
+// @Description Удаляет пункт из списка задач. Требуется доступ к заметке не ниже editor.
+// @Tags checklist
+// @Produce json
+// @Param id path int true "ID пункта"
+// @Success 200 {object} models.SuccessResponse "Пункт удален"
+// @Failure 400 {object} models.ErrorResponse "id пункта должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Пункт не найден"
+// @Router /checklist/{id} [delete]
+// @Security Bearer
+func DeleteChecklistItem(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		itemID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id пункта должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		checklistService := services.ChecklistService{DB: db, Ctx: c.Request.Context()}
+		if err := checklistService.DeleteItem(itemID, userID); err != nil {
+			respondNoteError(c, err, "Ошибка при удалении пункта")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Пункт удален"})
+	}
+}
+
+// GetTasks @Summary Открытые задачи
+// @Description Возвращает невыполненные пункты списков задач во всех доступных заметках: сначала с ближайшим сроком.
+// @Description assignee принимает me, none или ID пользователя.
+// @Tags checklist
+// @Produce json
+// @Param assignee query string false "Исполнитель: me, none или ID пользователя"
+// @Param due_before query string false "Срок не позже даты (YYYY-MM-DD)"
+// @Param due_after query string false "Срок не раньше даты (YYYY-MM-DD)"
+// @Param page query int false "Номер страницы"
+// @Param limit query int false "Количество задач на странице"
+// @Success 200 {array} models.ChecklistItem "Открытые задачи"
+// @Failure 400 {object} models.ErrorResponse "Некорректный фильтр"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Router /tasks [get]
+// @Security Bearer
+func GetTasks(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		var filter models.TaskFilter
+		switch assignee := c.Query("assignee"); assignee {
+		case "":
+		case "me":
+			filter.AssigneeID = &userID
+		case "none":
+			filter.Unassigned = true
+		default:
+			id, err := strconv.Atoi(assignee)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "assignee должен быть me, none или ID пользователя"})
+				return
+			}
+			filter.AssigneeID = &id
+		}
+		if filter.DueBefore, err = queryTime(c, "due_before"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if filter.DueAfter, err = queryTime(c, "due_after"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		page, limit := getPagination(c)
+		checklistService := services.ChecklistService{DB: db, Ctx: c.Request.Context()}
+		tasks, err := checklistService.GetTasks(userID, filter, page, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении задач"})
+			return
+		}
+		c.JSON(http.StatusOK, tasks)
+	}
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"notes-api/internal/models"
+	"notes-api/internal/services"
+	"strconv"
+)
+
+// GetComments @Summary Комментарии к заметке
+// @Description Возвращает обсуждения заметки: корневые комментарии с ответами
+// @Tags comments
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Success 200 {array} models.Comment "Список обсуждений"
+// @Failure 400 {object} models.ErrorResponse "id заметки должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Заметка не найдена"
+// @Router /notes/{id}/comments [get]
+// @Security Bearer
+func GetComments(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		commentService := services.CommentService{DB: db, Ctx: c.Request.Context()}
+		comments, err := commentService.GetComments(noteID, userID)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при получении комментариев")
+			return
+		}
+		c.JSON(http.StatusOK, comments)
+	}
+}
+
+// CreateComment @Summary Добавление комментария
+// @Description Добавляет комментарий к заметке или ответ в обсуждении (parent_id). Корневой комментарий можно
+// @Description привязать к фрагменту текста заметки смещениями anchor_start и anchor_end в символах.
+// @Description Требуется доступ к заметке не ниже commenter.
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Param comment body models.CreateCommentRequest true "Комментарий"
+// @Success 201 {object} models.Comment "Созданный комментарий"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Заметка не найдена"
+// @Router /notes/{id}/comments [post]
+// @Security Bearer
+func CreateComment(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		var request models.CreateCommentRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		commentService := services.CommentService{DB: db, Ctx: c.Request.Context()}
+		comment, err := commentService.CreateComment(noteID, userID, request)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при добавлении комментария")
+			return
+		}
+		c.JSON(http.StatusCreated, comment)
+	}
+}
+
+// UpdateComment @Summary Редактирование комментария
+// @Description Меняет текст комментария. Доступно только автору.
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Param id path int true "ID комментария"
+// @Param comment body models.UpdateCommentRequest true "Новый текст"
+// @Success 200 {object} models.Comment "Обновленный комментарий"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Комментарий не найден"
+// @Router /comments/{id} [put]
+// @Security Bearer
+func UpdateComment(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		commentID, userID, ok := commentRequest(c)
+		if !ok {
+			return
+		}
+		var request models.UpdateCommentRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		commentService := services.CommentService{DB: db, Ctx: c.Request.Context()}
+		comment, err := commentService.UpdateComment(commentID, userID, request.Content)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при редактировании комментария")
+			return
+		}
+		c.JSON(http.StatusOK, comment)
+	}
+}
+
+// DeleteComment @Summary Удаление комментария
+// @Description Удаляет комментарий вместе с ответами на него. Доступно только автору.
+// @Tags comments
+// @Produce json
+// @Param id path int true "ID комментария"
+// @Success 200 {object} models.SuccessResponse "Комментарий удален"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Комментарий не найден"
+// @Router /comments/{id} [delete]
+// @Security Bearer
+func DeleteComment(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		commentID, userID, ok := commentRequest(c)
+		if !ok {
+			return
+		}
+		commentService := services.CommentService{DB: db, Ctx: c.Request.Context()}
+		if err := commentService.DeleteComment(commentID, userID); err != nil {
+			respondNoteError(c, err, "Ошибка при удалении комментария")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Комментарий удален"})
+	}
+}
+
+// ResolveComment @Summary Закрытие обсуждения
+// @Description Отмечает обсуждение как решенное. Доступно автору и редакторам заметки.
+// @Tags comments
+// @Produce json
+// @Param id path int true "ID корневого комментария"
+// @Success 200 {object} models.Comment "Комментарий"
+// @Failure 400 {object} models.ErrorResponse "Ответы нельзя закрыть отдельно"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Комментарий не найден"
+// @Router /comments/{id}/resolve [post]
+// @Security Bearer
+func ResolveComment(db *sql.DB) gin.HandlerFunc {
+	return setCommentResolved(db, true)
+}
+
+// ReopenComment @Summary Переоткрытие обсуждения
+// @Description Снимает с обсуждения отметку о решении. Доступно автору и редакторам заметки.
+// @Tags comments
+// @Produce json
+// @Param id path int true "ID корневого комментария"
+// @Success 200 {object} models.Comment "Комментарий"
+// @Failure 400 {object} models.ErrorResponse "Ответы нельзя переоткрыть отдельно"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Комментарий не найден"
+// @Router /comments/{id}/reopen [post]
+// @Security Bearer
+func ReopenComment(db *sql.DB) gin.HandlerFunc {
+	return setCommentResolved(db, false)
+}
+
+func setCommentResolved(db *sql.DB, resolved bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		commentID, userID, ok := commentRequest(c)
+		if !ok {
+			return
+		}
+		commentService := services.CommentService{DB: db, Ctx: c.Request.Context()}
+		comment, err := commentService.SetResolved(commentID, userID, resolved)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при изменении обсуждения")
+			return
+		}
+		c.JSON(http.StatusOK, comment)
+	}
+}
+
+// commentRequest извлекает ID комментария из пути и пользователя из токена, при ошибке отвечает клиенту
+func commentRequest(c *gin.Context) (int, int, bool) {
+	commentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id комментария должен быть формата int"})
+		return 0, 0, false
+	}
+	userID, err := getUserIDFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+		return 0, 0, false
+	}
+	return commentID, userID, true
+}
@@ -0,0 +1,445 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"mime"
+	"net/http"
+	"notes-api/internal/models"
+	"notes-api/internal/services"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportProfile @Summary Выгрузка всех данных пользователя
+// @Description Запускает формирование ZIP-архива со всеми заметками, тегами и доступами пользователя в JSON и Markdown.
+// @Description Архив формируется в фоне, его состояние доступно по ссылке из ответа.
+// @Tags users
+// @Produce json
+// @Success 202 {object} models.UserExport "Выгрузка запущена"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 500 {object} models.ErrorResponse "Внутренняя ошибка сервера"
+// @Router /profile/export [get]
+// @Security Bearer
+func ExportProfile(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		exportService := services.ExportService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		export, err := exportService.StartExport(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при запуске выгрузки"})
+			return
+		}
+		c.Header("Location", fmt.Sprintf("/profile/export/%d", export.ID))
+		c.JSON(http.StatusAccepted, export)
+	}
+}
+
+// GetProfileExport @Summary Состояние выгрузки данных
+// @Description Возвращает состояние выгрузки и ссылку на скачивание, когда архив готов
+// @Tags users
+// @Produce json
+// @Param id path int true "ID выгрузки"
+// @Success 200 {object} models.UserExport "Состояние выгрузки"
+// @Failure 400 {object} models.ErrorResponse "id выгрузки должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Выгрузка не найдена"
+// @Router /profile/export/{id} [get]
+// @Security Bearer
+func GetProfileExport(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exportID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id выгрузки должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		exportService := services.ExportService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		export, err := exportService.GetExport(exportID, userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Выгрузка не найдена"})
+			return
+		}
+		if export.Status == services.ExportCompleted {
+			export.DownloadURL = fmt.Sprintf("/profile/export/%d/download", export.ID)
+		}
+		c.JSON(http.StatusOK, export)
+	}
+}
+
+// DownloadProfileExport @Summary Скачивание выгрузки данных
+// @Description Возвращает готовый ZIP-архив с данными пользователя
+// @Tags users
+// @Produce application/zip
+// @Param id path int true "ID выгрузки"
+// @Success 200 {file} file "ZIP-архив"
+// @Failure 400 {object} models.ErrorResponse "id выгрузки должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Выгрузка не найдена"
+// @Failure 409 {object} models.ErrorResponse "Выгрузка еще не готова"
+// @Router /profile/export/{id}/download [get]
+// @Security Bearer
+func DownloadProfileExport(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exportID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id выгрузки должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		exportService := services.ExportService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		archive, err := exportService.GetExportArchive(exportID, userID)
+		if err != nil {
+			if errors.Is(err, services.ErrExportNotReady) {
+				c.JSON(http.StatusConflict, models.ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusNotFound, gin.H{"error": "Выгрузка не найдена"})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="notes-export-%d.zip"`, exportID))
+		c.Data(http.StatusOK, "application/zip", archive)
+	}
+}
+
+// ExportNotes @Summary Выгрузка заметок в Markdown
+// @Description Возвращает ZIP-архив с личными заметками пользователя: по Markdown-файлу на заметку с YAML-заголовком
+// @Description (id, title, tags, notebook, format, created, updated, due, pinned, archived). Заметки блокнотов лежат
+// @Description в папках с именами блокнотов. Архив подходит для POST /import и открывается как хранилище Obsidian.
+// @Tags notes
+// @Produce application/zip
+// @Param format query string false "Формат выгрузки, поддерживается только zip"
+// @Success 200 {file} file "ZIP-архив"
+// @Failure 400 {object} models.ErrorResponse "Неподдерживаемый формат"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 500 {object} models.ErrorResponse "Внутренняя ошибка сервера"
+// @Router /export [get]
+// @Security Bearer
+func ExportNotes(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if format := c.DefaultQuery("format", "zip"); format != "zip" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Поддерживается только format=zip"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="notes-%s.zip"`, time.Now().Format("2006-01-02")))
+		vaultService := services.VaultService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := vaultService.Export(userID, c.Writer); err != nil {
+			if c.Writer.Written() {
+				// Часть архива уже отправлена, поэтому ошибка только записывается в лог
+				c.Error(err)
+				return
+			}
+			c.Header("Content-Disposition", "")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при выгрузке заметок"})
+		}
+	}
+}
+
+// ExportNote @Summary Выгрузка заметки в файл
+// @Description Возвращает заметку с тегами и датами в PDF, HTML, Markdown или обычном тексте для передачи
+// @Description за пределы сервиса. Изображения-вложения встраиваются в PDF, а в HTML и Markdown - как data URI,
+// @Description поэтому файл открывается без доступа к сервису. PDF набирается шрифтами Go: латиница, кириллица и греческий.
+// @Tags notes
+// @Produce application/pdf
+// @Produce text/html
+// @Produce text/markdown
+// @Produce text/plain
+// @Param id path int true "ID заметки"
+// @Param format query string false "pdf (по умолчанию), html, md или txt"
+// @Success 200 {file} file "Файл заметки"
+// @Failure 400 {object} models.ErrorResponse "Неподдерживаемый формат"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Заметка не найдена"
+// @Failure 500 {object} models.ErrorResponse "Внутренняя ошибка сервера"
+// @Router /notes/{id}/export [get]
+// @Security Bearer
+func ExportNote(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		documentService := services.DocumentService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		file, err := documentService.ExportNote(noteID, userID, c.DefaultQuery("format", services.DocumentPDF))
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при выгрузке заметки")
+			return
+		}
+		sendDocument(c, file)
+	}
+}
+
+// ExportNotebook @Summary Выгрузка блокнота в файл
+// @Description Возвращает все заметки блокнота одним файлом: оглавление (в PDF - с номерами страниц), затем заметки
+// @Description по алфавиту, каждая в PDF с новой страницы. Форматы и встраивание изображений - как у GET /notes/{id}/export.
+// @Tags notebooks
+// @Produce application/pdf
+// @Produce text/html
+// @Produce text/markdown
+// @Produce text/plain
+// @Param id path int true "ID блокнота"
+// @Param format query string false "pdf (по умолчанию), html, md или txt"
+// @Success 200 {file} file "Файл блокнота"
+// @Failure 400 {object} models.ErrorResponse "Неподдерживаемый формат"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Блокнот не найден"
+// @Failure 500 {object} models.ErrorResponse "Внутренняя ошибка сервера"
+// @Router /notebooks/{id}/export [get]
+// @Security Bearer
+func ExportNotebook(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		notebookID, userID, ok := notebookRequest(c)
+		if !ok {
+			return
+		}
+		documentService := services.DocumentService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		file, err := documentService.ExportNotebook(notebookID, userID, c.DefaultQuery("format", services.DocumentPDF))
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при выгрузке блокнота")
+			return
+		}
+		sendDocument(c, file)
+	}
+}
+
+// sendDocument отдает выгруженный файл для сохранения
+func sendDocument(c *gin.Context, file services.Document) {
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.FileName}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, file.ContentType, file.Data)
+}
+
+// ImportNotes @Summary Импорт заметок из ZIP-архива
+// @Description Загружает заметки из архива GET /export или хранилища Obsidian. Архив передается полем file
+// @Description формы multipart/form-data или телом запроса с типом application/zip.
+// @Description Блокноты восстанавливаются по заголовку notebook или по папкам, теги - по заголовку tags или #тегам в тексте.
+// @Description Дубликатом считается заметка с тем же id или с тем же заголовком в том же блокноте.
+// @Description Файлы, не являющиеся заметками (.md, .markdown, .txt), перечисляются в ignored.
+// @Tags notes
+// @Accept multipart/form-data
+// @Accept application/zip
+// @Produce json
+// @Param file formData file false "ZIP-архив"
+// @Param dry_run query bool false "Только составить отчет, ничего не изменяя"
+// @Param on_duplicate query string false "skip (по умолчанию), overwrite или keep"
+// @Success 200 {object} models.ImportReport "Отчет об импорте"
+// @Failure 400 {object} models.ErrorResponse "Некорректный архив или параметры"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 413 {object} models.ErrorResponse "Слишком большой архив"
+// @Failure 500 {object} models.ErrorResponse "Внутренняя ошибка сервера"
+// @Router /import [post]
+// @Security Bearer
+func ImportNotes(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		options, ok := importOptions(c)
+		if !ok {
+			return
+		}
+		archive, ok := readImportFile(c)
+		if !ok {
+			return
+		}
+		vaultService := services.VaultService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		report, err := vaultService.Import(userID, archive, options)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при импорте заметок")
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// ImportENEX @Summary Импорт из Evernote
+// @Description Запускает фоновый импорт файла ENEX, экспортированного из Evernote. Файл передается полем file
+// @Description формы multipart/form-data или телом запроса. Текст заметок преобразуется в Markdown, файлы
+// @Description становятся вложениями, теги и даты создания и изменения сохраняются. Заметки без блокнота
+// @Description попадают в блокнот notebook, если он указан. Ход импорта доступен по ссылке из ответа.
+// @Tags notes
+// @Accept multipart/form-data
+// @Accept application/xml
+// @Produce json
+// @Param file formData file false "Файл ENEX"
+// @Param dry_run query bool false "Только составить отчет, ничего не изменяя"
+// @Param on_duplicate query string false "skip (по умолчанию), overwrite или keep"
+// @Param notebook query string false "Блокнот для импортированных заметок"
+// @Success 202 {object} models.ImportJob "Импорт запущен"
+// @Failure 400 {object} models.ErrorResponse "Некорректный файл или параметры"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 413 {object} models.ErrorResponse "Слишком большой файл"
+// @Failure 500 {object} models.ErrorResponse "Внутренняя ошибка сервера"
+// @Router /import/enex [post]
+// @Security Bearer
+func ImportENEX(db *sql.DB) gin.HandlerFunc {
+	return startImport(db, models.ImportSourceENEX)
+}
+
+// ImportKeep @Summary Импорт из Google Keep
+// @Description Запускает фоновый импорт ZIP-архива Google Takeout с заметками Keep. Архив передается полем file
+// @Description формы multipart/form-data или телом запроса. Ярлыки становятся тегами, списки - пунктами списка задач,
+// @Description файлы - вложениями; закрепление, архивация и даты сохраняются, заметки из корзины пропускаются.
+// @Description Ход импорта доступен по ссылке из ответа.
+// @Tags notes
+// @Accept multipart/form-data
+// @Accept application/zip
+// @Produce json
+// @Param file formData file false "ZIP-архив Google Takeout"
+// @Param dry_run query bool false "Только составить отчет, ничего не изменяя"
+// @Param on_duplicate query string false "skip (по умолчанию), overwrite или keep"
+// @Param notebook query string false "Блокнот для импортированных заметок"
+// @Success 202 {object} models.ImportJob "Импорт запущен"
+// @Failure 400 {object} models.ErrorResponse "Некорректный архив или параметры"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 413 {object} models.ErrorResponse "Слишком большой архив"
+// @Failure 500 {object} models.ErrorResponse "Внутренняя ошибка сервера"
+// @Router /import/keep [post]
+// @Security Bearer
+func ImportKeep(db *sql.DB) gin.HandlerFunc {
+	return startImport(db, models.ImportSourceKeep)
+}
+
+// GetImportJob @Summary Состояние импорта
+// @Description Возвращает ход фонового импорта: total - число заметок в файле, processed - обработано.
+// @Description После завершения содержит отчет об импорте.
+// @Tags notes
+// @Produce json
+// @Param id path int true "ID импорта"
+// @Success 200 {object} models.ImportJob "Состояние импорта"
+// @Failure 400 {object} models.ErrorResponse "id импорта должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Импорт не найден"
+// @Router /import/jobs/{id} [get]
+// @Security Bearer
+func GetImportJob(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jobID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id импорта должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		vaultService := services.VaultService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		job, err := vaultService.GetImportJob(jobID, userID)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при получении импорта")
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// startImport возвращает обработчик, запускающий фоновый импорт из источника source
+func startImport(db *sql.DB, source string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		options, ok := importOptions(c)
+		if !ok {
+			return
+		}
+		data, ok := readImportFile(c)
+		if !ok {
+			return
+		}
+		vaultService := services.VaultService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		job, err := vaultService.StartImport(userID, source, data, options)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при запуске импорта")
+			return
+		}
+		c.Header("Location", fmt.Sprintf("/import/jobs/%d", job.ID))
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// importOptions читает параметры импорта из запроса
+func importOptions(c *gin.Context) (models.ImportOptions, bool) {
+	options := models.ImportOptions{OnDuplicate: c.Query("on_duplicate"), Notebook: c.Query("notebook")}
+	if value := c.Query("dry_run"); value != "" {
+		var err error
+		if options.DryRun, err = strconv.ParseBool(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "dry_run должен быть true или false"})
+			return options, false
+		}
+	}
+	return options, true
+}
+
+// readImportFile читает загружаемый файл из поля file формы или из тела запроса
+func readImportFile(c *gin.Context) ([]byte, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, services.MaxImportSize)
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			respondImportReadError(c, err)
+			return nil, false
+		}
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при чтении файла"})
+			return nil, false
+		}
+		defer file.Close()
+		body = file
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		respondImportReadError(c, err)
+		return nil, false
+	}
+	if len(data) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Передайте файл в поле file или в теле запроса"})
+		return nil, false
+	}
+	return data, true
+}
+
+// respondImportReadError отвечает на ошибку чтения загружаемого файла
+func respondImportReadError(c *gin.Context, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": services.ErrArchiveTooLarge.Error()})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Передайте файл в поле file или в теле запроса"})
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"net/http"
+	"notes-api/internal/database"
+	"notes-api/internal/models"
+	"notes-api/internal/services"
+	"time"
+)
+
+// readinessTimeout - наибольшее время проверки базы данных при проверке готовности
+const readinessTimeout = 2 * time.Second
+
+// Healthz @Summary Проверка работоспособности
+// @Description Отвечает 200, пока процесс обрабатывает запросы. Не обращается к базе данных.
+// @Tags health
+// @Produce json
+// @Success 200 {object} models.HealthStatus "Сервис работает"
+// @Router /healthz [get]
+func Healthz() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, models.HealthStatus{Status: "ok"})
+	}
+}
+
+// Readyz @Summary Проверка готовности
+// @Description Проверяет соединение с базой данных, применение схемы и работу обработчиков очереди задач.
+// @Description Во время остановки сервиса отвечает 503, чтобы балансировщик перестал направлять запросы.
+// @Tags health
+// @Produce json
+// @Success 200 {object} models.HealthStatus "Сервис готов"
+// @Failure 503 {object} models.HealthStatus "Сервис не готов"
+// @Router /readyz [get]
+func Readyz(shutdown context.Context, db *sql.DB, worker *services.Worker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+		defer cancel()
+		checks := map[string]string{"database": "ok", "schema": "ok", "worker": "ok"}
+		ready := true
+		// Маршрут доступен без аутентификации, поэтому текст ошибки только записывается в лог
+		fail := func(check string, err error) {
+			checks[check], ready = "error", false
+			slog.ErrorContext(c.Request.Context(), "Проверка готовности не пройдена", "check", check, "error", err)
+		}
+		if err := db.PingContext(ctx); err != nil {
+			fail("database", err)
+		} else if err := database.CheckSchema(ctx, db); err != nil {
+			fail("schema", err)
+		}
+		switch {
+		case worker == nil || worker.Concurrency == 0:
+			checks["worker"] = "disabled"
+		case !worker.Running():
+			checks["worker"], ready = "stopped", false
+		}
+		if shutdown.Err() != nil {
+			checks["shutdown"], ready = "stopping", false
+		}
+		if !ready {
+			c.JSON(http.StatusServiceUnavailable, models.HealthStatus{Status: "not_ready", Checks: checks})
+			return
+		}
+		c.JSON(http.StatusOK, models.HealthStatus{Status: "ready", Checks: checks})
+	}
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"notes-api/internal/services"
+	"strconv"
+)
+
+// GetInvitations @Summary Входящие приглашения
+// @Description Возвращает приглашения к заметкам, ожидающие ответа текущего пользователя
+// @Tags invitations
+// @Produce json
+// @Success 200 {array} models.NoteInvitation "Список приглашений"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Router /invitations [get]
+// @Security Bearer
+func GetInvitations(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		invitationService := services.InvitationService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		invitations, err := invitationService.GetPendingInvitations(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении приглашений"})
+			return
+		}
+		c.JSON(http.StatusOK, invitations)
+	}
+}
+
+// AcceptInvitation @Summary Принятие приглашения
+// @Description Принимает приглашение, после чего заметка становится доступной пользователю
+// @Tags invitations
+// @Produce json
+// @Param id path int true "ID приглашения"
+// @Success 200 {object} models.NoteInvitation "Принятое приглашение"
+// @Failure 400 {object} models.ErrorResponse "id приглашения должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Приглашение не найдено"
+// @Router /invitations/{id}/accept [post]
+// @Security Bearer
+func AcceptInvitation(db *sql.DB) gin.HandlerFunc {
+	return respondInvitation(db, true)
+}
+
+// DeclineInvitation @Summary Отклонение приглашения
+// @Description Отклоняет приглашение к заметке
+// @Tags invitations
+// @Produce json
+// @Param id path int true "ID приглашения"
+// @Success 200 {object} models.NoteInvitation "Отклоненное приглашение"
+// @Failure 400 {object} models.ErrorResponse "id приглашения должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Приглашение не найдено"
+// @Router /invitations/{id}/decline [post]
+// @Security Bearer
+func DeclineInvitation(db *sql.DB) gin.HandlerFunc {
+	return respondInvitation(db, false)
+}
+
+func respondInvitation(db *sql.DB, accept bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		invitationID, userID, ok := invitationRequest(c)
+		if !ok {
+			return
+		}
+		invitationService := services.InvitationService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		invitation, err := invitationService.Respond(invitationID, userID, accept)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при ответе на приглашение")
+			return
+		}
+		c.JSON(http.StatusOK, invitation)
+	}
+}
+
+// CancelInvitation @Summary Отзыв приглашения
+// @Description Отзывает отправленное приглашение, пока получатель на него не ответил
+// @Tags invitations
+// @Produce json
+// @Param id path int true "ID приглашения"
+// @Success 200 {object} models.SuccessResponse "Приглашение отозвано"
+// @Failure 400 {object} models.ErrorResponse "id приглашения должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Приглашение не найдено"
+// @Router /invitations/{id} [delete]
+// @Security Bearer
+func CancelInvitation(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		invitationID, userID, ok := invitationRequest(c)
+		if !ok {
+			return
+		}
+		invitationService := services.InvitationService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := invitationService.Cancel(invitationID, userID); err != nil {
+			respondNoteError(c, err, "Ошибка при отзыве приглашения")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Приглашение отозвано"})
+	}
+}
+
+// GetNoteAccess @Summary Доступ к заметке
+// @Description Возвращает владельцу заметки всех пользователей и команды с доступом к ней, а также ожидающие приглашения
+// @Tags notes
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Success 200 {object} models.NoteAccessList "Доступ к заметке"
+// @Failure 400 {object} models.ErrorResponse "id заметки должен быть формата int"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Заметка не найдена"
+// @Router /notes/{id}/access [get]
+// @Security Bearer
+func GetNoteAccess(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		invitationService := services.InvitationService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		access, err := invitationService.GetNoteAccess(noteID, userID)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при получении списка доступа")
+			return
+		}
+		c.JSON(http.StatusOK, access)
+	}
+}
+
+// RevokeNoteAccess @Summary Отзыв доступа к заметке
+// @Description Отзывает личный доступ пользователя к заметке
+// @Tags notes
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Param user_id path int true "ID пользователя"
+// @Success 200 {object} models.SuccessResponse "Доступ отозван"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Заметка или пользователь не найдены"
+// @Router /notes/{id}/access/{user_id} [delete]
+// @Security Bearer
+func RevokeNoteAccess(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		targetID, err := strconv.Atoi(c.Param("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id пользователя должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		invitationService := services.InvitationService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := invitationService.RevokeAccess(noteID, userID, targetID); err != nil {
+			respondNoteError(c, err, "Ошибка при отзыве доступа")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Доступ к заметке отозван"})
+	}
+}
+
+// invitationRequest извлекает ID приглашения из пути и пользователя из токена, при ошибке отвечает клиенту
+func invitationRequest(c *gin.Context) (int, int, bool) {
+	invitationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id приглашения должен быть формата int"})
+		return 0, 0, false
+	}
+	userID, err := getUserIDFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+		return 0, 0, false
+	}
+	return invitationID, userID, true
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"notes-api/internal/services"
+	"strconv"
+)
+
+// GetJob @Summary Состояние задачи
+// @Description Возвращает задачу очереди, запущенную пользователем: статус, число попыток, последнюю ошибку
+// @Description и результат. job_id возвращают запуск выгрузки, импорта и фоновой групповой обработки.
+// @Tags jobs
+// @Produce json
+// @Param id path int true "ID задачи"
+// @Success 200 {object} models.Job "Задача"
+// @Failure 400 {object} models.ErrorResponse "id задачи должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Задача не найдена"
+// @Router /jobs/{id} [get]
+// @Security Bearer
+func GetJob(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jobID, ok := jobIDParam(c)
+		if !ok {
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		jobService := services.JobService{DB: db, Ctx: c.Request.Context()}
+		job, err := jobService.GetJob(jobID, userID)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при получении задачи")
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// AdminListJobs @Summary Задачи очереди
+// @Description Возвращает задачи всех пользователей, новые первыми. status=dead показывает задачи, исчерпавшие попытки.
+// @Tags admin
+// @Produce json
+// @Param status query string false "Статус: pending, running, completed или dead"
+// @Param page query int false "Номер страницы"
+// @Param limit query int false "Количество задач на странице"
+// @Success 200 {array} models.Job "Список задач"
+// @Failure 403 {object} models.ErrorResponse "Требуются права администратора"
+// @Router /admin/jobs [get]
+// @Security Bearer
+func AdminListJobs(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, limit := getPagination(c)
+		adminService := services.AdminService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		jobs, err := adminService.ListJobs(c.Query("status"), page, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении задач"})
+			return
+		}
+		c.JSON(http.StatusOK, jobs)
+	}
+}
+
+// AdminRetryJob @Summary Повтор задачи
+// @Description Заново ставит в очередь задачу, исчерпавшую попытки
+// @Tags admin
+// @Produce json
+// @Param id path int true "ID задачи"
+// @Success 200 {object} models.Job "Задача"
+// @Failure 400 {object} models.ErrorResponse "id задачи должен быть формата int"
+// @Failure 403 {object} models.ErrorResponse "Требуются права администратора"
+// @Failure 404 {object} models.ErrorResponse "Задача не найдена"
+// @Failure 409 {object} models.ErrorResponse "Задача не исчерпала попытки"
+// @Router /admin/jobs/{id}/retry [post]
+// @Security Bearer
+func AdminRetryJob(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jobID, ok := jobIDParam(c)
+		if !ok {
+			return
+		}
+		adminID, _ := getUserIDFromToken(c)
+		adminService := services.AdminService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		job, err := adminService.RetryJob(adminID, jobID)
+		if err != nil {
+			if errors.Is(err, services.ErrJobNotDead) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			respondAdminError(c, err, "Ошибка при повторе задачи")
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// jobIDParam извлекает ID задачи из пути, при ошибке отвечает клиенту
+func jobIDParam(c *gin.Context) (int, bool) {
+	jobID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id задачи должен быть формата int"})
+		return 0, false
+	}
+	return jobID, true
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"notes-api/internal/services"
+	"strconv"
+)
+
+// GetNoteLinks @Summary Ссылки из заметки
+// @Description Возвращает вики-ссылки [[Название]] и [[id:123]] из содержимого заметки; broken = true у ссылок,
+// @Description для которых заметка не найдена
+// @Tags links
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Success 200 {array} models.NoteLink "Исходящие ссылки"
+// @Failure 400 {object} models.ErrorResponse "id заметки должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Заметка не найдена"
+// @Router /notes/{id}/links [get]
+// @Security Bearer
+func GetNoteLinks(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		linkService := services.LinkService{DB: db, Ctx: c.Request.Context()}
+		links, err := linkService.GetLinks(noteID, userID)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при получении ссылок")
+			return
+		}
+		c.JSON(http.StatusOK, links)
+	}
+}
+
+// GetNoteBacklinks @Summary Обратные ссылки
+// @Description Возвращает ссылки на заметку из доступных текущему пользователю заметок
+// @Tags links
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Success 200 {array} models.NoteLink "Обратные ссылки"
+// @Failure 400 {object} models.ErrorResponse "id заметки должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Заметка не найдена"
+// @Router /notes/{id}/backlinks [get]
+// @Security Bearer
+func GetNoteBacklinks(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		linkService := services.LinkService{DB: db, Ctx: c.Request.Context()}
+		links, err := linkService.GetBacklinks(noteID, userID)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при получении обратных ссылок")
+			return
+		}
+		c.JSON(http.StatusOK, links)
+	}
+}
+
+// GetBrokenLinks @Summary Битые ссылки
+// @Description Возвращает ссылки на несуществующие или недоступные заметки в доступных текущему пользователю заметках
+// @Tags links
+// @Produce json
+// @Success 200 {array} models.NoteLink "Битые ссылки"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Router /links/broken [get]
+// @Security Bearer
+func GetBrokenLinks(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		linkService := services.LinkService{DB: db, Ctx: c.Request.Context()}
+		links, err := linkService.GetBroken(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении битых ссылок"})
+			return
+		}
+		c.JSON(http.StatusOK, links)
+	}
+}
+
+// GetGraph @Summary Граф заметок
+// @Description Возвращает доступные текущему пользователю заметки (nodes) и ссылки между ними (edges)
+// @Tags links
+// @Produce json
+// @Success 200 {object} models.NoteGraph "Граф заметок"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Router /graph [get]
+// @Security Bearer
+func GetGraph(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		linkService := services.LinkService{DB: db, Ctx: c.Request.Context()}
+		graph, err := linkService.GetGraph(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при построении графа заметок"})
+			return
+		}
+		c.JSON(http.StatusOK, graph)
+	}
+}
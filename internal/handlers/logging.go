@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"notes-api/internal/logging"
+	"time"
+)
+
+// RequestIDHeader - заголовок с номером запроса. Номер от балансировщика или клиента сохраняется,
+// чтобы запрос можно было найти в журналах всех сервисов.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength - наибольшая длина номера запроса, принимаемого из заголовка
+const maxRequestIDLength = 128
+
+// RequestLogger присваивает запросу номер, возвращает его в X-Request-ID и записывает запрос в журнал.
+// Записи, сделанные обработчиками и сервисами с контекстом запроса, получают тот же request_id и route.
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		c.Header(RequestIDHeader, requestID)
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx := logging.With(c.Request.Context(), slog.String("request_id", requestID), slog.String("route", route))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+		// c.Request.Context() уже содержит user_id, если его добавила проверка сессии
+		slog.LogAttrs(c.Request.Context(), level, "HTTP-запрос", attrs...)
+	}
+}
+
+// validRequestID допускает непустой номер из печатных символов ASCII, чтобы в журнал не попали переводы строк
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"notes-api/internal/metrics"
+	"strconv"
+	"time"
+)
+
+// RecordMetrics считает запросы и время их обработки по шаблону маршрута
+func RecordMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			// Запросы к несуществующим маршрутам сводятся в один ряд
+			route = "unmatched"
+		}
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		metrics.HTTPDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Metrics @Summary Метрики Prometheus
+// @Description Отдает метрики сервиса в текстовом формате Prometheus. Если задан METRICS_TOKEN,
+// @Description требует заголовок Authorization: Bearer {METRICS_TOKEN}.
+// @Tags health
+// @Produce plain
+// @Success 200 {string} string "Метрики"
+// @Failure 401 {object} models.ErrorResponse "Неверный токен"
+// @Router /metrics [get]
+func Metrics(token string) gin.HandlerFunc {
+	handler := metrics.Handler()
+	return func(c *gin.Context) {
+		if token != "" {
+			provided := c.GetHeader("Authorization")
+			if subtle.ConstantTimeCompare([]byte(provided), []byte("Bearer "+token)) != 1 {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверный токен"})
+				return
+			}
+		}
+		handler.ServeHTTP(c.Writer, c.Request)
+	}
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"notes-api/internal/models"
+	"notes-api/internal/services"
+	"strconv"
+)
+
+// CreateNotebook @Summary Создание блокнота
+// @Description Создает личный блокнот или, если указан team_id, блокнот команды
+// @Tags notebooks
+// @Accept json
+// @Produce json
+// @Param notebook body models.Notebook true "Блокнот"
+// @Success 201 {object} models.Notebook "Созданный блокнот"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 403 {object} models.ErrorResponse "Недостаточно прав в команде"
+// @Router /notebooks [post]
+// @Security Bearer
+func CreateNotebook(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var notebook models.Notebook
+		if err := c.ShouldBindJSON(&notebook); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		notebookService := services.NotebookService{DB: db, Ctx: c.Request.Context()}
+		if err := notebookService.CreateNotebook(&notebook, userID); err != nil {
+			respondNoteError(c, err, "Ошибка при создании блокнота")
+			return
+		}
+		c.JSON(http.StatusCreated, notebook)
+	}
+}
+
+// GetNotebooks @Summary Список блокнотов
+// @Description Возвращает личные блокноты пользователя и блокноты его команд
+// @Tags notebooks
+// @Produce json
+// @Success 200 {array} models.Notebook "Список блокнотов"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Router /notebooks [get]
+// @Security Bearer
+func GetNotebooks(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		notebookService := services.NotebookService{DB: db, Ctx: c.Request.Context()}
+		notebooks, err := notebookService.GetNotebooks(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении блокнотов"})
+			return
+		}
+		c.JSON(http.StatusOK, notebooks)
+	}
+}
+
+// RenameNotebook @Summary Переименование блокнота
+// @Description Меняет название блокнота
+// @Tags notebooks
+// @Accept json
+// @Produce json
+// @Param id path int true "ID блокнота"
+// @Param notebook body models.Notebook true "Блокнот с новым названием"
+// @Success 200 {object} models.Notebook "Блокнот"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 404 {object} models.ErrorResponse "Блокнот не найден"
+// @Router /notebooks/{id} [put]
+// @Security Bearer
+func RenameNotebook(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		notebookID, userID, ok := notebookRequest(c)
+		if !ok {
+			return
+		}
+		var request models.Notebook
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		notebookService := services.NotebookService{DB: db, Ctx: c.Request.Context()}
+		notebook, err := notebookService.RenameNotebook(notebookID, userID, request.Name)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при переименовании блокнота")
+			return
+		}
+		c.JSON(http.StatusOK, notebook)
+	}
+}
+
+// DeleteNotebook @Summary Удаление блокнота
+// @Description Удаляет блокнот. Заметки из него не удаляются, а остаются без блокнота.
+// @Tags notebooks
+// @Produce json
+// @Param id path int true "ID блокнота"
+// @Success 200 {object} models.SuccessResponse "Блокнот удален"
+// @Failure 404 {object} models.ErrorResponse "Блокнот не найден"
+// @Router /notebooks/{id} [delete]
+// @Security Bearer
+func DeleteNotebook(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		notebookID, userID, ok := notebookRequest(c)
+		if !ok {
+			return
+		}
+		notebookService := services.NotebookService{DB: db, Ctx: c.Request.Context()}
+		if err := notebookService.DeleteNotebook(notebookID, userID); err != nil {
+			respondNoteError(c, err, "Ошибка при удалении блокнота")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Блокнот удален"})
+	}
+}
+
+// GetNotebookNotes @Summary Заметки блокнота
+// @Description Возвращает заметки блокнота с пагинацией
+// @Tags notebooks
+// @Produce json
+// @Param id path int true "ID блокнота"
+// @Param page query int false "Номер страницы"
+// @Param limit query int false "Количество заметок на странице"
+// @Success 200 {array} models.Note "Список заметок"
+// @Failure 404 {object} models.ErrorResponse "Блокнот не найден"
+// @Router /notebooks/{id}/notes [get]
+// @Security Bearer
+func GetNotebookNotes(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		notebookID, userID, ok := notebookRequest(c)
+		if !ok {
+			return
+		}
+		page, limit := getPagination(c)
+		notebookService := services.NotebookService{DB: db, Ctx: c.Request.Context()}
+		notes, err := notebookService.GetNotebookNotes(notebookID, userID, page, limit)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при получении заметок блокнота")
+			return
+		}
+		c.JSON(http.StatusOK, notes)
+	}
+}
+
+// notebookRequest извлекает ID блокнота из пути и пользователя из токена, при ошибке отвечает клиенту
+func notebookRequest(c *gin.Context) (int, int, bool) {
+	notebookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id блокнота должен быть формата int"})
+		return 0, 0, false
+	}
+	userID, err := getUserIDFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+		return 0, 0, false
+	}
+	return notebookID, userID, true
+}
@@ -2,24 +2,27 @@ package handlers
 
 import (
 	"database/sql"
-	"github.com/dgrijalva/jwt-go"
+	"errors"
 	"github.com/gin-gonic/gin"
-	"log"
+	"github.com/gin-gonic/gin/binding"
+	"html"
+	"log/slog"
 	"net/http"
 	"notes-api/internal/models"
 	"notes-api/internal/services"
-	"os"
 	"strconv"
 )
 
 // CreateNote @Summary Создание заметки
-// @Description Создает новую заметку
+// @Description Создает новую заметку. С team_id или notebook_id блокнота команды заметка принадлежит команде.
 // @Tags notes
 // @Accept json
 // @Produce json
 // @Param note body models.Note true "Заметка"
 // @Success 201 {object} models.SuccessResponse "Созданная заметка"
 // @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 403 {object} models.ErrorResponse "Недостаточно прав в команде"
+// @Failure 404 {object} models.ErrorResponse "Команда или блокнот не найдены"
 // @Failure 500 {object} models.ErrorResponse "Внутренняя ошибка сервера"
 // @Router /notes [post]
 // @Security Bearer
@@ -37,9 +40,9 @@ func CreateNote(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 		note.UserID = userID // Устанавливаем user_id для заметки
-		noteService := services.NoteService{DB: db}
+		noteService := services.NoteService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
 		if err := noteService.CreateNote(&note); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при создании заметки"})
+			respondNoteError(c, err, "Ошибка при создании заметки")
 			return
 		}
 
@@ -49,13 +52,19 @@ func CreateNote(db *sql.DB) gin.HandlerFunc {
 
 // GetNotes возвращает список заметок с пагинацией
 // @Summary Получение списка заметок
-// @Description Получает список заметок с пагинацией
+// @Description Получает список заметок с пагинацией, закрепленные заметки первыми. Архивные заметки скрыты,
+// @Description если не указан archived; в поиске (q) и избранном (starred) они возвращаются.
 // @Tags notes
 // @Produce json
 // @Param page query int false "Номер страницы"
 // @Param limit query int false "Количество заметок на странице"
+// @Param archived query bool false "true - только архивные, false - только неархивные"
+// @Param starred query bool false "true - избранные заметки, включая чужие доступные"
+// @Param q query string false "Поиск по названию и содержимому"
 // @Success 200 {array} models.Note "Список заметок"
+// @Failure 400 {object} models.ErrorResponse "Некорректный фильтр"
 // @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 500 {object} models.ErrorResponse "Ошибка при получении заметок или тегов"
 // @Router /notes [get]
 // @Security Bearer
 func GetNotes(db *sql.DB) gin.HandlerFunc {
@@ -65,27 +74,34 @@ func GetNotes(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
 			return
 		}
-		pageStr := c.Query("page")
-		page, err := strconv.Atoi(pageStr)
-		if err != nil || page < 1 {
-			page = 1 // По умолчанию первая страница
+		filter := models.NoteFilter{Query: c.Query("q")}
+		if value := c.Query("archived"); value != "" {
+			archived, err := strconv.ParseBool(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "archived должен быть true или false"})
+				return
+			}
+			filter.Archived = &archived
 		}
-		limitStr := c.Query("limit")
-		limit, err := strconv.Atoi(limitStr)
-		if err != nil || limit < 1 {
-			limit = 10 // По умолчанию 10 заметок на страницу
+		if value := c.Query("starred"); value != "" {
+			if filter.Starred, err = strconv.ParseBool(value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "starred должен быть true или false"})
+				return
+			}
 		}
-		noteService := services.NoteService{DB: db}
-		notes, err := noteService.GetNotes(userID, page, limit)
+		page, limit := getPagination(c)
+		noteService := services.NoteService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		notes, err := noteService.GetNotes(userID, filter, page, limit)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении заметок"})
 			return
 		}
 		// Получаем теги для каждой заметки
 		for i := range notes {
-			tags, err := noteService.GetTagsForNote(notes[i].ID)
-			if err == nil {
-				notes[i].Tags = tags
+			if notes[i].Tags, err = noteService.GetTagsForNote(notes[i].ID); err != nil {
+				c.Error(err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении тегов"})
+				return
 			}
 		}
 
@@ -94,14 +110,18 @@ func GetNotes(db *sql.DB) gin.HandlerFunc {
 }
 
 // GetNoteByID @Summary Получение заметки по ID
-// @Description Получает заметку по ID
+// @Description Получает заметку по ID. С параметром render=html ответ содержит поле html с очищенным HTML
+// @Description содержимого (markdown-заметки преобразуются по CommonMark с расширениями GFM). При заголовке
+// @Description Accept: text/html возвращается HTML-страница заметки.
 // @Tags notes
-// @Produce json
+// @Produce json,html
 // @Param id path int true "ID заметки"
+// @Param render query string false "html - добавить в ответ очищенный HTML"
 // @Success 200 {object} models.SuccessResponse "Заметка"
 // @Failure 404 {object} models.ErrorResponse "Заметка не найдена или доступ запрещен"
 // @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
 // @Failure 400 {object} models.ErrorResponse "id заметки должен быть формата int"
+// @Failure 500 {object} models.ErrorResponse "Ошибка при получении тегов"
 // @Router /notes/{id} [get]
 // @Security Bearer
 func GetNoteByID(db *sql.DB) gin.HandlerFunc {
@@ -118,18 +138,33 @@ func GetNoteByID(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Вы должны быть авторизованы"})
 			return
 		}
-		noteService := services.NoteService{DB: db}
+		noteService := services.NoteService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
 		note, err := noteService.GetNoteByID(noteID, userID) // Передаем userID
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Заметка не найдена или доступ запрещен"})
 			return
 		}
 		// Получаем теги для заметки
-		tags, err := noteService.GetTagsForNote(note.ID)
-		if err == nil {
-			note.Tags = tags
+		if note.Tags, err = noteService.GetTagsForNote(note.ID); err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении тегов"})
+			return
+		}
+		wantsPage := c.NegotiateFormat(binding.MIMEJSON, binding.MIMEHTML) == binding.MIMEHTML
+		if c.Query("render") == "html" || wantsPage {
+			note.HTML, err = services.RenderHTML(note.ContentFormat, note.Content)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при отображении заметки"})
+				return
+			}
+		}
+		if wantsPage {
+			// Содержимое уже очищено; CSP запрещает скрипты, даже если что-то пропущено
+			c.Header("Content-Security-Policy", "default-src 'none'; img-src https: data:; style-src 'unsafe-inline'")
+			c.Data(http.StatusOK, "text/html; charset=utf-8", []byte("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>"+
+				html.EscapeString(note.Title)+"</title></head><body>\n<h1>"+html.EscapeString(note.Title)+"</h1>\n"+note.HTML+"</body></html>\n"))
+			return
 		}
-
 		c.JSON(http.StatusOK, note)
 	}
 }
@@ -167,8 +202,12 @@ func UpdateNote(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Вы должны быть авторизованы"})
 			return
 		}
-		noteService := services.NoteService{DB: db}
+		noteService := services.NoteService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
 		updatedNote, err := noteService.UpdateNote(&note, userID)
+		if errors.Is(err, services.ErrInvalidContentFormat) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Вы не можете редактировать эту заметку"})
 			return
@@ -202,7 +241,7 @@ func DeleteNote(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
 			return
 		}
-		noteService := services.NoteService{DB: db}
+		noteService := services.NoteService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
 		if err := noteService.DeleteNote(noteID, userID); err != nil {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Вы не можете удалить эту заметку"})
 			return
@@ -245,7 +284,7 @@ func AddTags(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
 			return
 		}
-		noteService := services.NoteService{DB: db}
+		noteService := services.NoteService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
 		if err := noteService.AddTags(noteID, tags, userID); err != nil {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Вы не можете добавлять теги к этой заметке"})
 			return
@@ -272,10 +311,13 @@ func AddTags(db *sql.DB) gin.HandlerFunc {
 // @Tags notes
 // @Produce json
 // @Param tag query string true "Тег"
+// @Param team_id query int false "ID команды, в пространстве имен которой ищется тег; без него - личный тег"
 // @Success 200 {array} models.Note "Список заметок"
 // @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
-// @Failure 404 {object} models.ErrorResponse "Тег не найден"
-// @Router /notes/tag [get]
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Тег или команда не найдены"
+// @Router /notes/tags [get]
+// @Security Bearer
 func GetNotesByTag(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tag := c.Query("tag")
@@ -283,14 +325,28 @@ func GetNotesByTag(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Тег обязателен"})
 			return
 		}
-		noteService := services.NoteService{DB: db}
-		notes, err := noteService.GetNotesByTag(tag)
+		var teamID *int
+		if value := c.Query("team_id"); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "team_id должен быть формата int"})
+				return
+			}
+			teamID = &id
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		noteService := services.NoteService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		notes, err := noteService.GetNotesByTag(tag, teamID, userID)
 		if err != nil {
-			if err.Error() == "тег не найден" {
+			if errors.Is(err, services.ErrTagNotFound) {
 				c.JSON(http.StatusNotFound, gin.H{"error": "Тег не найден"})
 				return
 			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении заметок по тегу"})
+			respondNoteError(c, err, "Ошибка при получении заметок по тегу")
 			return
 		}
 		c.JSON(http.StatusOK, notes)
@@ -298,17 +354,20 @@ func GetNotesByTag(db *sql.DB) gin.HandlerFunc {
 }
 
 // ShareNote - обработчик для передачи доступа к заметке
-// @Summary Передача доступа к заметке
-// @Description Делает заметку доступной для другого пользователя
+// @Summary Приглашение к заметке
+// @Description Приглашает пользователя к заметке по user_id, username или email с уровнем доступа viewer (по умолчанию), commenter или editor.
+// @Description Доступ появится, когда получатель примет приглашение. Приглашение на email незарегистрированного
+// @Description пользователя будет ждать его регистрации.
 // @Tags notes
 // @Accept json
 // @Produce json
 // @Param id path int true "ID заметки"
-// @Param requestBody body models.ShareNoteRequest true "ID пользователя, которому передается доступ"
-// @Success 200 {object} map[string]string "Сообщение об успешной передаче доступа"
+// @Param requestBody body models.ShareNoteRequest true "Получатель и уровень доступа"
+// @Success 201 {object} models.NoteInvitation "Отправленное приглашение"
 // @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
 // @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
 // @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Заметка или пользователь не найдены"
 // @Router /notes/{id}/share [post]
 // @Security Bearer
 func ShareNote(db *sql.DB) gin.HandlerFunc {
@@ -319,9 +378,7 @@ func ShareNote(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "note_id должен быть integer"})
 			return
 		}
-		var requestBody struct {
-			UserID int `json:"user_id"`
-		}
+		var requestBody models.ShareNoteRequest
 		if err := c.ShouldBindJSON(&requestBody); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
@@ -331,18 +388,19 @@ func ShareNote(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
 			return
 		}
-		noteService := services.NoteService{DB: db}
-		if err := noteService.ShareNote(noteID, ownerID, requestBody.UserID); err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()}) // Возвращаем конкретное сообщение об ошибке
+		invitationService := services.InvitationService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		invitation, err := invitationService.Invite(noteID, ownerID, requestBody)
+		if err != nil {
+			respondNoteError(c, err, "Не удалось отправить приглашение")
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "Доступ к заметке успешно передан"})
+		c.JSON(http.StatusCreated, invitation)
 	}
 }
 
 // GetSharedNotes - возвращает список заметок, доступных текущему пользователю
 // @Summary Получение списка доступных заметок
-// @Description Возвращает заметки, к которым у пользователя есть доступ
+// @Description Возвращает чужие заметки, доступ к которым выдан пользователю лично или его командам
 // @Tags notes
 // @Produce json
 // @Success 200 {array} models.Note "Список доступных заметок"
@@ -356,10 +414,10 @@ func GetSharedNotes(db *sql.DB) gin.HandlerFunc {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
 			return
 		}
-		noteService := services.NoteService{DB: db}
+		noteService := services.NoteService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
 		notes, err := noteService.GetSharedNotes(userID)
 		if err != nil {
-			log.Printf("Ошибка при получении доступных заметок: %v", err) // Логируем ошибку
+			slog.ErrorContext(c.Request.Context(), "Ошибка при получении доступных заметок", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить доступные заметки"})
 			return
 		}
@@ -367,20 +425,273 @@ func GetSharedNotes(db *sql.DB) gin.HandlerFunc {
 	}
 }
 
+// MoveNote @Summary Перемещение заметки в блокнот
+// @Description Перемещает заметку в блокнот того же владельца; notebook_id = null убирает заметку из блокнота
+// @Tags notes
+// @Accept json
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Param input body models.MoveNoteRequest true "Блокнот"
+// @Success 200 {object} models.SuccessResponse "Заметка перемещена"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Заметка или блокнот не найдены"
+// @Router /notes/{id}/notebook [put]
+// @Security Bearer
+func MoveNote(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		var request models.MoveNoteRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		noteService := services.NoteService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := noteService.MoveToNotebook(noteID, userID, request.NotebookID); err != nil {
+			respondNoteError(c, err, "Ошибка при перемещении заметки")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Заметка перемещена"})
+	}
+}
+
+// SetNoteState @Summary Закрепление, архивация и избранное
+// @Description Закрепляет заметку вверху списка (pinned), убирает ее в архив (archived) или добавляет в избранное
+// @Description текущего пользователя (starred). Для pinned и archived нужен доступ не ниже editor, для starred
+// @Description достаточно просмотра. Не переданные поля не меняются.
+// @Tags notes
+// @Accept json
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Param state body models.NoteStateRequest true "Новое состояние"
+// @Success 200 {object} models.Note "Заметка"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Заметка не найдена"
+// @Router /notes/{id}/state [put]
+// @Security Bearer
+func SetNoteState(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		var request models.NoteStateRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		noteService := services.NoteService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		note, err := noteService.SetState(noteID, userID, request)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при изменении состояния заметки")
+			return
+		}
+		c.JSON(http.StatusOK, note)
+	}
+}
+
+// SetNotesState @Summary Групповое закрепление, архивация и избранное
+// @Description Меняет состояние нескольких заметок (не больше 500). Заметки обрабатываются независимо,
+// @Description результат возвращается для каждой заметки.
+// @Tags notes
+// @Accept json
+// @Produce json
+// @Param state body models.BulkNoteStateRequest true "Заметки и новое состояние"
+// @Success 200 {array} models.BulkNoteResult "Результаты по заметкам"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Router /notes/state [put]
+// @Security Bearer
+func SetNotesState(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request models.BulkNoteStateRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		noteService := services.NoteService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		results, err := noteService.SetStateBulk(userID, request.NoteIDs, models.NoteStateRequest{
+			Pinned: request.Pinned, Archived: request.Archived, Starred: request.Starred})
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при изменении состояния заметок")
+			return
+		}
+		c.JSON(http.StatusOK, results)
+	}
+}
+
+// BatchNotes @Summary Групповые операции над заметками
+// @Description Выполняет операции delete, tag, untag, move, archive, unarchive и share над заметками из note_ids или
+// @Description выбранными фильтром filter (заметки пользователя) в одной транзакции. Заметки без нужного доступа
+// @Description пропускаются с ошибкой в результатах; при atomic = true любая ошибка отменяет все изменения.
+// @Description Синхронно обрабатывается до 500 заметок; с async = true до 10000 заметок обрабатываются в фоне,
+// @Description ответ 202 содержит задачу, состояние которой возвращает GET /notes/batch/{id}.
+// @Tags notes
+// @Accept json
+// @Produce json
+// @Param batch body models.BatchRequest true "Заметки и операции"
+// @Success 200 {object} models.BatchResult "Результаты по заметкам"
+// @Success 202 {object} models.BatchJob "Фоновая задача"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Блокнот или получатель не найдены"
+// @Router /notes/batch [post]
+// @Security Bearer
+func BatchNotes(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request models.BatchRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		batchService := services.BatchService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if request.Async {
+			job, err := batchService.Start(userID, request)
+			if err != nil {
+				respondNoteError(c, err, "Ошибка при запуске групповой операции")
+				return
+			}
+			c.JSON(http.StatusAccepted, job)
+			return
+		}
+		result, err := batchService.Run(userID, request)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при выполнении групповой операции")
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// GetBatchJob @Summary Состояние фоновой групповой операции
+// @Description Возвращает состояние фоновой групповой операции и, после завершения, результаты по заметкам
+// @Tags notes
+// @Produce json
+// @Param id path int true "ID задачи"
+// @Success 200 {object} models.BatchJob "Задача"
+// @Failure 400 {object} models.ErrorResponse "id задачи должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Задача не найдена"
+// @Router /notes/batch/{id} [get]
+// @Security Bearer
+func GetBatchJob(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jobID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id задачи должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		batchService := services.BatchService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		job, err := batchService.GetJob(jobID, userID)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при получении задачи")
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// respondNoteError отвечает клиенту статусом, соответствующим ошибке сервисов заметок, команд и блокнотов
+func respondNoteError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrNoteNotFound), errors.Is(err, services.ErrTeamNotFound),
+		errors.Is(err, services.ErrNotebookNotFound), errors.Is(err, services.ErrMemberNotFound),
+		errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrInvitationNotFound),
+		errors.Is(err, services.ErrTransferNotFound), errors.Is(err, services.ErrCommentNotFound),
+		errors.Is(err, services.ErrNotificationNotFound), errors.Is(err, services.ErrWebhookNotFound),
+		errors.Is(err, services.ErrDeliveryNotFound), errors.Is(err, services.ErrChecklistItemNotFound),
+		errors.Is(err, services.ErrReminderNotFound), errors.Is(err, services.ErrTemplateNotFound),
+		errors.Is(err, services.ErrBatchJobNotFound), errors.Is(err, services.ErrAttachmentNotFound),
+		errors.Is(err, services.ErrImportJobNotFound), errors.Is(err, services.ErrJobNotFound),
+		errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNoteForbidden), errors.Is(err, services.ErrTeamForbidden),
+		errors.Is(err, services.ErrNotNoteOwner), errors.Is(err, services.ErrCommentForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidPermission), errors.Is(err, services.ErrInvalidTeamRole),
+		errors.Is(err, services.ErrNotebookMismatch), errors.Is(err, services.ErrLastTeamOwner),
+		errors.Is(err, services.ErrShareWithOwner), errors.Is(err, services.ErrRecipientRequired),
+		errors.Is(err, services.ErrTeamNoteShare),
+		errors.Is(err, services.ErrTeamNoteTransfer), errors.Is(err, services.ErrInvalidAnchor),
+		errors.Is(err, services.ErrInvalidParent), errors.Is(err, services.ErrInvalidNotificationType),
+		errors.Is(err, services.ErrInvalidWebhookURL), errors.Is(err, services.ErrInvalidWebhookEvent),
+		errors.Is(err, services.ErrWebhookAddress),
+		errors.Is(err, services.ErrInvalidContentFormat), errors.Is(err, services.ErrInvalidDueDate),
+		errors.Is(err, services.ErrInvalidAssignee), errors.Is(err, services.ErrInvalidItemOrder),
+		errors.Is(err, services.ErrInvalidRRule), errors.Is(err, services.ErrInvalidReminderChannel),
+		errors.Is(err, services.ErrRRuleTooFrequent), errors.Is(err, services.ErrReminderWebhookOwner),
+		errors.Is(err, services.ErrInvalidSnooze), errors.Is(err, services.ErrMissingTemplateValue),
+		errors.Is(err, services.ErrInvalidTimezone), errors.Is(err, services.ErrTooManyNotes),
+		errors.Is(err, services.ErrInvalidBatchOperation), errors.Is(err, services.ErrBatchNotesRequired),
+		errors.Is(err, services.ErrInvalidArchive), errors.Is(err, services.ErrInvalidDuplicateMode),
+		errors.Is(err, services.ErrAttachmentTooLarge), errors.Is(err, services.ErrInvalidENEX),
+		errors.Is(err, services.ErrInvalidDocumentFormat):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAlreadyTeamMember):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrArchiveTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
 // Вспомогательная функция для извлечения user_id из токена
 func getUserIDFromToken(c *gin.Context) (int, error) {
-	tokenString, err := c.Cookie("tokenJWT")
-	if err != nil {
-		return 0, err
+	userID, ok := c.Get(userIDKey)
+	if !ok {
+		return 0, errInvalidToken
+	}
+	return userID.(int), nil
+}
+
+// Вспомогательная функция для получения сведений о клиенте для журнала аудита
+func clientInfo(c *gin.Context) models.ClientInfo {
+	return models.ClientInfo{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+}
+
+// Вспомогательная функция для получения параметров пагинации из запроса
+func getPagination(c *gin.Context) (int, int) {
+	page, err := strconv.Atoi(c.Query("page"))
+	if err != nil || page < 1 {
+		page = 1 // По умолчанию первая страница
 	}
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, http.ErrNotSupported
-		}
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return int(claims["sub"].(float64)), nil
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit < 1 {
+		limit = 10 // По умолчанию 10 записей на страницу
 	}
-	return 0, err
+	return page, limit
 }
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"notes-api/internal/models"
+	"notes-api/internal/services"
+	"strconv"
+)
+
+// GetNotifications @Summary Уведомления
+// @Description Возвращает уведомления пользователя (новые первыми) и количество непрочитанных.
+// @Description С параметром unread=true возвращаются только непрочитанные.
+// @Tags notifications
+// @Produce json
+// @Param unread query bool false "Только непрочитанные"
+// @Param page query int false "Номер страницы"
+// @Param limit query int false "Количество уведомлений на странице"
+// @Success 200 {object} models.NotificationList "Уведомления"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 500 {object} models.ErrorResponse "Ошибка при получении уведомлений"
+// @Router /notifications [get]
+// @Security Bearer
+func GetNotifications(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		page, limit := getPagination(c)
+		unreadOnly := c.Query("unread") == "true"
+		notificationService := services.NotificationService{DB: db, Ctx: c.Request.Context()}
+		list, err := notificationService.GetNotifications(userID, unreadOnly, page, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении уведомлений"})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// MarkNotificationRead @Summary Прочитать уведомление
+// @Description Отмечает уведомление прочитанным
+// @Tags notifications
+// @Produce json
+// @Param id path int true "ID уведомления"
+// @Success 200 {object} models.SuccessResponse "Уведомление прочитано"
+// @Failure 400 {object} models.ErrorResponse "id уведомления должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Уведомление не найдено"
+// @Router /notifications/{id}/read [post]
+// @Security Bearer
+func MarkNotificationRead(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		notificationID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id уведомления должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		notificationService := services.NotificationService{DB: db, Ctx: c.Request.Context()}
+		if err := notificationService.MarkRead(notificationID, userID); err != nil {
+			respondNoteError(c, err, "Ошибка при обновлении уведомления")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Уведомление прочитано"})
+	}
+}
+
+// MarkAllNotificationsRead @Summary Прочитать все уведомления
+// @Description Отмечает прочитанными все уведомления пользователя
+// @Tags notifications
+// @Produce json
+// @Success 200 {object} map[string]int64 "Количество отмеченных уведомлений"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 500 {object} models.ErrorResponse "Ошибка при обновлении уведомлений"
+// @Router /notifications/read-all [post]
+// @Security Bearer
+func MarkAllNotificationsRead(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		notificationService := services.NotificationService{DB: db, Ctx: c.Request.Context()}
+		marked, err := notificationService.MarkAllRead(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при обновлении уведомлений"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"marked": marked})
+	}
+}
+
+// GetNotificationPreferences @Summary Настройки уведомлений
+// @Description Возвращает включенные и отключенные типы уведомлений: share_granted, invitation_received,
+// @Description comment_added, mention, note_updated. По умолчанию все типы включены.
+// @Tags notifications
+// @Produce json
+// @Success 200 {object} models.NotificationPreferences "Настройки уведомлений"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 500 {object} models.ErrorResponse "Ошибка при получении настроек"
+// @Router /notifications/preferences [get]
+// @Security Bearer
+func GetNotificationPreferences(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		notificationService := services.NotificationService{DB: db, Ctx: c.Request.Context()}
+		preferences, err := notificationService.GetPreferences(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении настроек"})
+			return
+		}
+		c.JSON(http.StatusOK, preferences)
+	}
+}
+
+// UpdateNotificationPreferences @Summary Изменение настроек уведомлений
+// @Description Включает или отключает уведомления указанных типов. Не указанные типы не меняются.
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param preferences body models.NotificationPreferences true "Тип уведомления и признак включения"
+// @Success 200 {object} models.NotificationPreferences "Обновленные настройки"
+// @Failure 400 {object} models.ErrorResponse "Неизвестный тип уведомления"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Router /notifications/preferences [put]
+// @Security Bearer
+func UpdateNotificationPreferences(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var preferences models.NotificationPreferences
+		if err := c.ShouldBindJSON(&preferences); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		notificationService := services.NotificationService{DB: db, Ctx: c.Request.Context()}
+		updated, err := notificationService.UpdatePreferences(userID, preferences)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при обновлении настроек")
+			return
+		}
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+// FollowNote @Summary Подписка на заметку
+// @Description Подписывает пользователя на уведомления об изменениях и комментариях заметки
+// @Tags notifications
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Success 200 {object} models.SuccessResponse "Подписка оформлена"
+// @Failure 400 {object} models.ErrorResponse "id заметки должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Заметка не найдена"
+// @Router /notes/{id}/follow [post]
+// @Security Bearer
+func FollowNote(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		notificationService := services.NotificationService{DB: db, Ctx: c.Request.Context()}
+		if err := notificationService.Follow(noteID, userID); err != nil {
+			respondNoteError(c, err, "Ошибка при оформлении подписки")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Подписка оформлена"})
+	}
+}
+
+// UnfollowNote @Summary Отмена подписки на заметку
+// @Description Отписывает пользователя от уведомлений об изменениях заметки
+// @Tags notifications
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Success 200 {object} models.SuccessResponse "Подписка отменена"
+// @Failure 400 {object} models.ErrorResponse "id заметки должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Router /notes/{id}/follow [delete]
+// @Security Bearer
+func UnfollowNote(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		notificationService := services.NotificationService{DB: db, Ctx: c.Request.Context()}
+		if err := notificationService.Unfollow(noteID, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при отмене подписки"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Подписка отменена"})
+	}
+}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"notes-api/internal/models"
+	"notes-api/internal/services"
+	"strconv"
+	"time"
+)
+
+// GetNoteReminders @Summary Напоминания о заметке
+// @Description Возвращает напоминания текущего пользователя о заметке и пунктах ее списка задач
+// @Tags reminders
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Success 200 {array} models.Reminder "Напоминания"
+// @Failure 400 {object} models.ErrorResponse "id заметки должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Заметка не найдена"
+// @Router /notes/{id}/reminders [get]
+// @Security Bearer
+func GetNoteReminders(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		reminderService := services.ReminderService{DB: db, Ctx: c.Request.Context()}
+		reminders, err := reminderService.GetNoteReminders(noteID, userID)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при получении напоминаний")
+			return
+		}
+		c.JSON(http.StatusOK, reminders)
+	}
+}
+
+// CreateReminder @Summary Создание напоминания
+// @Description Создает напоминание о заметке или пункте ее списка задач (checklist_item_id). rrule задает
+// @Description повторение в формате RFC 5545, например FREQ=WEEKLY;BYDAY=MO. Каналы доставки: notification
+// @Description (по умолчанию), email и webhook (событие reminder.fired вебхуков владельца заметки).
+// @Tags reminders
+// @Accept json
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Param reminder body models.CreateReminderRequest true "Напоминание"
+// @Success 201 {object} models.Reminder "Созданное напоминание"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Заметка или пункт не найдены"
+// @Router /notes/{id}/reminders [post]
+// @Security Bearer
+func CreateReminder(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		var request models.CreateReminderRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		reminderService := services.ReminderService{DB: db, Ctx: c.Request.Context()}
+		reminder, err := reminderService.CreateReminder(noteID, userID, request)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при создании напоминания")
+			return
+		}
+		c.JSON(http.StatusCreated, reminder)
+	}
+}
+
+// UpdateReminder @Summary Изменение напоминания
+// @Description Меняет время, повторение, текст или каналы напоминания; пустой rrule отменяет повторение
+// @Tags reminders
+// @Accept json
+// @Produce json
+// @Param id path int true "ID напоминания"
+// @Param reminder body models.UpdateReminderRequest true "Изменяемые поля"
+// @Success 200 {object} models.Reminder "Обновленное напоминание"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Напоминание не найдено"
+// @Router /reminders/{id} [put]
+// @Security Bearer
+func UpdateReminder(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reminderID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id напоминания должен быть формата int"})
+			return
+		}
+		var request models.UpdateReminderRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		reminderService := services.ReminderService{DB: db, Ctx: c.Request.Context()}
+		reminder, err := reminderService.UpdateReminder(reminderID, userID, request)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при изменении напоминания")
+			return
+		}
+		c.JSON(http.StatusOK, reminder)
+	}
+}
+
+// DeleteReminder @Summary Удаление напоминания
+// @Description Удаляет напоминание текущего пользователя
+// @Tags reminders
+// @Produce json
+// @Param id path int true "ID напоминания"
+// @Success 200 {object} models.SuccessResponse "Напоминание удалено"
+// @Failure 400 {object} models.ErrorResponse "id напоминания должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Напоминание не найдено"
+// @Router /reminders/{id} [delete]
+// @Security Bearer
+func DeleteReminder(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reminderID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id напоминания должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		reminderService := services.ReminderService{DB: db, Ctx: c.Request.Context()}
+		if err := reminderService.DeleteReminder(reminderID, userID); err != nil {
+			respondNoteError(c, err, "Ошибка при удалении напоминания")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Напоминание удалено"})
+	}
+}
+
+// SnoozeReminder @Summary Откладывание напоминания
+// @Description Переносит ближайшее срабатывание на minutes минут или до момента until
+// @Tags reminders
+// @Accept json
+// @Produce json
+// @Param id path int true "ID напоминания"
+// @Param snooze body models.SnoozeReminderRequest true "На сколько отложить"
+// @Success 200 {object} models.Reminder "Отложенное напоминание"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Напоминание не найдено"
+// @Router /reminders/{id}/snooze [post]
+// @Security Bearer
+func SnoozeReminder(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reminderID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id напоминания должен быть формата int"})
+			return
+		}
+		var request models.SnoozeReminderRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		reminderService := services.ReminderService{DB: db, Ctx: c.Request.Context()}
+		reminder, err := reminderService.Snooze(reminderID, userID, request)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при откладывании напоминания")
+			return
+		}
+		c.JSON(http.StatusOK, reminder)
+	}
+}
+
+// GetUpcomingReminders @Summary Ближайшие напоминания
+// @Description Возвращает напоминания текущего пользователя, которые сработают в ближайшие days дней
+// @Description (по умолчанию 7, не больше 90), и доступные ему заметки со сроком в этом периоде
+// @Tags reminders
+// @Produce json
+// @Param days query int false "Период в днях"
+// @Success 200 {object} models.UpcomingReminders "Ближайшие напоминания и сроки"
+// @Failure 400 {object} models.ErrorResponse "Некорректный период"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Router /reminders/upcoming [get]
+// @Security Bearer
+func GetUpcomingReminders(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+		if err != nil || days < 1 || days > 90 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days должен быть числом от 1 до 90"})
+			return
+		}
+		reminderService := services.ReminderService{DB: db, Ctx: c.Request.Context()}
+		upcoming, err := reminderService.Upcoming(userID, time.Now().AddDate(0, 0, days))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении напоминаний"})
+			return
+		}
+		c.JSON(http.StatusOK, upcoming)
+	}
+}
+
+// SetNoteDue @Summary Срок заметки
+// @Description Устанавливает срок заметки; due_at = null снимает срок. Требуется доступ не ниже editor.
+// @Tags reminders
+// @Accept json
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Param input body models.SetDueRequest true "Срок"
+// @Success 200 {object} models.SuccessResponse "Срок заметки изменен"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Заметка не найдена"
+// @Router /notes/{id}/due [put]
+// @Security Bearer
+func SetNoteDue(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		var request models.SetDueRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		noteService := services.NoteService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := noteService.SetDue(noteID, userID, request.DueAt); err != nil {
+			respondNoteError(c, err, "Ошибка при изменении срока заметки")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Срок заметки изменен"})
+	}
+}
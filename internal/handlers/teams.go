@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"notes-api/internal/models"
+	"notes-api/internal/services"
+	"strconv"
+)
+
+// CreateTeam @Summary Создание команды
+// @Description Создает команду, текущий пользователь становится ее владельцем
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param team body models.Team true "Команда"
+// @Success 201 {object} models.Team "Созданная команда"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Router /teams [post]
+// @Security Bearer
+func CreateTeam(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var team models.Team
+		if err := c.ShouldBindJSON(&team); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		teamService := services.TeamService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := teamService.CreateTeam(&team, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при создании команды"})
+			return
+		}
+		c.JSON(http.StatusCreated, team)
+	}
+}
+
+// GetTeams @Summary Список команд
+// @Description Возвращает команды, в которых состоит пользователь, с его ролью
+// @Tags teams
+// @Produce json
+// @Success 200 {array} models.Team "Список команд"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Router /teams [get]
+// @Security Bearer
+func GetTeams(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		teamService := services.TeamService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		teams, err := teamService.GetTeams(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении команд"})
+			return
+		}
+		c.JSON(http.StatusOK, teams)
+	}
+}
+
+// GetTeam @Summary Получение команды
+// @Description Возвращает команду со списком участников
+// @Tags teams
+// @Produce json
+// @Param id path int true "ID команды"
+// @Success 200 {object} models.Team "Команда"
+// @Failure 400 {object} models.ErrorResponse "id команды должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Команда не найдена"
+// @Router /teams/{id} [get]
+// @Security Bearer
+func GetTeam(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamID, userID, ok := teamRequest(c)
+		if !ok {
+			return
+		}
+		teamService := services.TeamService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		team, err := teamService.GetTeam(teamID, userID)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при получении команды")
+			return
+		}
+		c.JSON(http.StatusOK, team)
+	}
+}
+
+// RenameTeam @Summary Переименование команды
+// @Description Меняет название команды. Доступно владельцам и администраторам команды.
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param id path int true "ID команды"
+// @Param team body models.Team true "Команда с новым названием"
+// @Success 200 {object} models.SuccessResponse "Команда переименована"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 403 {object} models.ErrorResponse "Недостаточно прав в команде"
+// @Failure 404 {object} models.ErrorResponse "Команда не найдена"
+// @Router /teams/{id} [put]
+// @Security Bearer
+func RenameTeam(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamID, userID, ok := teamRequest(c)
+		if !ok {
+			return
+		}
+		var team models.Team
+		if err := c.ShouldBindJSON(&team); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		teamService := services.TeamService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := teamService.RenameTeam(teamID, userID, team.Name); err != nil {
+			respondNoteError(c, err, "Ошибка при переименовании команды")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Команда переименована"})
+	}
+}
+
+// DeleteTeam @Summary Удаление команды
+// @Description Удаляет команду вместе с ее заметками, блокнотами и тегами. Доступно только владельцам.
+// @Tags teams
+// @Produce json
+// @Param id path int true "ID команды"
+// @Success 200 {object} models.SuccessResponse "Команда удалена"
+// @Failure 403 {object} models.ErrorResponse "Недостаточно прав в команде"
+// @Failure 404 {object} models.ErrorResponse "Команда не найдена"
+// @Router /teams/{id} [delete]
+// @Security Bearer
+func DeleteTeam(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamID, userID, ok := teamRequest(c)
+		if !ok {
+			return
+		}
+		teamService := services.TeamService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := teamService.DeleteTeam(teamID, userID); err != nil {
+			respondNoteError(c, err, "Ошибка при удалении команды")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Команда удалена"})
+	}
+}
+
+// AddTeamMember @Summary Добавление участника команды
+// @Description Добавляет пользователя в команду по user_id или username с ролью owner, admin, member (по умолчанию) или guest
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param id path int true "ID команды"
+// @Param member body models.AddTeamMemberRequest true "Участник"
+// @Success 201 {object} models.TeamMember "Добавленный участник"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 403 {object} models.ErrorResponse "Недостаточно прав в команде"
+// @Failure 404 {object} models.ErrorResponse "Команда или пользователь не найдены"
+// @Failure 409 {object} models.ErrorResponse "Пользователь уже состоит в команде"
+// @Router /teams/{id}/members [post]
+// @Security Bearer
+func AddTeamMember(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamID, userID, ok := teamRequest(c)
+		if !ok {
+			return
+		}
+		var request models.AddTeamMemberRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if request.UserID == 0 && request.Username == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите user_id или username"})
+			return
+		}
+		teamService := services.TeamService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		member, err := teamService.AddMember(teamID, userID, request)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при добавлении участника")
+			return
+		}
+		c.JSON(http.StatusCreated, member)
+	}
+}
+
+// UpdateTeamMember @Summary Смена роли участника команды
+// @Description Меняет роль участника. Назначать владельцев и менять роли администраторов может только владелец.
+// @Tags teams
+// @Accept json
+// @Produce json
+// @Param id path int true "ID команды"
+// @Param user_id path int true "ID участника"
+// @Param member body models.UpdateTeamMemberRequest true "Новая роль"
+// @Success 200 {object} models.SuccessResponse "Роль изменена"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 403 {object} models.ErrorResponse "Недостаточно прав в команде"
+// @Failure 404 {object} models.ErrorResponse "Команда или участник не найдены"
+// @Router /teams/{id}/members/{user_id} [put]
+// @Security Bearer
+func UpdateTeamMember(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamID, userID, ok := teamRequest(c)
+		if !ok {
+			return
+		}
+		memberID, err := strconv.Atoi(c.Param("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id пользователя должен быть формата int"})
+			return
+		}
+		var request models.UpdateTeamMemberRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		teamService := services.TeamService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := teamService.UpdateMemberRole(teamID, userID, memberID, request.Role); err != nil {
+			respondNoteError(c, err, "Ошибка при смене роли участника")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Роль изменена"})
+	}
+}
+
+// RemoveTeamMember @Summary Исключение участника команды
+// @Description Исключает участника из команды. Участник может покинуть команду сам.
+// @Tags teams
+// @Produce json
+// @Param id path int true "ID команды"
+// @Param user_id path int true "ID участника"
+// @Success 200 {object} models.SuccessResponse "Участник исключен"
+// @Failure 400 {object} models.ErrorResponse "В команде должен остаться владелец"
+// @Failure 403 {object} models.ErrorResponse "Недостаточно прав в команде"
+// @Failure 404 {object} models.ErrorResponse "Команда или участник не найдены"
+// @Router /teams/{id}/members/{user_id} [delete]
+// @Security Bearer
+func RemoveTeamMember(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamID, userID, ok := teamRequest(c)
+		if !ok {
+			return
+		}
+		memberID, err := strconv.Atoi(c.Param("user_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id пользователя должен быть формата int"})
+			return
+		}
+		teamService := services.TeamService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := teamService.RemoveMember(teamID, userID, memberID); err != nil {
+			respondNoteError(c, err, "Ошибка при исключении участника")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Участник исключен из команды"})
+	}
+}
+
+// GetTeamNotes @Summary Заметки команды
+// @Description Возвращает заметки, принадлежащие команде, и заметки, к которым команде выдан доступ
+// @Tags teams
+// @Produce json
+// @Param id path int true "ID команды"
+// @Param page query int false "Номер страницы"
+// @Param limit query int false "Количество заметок на странице"
+// @Success 200 {array} models.Note "Список заметок"
+// @Failure 404 {object} models.ErrorResponse "Команда не найдена"
+// @Failure 500 {object} models.ErrorResponse "Внутренняя ошибка сервера"
+// @Router /teams/{id}/notes [get]
+// @Security Bearer
+func GetTeamNotes(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamID, userID, ok := teamRequest(c)
+		if !ok {
+			return
+		}
+		page, limit := getPagination(c)
+		teamService := services.TeamService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		notes, err := teamService.GetTeamNotes(teamID, userID, page, limit)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при получении заметок команды")
+			return
+		}
+		noteService := services.NoteService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		for i := range notes {
+			if notes[i].Tags, err = noteService.GetTagsForNote(notes[i].ID); err != nil {
+				c.Error(err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении тегов"})
+				return
+			}
+		}
+		c.JSON(http.StatusOK, notes)
+	}
+}
+
+// GetTeamTags @Summary Теги команды
+// @Description Возвращает теги из пространства имен команды
+// @Tags teams
+// @Produce json
+// @Param id path int true "ID команды"
+// @Success 200 {array} models.Tag "Список тегов"
+// @Failure 404 {object} models.ErrorResponse "Команда не найдена"
+// @Router /teams/{id}/tags [get]
+// @Security Bearer
+func GetTeamTags(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		teamID, userID, ok := teamRequest(c)
+		if !ok {
+			return
+		}
+		teamService := services.TeamService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		tags, err := teamService.GetTeamTags(teamID, userID)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при получении тегов команды")
+			return
+		}
+		c.JSON(http.StatusOK, tags)
+	}
+}
+
+// ShareNoteWithTeam @Summary Передача доступа к заметке команде
+// @Description Делает заметку доступной всем участникам команды с уровнем доступа viewer (по умолчанию), commenter или editor.
+// @Description Гости команды получают только просмотр.
+// @Tags notes
+// @Accept json
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Param requestBody body models.ShareNoteWithTeamRequest true "Команда и уровень доступа"
+// @Success 200 {object} models.SuccessResponse "Доступ передан"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Заметка или команда не найдены"
+// @Router /notes/{id}/share-team [post]
+// @Security Bearer
+func ShareNoteWithTeam(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		var request models.ShareNoteWithTeamRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		teamService := services.TeamService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := teamService.ShareNoteWithTeam(noteID, userID, request); err != nil {
+			respondNoteError(c, err, "Ошибка при передаче доступа команде")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Доступ к заметке передан команде"})
+	}
+}
+
+// UnshareNoteWithTeam @Summary Отзыв доступа команды к заметке
+// @Description Отзывает доступ, выданный команде
+// @Tags notes
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Param team_id path int true "ID команды"
+// @Success 200 {object} models.SuccessResponse "Доступ отозван"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Заметка не найдена"
+// @Router /notes/{id}/share-team/{team_id} [delete]
+// @Security Bearer
+func UnshareNoteWithTeam(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		teamID, err := strconv.Atoi(c.Param("team_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id команды должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		teamService := services.TeamService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := teamService.UnshareNoteWithTeam(noteID, teamID, userID); err != nil {
+			respondNoteError(c, err, "Ошибка при отзыве доступа команды")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Доступ команды к заметке отозван"})
+	}
+}
+
+// teamRequest извлекает ID команды из пути и пользователя из токена, при ошибке отвечает клиенту
+func teamRequest(c *gin.Context) (int, int, bool) {
+	teamID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id команды должен быть формата int"})
+		return 0, 0, false
+	}
+	userID, err := getUserIDFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+		return 0, 0, false
+	}
+	return teamID, userID, true
+}
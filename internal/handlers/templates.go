@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"notes-api/internal/models"
+	"notes-api/internal/services"
+	"strconv"
+)
+
+// GetTemplates @Summary Шаблоны заметок
+// @Description Возвращает личные шаблоны пользователя и шаблоны его команд
+// @Tags templates
+// @Produce json
+// @Success 200 {array} models.NoteTemplate "Шаблоны"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Router /templates [get]
+// @Security Bearer
+func GetTemplates(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		templateService := services.TemplateService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		templates, err := templateService.GetTemplates(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении шаблонов"})
+			return
+		}
+		c.JSON(http.StatusOK, templates)
+	}
+}
+
+// GetTemplate @Summary Шаблон заметки
+// @Description Возвращает шаблон и список переменных {{prompt:Имя}}, значения которых нужно передать при создании заметки
+// @Tags templates
+// @Produce json
+// @Param id path int true "ID шаблона"
+// @Success 200 {object} models.NoteTemplate "Шаблон"
+// @Failure 400 {object} models.ErrorResponse "id шаблона должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Шаблон не найден"
+// @Router /templates/{id} [get]
+// @Security Bearer
+func GetTemplate(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		templateID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id шаблона должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		templateService := services.TemplateService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		template, err := templateService.GetTemplate(templateID, userID)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при получении шаблона")
+			return
+		}
+		c.JSON(http.StatusOK, template)
+	}
+}
+
+// CreateTemplate @Summary Создание шаблона
+// @Description Создает личный шаблон или шаблон команды (team_id, роль не ниже member). Название и содержимое
+// @Description могут содержать переменные {{date}}, {{time}}, {{datetime}}, {{user}} и {{prompt:Имя}}.
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Param template body models.CreateTemplateRequest true "Шаблон"
+// @Success 201 {object} models.NoteTemplate "Созданный шаблон"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Команда или блокнот не найдены"
+// @Router /templates [post]
+// @Security Bearer
+func CreateTemplate(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request models.CreateTemplateRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		templateService := services.TemplateService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		template, err := templateService.CreateTemplate(userID, request)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при создании шаблона")
+			return
+		}
+		c.JSON(http.StatusCreated, template)
+	}
+}
+
+// UpdateTemplate @Summary Изменение шаблона
+// @Description Меняет шаблон; notebook_id = 0 убирает блокнот по умолчанию
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Param id path int true "ID шаблона"
+// @Param template body models.UpdateTemplateRequest true "Изменяемые поля"
+// @Success 200 {object} models.NoteTemplate "Обновленный шаблон"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Шаблон не найден"
+// @Router /templates/{id} [put]
+// @Security Bearer
+func UpdateTemplate(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		templateID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id шаблона должен быть формата int"})
+			return
+		}
+		var request models.UpdateTemplateRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		templateService := services.TemplateService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		template, err := templateService.UpdateTemplate(templateID, userID, request)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при изменении шаблона")
+			return
+		}
+		c.JSON(http.StatusOK, template)
+	}
+}
+
+// DeleteTemplate @Summary Удаление шаблона
+// @Description Удаляет шаблон; созданные по нему заметки остаются
+// @Tags templates
+// @Produce json
+// @Param id path int true "ID шаблона"
+// @Success 200 {object} models.SuccessResponse "Шаблон удален"
+// @Failure 400 {object} models.ErrorResponse "id шаблона должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Шаблон не найден"
+// @Router /templates/{id} [delete]
+// @Security Bearer
+func DeleteTemplate(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		templateID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id шаблона должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		templateService := services.TemplateService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := templateService.DeleteTemplate(templateID, userID); err != nil {
+			respondNoteError(c, err, "Ошибка при удалении шаблона")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Шаблон удален"})
+	}
+}
+
+// CreateNoteFromTemplate @Summary Создание заметки по шаблону
+// @Description Создает заметку по шаблону, подставляя переменные. Значения {{prompt:Имя}} передаются в values,
+// @Description {{date}} и {{time}} вычисляются в часовом поясе timezone. Заметка по шаблону команды принадлежит команде.
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Param id path int true "ID шаблона"
+// @Param input body models.InstantiateTemplateRequest false "Значения переменных"
+// @Success 201 {object} models.Note "Созданная заметка"
+// @Failure 400 {object} models.ErrorResponse "Не передано значение переменной"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Шаблон не найден"
+// @Router /notes/from-template/{id} [post]
+// @Security Bearer
+func CreateNoteFromTemplate(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		templateID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id шаблона должен быть формата int"})
+			return
+		}
+		var request models.InstantiateTemplateRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		templateService := services.TemplateService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		note, err := templateService.Instantiate(templateID, userID, request)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при создании заметки по шаблону")
+			return
+		}
+		c.JSON(http.StatusCreated, note)
+	}
+}
+
+// GetDailyNote @Summary Ежедневная заметка
+// @Description Возвращает личную заметку за сегодняшнюю дату в часовом поясе timezone. Если ее еще нет,
+// @Description создает ее (по шаблону template_id, если он указан) и отвечает 201.
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Param input body models.DailyNoteRequest false "Шаблон и часовой пояс"
+// @Success 200 {object} models.Note "Существующая заметка за сегодня"
+// @Success 201 {object} models.Note "Созданная заметка за сегодня"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Шаблон не найден"
+// @Router /notes/daily [post]
+// @Security Bearer
+func GetDailyNote(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request models.DailyNoteRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		templateService := services.TemplateService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		note, created, err := templateService.DailyNote(userID, request)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при получении ежедневной заметки")
+			return
+		}
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		c.JSON(status, note)
+	}
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"notes-api/internal/models"
+	"notes-api/internal/services"
+	"strconv"
+)
+
+// TransferNote @Summary Передача права владения заметкой
+// @Description Предлагает пользователю стать владельцем заметки. После принятия предложения прежний владелец
+// @Description остается редактором заметки.
+// @Tags notes
+// @Accept json
+// @Produce json
+// @Param id path int true "ID заметки"
+// @Param requestBody body models.TransferNoteRequest true "Новый владелец"
+// @Success 201 {object} models.NoteTransfer "Предложение передачи"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 403 {object} models.ErrorResponse "Запрещено"
+// @Failure 404 {object} models.ErrorResponse "Заметка или пользователь не найдены"
+// @Router /notes/{id}/transfer [post]
+// @Security Bearer
+func TransferNote(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id заметки должен быть формата int"})
+			return
+		}
+		var request models.TransferNoteRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		transferService := services.TransferService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		transfer, err := transferService.OfferTransfer(noteID, userID, request)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при передаче заметки")
+			return
+		}
+		c.JSON(http.StatusCreated, transfer)
+	}
+}
+
+// GetTransfers @Summary Предложения передачи заметок
+// @Description Возвращает входящие и исходящие предложения передачи права владения, ожидающие ответа
+// @Tags transfers
+// @Produce json
+// @Success 200 {array} models.NoteTransfer "Список предложений"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Router /transfers [get]
+// @Security Bearer
+func GetTransfers(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		transferService := services.TransferService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		transfers, err := transferService.GetTransfers(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении предложений передачи"})
+			return
+		}
+		c.JSON(http.StatusOK, transfers)
+	}
+}
+
+// AcceptTransfer @Summary Принятие заметки во владение
+// @Description Принимает предложение передачи: пользователь становится владельцем заметки
+// @Tags transfers
+// @Produce json
+// @Param id path int true "ID предложения"
+// @Success 200 {object} models.NoteTransfer "Принятое предложение"
+// @Failure 400 {object} models.ErrorResponse "id предложения должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Предложение не найдено"
+// @Router /transfers/{id}/accept [post]
+// @Security Bearer
+func AcceptTransfer(db *sql.DB) gin.HandlerFunc {
+	return respondTransfer(db, true)
+}
+
+// DeclineTransfer @Summary Отказ от владения заметкой
+// @Description Отклоняет предложение передачи права владения
+// @Tags transfers
+// @Produce json
+// @Param id path int true "ID предложения"
+// @Success 200 {object} models.NoteTransfer "Отклоненное предложение"
+// @Failure 400 {object} models.ErrorResponse "id предложения должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Предложение не найдено"
+// @Router /transfers/{id}/decline [post]
+// @Security Bearer
+func DeclineTransfer(db *sql.DB) gin.HandlerFunc {
+	return respondTransfer(db, false)
+}
+
+func respondTransfer(db *sql.DB, accept bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transferID, userID, ok := transferRequest(c)
+		if !ok {
+			return
+		}
+		transferService := services.TransferService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		transfer, err := transferService.Respond(transferID, userID, accept)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при ответе на предложение передачи")
+			return
+		}
+		c.JSON(http.StatusOK, transfer)
+	}
+}
+
+// CancelTransfer @Summary Отзыв предложения передачи
+// @Description Отзывает предложение передачи заметки, пока получатель на него не ответил
+// @Tags transfers
+// @Produce json
+// @Param id path int true "ID предложения"
+// @Success 200 {object} models.SuccessResponse "Предложение отозвано"
+// @Failure 400 {object} models.ErrorResponse "id предложения должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Предложение не найдено"
+// @Router /transfers/{id} [delete]
+// @Security Bearer
+func CancelTransfer(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transferID, userID, ok := transferRequest(c)
+		if !ok {
+			return
+		}
+		transferService := services.TransferService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := transferService.Cancel(transferID, userID); err != nil {
+			respondNoteError(c, err, "Ошибка при отзыве предложения передачи")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Предложение передачи отозвано"})
+	}
+}
+
+// transferRequest извлекает ID предложения из пути и пользователя из токена, при ошибке отвечает клиенту
+func transferRequest(c *gin.Context) (int, int, bool) {
+	transferID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id предложения должен быть формата int"})
+		return 0, 0, false
+	}
+	userID, err := getUserIDFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+		return 0, 0, false
+	}
+	return transferID, userID, true
+}
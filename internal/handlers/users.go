@@ -2,16 +2,17 @@ package handlers
 
 import (
 	"database/sql"
-	"github.com/dgrijalva/jwt-go"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"notes-api/internal/config"
 	"notes-api/internal/models"
 	"notes-api/internal/services"
-	"os"
 )
 
 // RegisterUser  @Summary Регистрация пользователя
-// @Description Регистрирует нового пользователя
+// @Description Регистрирует нового пользователя. Если указан email, на него отправляется код подтверждения.
+// @Description Приглашения, отправленные на этот адрес, переходят к пользователю после подтверждения email.
 // @Tags users
 // @Accept json
 // @Produce json
@@ -21,23 +22,23 @@ import (
 // @Failure 409 {object} models.ErrorResponse "Пользователь с таким именем уже существует"
 // @Failure 500 {object} models.ErrorResponse "Внутренняя ошибка сервера"
 // @Router /register [post]
-func RegisterUser(db *sql.DB) gin.HandlerFunc {
+func RegisterUser(db *sql.DB, smtp config.SMTPConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var user models.User
 		if err := c.ShouldBindJSON(&user); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		userService := services.UserService{DB: db}
+		userService := services.UserService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c), SMTP: smtp}
 		if err := userService.RegisterUser(&user); err != nil {
-			if err.Error() == "пользователь с таким именем уже существует" {
+			if err.Error() == "пользователь с таким именем уже существует" || errors.Is(err, services.ErrEmailTaken) {
 				c.JSON(http.StatusConflict, gin.H{"error": err.Error()}) // Используем статус 409
 				return
 			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при регистрации пользователя"})
 			return
 		}
-		c.JSON(http.StatusCreated, gin.H{"id": user.ID, "username": user.Username, "created_at": user.CreatedAt})
+		c.JSON(http.StatusCreated, gin.H{"id": user.ID, "username": user.Username, "email": user.Email, "created_at": user.CreatedAt})
 	}
 }
 
@@ -50,22 +51,27 @@ func RegisterUser(db *sql.DB) gin.HandlerFunc {
 // @Success 200 {object} models.ErrorResponse "Успешно аутентифицирован"
 // @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
 // @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 403 {object} models.ErrorResponse "Учетная запись заблокирована"
 // @Router /login [post]
-func LoginUser(db *sql.DB) gin.HandlerFunc {
+func LoginUser(db *sql.DB, session Session) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var user models.User
 		if err := c.ShouldBindJSON(&user); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		userService := services.UserService{DB: db}
-		token, err := userService.LoginUser(&user)
+		userService := services.UserService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		token, err := userService.LoginUser(&user, session.Secret)
 		if err != nil {
+			if errors.Is(err, services.ErrUserDisabled) {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
 			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			return
 		}
 		// Установите cookie с токеном
-		c.SetCookie("tokenJWT", token, 3600, "/", "localhost", false, true)
+		session.setCookie(c, token, 3600)
 		c.JSON(http.StatusOK, gin.H{"message": "Успешная аутентификация"})
 	}
 }
@@ -82,28 +88,158 @@ func LoginUser(db *sql.DB) gin.HandlerFunc {
 // @Router /profile [get]
 func GetProfile(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenString, err := c.Cookie("tokenJWT")
+		userID, err := getUserIDFromToken(c)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Требуется токен аутентификации"})
 			return
 		}
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, http.ErrNotSupported
+		userService := services.UserService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		userProfile, err := userService.GetUserByID(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Ошибка при получении профиля"})
+			return
+		}
+		c.JSON(http.StatusOK, userProfile)
+	}
+}
+
+// VerifyEmail @Summary Подтверждение email
+// @Description Подтверждает email кодом из письма. К пользователю переходят приглашения, отправленные на этот адрес.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param input body models.VerifyEmailRequest true "Код подтверждения"
+// @Success 200 {object} models.SuccessResponse "Email подтвержден"
+// @Failure 400 {object} models.ErrorResponse "Код подтверждения неверен или устарел"
+// @Failure 500 {object} models.ErrorResponse "Внутренняя ошибка сервера"
+// @Router /verify-email [post]
+func VerifyEmail(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request models.VerifyEmailRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userService := services.UserService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := userService.VerifyEmail(request.Token); err != nil {
+			if errors.Is(err, services.ErrInvalidVerificationToken) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при подтверждении email"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Email подтвержден"})
+	}
+}
+
+// ResendEmailVerification @Summary Повторная отправка кода подтверждения email
+// @Description Отправляет на email пользователя новый код подтверждения. Прежние коды перестают действовать.
+// @Tags users
+// @Produce json
+// @Success 202 {object} models.SuccessResponse "Письмо отправлено"
+// @Failure 400 {object} models.ErrorResponse "Email не указан"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 409 {object} models.ErrorResponse "Email уже подтвержден"
+// @Failure 503 {object} models.ErrorResponse "Отправка почты не настроена"
+// @Router /profile/email/verification [post]
+// @Security Bearer
+func ResendEmailVerification(db *sql.DB, smtp config.SMTPConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		userService := services.UserService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c), SMTP: smtp}
+		if err := userService.SendEmailVerification(userID); err != nil {
+			switch {
+			case errors.Is(err, services.ErrNoEmail):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case errors.Is(err, services.ErrEmailAlreadyVerified):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			case errors.Is(err, services.ErrMailNotConfigured):
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при отправке письма"})
+			}
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "Письмо с кодом подтверждения отправлено"})
+	}
+}
+
+// DeleteProfile @Summary Удаление аккаунта
+// @Description Планирует удаление аккаунта после подтверждения паролем. В течение 30 дней удаление можно отменить.
+// @Description Политика shared_notes_policy определяет судьбу заметок, к которым есть доступ у других пользователей:
+// @Description transfer (по умолчанию) передает их первому пользователю с доступом, delete удаляет их.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param input body models.DeleteAccountRequest true "Подтверждение удаления"
+// @Success 202 {object} models.SuccessResponse "Удаление запланировано"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 403 {object} models.ErrorResponse "Неверный пароль"
+// @Router /profile [delete]
+// @Security Bearer
+func DeleteProfile(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request models.DeleteAccountRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		userService := services.UserService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		scheduledAt, err := userService.RequestAccountDeletion(userID, request.Password, request.SharedNotesPolicy)
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrInvalidSharedNotesPolicy):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case errors.Is(err, services.ErrInvalidPassword):
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при удалении аккаунта"})
 			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
+			return
+		}
+		c.JSON(http.StatusAccepted, models.SuccessResponse{
+			Message: "Аккаунт будет удален, до этого момента удаление можно отменить",
+			Data:    gin.H{"deletion_scheduled_at": scheduledAt},
 		})
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			userID := int(claims["sub"].(float64))
-			userService := services.UserService{DB: db}
-			userProfile, err := userService.GetUserByID(userID)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Ошибка при получении профиля"})
+	}
+}
+
+// CancelProfileDeletion @Summary Отмена удаления аккаунта
+// @Description Отменяет запрошенное ранее удаление аккаунта
+// @Tags users
+// @Produce json
+// @Success 200 {object} models.SuccessResponse "Удаление отменено"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Удаление аккаунта не запрошено"
+// @Router /profile/deletion [delete]
+// @Security Bearer
+func CancelProfileDeletion(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		userService := services.UserService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := userService.CancelAccountDeletion(userID); err != nil {
+			if errors.Is(err, services.ErrDeletionNotRequested) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 				return
 			}
-			c.JSON(http.StatusOK, userProfile)
-		} else {
-			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Неверный токен"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при отмене удаления аккаунта"})
+			return
 		}
+		c.JSON(http.StatusOK, gin.H{"message": "Удаление аккаунта отменено"})
 	}
 }
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"notes-api/internal/models"
+	"notes-api/internal/services"
+	"strconv"
+)
+
+// CreateWebhook @Summary Создание вебхука
+// @Description Подписывает url на события заметок: note.created, note.updated, note.deleted, note.shared, tag.added.
+// @Description Без team_id вебхук получает события личных заметок пользователя, с team_id - заметок команды
+// @Description (требуется роль admin). Тело запроса подписывается HMAC-SHA256 секретом вебхука, подпись передается
+// @Description в заголовке X-Webhook-Signature в виде sha256=<hex>. Секрет возвращается только в этом ответе.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param webhook body models.CreateWebhookRequest true "Адрес и события"
+// @Success 201 {object} models.Webhook "Созданный вебхук с секретом"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 403 {object} models.ErrorResponse "Недостаточно прав в команде"
+// @Router /webhooks [post]
+// @Security Bearer
+func CreateWebhook(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request models.CreateWebhookRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		webhookService := services.WebhookService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		webhook, err := webhookService.CreateWebhook(userID, request)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при создании вебхука")
+			return
+		}
+		c.JSON(http.StatusCreated, webhook)
+	}
+}
+
+// GetWebhooks @Summary Список вебхуков
+// @Description Возвращает вебхуки пользователя и команд, в которых он администратор
+// @Tags webhooks
+// @Produce json
+// @Success 200 {array} models.Webhook "Вебхуки"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 500 {object} models.ErrorResponse "Ошибка при получении вебхуков"
+// @Router /webhooks [get]
+// @Security Bearer
+func GetWebhooks(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		webhookService := services.WebhookService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		webhooks, err := webhookService.GetWebhooks(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении вебхуков"})
+			return
+		}
+		c.JSON(http.StatusOK, webhooks)
+	}
+}
+
+// UpdateWebhook @Summary Изменение вебхука
+// @Description Меняет адрес и события вебхука, active=false приостанавливает отправку новых событий
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path int true "ID вебхука"
+// @Param webhook body models.UpdateWebhookRequest true "Изменяемые поля"
+// @Success 200 {object} models.Webhook "Обновленный вебхук"
+// @Failure 400 {object} models.ErrorResponse "Ошибка валидации"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Вебхук не найден"
+// @Router /webhooks/{id} [put]
+// @Security Bearer
+func UpdateWebhook(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhookID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id вебхука должен быть формата int"})
+			return
+		}
+		var request models.UpdateWebhookRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		webhookService := services.WebhookService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		webhook, err := webhookService.UpdateWebhook(webhookID, userID, request)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при обновлении вебхука")
+			return
+		}
+		c.JSON(http.StatusOK, webhook)
+	}
+}
+
+// DeleteWebhook @Summary Удаление вебхука
+// @Description Удаляет вебхук вместе с журналом доставки
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "ID вебхука"
+// @Success 200 {object} models.SuccessResponse "Вебхук удален"
+// @Failure 400 {object} models.ErrorResponse "id вебхука должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Вебхук не найден"
+// @Router /webhooks/{id} [delete]
+// @Security Bearer
+func DeleteWebhook(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhookID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id вебхука должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		webhookService := services.WebhookService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		if err := webhookService.DeleteWebhook(webhookID, userID); err != nil {
+			respondNoteError(c, err, "Ошибка при удалении вебхука")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Вебхук удален"})
+	}
+}
+
+// GetWebhookDeliveries @Summary Журнал доставки вебхука
+// @Description Возвращает отправленные и ожидающие отправки события: статус, число попыток, код ответа
+// @Description получателя и время следующей попытки. Неудачные попытки повторяются с экспоненциальной задержкой.
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "ID вебхука"
+// @Param page query int false "Номер страницы"
+// @Param limit query int false "Количество записей на странице"
+// @Success 200 {array} models.WebhookDelivery "Журнал доставки"
+// @Failure 400 {object} models.ErrorResponse "id вебхука должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Вебхук не найден"
+// @Router /webhooks/{id}/deliveries [get]
+// @Security Bearer
+func GetWebhookDeliveries(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhookID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id вебхука должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		page, limit := getPagination(c)
+		webhookService := services.WebhookService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		deliveries, err := webhookService.GetDeliveries(webhookID, userID, page, limit)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при получении журнала доставки")
+			return
+		}
+		c.JSON(http.StatusOK, deliveries)
+	}
+}
+
+// RedeliverWebhook @Summary Повторная доставка
+// @Description Ставит событие из журнала в очередь на повторную отправку с тем же телом
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "ID вебхука"
+// @Param delivery_id path int true "ID доставки"
+// @Success 202 {object} models.WebhookDelivery "Новая доставка"
+// @Failure 400 {object} models.ErrorResponse "id должен быть формата int"
+// @Failure 401 {object} models.ErrorResponse "Неавторизованный доступ"
+// @Failure 404 {object} models.ErrorResponse "Доставка не найдена"
+// @Router /webhooks/{id}/deliveries/{delivery_id}/redeliver [post]
+// @Security Bearer
+func RedeliverWebhook(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhookID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id вебхука должен быть формата int"})
+			return
+		}
+		deliveryID, err := strconv.Atoi(c.Param("delivery_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id доставки должен быть формата int"})
+			return
+		}
+		userID, err := getUserIDFromToken(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется токен аутентификации"})
+			return
+		}
+		webhookService := services.WebhookService{DB: db, Ctx: c.Request.Context(), Client: clientInfo(c)}
+		delivery, err := webhookService.Redeliver(webhookID, deliveryID, userID)
+		if err != nil {
+			respondNoteError(c, err, "Ошибка при повторной доставке")
+			return
+		}
+		c.JSON(http.StatusAccepted, delivery)
+	}
+}
@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+)
+
+// Setup настраивает журнал по умолчанию: JSON или текст, начиная с уровня level.
+// Записи, сделанные с контекстом запроса, дополняются его атрибутами: request_id, user_id, route.
+func Setup(w io.Writer, format string, level slog.Level) {
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewJSONHandler(w, options)
+	if format == "text" {
+		handler = slog.NewTextHandler(w, options)
+	}
+	slog.SetDefault(slog.New(contextHandler{handler}))
+}
+
+type attrsKey struct{}
+
+// With возвращает контекст, записи журнала с которым получат атрибуты attrs
+func With(ctx context.Context, attrs ...slog.Attr) context.Context {
+	previous, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	// Новый срез, чтобы не менять атрибуты родительского контекста
+	combined := make([]slog.Attr, 0, len(previous)+len(attrs))
+	combined = append(append(combined, previous...), attrs...)
+	return context.WithValue(ctx, attrsKey{}, combined)
+}
+
+// Attrs возвращает атрибуты, добавленные в контекст через With
+func Attrs(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+// contextHandler добавляет в запись атрибуты из контекста
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		record.AddAttrs(Attrs(ctx)...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
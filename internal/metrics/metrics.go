@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"database/sql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+// Registry - реестр метрик сервиса. Отдельный реестр вместо глобального,
+// чтобы в выдачу попадали только метрики, зарегистрированные здесь.
+var Registry = prometheus.NewRegistry()
+
+// Метрики HTTP-запросов. route - шаблон маршрута gin, например /notes/:id, чтобы число рядов не росло с ID.
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "notes_http_requests_total",
+		Help: "Число обработанных HTTP-запросов",
+	}, []string{"method", "route", "status"})
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "notes_http_request_duration_seconds",
+		Help:    "Время обработки HTTP-запросов",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// Метрики событий предметной области
+var (
+	NotesCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "notes_notes_created_total",
+		Help: "Число созданных заметок",
+	})
+	// stage: invited - отправлено приглашение к заметке, accepted - приглашение принято
+	Shares = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "notes_shares_total",
+		Help: "Число приглашений к заметкам и принятых приглашений",
+	}, []string{"stage"})
+	// result: success или failure
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "notes_logins_total",
+		Help: "Число попыток входа",
+	}, []string{"result"})
+	SearchDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "notes_search_duration_seconds",
+		Help:    "Время поиска заметок по тексту",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests, HTTPDuration, NotesCreated, Shares, Logins, SearchDuration,
+	)
+	// Ряды с нулевыми значениями видны до первого события, и rate() по ним считается сразу
+	for _, stage := range []string{"invited", "accepted"} {
+		Shares.WithLabelValues(stage)
+	}
+	for _, result := range []string{"success", "failure"} {
+		Logins.WithLabelValues(result)
+	}
+}
+
+// RegisterDB добавляет статистику пула соединений: открытые и занятые соединения, число и время ожидания
+func RegisterDB(db *sql.DB) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, "notes"))
+}
+
+// Handler отдает метрики в текстовом формате Prometheus
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// Роли пользователей
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// AdminUser - сведения о пользователе для администратора
+type AdminUser struct {
+	ID                  int        `json:"id"`
+	Username            string     `json:"username"`
+	Role                string     `json:"role"`
+	CreatedAt           time.Time  `json:"created_at"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	NotesCount          int        `json:"notes_count"`
+	StorageBytes        int64      `json:"storage_bytes"`
+}
+
+// UserUsage - статистика использования сервиса пользователем
+type UserUsage struct {
+	UserID        int   `json:"user_id"`
+	NotesCount    int   `json:"notes_count"`
+	TagsCount     int   `json:"tags_count"`
+	SharedCount   int   `json:"shared_count"`   // Количество выданных доступов к заметкам пользователя
+	ReceivedCount int   `json:"received_count"` // Количество заметок, доступных пользователю
+	StorageBytes  int64 `json:"storage_bytes"`  // Объем заголовков, содержимого и вложений заметок
+}
+
+// SetPasswordRequest - запрос администратора на смену пароля пользователя
+type SetPasswordRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// SetRoleRequest - запрос на смену роли пользователя
+type SetRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// BreakGlassRequest - запрос на экстренный доступ администратора к заметке
+type BreakGlassRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// BreakGlassRecord - запись журнала экстренного доступа к заметкам
+type BreakGlassRecord struct {
+	ID        int       `json:"id"`
+	AdminID   int       `json:"admin_id"`
+	NoteID    int       `json:"note_id"`
+	OwnerID   int       `json:"owner_id"`
+	Reason    string    `json:"reason"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Attachment - файл, прикрепленный к заметке. Содержимое отдается по URL.
+type Attachment struct {
+	ID        int       `json:"id"`
+	NoteID    int       `json:"note_id"`
+	FileName  string    `json:"filename"`
+	MimeType  string    `json:"mime_type"`
+	Size      int       `json:"size"`
+	URL       string    `json:"url" example:"/attachments/1"`
+	CreatedAt time.Time `json:"created_at"`
+}
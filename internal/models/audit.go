@@ -0,0 +1,98 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Действия, записываемые в журнал аудита
+const (
+	AuditUserRegistered       = "user.registered"
+	AuditUserLogin            = "user.login"
+	AuditUserLoginFailed      = "user.login_failed"
+	AuditUserDeletionRequest  = "user.deletion_requested"
+	AuditUserDeletionCancel   = "user.deletion_cancelled"
+	AuditUserPurged           = "user.purged"
+	AuditUserExportRequested  = "user.export_requested"
+	AuditUserEmailVerified    = "user.email_verified"
+	AuditNotesExported        = "user.notes_exported"
+	AuditNotesImported        = "user.notes_imported"
+	AuditNoteCreated          = "note.created"
+	AuditNoteUpdated          = "note.updated"
+	AuditNoteDeleted          = "note.deleted"
+	AuditNoteExported         = "note.exported"
+	AuditNoteShared           = "note.shared"
+	AuditNoteAccessRevoked    = "note.access_revoked"
+	AuditNoteTeamShared       = "note.team_shared"
+	AuditNoteTeamUnshared     = "note.team_unshared"
+	AuditNoteTransferOffered  = "note.transfer_offered"
+	AuditNoteTransferAccepted = "note.transfer_accepted"
+	AuditNoteTransferDeclined = "note.transfer_declined"
+	AuditInvitationAccepted   = "invitation.accepted"
+	AuditInvitationDeclined   = "invitation.declined"
+	AuditInvitationCancelled  = "invitation.cancelled"
+	AuditNotebookExported     = "notebook.exported"
+	AuditTeamDeleted          = "team.deleted"
+	AuditTeamMemberAdded      = "team.member_added"
+	AuditTeamMemberRole       = "team.member_role_changed"
+	AuditTeamMemberRemoved    = "team.member_removed"
+	AuditWebhookCreated       = "webhook.created"
+	AuditWebhookUpdated       = "webhook.updated"
+	AuditWebhookDeleted       = "webhook.deleted"
+	AuditAdminUserDisabled    = "admin.user_disabled"
+	AuditAdminUserEnabled     = "admin.user_enabled"
+	AuditAdminLogout          = "admin.logout_forced"
+	AuditAdminPasswordReset   = "admin.password_reset"
+	AuditAdminRoleChanged     = "admin.role_changed"
+	AuditAdminBreakGlass      = "admin.break_glass"
+	AuditAdminJobRetried      = "admin.job_retried"
+)
+
+// Типы объектов, над которыми выполняются действия
+const (
+	AuditTargetUser       = "user"
+	AuditTargetNote       = "note"
+	AuditTargetTeam       = "team"
+	AuditTargetNotebook   = "notebook"
+	AuditTargetInvitation = "invitation"
+	AuditTargetTransfer   = "transfer"
+	AuditTargetWebhook    = "webhook"
+	AuditTargetJob        = "job"
+)
+
+// SecurityAuditActions - события безопасности, которые пользователь видит в своей истории активности
+var SecurityAuditActions = []string{
+	AuditUserRegistered, AuditUserLogin, AuditUserLoginFailed, AuditUserDeletionRequest, AuditUserDeletionCancel,
+	AuditUserExportRequested, AuditNotesExported, AuditAdminUserDisabled, AuditAdminUserEnabled, AuditAdminLogout,
+	AuditAdminPasswordReset, AuditAdminRoleChanged, AuditUserEmailVerified,
+}
+
+// ClientInfo - сведения о клиенте, выполнившем запрос
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// AuditEntry - запись журнала аудита. Details содержит сводку изменения, например значения до и после.
+type AuditEntry struct {
+	ID         int             `json:"id"`
+	ActorID    *int            `json:"actor_id,omitempty"`
+	ActorName  string          `json:"actor_name,omitempty"` // Имя на момент действия
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   *int            `json:"target_id,omitempty"`
+	IP         string          `json:"ip,omitempty"`
+	UserAgent  string          `json:"user_agent,omitempty"`
+	Details    json.RawMessage `json:"details,omitempty" swaggertype:"object"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditFilter - условия выборки из журнала аудита; пустые поля не ограничивают выборку
+type AuditFilter struct {
+	ActorID    *int
+	Action     string
+	TargetType string
+	TargetID   *int
+	From       *time.Time
+	To         *time.Time
+}
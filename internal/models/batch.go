@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// Операции групповой обработки заметок
+const (
+	BatchDelete    = "delete"
+	BatchTag       = "tag"
+	BatchUntag     = "untag"
+	BatchMove      = "move"
+	BatchArchive   = "archive"
+	BatchUnarchive = "unarchive"
+	BatchShare     = "share"
+)
+
+// BatchRequest - операции над заметками, выбранными по ID или фильтру
+type BatchRequest struct {
+	NoteIDs    []int            `json:"note_ids"`
+	Filter     *BatchFilter     `json:"filter"` // Вместо note_ids
+	Operations []BatchOperation `json:"operations" binding:"required"`
+	Atomic     bool             `json:"atomic"` // Отменить все изменения, если хотя бы одна заметка не обработана
+	Async      bool             `json:"async"`  // Выполнить в фоне и вернуть задачу
+}
+
+// BatchFilter - выбор заметок пользователя для групповой обработки
+type BatchFilter struct {
+	Q          string `json:"q"`
+	Tag        string `json:"tag"`
+	NotebookID *int   `json:"notebook_id"`
+	Archived   *bool  `json:"archived"`
+}
+
+// BatchOperation - одна операция; используемые поля зависят от op
+type BatchOperation struct {
+	Op         string   `json:"op" example:"tag"` // delete, tag, untag, move, archive, unarchive или share
+	Tags       []string `json:"tags"`             // tag, untag
+	NotebookID *int     `json:"notebook_id"`      // move; null убирает заметку из блокнота
+	UserID     int      `json:"user_id"`          // share
+	Username   string   `json:"username"`         // share
+	Email      string   `json:"email"`            // share
+	Permission string   `json:"permission"`       // share: viewer (по умолчанию), commenter или editor
+}
+
+// BatchResult - итог групповой обработки
+type BatchResult struct {
+	Total      int              `json:"total"`
+	Succeeded  int              `json:"succeeded"`
+	Failed     int              `json:"failed"`
+	RolledBack bool             `json:"rolled_back"` // Изменения отменены из-за ошибок в атомарной обработке
+	Results    []BulkNoteResult `json:"results"`
+}
+
+// BatchJob - фоновая групповая обработка заметок
+type BatchJob struct {
+	ID          int          `json:"id"`
+	Status      string       `json:"status"` // pending, completed или failed
+	Error       string       `json:"error,omitempty"`
+	Result      *BatchResult `json:"result,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	CompletedAt *time.Time   `json:"completed_at,omitempty"`
+	JobID       int          `json:"job_id,omitempty"` // Задача очереди, возвращается при запуске
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// ChecklistItem - пункт списка задач заметки
+type ChecklistItem struct {
+	ID           int        `json:"id"`
+	NoteID       int        `json:"note_id"`
+	NoteTitle    string     `json:"note_title"`
+	Text         string     `json:"text"`
+	Checked      bool       `json:"checked"`
+	Position     int        `json:"position"`
+	DueDate      *string    `json:"due_date,omitempty" example:"2026-12-31"` // Срок в формате YYYY-MM-DD
+	AssigneeID   *int       `json:"assignee_id,omitempty"`
+	AssigneeName string     `json:"assignee_name,omitempty"`
+	CheckedAt    *time.Time `json:"checked_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+type CreateChecklistItemRequest struct {
+	Text       string  `json:"text" binding:"required"`
+	DueDate    *string `json:"due_date" example:"2026-12-31"`
+	AssigneeID *int    `json:"assignee_id"` // Пользователь с доступом к заметке
+	Position   *int    `json:"position"`    // По умолчанию пункт добавляется в конец
+}
+
+// UpdateChecklistItemRequest - изменение пункта; пустой due_date снимает срок, assignee_id = 0 снимает исполнителя
+type UpdateChecklistItemRequest struct {
+	Text       *string `json:"text"`
+	Checked    *bool   `json:"checked"`
+	DueDate    *string `json:"due_date" example:"2026-12-31"`
+	AssigneeID *int    `json:"assignee_id"`
+}
+
+// ReorderChecklistRequest - новый порядок всех пунктов заметки
+type ReorderChecklistRequest struct {
+	ItemIDs []int `json:"item_ids" binding:"required"`
+}
+
+// TaskFilter - условия выборки открытых задач
+type TaskFilter struct {
+	AssigneeID *int       // Задачи исполнителя
+	Unassigned bool       // Задачи без исполнителя
+	DueBefore  *time.Time // Срок не позже указанной даты
+	DueAfter   *time.Time // Срок не раньше указанной даты
+}
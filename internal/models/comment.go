@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Comment - комментарий к заметке. Ответы ссылаются на корневой комментарий через ParentID.
+// Комментарий может быть привязан к фрагменту текста заметки (смещения в символах).
+type Comment struct {
+	ID          int        `json:"id"`
+	NoteID      int        `json:"note_id"`
+	UserID      int        `json:"user_id"`
+	Username    string     `json:"username"`
+	ParentID    *int       `json:"parent_id,omitempty"`
+	Content     string     `json:"content"`
+	AnchorStart *int       `json:"anchor_start,omitempty"`
+	AnchorEnd   *int       `json:"anchor_end,omitempty"`
+	AnchorText  string     `json:"anchor_text,omitempty"` // Фрагмент текста на момент создания комментария
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy  *int       `json:"resolved_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Replies     []Comment  `json:"replies,omitempty"`
+}
+
+// CreateCommentRequest - новый комментарий или ответ в обсуждении
+type CreateCommentRequest struct {
+	Content     string `json:"content" binding:"required"`
+	ParentID    *int   `json:"parent_id"`
+	AnchorStart *int   `json:"anchor_start"`
+	AnchorEnd   *int   `json:"anchor_end"`
+}
+
+type UpdateCommentRequest struct {
+	Content string `json:"content" binding:"required"`
+}
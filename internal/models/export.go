@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// UserExport - выгрузка всех данных пользователя в ZIP-архив
+type UserExport struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	Status      string     `json:"status"` // pending, completed или failed
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	JobID       int        `json:"job_id,omitempty"` // Задача очереди, возвращается при запуске
+}
@@ -0,0 +1,7 @@
+package models
+
+// HealthStatus - результат проверки состояния сервиса
+type HealthStatus struct {
+	Status string            `json:"status"`           // ok, ready или not_ready
+	Checks map[string]string `json:"checks,omitempty"` // Результат каждой проверки: ok, disabled, error, stopped или stopping
+}
@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+// Источники фонового импорта заметок
+const (
+	ImportSourceENEX = "enex" // Экспорт Evernote
+	ImportSourceKeep = "keep" // Google Keep из Google Takeout
+)
+
+// Действия с дубликатами при импорте заметок
+const (
+	ImportSkip      = "skip"      // Не импортировать заметку, если такая уже есть
+	ImportOverwrite = "overwrite" // Заменить текст существующей заметки
+	ImportKeep      = "keep"      // Создать еще одну заметку
+)
+
+// Результаты импорта отдельного файла
+const (
+	ImportActionCreate = "create"
+	ImportActionUpdate = "update"
+	ImportActionSkip   = "skip"
+	ImportActionError  = "error"
+)
+
+// ImportOptions - параметры импорта архива с заметками
+type ImportOptions struct {
+	DryRun      bool   `json:"dry_run"`      // Только составить отчет, ничего не изменяя
+	OnDuplicate string `json:"on_duplicate"` // skip (по умолчанию), overwrite или keep
+	Notebook    string `json:"notebook"`     // Блокнот для заметок, у которых в архиве блокнота нет
+}
+
+// ImportReport - отчет об импорте. При dry_run описывает изменения, которые были бы выполнены.
+type ImportReport struct {
+	DryRun           bool         `json:"dry_run"`
+	Created          int          `json:"created"`
+	Updated          int          `json:"updated"`
+	Skipped          int          `json:"skipped"`
+	Failed           int          `json:"failed"`
+	NotebooksCreated []string     `json:"notebooks_created"`
+	Ignored          []string     `json:"ignored"` // Файлы архива, которые не являются заметками
+	Items            []ImportItem `json:"items"`
+}
+
+// ImportItem - результат импорта одного файла архива
+type ImportItem struct {
+	Path      string   `json:"path"`
+	Title     string   `json:"title"`
+	Notebook  string   `json:"notebook,omitempty"`
+	Tags      []string `json:"tags"`
+	Action    string   `json:"action" example:"create"` // create, update, skip или error
+	NoteID    int      `json:"note_id,omitempty"`       // Созданная, обновленная или совпавшая заметка
+	Duplicate bool     `json:"duplicate"`               // Заметка с тем же заголовком уже есть в этом блокноте
+	Error     string   `json:"error,omitempty"`         // Причина пропуска или ошибки
+}
+
+// ImportJob - фоновый импорт заметок. Total известно после разбора файла, Processed растет по мере импорта.
+type ImportJob struct {
+	ID          int           `json:"id"`
+	Source      string        `json:"source"` // enex или keep
+	Status      string        `json:"status"` // pending, completed или failed
+	Total       int           `json:"total"`
+	Processed   int           `json:"processed"`
+	Error       string        `json:"error,omitempty"`
+	Report      *ImportReport `json:"report,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+	CompletedAt *time.Time    `json:"completed_at,omitempty"`
+	JobID       int           `json:"job_id,omitempty"` // Задача очереди, возвращается при запуске
+}
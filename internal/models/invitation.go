@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Статусы приглашений к заметкам
+const (
+	InvitationPending   = "pending"
+	InvitationAccepted  = "accepted"
+	InvitationDeclined  = "declined"
+	InvitationCancelled = "cancelled"
+)
+
+// NoteInvitation - приглашение к совместной работе над заметкой. Пока получатель не принял
+// приглашение, доступа к заметке у него нет. Приглашение на email незарегистрированного
+// пользователя привязывается к нему при регистрации.
+type NoteInvitation struct {
+	ID          int        `json:"id"`
+	NoteID      int        `json:"note_id"`
+	NoteTitle   string     `json:"note_title"`
+	InviterID   int        `json:"inviter_id"`
+	InviterName string     `json:"inviter_name"`
+	InviteeID   *int       `json:"invitee_id,omitempty"`
+	InviteeName string     `json:"invitee_name,omitempty"`
+	Email       string     `json:"email,omitempty"`
+	Permission  string     `json:"permission"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+}
+
+// NoteAccessUser - пользователь с доступом к заметке
+type NoteAccessUser struct {
+	UserID     int    `json:"user_id"`
+	Username   string `json:"username"`
+	Permission string `json:"permission"`
+}
+
+// NoteAccessTeam - команда с доступом к заметке
+type NoteAccessTeam struct {
+	TeamID     int    `json:"team_id"`
+	Name       string `json:"name"`
+	Permission string `json:"permission"`
+}
+
+// NoteAccessList - все, у кого есть доступ к заметке или приглашение к ней
+type NoteAccessList struct {
+	Owner       NoteAccessUser   `json:"owner"`
+	OwnerTeam   *NoteAccessTeam  `json:"owner_team,omitempty"`
+	Users       []NoteAccessUser `json:"users"`
+	Teams       []NoteAccessTeam `json:"teams"`
+	Invitations []NoteInvitation `json:"invitations"`
+}
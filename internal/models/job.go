@@ -0,0 +1,23 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Job - задача фоновой очереди
+type Job struct {
+	ID          int             `json:"id"`
+	Kind        string          `json:"kind"`   // export, batch, import или служебная периодическая задача
+	Status      string          `json:"status"` // pending, running, completed или dead
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"` // Время следующего запуска, в том числе повторного после ошибки
+	LastError   string          `json:"last_error,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty" swaggertype:"object"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	CompletedAt *time.Time      `json:"completed_at,omitempty"`
+	UserID      *int            `json:"user_id,omitempty"` // Владелец; у служебных задач не задан
+	Payload     json.RawMessage `json:"-"`
+}
@@ -0,0 +1,28 @@
+package models
+
+// NoteLink - вики-ссылка [[Название]] или [[id:123]] из одной заметки на другую.
+// Ссылка без найденной заметки считается битой.
+type NoteLink struct {
+	SourceID    int    `json:"source_id"`
+	SourceTitle string `json:"source_title"`
+	TargetID    *int   `json:"target_id,omitempty"`
+	TargetTitle string `json:"target_title,omitempty"`
+	Text        string `json:"text"` // Текст внутри [[...]]
+	Broken      bool   `json:"broken"`
+}
+
+type GraphNode struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+type GraphEdge struct {
+	Source int `json:"source"`
+	Target int `json:"target"`
+}
+
+// NoteGraph - граф связей между доступными пользователю заметками
+type NoteGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
@@ -3,13 +3,71 @@ package models
 import "time"
 
 type Note struct {
-	ID        int       `json:"id"`
-	Title     string    `json:"title" binding:"required"`
-	Content   string    `json:"content" binding:"required"`
-	UserID    int       `json:"user_id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Tags      []Tag     `json:"tags,omitempty"` // Добавляем поле для тегов
+	ID             int        `json:"id"`
+	Title          string     `json:"title" binding:"required"`
+	Content        string     `json:"content" binding:"required"`
+	UserID         int        `json:"user_id"`
+	TeamID         *int       `json:"team_id,omitempty"`     // Команда-владелец заметки
+	NotebookID     *int       `json:"notebook_id,omitempty"` // Блокнот, в котором находится заметка
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	Tags           []Tag      `json:"tags,omitempty"`       // Добавляем поле для тегов
+	Permission     string     `json:"permission,omitempty"` // Уровень доступа текущего пользователя
+	CommentCount   int        `json:"comment_count"`
+	ContentFormat  string     `json:"content_format"`    // plain (по умолчанию) или markdown
+	Excerpt        string     `json:"excerpt,omitempty"` // Начало текста без разметки, в списках заметок
+	Outline        []Heading  `json:"outline,omitempty"` // Заголовки markdown-заметки, в списках заметок
+	HTML           string     `json:"html,omitempty"`    // Очищенный HTML, при запросе с render=html
+	ChecklistTotal int        `json:"checklist_total"`   // Количество пунктов списка задач
+	ChecklistDone  int        `json:"checklist_done"`    // Количество выполненных пунктов
+	Completion     int        `json:"completion"`        // Процент выполненных пунктов, 0 без списка задач
+	DueAt          *time.Time `json:"due_at,omitempty"`  // Срок заметки
+	Pinned         bool       `json:"pinned"`            // Закреплена вверху списка заметок
+	Archived       bool       `json:"archived"`          // Скрыта из списка заметок по умолчанию
+	Starred        bool       `json:"starred"`           // В избранном у текущего пользователя
+}
+
+// NoteFilter - условия выборки списка заметок
+type NoteFilter struct {
+	Archived   *bool  // Только архивные или только неархивные; по умолчанию архивные скрыты, кроме поиска и избранного
+	Starred    bool   // Избранные заметки, включая чужие доступные
+	Query      string // Поиск по названию и содержимому
+	Tag        string // Заметки с тегом
+	NotebookID *int   // Заметки блокнота
+}
+
+// NoteStateRequest - закрепление, архивация и избранное; не переданные поля не меняются
+type NoteStateRequest struct {
+	Pinned   *bool `json:"pinned"`
+	Archived *bool `json:"archived"`
+	Starred  *bool `json:"starred"`
+}
+
+// BulkNoteStateRequest - изменение состояния нескольких заметок
+type BulkNoteStateRequest struct {
+	NoteIDs  []int `json:"note_ids" binding:"required"`
+	Pinned   *bool `json:"pinned"`
+	Archived *bool `json:"archived"`
+	Starred  *bool `json:"starred"`
+}
+
+// BulkNoteResult - результат операции над одной заметкой из группы
+type BulkNoteResult struct {
+	NoteID int    `json:"note_id"`
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Форматы содержимого заметки
+const (
+	ContentPlain    = "plain"
+	ContentMarkdown = "markdown"
+)
+
+// Heading - заголовок в оглавлении заметки
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
 }
 
 type Tag struct {
@@ -17,8 +75,12 @@ type Tag struct {
 	Name string `json:"name"`
 }
 
+// ShareNoteRequest - приглашение к заметке по ID, имени пользователя или email
 type ShareNoteRequest struct {
-	UserID int `json:"user_id"`
+	UserID     int    `json:"user_id"`
+	Username   string `json:"username"`
+	Email      string `json:"email"`
+	Permission string `json:"permission"` // viewer (по умолчанию), commenter или editor
 }
 
 type SuccessResponse struct {
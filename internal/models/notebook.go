@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Notebook - блокнот для группировки заметок. Принадлежит пользователю или команде.
+type Notebook struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name" binding:"required"`
+	UserID    int       `json:"user_id"`
+	TeamID    *int      `json:"team_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MoveNoteRequest - перемещение заметки в блокнот; null убирает заметку из блокнота
+type MoveNoteRequest struct {
+	NotebookID *int `json:"notebook_id"`
+}
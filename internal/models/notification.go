@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Типы уведомлений
+const (
+	NotificationShareGranted       = "share_granted"
+	NotificationInvitationReceived = "invitation_received"
+	NotificationCommentAdded       = "comment_added"
+	NotificationMention            = "mention"
+	NotificationNoteUpdated        = "note_updated"
+	NotificationReminder           = "reminder"
+)
+
+// NotificationTypes - все типы уведомлений, которые пользователь может отключить
+var NotificationTypes = []string{
+	NotificationShareGranted,
+	NotificationInvitationReceived,
+	NotificationCommentAdded,
+	NotificationMention,
+	NotificationNoteUpdated,
+	NotificationReminder,
+}
+
+type Notification struct {
+	ID        int        `json:"id"`
+	Type      string     `json:"type"`
+	ActorID   *int       `json:"actor_id,omitempty"`
+	ActorName string     `json:"actor_name,omitempty"`
+	NoteID    *int       `json:"note_id,omitempty"`
+	CommentID *int       `json:"comment_id,omitempty"`
+	Message   string     `json:"message"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// NotificationList - страница уведомлений и количество непрочитанных
+type NotificationList struct {
+	UnreadCount   int            `json:"unread_count"`
+	Notifications []Notification `json:"notifications"`
+}
+
+// NotificationPreferences - включенность уведомлений по типам
+type NotificationPreferences map[string]bool
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// Каналы доставки напоминаний
+const (
+	ReminderChannelNotification = "notification"
+	ReminderChannelEmail        = "email"
+	ReminderChannelWebhook      = "webhook"
+)
+
+// ReminderChannels - все каналы доставки напоминаний
+var ReminderChannels = []string{
+	ReminderChannelNotification,
+	ReminderChannelEmail,
+	ReminderChannelWebhook,
+}
+
+// Reminder - напоминание пользователя о заметке или пункте ее списка задач
+type Reminder struct {
+	ID              int        `json:"id"`
+	UserID          int        `json:"user_id"`
+	NoteID          int        `json:"note_id"`
+	NoteTitle       string     `json:"note_title"`
+	ChecklistItemID *int       `json:"checklist_item_id,omitempty"`
+	ItemText        string     `json:"item_text,omitempty"`
+	Message         string     `json:"message,omitempty"`
+	RemindAt        time.Time  `json:"remind_at"`                                            // Первое срабатывание
+	RRule           string     `json:"rrule,omitempty" example:"FREQ=WEEKLY;BYDAY=MO,WE,FR"` // Правило повторения (RFC 5545)
+	Channels        []string   `json:"channels"`
+	NextAt          *time.Time `json:"next_at,omitempty"` // Ближайшее срабатывание; пусто у сработавшего напоминания
+	LastFiredAt     *time.Time `json:"last_fired_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+type CreateReminderRequest struct {
+	RemindAt        time.Time `json:"remind_at" binding:"required"`
+	RRule           string    `json:"rrule" example:"FREQ=DAILY"`
+	Message         string    `json:"message"`
+	ChecklistItemID *int      `json:"checklist_item_id"`
+	Channels        []string  `json:"channels"` // По умолчанию notification
+}
+
+// UpdateReminderRequest - изменение напоминания; пустой rrule отменяет повторение
+type UpdateReminderRequest struct {
+	RemindAt *time.Time `json:"remind_at"`
+	RRule    *string    `json:"rrule"`
+	Message  *string    `json:"message"`
+	Channels []string   `json:"channels"`
+}
+
+// SnoozeReminderRequest - откладывание напоминания на minutes минут или до момента until
+type SnoozeReminderRequest struct {
+	Minutes int        `json:"minutes" example:"15"`
+	Until   *time.Time `json:"until"`
+}
+
+// SetDueRequest - срок заметки; null снимает срок
+type SetDueRequest struct {
+	DueAt *time.Time `json:"due_at"`
+}
+
+// UpcomingReminders - ближайшие напоминания и сроки пользователя
+type UpcomingReminders struct {
+	Reminders []Reminder `json:"reminders"`
+	DueNotes  []Note     `json:"due_notes"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Роли участников команды
+const (
+	TeamRoleOwner  = "owner"
+	TeamRoleAdmin  = "admin"
+	TeamRoleMember = "member"
+	TeamRoleGuest  = "guest"
+)
+
+// Уровни доступа к заметке
+const (
+	PermissionViewer    = "viewer"
+	PermissionCommenter = "commenter"
+	PermissionEditor    = "editor"
+	PermissionOwner     = "owner"
+)
+
+type Team struct {
+	ID        int          `json:"id"`
+	Name      string       `json:"name" binding:"required"`
+	CreatedBy int          `json:"created_by"`
+	CreatedAt time.Time    `json:"created_at"`
+	Role      string       `json:"role,omitempty"` // Роль текущего пользователя в команде
+	Members   []TeamMember `json:"members,omitempty"`
+}
+
+type TeamMember struct {
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddTeamMemberRequest - добавление пользователя в команду по ID или имени
+type AddTeamMemberRequest struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type UpdateTeamMemberRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// ShareNoteWithTeamRequest - передача доступа к заметке всем участникам команды
+type ShareNoteWithTeamRequest struct {
+	TeamID     int    `json:"team_id" binding:"required"`
+	Permission string `json:"permission"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// NoteTemplate - шаблон заметки пользователя или команды. Название и содержимое могут содержать
+// переменные {{date}}, {{time}}, {{datetime}}, {{user}} и {{prompt:Имя}}.
+type NoteTemplate struct {
+	ID            int       `json:"id"`
+	Name          string    `json:"name"`
+	UserID        int       `json:"user_id,omitempty"` // Владелец личного шаблона
+	TeamID        *int      `json:"team_id,omitempty"` // Команда, которой доступен шаблон
+	Title         string    `json:"title" example:"Встреча {{date}}"`
+	Content       string    `json:"content" example:"Проект: {{prompt:Проект}}"`
+	ContentFormat string    `json:"content_format"`
+	Tags          []string  `json:"tags"`
+	NotebookID    *int      `json:"notebook_id,omitempty"` // Блокнот для новых заметок
+	Prompts       []string  `json:"prompts"`               // Значения, которые нужно передать при создании заметки
+	CreatedBy     *int      `json:"created_by,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type CreateTemplateRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	TeamID        *int     `json:"team_id"`
+	Title         string   `json:"title"`
+	Content       string   `json:"content"`
+	ContentFormat string   `json:"content_format"`
+	Tags          []string `json:"tags"`
+	NotebookID    *int     `json:"notebook_id"`
+}
+
+// UpdateTemplateRequest - изменение шаблона; notebook_id = 0 убирает блокнот по умолчанию
+type UpdateTemplateRequest struct {
+	Name          *string  `json:"name"`
+	Title         *string  `json:"title"`
+	Content       *string  `json:"content"`
+	ContentFormat *string  `json:"content_format"`
+	Tags          []string `json:"tags"`
+	NotebookID    *int     `json:"notebook_id"`
+}
+
+// InstantiateTemplateRequest - значения переменных {{prompt:Имя}} и часовой пояс для {{date}} и {{time}}
+type InstantiateTemplateRequest struct {
+	Values   map[string]string `json:"values"`
+	Timezone string            `json:"timezone" example:"Europe/Moscow"` // По умолчанию UTC
+}
+
+// DailyNoteRequest - ежедневная заметка, по умолчанию без шаблона и в UTC
+type DailyNoteRequest struct {
+	TemplateID *int   `json:"template_id"`
+	Timezone   string `json:"timezone" example:"Europe/Moscow"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// NoteTransfer - предложение передать право владения заметкой другому пользователю.
+// Статусы совпадают со статусами приглашений.
+type NoteTransfer struct {
+	ID           int        `json:"id"`
+	NoteID       int        `json:"note_id"`
+	NoteTitle    string     `json:"note_title"`
+	FromUserID   int        `json:"from_user_id"`
+	FromUsername string     `json:"from_username"`
+	ToUserID     int        `json:"to_user_id"`
+	ToUsername   string     `json:"to_username"`
+	Status       string     `json:"status"`
+	CreatedAt    time.Time  `json:"created_at"`
+	RespondedAt  *time.Time `json:"responded_at,omitempty"`
+}
+
+// TransferNoteRequest - новый владелец заметки по ID или имени
+type TransferNoteRequest struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+}
@@ -8,13 +8,29 @@ type User struct {
 	ID        int       `json:"id"`
 	Username  string    `json:"username" binding:"required"`
 	Password  string    `json:"password" binding:"required"`
+	Email     string    `json:"email,omitempty" binding:"omitempty,email"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
 type UserProfile struct {
-	ID        int       `json:"id"`
-	Username  string    `json:"username"`
-	CreatedAt time.Time `json:"created_at"`
+	ID                  int        `json:"id"`
+	Username            string     `json:"username"`
+	Email               string     `json:"email,omitempty"`
+	EmailVerified       bool       `json:"email_verified"` // Подтвержден ли email кодом из письма
+	CreatedAt           time.Time  `json:"created_at"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"` // Дата окончательного удаления аккаунта, если оно запрошено
+}
+
+// VerifyEmailRequest - запрос на подтверждение email кодом из письма
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// DeleteAccountRequest - запрос на удаление аккаунта
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+	// Политика для заметок, к которым есть доступ у других пользователей: transfer или delete
+	SharedNotesPolicy string `json:"shared_notes_policy"`
 }
 
 type UserSuccess struct {
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// События, на которые можно подписать вебхук
+const (
+	EventNoteCreated = "note.created"
+	EventNoteUpdated = "note.updated"
+	EventNoteDeleted = "note.deleted"
+	EventNoteShared  = "note.shared"
+	EventTagAdded    = "tag.added"
+	EventReminder    = "reminder.fired"
+)
+
+var WebhookEvents = []string{EventNoteCreated, EventNoteUpdated, EventNoteDeleted, EventNoteShared, EventTagAdded, EventReminder}
+
+// Статусы доставки вебхука
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook - подписка на события заметок пользователя или команды. Тело запроса подписывается
+// HMAC-SHA256 с ключом Secret, подпись передается в заголовке X-Webhook-Signature.
+type Webhook struct {
+	ID        int       `json:"id"`
+	UserID    *int      `json:"user_id,omitempty"` // Владелец вебхука на личные заметки
+	TeamID    *int      `json:"team_id,omitempty"` // Команда, на заметки которой оформлена подписка
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	Secret    string    `json:"secret,omitempty"` // Возвращается только при создании
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events" binding:"required"`
+	TeamID *int     `json:"team_id"` // Вебхук на заметки команды, требуется роль admin
+}
+
+type UpdateWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+// WebhookDelivery - запись журнала доставки события
+type WebhookDelivery struct {
+	ID            int             `json:"id"`
+	WebhookID     int             `json:"webhook_id"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload" swaggertype:"object"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt *time.Time      `json:"next_attempt_at,omitempty"`
+	StatusCode    *int            `json:"status_code,omitempty"` // Код ответа получателя на последнюю попытку
+	Error         string          `json:"error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// WebhookPayload - тело запроса, отправляемого получателю
+type WebhookPayload struct {
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
@@ -4,26 +4,154 @@ import (
 	"database/sql"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"notes-api/internal/config"
 	"notes-api/internal/handlers"
 )
 
-func SetupRoutes(router *gin.Engine, db *sql.DB) {
+func SetupRoutes(router *gin.Engine, db *sql.DB, cfg config.Config) {
+	session := handlers.NewSession(cfg)
+	// Проверка токена, блокировки пользователя и отзыва токена
+	router.Use(handlers.CheckSession(db, session))
 	// Регистрация пользователя
-	router.POST("/register", handlers.RegisterUser(db))
+	router.POST("/register", handlers.RegisterUser(db, cfg.SMTP))
 	// Аутентификация
-	router.POST("/login", handlers.LoginUser(db))
+	router.POST("/login", handlers.LoginUser(db, session))
+	// Подтверждение email
+	router.POST("/verify-email", handlers.VerifyEmail(db))
 	// Получение профиля пользователя
 	router.GET("/profile", handlers.GetProfile(db))
+	router.DELETE("/profile", handlers.DeleteProfile(db))
+	router.DELETE("/profile/deletion", handlers.CancelProfileDeletion(db))
+	router.GET("/profile/export", handlers.ExportProfile(db))
+	router.GET("/profile/export/:id", handlers.GetProfileExport(db))
+	router.GET("/profile/export/:id/download", handlers.DownloadProfileExport(db))
+	router.GET("/profile/activity", handlers.GetProfileActivity(db))
+	router.POST("/profile/email/verification", handlers.ResendEmailVerification(db, cfg.SMTP))
 	// Заметки
 	router.POST("/notes", handlers.CreateNote(db))
 	router.GET("/notes", handlers.GetNotes(db)) // Пагинация
 	router.GET("/notes/:id", handlers.GetNoteByID(db))
 	router.PUT("/notes/:id", handlers.UpdateNote(db))
 	router.DELETE("/notes/:id", handlers.DeleteNote(db))
+	router.PUT("/notes/:id/state", handlers.SetNoteState(db)) // Закрепление, архивация и избранное
+	router.PUT("/notes/state", handlers.SetNotesState(db))
+	router.POST("/notes/batch", handlers.BatchNotes(db)) // Групповые операции
+	router.GET("/notes/batch/:id", handlers.GetBatchJob(db))
 	router.POST("/notes/:id/tags", handlers.AddTags(db))
 	router.GET("/notes/tags", handlers.GetNotesByTag(db))
-	router.POST("/notes/:id/share", handlers.ShareNote(db))  // Новый маршрут для передачи доступа
+	router.POST("/notes/:id/share", handlers.ShareNote(db))  // Приглашение к заметке по ID, имени или email
 	router.GET("/shared-notes", handlers.GetSharedNotes(db)) // Новый маршрут для просмотра доступных заметок
+	router.POST("/notes/:id/share-team", handlers.ShareNoteWithTeam(db))
+	router.DELETE("/notes/:id/share-team/:team_id", handlers.UnshareNoteWithTeam(db))
+	router.PUT("/notes/:id/notebook", handlers.MoveNote(db))
+	router.GET("/notes/:id/access", handlers.GetNoteAccess(db))
+	router.DELETE("/notes/:id/access/:user_id", handlers.RevokeNoteAccess(db))
+	router.POST("/notes/:id/transfer", handlers.TransferNote(db))
+	// Комментарии
+	router.GET("/notes/:id/comments", handlers.GetComments(db))
+	router.POST("/notes/:id/comments", handlers.CreateComment(db))
+	router.PUT("/comments/:id", handlers.UpdateComment(db))
+	router.DELETE("/comments/:id", handlers.DeleteComment(db))
+	router.POST("/comments/:id/resolve", handlers.ResolveComment(db))
+	router.POST("/comments/:id/reopen", handlers.ReopenComment(db))
+	// Списки задач
+	router.GET("/notes/:id/checklist", handlers.GetChecklist(db))
+	router.POST("/notes/:id/checklist", handlers.CreateChecklistItem(db))
+	router.PUT("/notes/:id/checklist/order", handlers.ReorderChecklist(db))
+	router.PATCH("/checklist/:id", handlers.UpdateChecklistItem(db))
+	router.DELETE("/checklist/:id", handlers.DeleteChecklistItem(db))
+	router.GET("/tasks", handlers.GetTasks(db))
+	// Напоминания и сроки
+	router.PUT("/notes/:id/due", handlers.SetNoteDue(db))
+	router.GET("/notes/:id/reminders", handlers.GetNoteReminders(db))
+	router.POST("/notes/:id/reminders", handlers.CreateReminder(db))
+	router.GET("/reminders/upcoming", handlers.GetUpcomingReminders(db))
+	router.PUT("/reminders/:id", handlers.UpdateReminder(db))
+	router.DELETE("/reminders/:id", handlers.DeleteReminder(db))
+	router.POST("/reminders/:id/snooze", handlers.SnoozeReminder(db))
+	// Ссылки между заметками
+	router.GET("/notes/:id/links", handlers.GetNoteLinks(db))
+	router.GET("/notes/:id/backlinks", handlers.GetNoteBacklinks(db))
+	router.GET("/links/broken", handlers.GetBrokenLinks(db))
+	router.GET("/graph", handlers.GetGraph(db))
+	// Шаблоны заметок
+	router.GET("/templates", handlers.GetTemplates(db))
+	router.POST("/templates", handlers.CreateTemplate(db))
+	router.GET("/templates/:id", handlers.GetTemplate(db))
+	router.PUT("/templates/:id", handlers.UpdateTemplate(db))
+	router.DELETE("/templates/:id", handlers.DeleteTemplate(db))
+	router.POST("/notes/from-template/:id", handlers.CreateNoteFromTemplate(db))
+	router.POST("/notes/daily", handlers.GetDailyNote(db))
+	// Импорт и экспорт заметок в Markdown
+	router.GET("/export", handlers.ExportNotes(db))
+	router.POST("/import", handlers.ImportNotes(db))
+	router.POST("/import/enex", handlers.ImportENEX(db))
+	router.POST("/import/keep", handlers.ImportKeep(db))
+	router.GET("/import/jobs/:id", handlers.GetImportJob(db))
+	router.GET("/notes/:id/export", handlers.ExportNote(db)) // PDF, HTML, Markdown или текст
+	router.GET("/notebooks/:id/export", handlers.ExportNotebook(db))
+	// Состояние задач очереди: выгрузок, импортов и фоновых групповых операций
+	router.GET("/jobs/:id", handlers.GetJob(db))
+	// Вложения
+	router.GET("/notes/:id/attachments", handlers.GetNoteAttachments(db))
+	router.GET("/attachments/:id", handlers.DownloadAttachment(db))
+	// Уведомления
+	router.GET("/notifications", handlers.GetNotifications(db))
+	router.POST("/notifications/:id/read", handlers.MarkNotificationRead(db))
+	router.POST("/notifications/read-all", handlers.MarkAllNotificationsRead(db))
+	router.GET("/notifications/preferences", handlers.GetNotificationPreferences(db))
+	router.PUT("/notifications/preferences", handlers.UpdateNotificationPreferences(db))
+	router.POST("/notes/:id/follow", handlers.FollowNote(db))
+	router.DELETE("/notes/:id/follow", handlers.UnfollowNote(db))
+	// Вебхуки
+	router.POST("/webhooks", handlers.CreateWebhook(db))
+	router.GET("/webhooks", handlers.GetWebhooks(db))
+	router.PUT("/webhooks/:id", handlers.UpdateWebhook(db))
+	router.DELETE("/webhooks/:id", handlers.DeleteWebhook(db))
+	router.GET("/webhooks/:id/deliveries", handlers.GetWebhookDeliveries(db))
+	router.POST("/webhooks/:id/deliveries/:delivery_id/redeliver", handlers.RedeliverWebhook(db))
+	// Передача права владения заметками
+	router.GET("/transfers", handlers.GetTransfers(db))
+	router.POST("/transfers/:id/accept", handlers.AcceptTransfer(db))
+	router.POST("/transfers/:id/decline", handlers.DeclineTransfer(db))
+	router.DELETE("/transfers/:id", handlers.CancelTransfer(db))
+	// Приглашения к заметкам
+	router.GET("/invitations", handlers.GetInvitations(db))
+	router.POST("/invitations/:id/accept", handlers.AcceptInvitation(db))
+	router.POST("/invitations/:id/decline", handlers.DeclineInvitation(db))
+	router.DELETE("/invitations/:id", handlers.CancelInvitation(db))
+	// Блокноты
+	router.POST("/notebooks", handlers.CreateNotebook(db))
+	router.GET("/notebooks", handlers.GetNotebooks(db))
+	router.PUT("/notebooks/:id", handlers.RenameNotebook(db))
+	router.DELETE("/notebooks/:id", handlers.DeleteNotebook(db))
+	router.GET("/notebooks/:id/notes", handlers.GetNotebookNotes(db))
+	// Команды
+	router.POST("/teams", handlers.CreateTeam(db))
+	router.GET("/teams", handlers.GetTeams(db))
+	router.GET("/teams/:id", handlers.GetTeam(db))
+	router.PUT("/teams/:id", handlers.RenameTeam(db))
+	router.DELETE("/teams/:id", handlers.DeleteTeam(db))
+	router.POST("/teams/:id/members", handlers.AddTeamMember(db))
+	router.PUT("/teams/:id/members/:user_id", handlers.UpdateTeamMember(db))
+	router.DELETE("/teams/:id/members/:user_id", handlers.RemoveTeamMember(db))
+	router.GET("/teams/:id/notes", handlers.GetTeamNotes(db))
+	router.GET("/teams/:id/tags", handlers.GetTeamTags(db))
+	// Администрирование
+	admin := router.Group("/admin", handlers.RequireAdmin(db))
+	admin.GET("/users", handlers.AdminListUsers(db))
+	admin.GET("/users/:id/usage", handlers.AdminGetUserUsage(db))
+	admin.POST("/users/:id/disable", handlers.AdminDisableUser(db))
+	admin.POST("/users/:id/enable", handlers.AdminEnableUser(db))
+	admin.POST("/users/:id/logout", handlers.AdminLogoutUser(db))
+	admin.POST("/users/:id/password", handlers.AdminResetPassword(db))
+	admin.PUT("/users/:id/role", handlers.AdminSetRole(db))
+	admin.POST("/notes/:id/break-glass", handlers.AdminBreakGlassNote(db))
+	admin.GET("/break-glass", handlers.AdminGetBreakGlassLog(db))
+	admin.GET("/audit", handlers.AdminGetAuditLog(db))
+	admin.GET("/audit/export", handlers.AdminExportAuditLog(db))
+	admin.GET("/jobs", handlers.AdminListJobs(db))
+	admin.POST("/jobs/:id/retry", handlers.AdminRetryJob(db))
 	// Добавляем обработчик для главной страницы
 	router.GET("/", func(c *gin.Context) {
 		c.String(http.StatusOK, "Привет, мир!!!") // Отправляем ответ "Привет, мир!"
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"notes-api/internal/models"
+)
+
+var (
+	ErrNoteNotFound      = errors.New("заметка не найдена")
+	ErrNoteForbidden     = errors.New("недостаточно прав для этой заметки")
+	ErrInvalidPermission = errors.New("уровень доступа должен быть viewer, commenter или editor")
+)
+
+// permissionRank упорядочивает уровни доступа к заметке
+var permissionRank = map[string]int{
+	models.PermissionViewer:    1,
+	models.PermissionCommenter: 2,
+	models.PermissionEditor:    3,
+	models.PermissionOwner:     4,
+}
+
+// teamRolePermission - уровень доступа участника команды к заметкам, принадлежащим команде
+var teamRolePermission = map[string]string{
+	models.TeamRoleOwner:  models.PermissionOwner,
+	models.TeamRoleAdmin:  models.PermissionOwner,
+	models.TeamRoleMember: models.PermissionEditor,
+	models.TeamRoleGuest:  models.PermissionViewer,
+}
+
+// hasPermission проверяет, что уровень доступа granted не ниже required
+func hasPermission(granted, required string) bool {
+	return granted != "" && permissionRank[granted] >= permissionRank[required]
+}
+
+// maxPermission возвращает наибольший из уровней доступа
+func maxPermission(a, b string) string {
+	if permissionRank[b] > permissionRank[a] {
+		return b
+	}
+	return a
+}
+
+// minPermission возвращает наименьший из уровней доступа
+func minPermission(a, b string) string {
+	if permissionRank[b] < permissionRank[a] {
+		return b
+	}
+	return a
+}
+
+// validSharePermission проверяет уровень доступа, который можно выдать другому пользователю или команде
+func validSharePermission(permission string) (string, error) {
+	if permission == "" {
+		return models.PermissionViewer, nil
+	}
+	if permission != models.PermissionViewer && permission != models.PermissionCommenter && permission != models.PermissionEditor {
+		return "", ErrInvalidPermission
+	}
+	return permission, nil
+}
+
+// accessibleNoteIDs возвращает подзапрос с ID заметок, доступных пользователю, чей ID передается
+// параметром param (например "$1"): своих, выданных лично, заметок его команд и выданных его командам.
+// Доступ к заметкам команды определяется только командами: автор заметки теряет его вместе с членством.
+func accessibleNoteIDs(param string) string {
+	return `SELECT id FROM notes WHERE user_id = ` + param + ` AND team_id IS NULL
+		UNION SELECT na.note_id FROM note_access na JOIN notes pn ON pn.id = na.note_id
+			WHERE na.user_id = ` + param + ` AND pn.team_id IS NULL
+		UNION SELECT n.id FROM notes n JOIN team_members tm ON tm.team_id = n.team_id WHERE tm.user_id = ` + param + `
+		UNION SELECT tna.note_id FROM team_note_access tna
+			JOIN team_members tm ON tm.team_id = tna.team_id WHERE tm.user_id = ` + param
+}
+
+// NotePermission вычисляет уровень доступа пользователя к заметке. К личной заметке доступ дают владение
+// и личный доступ из note_access, к заметке команды - только роль в команде-владельце; к любой заметке -
+// доступ, выданный командам пользователя. Автор заметки команды в notes.user_id прав не получает:
+// исключенный из команды или ставший гостем автор теряет доступ, как и остальные участники.
+// Для заметки без доступа возвращается пустая строка, для несуществующей - ErrNoteNotFound.
+func (s *NoteService) NotePermission(noteID, userID int) (string, error) {
+	defer traceMethod(&s.Ctx, "NoteService.NotePermission")()
+	var ownerID int
+	var teamNote bool
+	var personal, teamRole string
+	query := `
+		SELECT n.user_id, n.team_id IS NOT NULL,
+			COALESCE((SELECT permission FROM note_access WHERE note_id = n.id AND user_id = $2), ''),
+			COALESCE((SELECT role FROM team_members WHERE team_id = n.team_id AND user_id = $2), '')
+		FROM notes n WHERE n.id = $1`
+	err := s.DB.QueryRowContext(s.Ctx, query, noteID, userID).Scan(&ownerID, &teamNote, &personal, &teamRole)
+	if err == sql.ErrNoRows {
+		return "", ErrNoteNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	permission := basePermission(userID, ownerID, teamNote, personal, teamRole)
+	if permission == models.PermissionOwner {
+		return permission, nil
+	}
+	rows, err := s.DB.QueryContext(s.Ctx, `
+		SELECT tna.permission, tm.role
+		FROM team_note_access tna
+		JOIN team_members tm ON tm.team_id = tna.team_id
+		WHERE tna.note_id = $1 AND tm.user_id = $2`, noteID, userID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var granted, role string
+		if err := rows.Scan(&granted, &role); err != nil {
+			return "", err
+		}
+		permission = maxPermission(permission, teamGrantPermission(granted, role))
+	}
+	return permission, rows.Err()
+}
+
+// basePermission - уровень доступа к заметке без учета доступа, выданного командам:
+// владение и личный доступ для личной заметки, роль в команде-владельце для заметки команды
+func basePermission(userID, ownerID int, teamNote bool, personal, teamRole string) string {
+	if teamNote {
+		return teamRolePermission[teamRole]
+	}
+	if ownerID == userID {
+		return models.PermissionOwner
+	}
+	return personal
+}
+
+// teamGrantPermission - уровень доступа участника с ролью role к заметке, выданной его команде с уровнем granted.
+// Гости команды получают не больше чем просмотр.
+func teamGrantPermission(granted, role string) string {
+	return minPermission(granted, teamRolePermission[role])
+}
+
+// accessibleNotes - NotePermission для набора заметок, вычисленный несколькими запросами к db, например
+// внутри транзакции. Возвращает доступные пользователю заметки с заполненным Permission; недоступные
+// и несуществующие заметки в результат не попадают.
+func accessibleNotes(ctx context.Context, db dbtx, noteIDs []int, userID int) (map[int]models.Note, error) {
+	permissions := map[int]string{}
+	rows, err := db.QueryContext(ctx, `
+		SELECT n.id, n.user_id, n.team_id IS NOT NULL,
+			COALESCE((SELECT permission FROM note_access WHERE note_id = n.id AND user_id = $2), ''),
+			COALESCE((SELECT role FROM team_members WHERE team_id = n.team_id AND user_id = $2), '')
+		FROM notes n WHERE n.id = ANY($1) AND n.id IN (`+accessibleNoteIDs("$2")+`)`, pq.Array(noteIDs), userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id, ownerID int
+		var teamNote bool
+		var personal, teamRole string
+		if err := rows.Scan(&id, &ownerID, &teamNote, &personal, &teamRole); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		permissions[id] = basePermission(userID, ownerID, teamNote, personal, teamRole)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows, err = db.QueryContext(ctx, `
+		SELECT tna.note_id, tna.permission, tm.role
+		FROM team_note_access tna
+		JOIN team_members tm ON tm.team_id = tna.team_id
+		WHERE tna.note_id = ANY($1) AND tm.user_id = $2`, pq.Array(noteIDs), userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int
+		var granted, role string
+		if err := rows.Scan(&id, &granted, &role); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if _, ok := permissions[id]; ok {
+			permissions[id] = maxPermission(permissions[id], teamGrantPermission(granted, role))
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	notes := map[int]models.Note{}
+	rows, err = db.QueryContext(ctx, `SELECT `+noteColumns+` FROM notes n WHERE n.id = ANY($1)`, pq.Array(noteIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		note, err := scanNote(rows)
+		if err != nil {
+			return nil, err
+		}
+		if permission := permissions[note.ID]; permission != "" {
+			note.Permission = permission
+			notes[note.ID] = note
+		}
+	}
+	return notes, rows.Err()
+}
+
+// requireNote возвращает заметку, если у пользователя есть к ней доступ уровня required
+func (s *NoteService) requireNote(noteID, userID int, required string) (models.Note, error) {
+	permission, err := s.NotePermission(noteID, userID)
+	if err != nil {
+		return models.Note{}, err
+	}
+	if permission == "" {
+		// Не раскрываем существование чужих заметок
+		return models.Note{}, ErrNoteNotFound
+	}
+	if !hasPermission(permission, required) {
+		return models.Note{}, ErrNoteForbidden
+	}
+	note, err := scanNote(s.DB.QueryRowContext(s.Ctx, `SELECT `+noteColumns+` FROM notes n WHERE n.id = $1`, noteID))
+	if err != nil {
+		return note, err
+	}
+	note.Permission = permission
+	return note, nil
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"notes-api/internal/models"
+	"strings"
+)
+
+var (
+	ErrUserNotFound = errors.New("пользователь не найден")
+	ErrInvalidRole  = errors.New("роль должна быть user или admin")
+	ErrSelfDemotion = errors.New("нельзя отключить или понизить собственную учетную запись")
+)
+
+// AdminService предоставляет методы для администрирования пользователей
+type AdminService struct {
+	DB     *sql.DB
+	Client models.ClientInfo // Клиент, выполняющий запрос; записывается в журнал аудита
+	Ctx    context.Context   // Контекст запроса: его отмена прерывает запросы к базе данных
+}
+
+// IsAdmin проверяет, что пользователь является администратором и не заблокирован
+func (s *AdminService) IsAdmin(userID int) (bool, error) {
+	var role string
+	query := `SELECT role FROM users WHERE id = $1 AND disabled_at IS NULL`
+	err := s.DB.QueryRowContext(s.Ctx, query, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return role == models.RoleAdmin, nil
+}
+
+// ListUsers возвращает пользователей с пагинацией и поиском по имени. Объем хранилища включает
+// заголовки и содержимое заметок пользователя и их вложения.
+func (s *AdminService) ListUsers(search string, page, limit int) ([]models.AdminUser, error) {
+	offset := (page - 1) * limit
+	query := `
+		SELECT u.id, u.username, u.role, u.created_at, u.disabled_at, u.deletion_scheduled_at,
+			COUNT(n.id), COALESCE(SUM(OCTET_LENGTH(n.title) + OCTET_LENGTH(n.content)), 0) + (
+				SELECT COALESCE(SUM(OCTET_LENGTH(a.data)), 0)
+				FROM note_attachments a JOIN notes an ON an.id = a.note_id WHERE an.user_id = u.id)
+		FROM users u
+		LEFT JOIN notes n ON n.user_id = u.id
+		WHERE $1 = '' OR u.username ILIKE '%' || $1 || '%'
+		GROUP BY u.id
+		ORDER BY u.id
+		LIMIT $2 OFFSET $3`
+	rows, err := s.DB.QueryContext(s.Ctx, query, search, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []models.AdminUser{}
+	for rows.Next() {
+		var user models.AdminUser
+		if err := rows.Scan(&user.ID, &user.Username, &user.Role, &user.CreatedAt, &user.DisabledAt,
+			&user.DeletionScheduledAt, &user.NotesCount, &user.StorageBytes); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// GetUsage возвращает статистику использования сервиса пользователем
+func (s *AdminService) GetUsage(userID int) (models.UserUsage, error) {
+	usage := models.UserUsage{UserID: userID}
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM notes WHERE user_id = u.id),
+			(SELECT COUNT(DISTINCT nt.tag_id) FROM note_tags nt JOIN notes n ON n.id = nt.note_id WHERE n.user_id = u.id),
+			(SELECT COUNT(*) FROM note_access na JOIN notes n ON n.id = na.note_id WHERE n.user_id = u.id),
+			(SELECT COUNT(*) FROM note_access WHERE user_id = u.id),
+			(SELECT COALESCE(SUM(OCTET_LENGTH(title) + OCTET_LENGTH(content)), 0) FROM notes WHERE user_id = u.id) +
+			(SELECT COALESCE(SUM(OCTET_LENGTH(a.data)), 0) FROM note_attachments a JOIN notes n ON n.id = a.note_id
+				WHERE n.user_id = u.id)
+		FROM users u WHERE u.id = $1`
+	err := s.DB.QueryRowContext(s.Ctx, query, userID).Scan(&usage.NotesCount, &usage.TagsCount, &usage.SharedCount,
+		&usage.ReceivedCount, &usage.StorageBytes)
+	if err == sql.ErrNoRows {
+		return usage, ErrUserNotFound
+	}
+	return usage, err
+}
+
+// SetDisabled блокирует или разблокирует пользователя. Блокировка завершает все его сессии.
+func (s *AdminService) SetDisabled(adminID, userID int, disabled bool) error {
+	if disabled && adminID == userID {
+		return ErrSelfDemotion
+	}
+	query := `UPDATE users SET disabled_at = NULL WHERE id = $1`
+	if disabled {
+		query = `UPDATE users SET disabled_at = CURRENT_TIMESTAMP, token_version = token_version + 1 WHERE id = $1`
+	}
+	if err := s.execForUser(query, userID); err != nil {
+		return err
+	}
+	action := models.AuditAdminUserEnabled
+	if disabled {
+		action = models.AuditAdminUserDisabled
+	}
+	audit(s.Ctx, s.DB, s.Client, adminID, action, models.AuditTargetUser, userID, nil)
+	return nil
+}
+
+// ForceLogout делает недействительными все выданные пользователю токены
+func (s *AdminService) ForceLogout(adminID, userID int) error {
+	if err := s.execForUser(`UPDATE users SET token_version = token_version + 1 WHERE id = $1`, userID); err != nil {
+		return err
+	}
+	audit(s.Ctx, s.DB, s.Client, adminID, models.AuditAdminLogout, models.AuditTargetUser, userID, nil)
+	return nil
+}
+
+// ResetPassword устанавливает пользователю новый пароль и завершает его сессии
+func (s *AdminService) ResetPassword(adminID, userID int, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE users SET password = $1, token_version = token_version + 1 WHERE id = $2`
+	res, err := s.DB.ExecContext(s.Ctx, query, string(hashedPassword), userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	audit(s.Ctx, s.DB, s.Client, adminID, models.AuditAdminPasswordReset, models.AuditTargetUser, userID, nil)
+	return nil
+}
+
+// SetRole меняет роль пользователя
+func (s *AdminService) SetRole(adminID, userID int, role string) error {
+	if role != models.RoleUser && role != models.RoleAdmin {
+		return ErrInvalidRole
+	}
+	if adminID == userID && role != models.RoleAdmin {
+		return ErrSelfDemotion
+	}
+	var before string
+	err := s.DB.QueryRowContext(s.Ctx, `UPDATE users u SET role = $1 FROM users old WHERE u.id = $2 AND old.id = u.id RETURNING old.role`,
+		role, userID).Scan(&before)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	audit(s.Ctx, s.DB, s.Client, adminID, models.AuditAdminRoleChanged, models.AuditTargetUser, userID,
+		map[string]string{"before": before, "after": role})
+	return nil
+}
+
+// PromoteAdmins назначает администраторами пользователей с указанными именами
+func (s *AdminService) PromoteAdmins(usernames []string) error {
+	for _, username := range usernames {
+		username = strings.TrimSpace(username)
+		if _, err := s.DB.ExecContext(s.Ctx, `UPDATE users SET role = $1 WHERE username = $2`, models.RoleAdmin, username); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BreakGlassNote возвращает любую заметку администратору, записывая обращение в журнал.
+// Запись в журнал и чтение заметки выполняются в одной транзакции: без записи доступа нет.
+func (s *AdminService) BreakGlassNote(adminID, noteID int, reason, ip string) (models.Note, error) {
+	var note models.Note
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return note, err
+	}
+	defer tx.Rollback()
+	query := `SELECT id, title, content, content_format, user_id, created_at, updated_at FROM notes WHERE id = $1`
+	err = tx.QueryRowContext(s.Ctx, query, noteID).Scan(&note.ID, &note.Title, &note.Content, &note.ContentFormat, &note.UserID, &note.CreatedAt, &note.UpdatedAt)
+	if err != nil {
+		return note, err
+	}
+	_, err = tx.ExecContext(s.Ctx, `INSERT INTO break_glass_log (admin_id, note_id, owner_id, reason, ip) VALUES ($1, $2, $3, $4, $5)`,
+		adminID, note.ID, note.UserID, reason, ip)
+	if err != nil {
+		return note, err
+	}
+	if err := tx.Commit(); err != nil {
+		return note, err
+	}
+	audit(s.Ctx, s.DB, s.Client, adminID, models.AuditAdminBreakGlass, models.AuditTargetNote, note.ID,
+		map[string]interface{}{"owner_id": note.UserID, "reason": reason})
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	note.Tags, err = noteService.GetTagsForNote(note.ID)
+	return note, err
+}
+
+// GetBreakGlassLog возвращает журнал экстренного доступа к заметкам
+func (s *AdminService) GetBreakGlassLog(page, limit int) ([]models.BreakGlassRecord, error) {
+	offset := (page - 1) * limit
+	query := `SELECT id, COALESCE(admin_id, 0), note_id, owner_id, reason, ip, created_at
+		FROM break_glass_log ORDER BY id DESC LIMIT $1 OFFSET $2`
+	rows, err := s.DB.QueryContext(s.Ctx, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records := []models.BreakGlassRecord{}
+	for rows.Next() {
+		var record models.BreakGlassRecord
+		if err := rows.Scan(&record.ID, &record.AdminID, &record.NoteID, &record.OwnerID, &record.Reason,
+			&record.IP, &record.CreatedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (s *AdminService) execForUser(query string, userID int) error {
+	res, err := s.DB.ExecContext(s.Ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// ListJobs возвращает задачи всех пользователей, новые первыми; status отбирает задачи с этим статусом
+func (s *AdminService) ListJobs(status string, page, limit int) ([]models.Job, error) {
+	offset := (page - 1) * limit
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+jobColumns+` FROM jobs WHERE $1 = '' OR status = $1
+		ORDER BY id DESC LIMIT $2 OFFSET $3`, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobs := []models.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// RetryJob заново ставит в очередь задачу, исчерпавшую попытки
+func (s *AdminService) RetryJob(adminID, jobID int) (models.Job, error) {
+	job, err := scanJob(s.DB.QueryRowContext(s.Ctx, `UPDATE jobs SET status = $1, attempts = 0, run_at = CURRENT_TIMESTAMP,
+		last_error = '', completed_at = NULL WHERE id = $2 AND status = $3 RETURNING `+jobColumns,
+		JobPending, jobID, JobDead))
+	if err == nil {
+		audit(s.Ctx, s.DB, s.Client, adminID, models.AuditAdminJobRetried, models.AuditTargetJob, jobID,
+			map[string]string{"kind": job.Kind})
+	}
+	if err != sql.ErrNoRows {
+		return job, err
+	}
+	var status string
+	if err := s.DB.QueryRowContext(s.Ctx, `SELECT status FROM jobs WHERE id = $1`, jobID).Scan(&status); err == sql.ErrNoRows {
+		return job, ErrJobNotFound
+	} else if err != nil {
+		return job, err
+	}
+	return job, ErrJobNotDead
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"notes-api/internal/models"
+	"path"
+	"strings"
+)
+
+// maxAttachmentSize - наибольший размер одного вложения
+const maxAttachmentSize = 10 << 20
+
+var (
+	ErrAttachmentNotFound = errors.New("вложение не найдено")
+	ErrAttachmentTooLarge = errors.New("слишком большое вложение")
+)
+
+// AttachmentService предоставляет методы для работы с вложениями заметок
+type AttachmentService struct {
+	DB  *sql.DB
+	Ctx context.Context // Контекст запроса: его отмена прерывает запросы к базе данных
+}
+
+// GetAttachments возвращает вложения заметки, доступной пользователю
+func (s *AttachmentService) GetAttachments(noteID, userID int) ([]models.Attachment, error) {
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	if _, err := noteService.requireNote(noteID, userID, models.PermissionViewer); err != nil {
+		return nil, err
+	}
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT id, note_id, filename, mime_type, size, created_at
+		FROM note_attachments WHERE note_id = $1 ORDER BY id`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	attachments := []models.Attachment{}
+	for rows.Next() {
+		var attachment models.Attachment
+		if err := rows.Scan(&attachment.ID, &attachment.NoteID, &attachment.FileName, &attachment.MimeType,
+			&attachment.Size, &attachment.CreatedAt); err != nil {
+			return nil, err
+		}
+		attachment.URL = attachmentURL(attachment.ID)
+		attachments = append(attachments, attachment)
+	}
+	return attachments, rows.Err()
+}
+
+// GetAttachment возвращает вложение с содержимым, если пользователю доступна его заметка
+func (s *AttachmentService) GetAttachment(attachmentID, userID int) (models.Attachment, []byte, error) {
+	var attachment models.Attachment
+	var data []byte
+	err := s.DB.QueryRowContext(s.Ctx, `SELECT id, note_id, filename, mime_type, size, created_at, data FROM note_attachments WHERE id = $1`,
+		attachmentID).Scan(&attachment.ID, &attachment.NoteID, &attachment.FileName, &attachment.MimeType,
+		&attachment.Size, &attachment.CreatedAt, &data)
+	if err == sql.ErrNoRows {
+		return attachment, nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return attachment, nil, err
+	}
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	if _, err := noteService.requireNote(attachment.NoteID, userID, models.PermissionViewer); err != nil {
+		if errors.Is(err, ErrNoteNotFound) {
+			return attachment, nil, ErrAttachmentNotFound
+		}
+		return attachment, nil, err
+	}
+	attachment.URL = attachmentURL(attachment.ID)
+	return attachment, data, nil
+}
+
+// addAttachment сохраняет вложение заметки. Тип файла определяется по содержимому, если не указан.
+func addAttachment(ctx context.Context, q dbtx, noteID int, filename, mimeType string, data []byte) (models.Attachment, error) {
+	attachment := models.Attachment{NoteID: noteID, FileName: attachmentName(filename), MimeType: mimeType, Size: len(data)}
+	if len(data) > maxAttachmentSize {
+		return attachment, ErrAttachmentTooLarge
+	}
+	if attachment.MimeType == "" {
+		attachment.MimeType = mime.TypeByExtension(path.Ext(attachment.FileName))
+	}
+	if attachment.MimeType == "" {
+		attachment.MimeType = http.DetectContentType(data)
+	}
+	err := q.QueryRowContext(ctx, `INSERT INTO note_attachments (note_id, filename, mime_type, size, data)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`,
+		noteID, attachment.FileName, truncateRunes(attachment.MimeType, 254), attachment.Size, data).
+		Scan(&attachment.ID, &attachment.CreatedAt)
+	attachment.URL = attachmentURL(attachment.ID)
+	return attachment, err
+}
+
+// attachmentName оставляет от имени файла вложения только базовое имя
+func attachmentName(filename string) string {
+	name := path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	if name == "." || name == "/" {
+		name = "attachment"
+	}
+	return truncateRunes(name, 254)
+}
+
+func attachmentURL(attachmentID int) string {
+	return fmt.Sprintf("/attachments/%d", attachmentID)
+}
+
+// IsInlineImage проверяет, что вложение можно показывать в браузере как изображение.
+// SVG исключен: он может содержать скрипты.
+func IsInlineImage(mimeType string) bool {
+	switch mimeType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
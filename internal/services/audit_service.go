@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"io"
+	"log/slog"
+	"notes-api/internal/models"
+	"strconv"
+	"time"
+)
+
+const auditColumns = `id, actor_id, actor_name, action, target_type, target_id, ip, user_agent, details, created_at`
+
+// auditExportLimit ограничивает число записей в одной CSV-выгрузке
+const auditExportLimit = 100000
+
+// AuditService предоставляет методы для записи и чтения журнала аудита
+type AuditService struct {
+	DB  *sql.DB
+	Ctx context.Context // Контекст запроса: его отмена прерывает запросы к базе данных
+}
+
+// Record добавляет запись в журнал аудита. actorID и targetID, равные 0, записываются как NULL.
+func (s *AuditService) Record(client models.ClientInfo, actorID int, action, targetType string, targetID int, details interface{}) error {
+	var detailsJSON []byte
+	if details != nil {
+		var err error
+		if detailsJSON, err = json.Marshal(details); err != nil {
+			return err
+		}
+	}
+	_, err := s.DB.ExecContext(s.Ctx, `INSERT INTO audit_log (actor_id, actor_name, action, target_type, target_id, ip, user_agent, details)
+		VALUES ($1, COALESCE((SELECT username FROM users WHERE id = $1), ''), $2, $3, $4, $5, $6, $7)`,
+		nullableID(actorID), action, targetType, nullableID(targetID), client.IP, client.UserAgent, detailsJSON)
+	return err
+}
+
+// audit записывает действие в журнал, не прерывая его: ошибка только записывается в лог
+func audit(ctx context.Context, db *sql.DB, client models.ClientInfo, actorID int, action, targetType string, targetID int, details interface{}) {
+	auditService := AuditService{DB: db, Ctx: ctx}
+	if err := auditService.Record(client, actorID, action, targetType, targetID, details); err != nil {
+		slog.ErrorContext(ctx, "Ошибка при записи в журнал аудита", "action", action, "error", err)
+	}
+}
+
+// GetUserActivity возвращает события безопасности пользователя: его входы, изменения аккаунта
+// и действия администраторов над ним
+func (s *AuditService) GetUserActivity(userID, page, limit int) ([]models.AuditEntry, error) {
+	offset := (page - 1) * limit
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+auditColumns+` FROM audit_log
+		WHERE (actor_id = $1 OR (target_type = $2 AND target_id = $1)) AND action = ANY($3)
+		ORDER BY id DESC LIMIT $4 OFFSET $5`,
+		userID, models.AuditTargetUser, pq.Array(models.SecurityAuditActions), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanAuditEntries(rows)
+}
+
+// Query возвращает записи журнала, удовлетворяющие фильтру, новые первыми
+func (s *AuditService) Query(filter models.AuditFilter, page, limit int) ([]models.AuditEntry, error) {
+	where, args := auditWhere(filter)
+	args = append(args, limit, (page-1)*limit)
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+auditColumns+` FROM audit_log`+where+
+		fmt.Sprintf(` ORDER BY id DESC LIMIT $%d OFFSET $%d`, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanAuditEntries(rows)
+}
+
+// ExportCSV записывает в w записи журнала, удовлетворяющие фильтру, в формате CSV
+func (s *AuditService) ExportCSV(filter models.AuditFilter, w io.Writer) error {
+	where, args := auditWhere(filter)
+	args = append(args, auditExportLimit)
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+auditColumns+` FROM audit_log`+where+
+		fmt.Sprintf(` ORDER BY id DESC LIMIT $%d`, len(args)), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	writer := csv.NewWriter(w)
+	header := []string{"id", "created_at", "actor_id", "actor_name", "action", "target_type", "target_id", "ip", "user_agent", "details"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return err
+		}
+		record := []string{
+			strconv.Itoa(entry.ID), entry.CreatedAt.Format(time.RFC3339), optionalID(entry.ActorID), entry.ActorName,
+			entry.Action, entry.TargetType, optionalID(entry.TargetID), entry.IP, entry.UserAgent, string(entry.Details),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// auditWhere строит условие WHERE и его аргументы по фильтру
+func auditWhere(filter models.AuditFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.ActorID != nil {
+		add("actor_id = $%d", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		add("action = $%d", filter.Action)
+	}
+	if filter.TargetType != "" {
+		add("target_type = $%d", filter.TargetType)
+	}
+	if filter.TargetID != nil {
+		add("target_id = $%d", *filter.TargetID)
+	}
+	if filter.From != nil {
+		add("created_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		add("created_at < $%d", *filter.To)
+	}
+	where := ""
+	for i, condition := range conditions {
+		if i == 0 {
+			where = " WHERE " + condition
+		} else {
+			where += " AND " + condition
+		}
+	}
+	return where, args
+}
+
+func scanAuditEntry(row rowScanner) (models.AuditEntry, error) {
+	var entry models.AuditEntry
+	var details []byte
+	err := row.Scan(&entry.ID, &entry.ActorID, &entry.ActorName, &entry.Action, &entry.TargetType, &entry.TargetID,
+		&entry.IP, &entry.UserAgent, &details, &entry.CreatedAt)
+	entry.Details = details
+	return entry, err
+}
+
+func scanAuditEntries(rows *sql.Rows) ([]models.AuditEntry, error) {
+	defer rows.Close()
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func nullableID(id int) *int {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+func optionalID(id *int) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.Itoa(*id)
+}
@@ -0,0 +1,370 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/lib/pq"
+	"notes-api/internal/models"
+)
+
+// maxAsyncBatchNotes - наибольшее число заметок в фоновой групповой операции
+const maxAsyncBatchNotes = 10000
+
+// Статусы фоновой групповой обработки
+const (
+	BatchPending   = "pending"
+	BatchCompleted = "completed"
+	BatchFailed    = "failed"
+)
+
+var (
+	ErrInvalidBatchOperation = errors.New("неизвестная или неполная операция: delete должна быть последней, tag и untag требуют tags")
+	ErrBatchNotesRequired    = errors.New("укажите note_ids или filter")
+	ErrBatchJobNotFound      = errors.New("задача не найдена")
+)
+
+// batchCanceled - ошибка заметки, изменения которой отменены из-за ошибок в других заметках атомарной обработки
+const batchCanceled = "отменено из-за ошибок в других заметках"
+
+// BatchService выполняет групповые операции над заметками
+type BatchService struct {
+	DB     *sql.DB
+	Client models.ClientInfo // Клиент, выполняющий запрос; записывается в журнал аудита
+	Ctx    context.Context   // Контекст запроса: его отмена прерывает запросы к базе данных
+}
+
+// batchPlan - проверенный запрос групповой обработки
+type batchPlan struct {
+	noteIDs    []int
+	operations []models.BatchOperation
+	atomic     bool
+	required   string           // Уровень доступа, нужный для всех операций
+	notebook   *models.Notebook // Блокнот операции move
+	inviteeID  *int             // Получатель операции share
+	email      string
+	permission string
+}
+
+// Run выполняет операции в одной транзакции. Каждая заметка обрабатывается в своей точке сохранения:
+// ошибка доступа к заметке отменяет только ее изменения, а в атомарном режиме - все изменения.
+func (s *BatchService) Run(userID int, request models.BatchRequest) (models.BatchResult, error) {
+	plan, err := s.prepare(userID, request, maxBulkNotes)
+	if err != nil {
+		return models.BatchResult{}, err
+	}
+	return s.execute(userID, plan)
+}
+
+// Start проверяет запрос, фиксирует выбранные фильтром заметки и ставит обработку в очередь задач
+func (s *BatchService) Start(userID int, request models.BatchRequest) (models.BatchJob, error) {
+	job := models.BatchJob{Status: BatchPending}
+	plan, err := s.prepare(userID, request, maxAsyncBatchNotes)
+	if err != nil {
+		return job, err
+	}
+	request.NoteIDs, request.Filter, request.Async = plan.noteIDs, nil, false
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return job, err
+	}
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return job, err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(s.Ctx, `INSERT INTO batch_jobs (user_id, status, request) VALUES ($1, $2, $3) RETURNING id, created_at`,
+		userID, BatchPending, payload).Scan(&job.ID, &job.CreatedAt)
+	if err != nil {
+		return job, err
+	}
+	job.JobID, err = enqueueJob(s.Ctx, tx, JobBatch, &userID, jobRef{ID: job.ID, Client: s.Client}, 0)
+	if err != nil {
+		return job, err
+	}
+	return job, tx.Commit()
+}
+
+// GetJob возвращает состояние фоновой обработки пользователя
+func (s *BatchService) GetJob(jobID, userID int) (models.BatchJob, error) {
+	var job models.BatchJob
+	var result []byte
+	err := s.DB.QueryRowContext(s.Ctx, `SELECT id, status, error, result, created_at, completed_at FROM batch_jobs
+		WHERE id = $1 AND user_id = $2`, jobID, userID).
+		Scan(&job.ID, &job.Status, &job.Error, &result, &job.CreatedAt, &job.CompletedAt)
+	if err == sql.ErrNoRows {
+		return job, ErrBatchJobNotFound
+	}
+	if err != nil {
+		return job, err
+	}
+	if result != nil {
+		job.Result = &models.BatchResult{}
+		if err := json.Unmarshal(result, job.Result); err != nil {
+			return job, err
+		}
+	}
+	return job, nil
+}
+
+// runBatchJob выполняет сохраненный запрос групповой обработки. Обработка идет в одной транзакции,
+// поэтому после сбоя ее можно повторить; ошибка проверки запроса не повторяется.
+func runBatchJob(ctx context.Context, db *sql.DB, job models.Job) (interface{}, error) {
+	ref, err := jobTarget(job)
+	if err != nil {
+		return nil, err
+	}
+	var userID int
+	var status string
+	var payload []byte
+	err = db.QueryRowContext(ctx, `SELECT user_id, status, request FROM batch_jobs WHERE id = $1`, ref.ID).
+		Scan(&userID, &status, &payload)
+	if err == sql.ErrNoRows {
+		return nil, permanentJobError{errJobTargetGone}
+	}
+	if err != nil || status == BatchCompleted {
+		return nil, err
+	}
+	var request models.BatchRequest
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return nil, permanentJobError{err}
+	}
+	s := BatchService{DB: db, Ctx: ctx, Client: ref.Client}
+	plan, err := s.prepare(userID, request, maxAsyncBatchNotes)
+	if err != nil {
+		return nil, permanentJobError{err}
+	}
+	result, err := s.execute(userID, plan)
+	if err != nil {
+		return nil, err
+	}
+	if payload, err = json.Marshal(result); err != nil {
+		return nil, err
+	}
+	_, err = db.ExecContext(ctx, `UPDATE batch_jobs SET status = $1, error = '', result = $2, completed_at = CURRENT_TIMESTAMP
+		WHERE id = $3`, BatchCompleted, payload, ref.ID)
+	return map[string]interface{}{"total": result.Total, "succeeded": result.Succeeded, "failed": result.Failed,
+		"rolled_back": result.RolledBack}, err
+}
+
+// failBatchJob отмечает обработку неудавшейся, когда задача исчерпала попытки
+func failBatchJob(db *sql.DB, job models.Job, err error) error {
+	ref, refErr := jobTarget(job)
+	if refErr != nil {
+		return nil
+	}
+	_, err = db.Exec(`UPDATE batch_jobs SET status = $1, error = $2, completed_at = CURRENT_TIMESTAMP WHERE id = $3`,
+		BatchFailed, err.Error(), ref.ID)
+	return err
+}
+
+// prepare проверяет операции, выбирает заметки и находит блокнот и получателя приглашения
+func (s *BatchService) prepare(userID int, request models.BatchRequest, limit int) (batchPlan, error) {
+	plan := batchPlan{operations: request.Operations, atomic: request.Atomic, required: models.PermissionEditor}
+	if len(request.Operations) == 0 {
+		return plan, ErrInvalidBatchOperation
+	}
+	for i, op := range request.Operations {
+		switch op.Op {
+		case models.BatchDelete:
+			if i != len(request.Operations)-1 {
+				return plan, ErrInvalidBatchOperation
+			}
+			plan.required = models.PermissionOwner
+		case models.BatchTag, models.BatchUntag:
+			if len(op.Tags) == 0 {
+				return plan, ErrInvalidBatchOperation
+			}
+		case models.BatchMove:
+			if op.NotebookID != nil {
+				notebookService := NotebookService{DB: s.DB, Ctx: s.Ctx}
+				notebook, err := notebookService.requireNotebook(*op.NotebookID, userID, true)
+				if err != nil {
+					return plan, err
+				}
+				plan.notebook = &notebook
+			}
+		case models.BatchArchive, models.BatchUnarchive:
+		case models.BatchShare:
+			permission, err := validSharePermission(op.Permission)
+			if err != nil {
+				return plan, err
+			}
+			invitationService := InvitationService{DB: s.DB, Ctx: s.Ctx}
+			inviteeID, email, err := invitationService.resolveRecipient(models.ShareNoteRequest{
+				UserID: op.UserID, Username: op.Username, Email: op.Email})
+			if err != nil {
+				return plan, err
+			}
+			plan.inviteeID, plan.email, plan.permission = inviteeID, email, permission
+			plan.required = models.PermissionOwner
+		default:
+			return plan, ErrInvalidBatchOperation
+		}
+	}
+	switch {
+	case request.Filter != nil:
+		noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+		notes, err := noteService.GetNotes(userID, models.NoteFilter{
+			Query: request.Filter.Q, Tag: request.Filter.Tag, NotebookID: request.Filter.NotebookID,
+			Archived: request.Filter.Archived}, 1, limit+1)
+		if err != nil {
+			return plan, err
+		}
+		for _, note := range notes {
+			plan.noteIDs = append(plan.noteIDs, note.ID)
+		}
+	case len(request.NoteIDs) > 0:
+		seen := map[int]bool{}
+		for _, id := range request.NoteIDs {
+			if !seen[id] {
+				seen[id] = true
+				plan.noteIDs = append(plan.noteIDs, id)
+			}
+		}
+	default:
+		return plan, ErrBatchNotesRequired
+	}
+	if len(plan.noteIDs) > limit {
+		return plan, ErrTooManyNotes
+	}
+	return plan, nil
+}
+
+func (s *BatchService) execute(userID int, plan batchPlan) (models.BatchResult, error) {
+	result := models.BatchResult{Total: len(plan.noteIDs), Results: []models.BulkNoteResult{}}
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+	// Доступ ко всем заметкам проверяется одним набором запросов в той же транзакции
+	notes, err := accessibleNotes(s.Ctx, tx, plan.noteIDs, userID)
+	if err != nil {
+		return result, err
+	}
+	// Уведомления, вебхуки и журнал аудита отправляются только после фиксации транзакции
+	var effects []func()
+	for _, noteID := range plan.noteIDs {
+		item := models.BulkNoteResult{NoteID: noteID, OK: true}
+		if _, err := tx.ExecContext(s.Ctx, `SAVEPOINT batch_note`); err != nil {
+			return result, err
+		}
+		noteEffects, err := s.apply(tx, userID, noteID, notes, plan)
+		if err != nil {
+			if !batchItemError(err) {
+				return result, err
+			}
+			if _, err := tx.ExecContext(s.Ctx, `ROLLBACK TO SAVEPOINT batch_note`); err != nil {
+				return result, err
+			}
+			item.OK, item.Error = false, err.Error()
+			result.Failed++
+		} else {
+			if _, err := tx.ExecContext(s.Ctx, `RELEASE SAVEPOINT batch_note`); err != nil {
+				return result, err
+			}
+			effects = append(effects, noteEffects...)
+			result.Succeeded++
+		}
+		result.Results = append(result.Results, item)
+	}
+	if plan.atomic && result.Failed > 0 {
+		for i := range result.Results {
+			if result.Results[i].OK {
+				result.Results[i].OK, result.Results[i].Error = false, batchCanceled
+			}
+		}
+		result.Succeeded, result.Failed, result.RolledBack = 0, result.Total, true
+		return result, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return result, err
+	}
+	for _, effect := range effects {
+		effect()
+	}
+	return result, nil
+}
+
+// apply выполняет все операции над одной заметкой и возвращает действия, которые нужно выполнить после фиксации.
+// notes - доступные пользователю заметки обработки с уровнем доступа.
+func (s *BatchService) apply(tx *sql.Tx, userID, noteID int, notes map[int]models.Note, plan batchPlan) ([]func(), error) {
+	note, ok := notes[noteID]
+	if !ok {
+		// Не раскрываем существование чужих заметок
+		return nil, ErrNoteNotFound
+	}
+	if !hasPermission(note.Permission, plan.required) {
+		return nil, ErrNoteForbidden
+	}
+	var err error
+	var effects []func()
+	for _, op := range plan.operations {
+		switch op.Op {
+		case models.BatchTag:
+			tags := make([]models.Tag, 0, len(op.Tags))
+			for _, name := range op.Tags {
+				tags = append(tags, models.Tag{Name: name})
+			}
+			if err := addNoteTags(s.Ctx, tx, noteID, note.TeamID, tags); err != nil {
+				return nil, err
+			}
+			effects = append(effects, func() {
+				dispatchEvent(s.Ctx, s.DB, models.EventTagAdded, note, map[string]interface{}{"note_id": noteID, "tags": tags})
+			})
+		case models.BatchUntag:
+			_, err = tx.ExecContext(s.Ctx, `DELETE FROM note_tags WHERE note_id = $1 AND tag_id IN (
+				SELECT id FROM tags WHERE name = ANY($2) AND COALESCE(team_id, 0) = COALESCE($3, 0))`,
+				noteID, pq.Array(op.Tags), note.TeamID)
+		case models.BatchMove:
+			var notebookID *int
+			if plan.notebook != nil {
+				if !sameOwner(note, *plan.notebook) {
+					return nil, ErrNotebookMismatch
+				}
+				notebookID = &plan.notebook.ID
+			}
+			_, err = tx.ExecContext(s.Ctx, `UPDATE notes SET notebook_id = $1 WHERE id = $2`, notebookID, noteID)
+		case models.BatchArchive, models.BatchUnarchive:
+			_, err = tx.ExecContext(s.Ctx, `UPDATE notes SET archived = $1 WHERE id = $2`, op.Op == models.BatchArchive, noteID)
+		case models.BatchShare:
+			if note.TeamID != nil {
+				return nil, ErrTeamNoteShare
+			}
+			if plan.inviteeID != nil && *plan.inviteeID == note.UserID {
+				return nil, ErrShareWithOwner
+			}
+			invitationID, err := upsertInvitation(s.Ctx, tx, noteID, userID, plan.inviteeID, plan.email, plan.permission)
+			if err != nil {
+				return nil, err
+			}
+			effects = append(effects, func() {
+				invitationService := InvitationService{DB: s.DB, Ctx: s.Ctx, Client: s.Client}
+				invitationService.invited(note, userID, invitationID, plan.inviteeID, plan.email, plan.permission)
+			})
+		case models.BatchDelete:
+			_, err = tx.ExecContext(s.Ctx, `DELETE FROM notes WHERE id = $1`, noteID)
+			effects = append(effects, func() {
+				dispatchEvent(s.Ctx, s.DB, models.EventNoteDeleted, note, note)
+				audit(s.Ctx, s.DB, s.Client, userID, models.AuditNoteDeleted, models.AuditTargetNote, noteID, noteSummary(note))
+			})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return effects, nil
+}
+
+// batchItemError сообщает, что ошибка относится к одной заметке и не должна прерывать всю обработку
+func batchItemError(err error) bool {
+	for _, target := range []error{ErrNoteNotFound, ErrNoteForbidden, ErrNotebookMismatch, ErrShareWithOwner,
+		ErrTeamNoteShare} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,308 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"notes-api/internal/models"
+	"strings"
+	"time"
+)
+
+var (
+	ErrChecklistItemNotFound = errors.New("пункт списка задач не найден")
+	ErrInvalidDueDate        = errors.New("срок должен быть в формате YYYY-MM-DD")
+	ErrInvalidAssignee       = errors.New("исполнитель должен иметь доступ к заметке")
+	ErrInvalidItemOrder      = errors.New("item_ids должен содержать все пункты заметки ровно по одному разу")
+)
+
+// checklistColumns - список столбцов пункта для запросов с псевдонимами ci, n и assignee
+const checklistColumns = `ci.id, ci.note_id, n.title, ci.text, ci.checked, ci.position, TO_CHAR(ci.due_date, 'YYYY-MM-DD'),
+	ci.assignee_id, COALESCE(assignee.username, ''), ci.checked_at, ci.created_at, ci.updated_at`
+
+const checklistJoins = ` FROM checklist_items ci
+	JOIN notes n ON n.id = ci.note_id
+	LEFT JOIN users assignee ON assignee.id = ci.assignee_id`
+
+// ChecklistService предоставляет методы для работы со списками задач в заметках
+type ChecklistService struct {
+	DB  *sql.DB
+	Ctx context.Context // Контекст запроса: его отмена прерывает запросы к базе данных
+}
+
+func scanChecklistItem(row rowScanner) (models.ChecklistItem, error) {
+	var item models.ChecklistItem
+	err := row.Scan(&item.ID, &item.NoteID, &item.NoteTitle, &item.Text, &item.Checked, &item.Position, &item.DueDate,
+		&item.AssigneeID, &item.AssigneeName, &item.CheckedAt, &item.CreatedAt, &item.UpdatedAt)
+	return item, err
+}
+
+func scanChecklistItems(rows *sql.Rows) ([]models.ChecklistItem, error) {
+	defer rows.Close()
+	items := []models.ChecklistItem{}
+	for rows.Next() {
+		item, err := scanChecklistItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// GetItems возвращает пункты списка задач заметки по порядку
+func (s *ChecklistService) GetItems(noteID, userID int) ([]models.ChecklistItem, error) {
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	if _, err := noteService.requireNote(noteID, userID, models.PermissionViewer); err != nil {
+		return nil, err
+	}
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+checklistColumns+checklistJoins+`
+		WHERE ci.note_id = $1 ORDER BY ci.position, ci.id`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	return scanChecklistItems(rows)
+}
+
+// CreateItem добавляет пункт в список задач. Без position пункт добавляется в конец,
+// иначе следующие пункты сдвигаются.
+func (s *ChecklistService) CreateItem(noteID, userID int, request models.CreateChecklistItemRequest) (models.ChecklistItem, error) {
+	var item models.ChecklistItem
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	if _, err := noteService.requireNote(noteID, userID, models.PermissionEditor); err != nil {
+		return item, err
+	}
+	dueDate, err := parseDueDate(request.DueDate)
+	if err != nil {
+		return item, err
+	}
+	if err := s.checkAssignee(noteID, request.AssigneeID); err != nil {
+		return item, err
+	}
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return item, err
+	}
+	defer tx.Rollback()
+	// Блокируем заметку, чтобы параллельные вставки не получили одинаковые позиции
+	if _, err := tx.ExecContext(s.Ctx, `SELECT id FROM notes WHERE id = $1 FOR UPDATE`, noteID); err != nil {
+		return item, err
+	}
+	var position int
+	if err := tx.QueryRowContext(s.Ctx, `SELECT COUNT(*) FROM checklist_items WHERE note_id = $1`, noteID).Scan(&position); err != nil {
+		return item, err
+	}
+	if request.Position != nil && *request.Position >= 0 && *request.Position < position {
+		position = *request.Position
+		_, err = tx.ExecContext(s.Ctx, `UPDATE checklist_items SET position = position + 1 WHERE note_id = $1 AND position >= $2`, noteID, position)
+		if err != nil {
+			return item, err
+		}
+	}
+	var itemID int
+	err = tx.QueryRowContext(s.Ctx, `INSERT INTO checklist_items (note_id, text, position, due_date, assignee_id, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		noteID, request.Text, position, dueDate, nullableAssignee(request.AssigneeID), userID).Scan(&itemID)
+	if err != nil {
+		return item, err
+	}
+	if err := tx.Commit(); err != nil {
+		return item, err
+	}
+	return s.getItem(itemID)
+}
+
+// UpdateItem меняет текст, отметку выполнения, срок или исполнителя пункта
+func (s *ChecklistService) UpdateItem(itemID, userID int, request models.UpdateChecklistItemRequest) (models.ChecklistItem, error) {
+	item, err := s.requireItem(itemID, userID, models.PermissionEditor)
+	if err != nil {
+		return item, err
+	}
+	if request.Text != nil {
+		item.Text = *request.Text
+	}
+	checkedChanged := request.Checked != nil && *request.Checked != item.Checked
+	if request.Checked != nil {
+		item.Checked = *request.Checked
+	}
+	dueDate, err := parseDueDate(item.DueDate)
+	if err != nil {
+		return item, err
+	}
+	if request.DueDate != nil {
+		if dueDate, err = parseDueDate(request.DueDate); err != nil {
+			return item, err
+		}
+	}
+	if request.AssigneeID != nil {
+		if err := s.checkAssignee(item.NoteID, request.AssigneeID); err != nil {
+			return item, err
+		}
+		item.AssigneeID = nullableAssignee(request.AssigneeID)
+	}
+	_, err = s.DB.ExecContext(s.Ctx, `UPDATE checklist_items SET text = $1, checked = $2, due_date = $3, assignee_id = $4,
+		checked_at = CASE WHEN NOT $2 THEN NULL WHEN $5 THEN CURRENT_TIMESTAMP ELSE checked_at END,
+		updated_at = CURRENT_TIMESTAMP
+		WHERE id = $6`, item.Text, item.Checked, dueDate, item.AssigneeID, checkedChanged, itemID)
+	if err != nil {
+		return item, err
+	}
+	return s.getItem(itemID)
+}
+
+// DeleteItem удаляет пункт и сдвигает следующие за ним
+func (s *ChecklistService) DeleteItem(itemID, userID int) error {
+	item, err := s.requireItem(itemID, userID, models.PermissionEditor)
+	if err != nil {
+		return err
+	}
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(s.Ctx, `DELETE FROM checklist_items WHERE id = $1`, itemID); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(s.Ctx, `UPDATE checklist_items SET position = position - 1 WHERE note_id = $1 AND position > $2`,
+		item.NoteID, item.Position)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Reorder задает порядок пунктов заметки; itemIDs должен содержать все ее пункты
+func (s *ChecklistService) Reorder(noteID, userID int, itemIDs []int) ([]models.ChecklistItem, error) {
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	if _, err := noteService.requireNote(noteID, userID, models.PermissionEditor); err != nil {
+		return nil, err
+	}
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(s.Ctx, `SELECT id FROM checklist_items WHERE note_id = $1 FOR UPDATE`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	existing := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		existing[id] = true
+	}
+	rows.Close()
+	if len(itemIDs) != len(existing) {
+		return nil, ErrInvalidItemOrder
+	}
+	for position, id := range itemIDs {
+		if !existing[id] {
+			return nil, ErrInvalidItemOrder
+		}
+		delete(existing, id)
+		if _, err := tx.ExecContext(s.Ctx, `UPDATE checklist_items SET position = $1 WHERE id = $2`, position, id); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetItems(noteID, userID)
+}
+
+// GetTasks возвращает невыполненные пункты во всех доступных пользователю заметках:
+// сначала с ближайшим сроком, затем без срока
+func (s *ChecklistService) GetTasks(userID int, filter models.TaskFilter, page, limit int) ([]models.ChecklistItem, error) {
+	conditions := []string{"NOT ci.checked", "ci.note_id IN (" + accessibleNoteIDs("$1") + ")"}
+	args := []interface{}{userID}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.AssigneeID != nil {
+		add("ci.assignee_id = $%d", *filter.AssigneeID)
+	}
+	if filter.Unassigned {
+		conditions = append(conditions, "ci.assignee_id IS NULL")
+	}
+	if filter.DueBefore != nil {
+		add("ci.due_date <= $%d", *filter.DueBefore)
+	}
+	if filter.DueAfter != nil {
+		add("ci.due_date >= $%d", *filter.DueAfter)
+	}
+	args = append(args, limit, (page-1)*limit)
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+checklistColumns+checklistJoins+`
+		WHERE `+strings.Join(conditions, " AND ")+
+		fmt.Sprintf(` ORDER BY ci.due_date NULLS LAST, ci.note_id, ci.position LIMIT $%d OFFSET $%d`, len(args)-1, len(args)),
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanChecklistItems(rows)
+}
+
+// requireItem возвращает пункт, если у пользователя есть доступ уровня required к его заметке
+func (s *ChecklistService) requireItem(itemID, userID int, required string) (models.ChecklistItem, error) {
+	item, err := s.getItem(itemID)
+	if err != nil {
+		return item, err
+	}
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	if _, err := noteService.requireNote(item.NoteID, userID, required); err != nil {
+		if errors.Is(err, ErrNoteNotFound) {
+			return item, ErrChecklistItemNotFound
+		}
+		return item, err
+	}
+	return item, nil
+}
+
+func (s *ChecklistService) getItem(itemID int) (models.ChecklistItem, error) {
+	item, err := scanChecklistItem(s.DB.QueryRowContext(s.Ctx, `SELECT `+checklistColumns+checklistJoins+` WHERE ci.id = $1`, itemID))
+	if err == sql.ErrNoRows {
+		return item, ErrChecklistItemNotFound
+	}
+	return item, err
+}
+
+// checkAssignee проверяет, что исполнитель имеет доступ к заметке. assigneeID = 0 снимает исполнителя.
+func (s *ChecklistService) checkAssignee(noteID int, assigneeID *int) error {
+	if assigneeID == nil || *assigneeID == 0 {
+		return nil
+	}
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	permission, err := noteService.NotePermission(noteID, *assigneeID)
+	if err != nil {
+		return err
+	}
+	if permission == "" {
+		return ErrInvalidAssignee
+	}
+	return nil
+}
+
+func nullableAssignee(assigneeID *int) *int {
+	if assigneeID == nil || *assigneeID == 0 {
+		return nil
+	}
+	return assigneeID
+}
+
+// parseDueDate проверяет срок в формате YYYY-MM-DD; пустая строка означает отсутствие срока
+func parseDueDate(value *string) (*time.Time, error) {
+	if value == nil || *value == "" {
+		return nil, nil
+	}
+	date, err := time.Parse("2006-01-02", *value)
+	if err != nil {
+		return nil, ErrInvalidDueDate
+	}
+	return &date, nil
+}
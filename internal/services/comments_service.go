@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"notes-api/internal/models"
+)
+
+var (
+	ErrCommentNotFound  = errors.New("комментарий не найден")
+	ErrCommentForbidden = errors.New("изменять комментарий может только его автор")
+	ErrInvalidAnchor    = errors.New("фрагмент комментария выходит за границы текста заметки")
+	ErrInvalidParent    = errors.New("ответить можно только на корневой комментарий этой заметки")
+)
+
+const commentColumns = `c.id, c.note_id, c.user_id, u.username, c.parent_id, c.content, c.anchor_start, c.anchor_end,
+	c.anchor_text, c.resolved_at, c.resolved_by, c.created_at, c.updated_at`
+
+func scanComment(row rowScanner) (models.Comment, error) {
+	var comment models.Comment
+	err := row.Scan(&comment.ID, &comment.NoteID, &comment.UserID, &comment.Username, &comment.ParentID, &comment.Content,
+		&comment.AnchorStart, &comment.AnchorEnd, &comment.AnchorText, &comment.ResolvedAt, &comment.ResolvedBy,
+		&comment.CreatedAt, &comment.UpdatedAt)
+	return comment, err
+}
+
+// CommentService предоставляет методы для обсуждения заметок
+type CommentService struct {
+	DB  *sql.DB
+	Ctx context.Context // Контекст запроса: его отмена прерывает запросы к базе данных
+}
+
+// GetComments возвращает обсуждения заметки: корневые комментарии с ответами
+func (s *CommentService) GetComments(noteID, userID int) ([]models.Comment, error) {
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	if _, err := noteService.requireNote(noteID, userID, models.PermissionViewer); err != nil {
+		return nil, err
+	}
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+commentColumns+`
+		FROM comments c JOIN users u ON u.id = c.user_id
+		WHERE c.note_id = $1 ORDER BY c.created_at, c.id`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	threads := []models.Comment{}
+	index := map[int]int{} // ID корневого комментария -> позиция в threads
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		if comment.ParentID == nil {
+			index[comment.ID] = len(threads)
+			threads = append(threads, comment)
+		} else if i, ok := index[*comment.ParentID]; ok {
+			threads[i].Replies = append(threads[i].Replies, comment)
+		}
+	}
+	return threads, rows.Err()
+}
+
+// CreateComment добавляет комментарий или ответ. Требуется доступ к заметке не ниже commenter.
+func (s *CommentService) CreateComment(noteID, userID int, request models.CreateCommentRequest) (models.Comment, error) {
+	var comment models.Comment
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	note, err := noteService.requireNote(noteID, userID, models.PermissionCommenter)
+	if err != nil {
+		return comment, err
+	}
+	anchorText := ""
+	if request.ParentID != nil {
+		// Ответы не привязываются к тексту и не образуют вложенных обсуждений
+		var parentNoteID int
+		var grandParent *int
+		err := s.DB.QueryRowContext(s.Ctx, `SELECT note_id, parent_id FROM comments WHERE id = $1`, *request.ParentID).Scan(&parentNoteID, &grandParent)
+		if err == sql.ErrNoRows || (err == nil && (parentNoteID != noteID || grandParent != nil)) {
+			return comment, ErrInvalidParent
+		}
+		if err != nil {
+			return comment, err
+		}
+		request.AnchorStart, request.AnchorEnd = nil, nil
+	} else if request.AnchorStart != nil || request.AnchorEnd != nil {
+		content := []rune(note.Content)
+		if request.AnchorStart == nil || request.AnchorEnd == nil || *request.AnchorStart < 0 ||
+			*request.AnchorStart >= *request.AnchorEnd || *request.AnchorEnd > len(content) {
+			return comment, ErrInvalidAnchor
+		}
+		anchorText = string(content[*request.AnchorStart:*request.AnchorEnd])
+	}
+	var commentID int
+	err = s.DB.QueryRowContext(s.Ctx, `INSERT INTO comments (note_id, user_id, parent_id, content, anchor_start, anchor_end, anchor_text)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		noteID, userID, request.ParentID, request.Content, request.AnchorStart, request.AnchorEnd, anchorText).Scan(&commentID)
+	if err != nil {
+		return comment, err
+	}
+	comment, err = s.getComment(commentID)
+	if err == nil {
+		notifyCommentAdded(s.Ctx, s.DB, note, comment)
+	}
+	return comment, err
+}
+
+// UpdateComment меняет текст комментария. Доступно только автору.
+func (s *CommentService) UpdateComment(commentID, userID int, content string) (models.Comment, error) {
+	if _, err := s.requireAuthor(commentID, userID); err != nil {
+		return models.Comment{}, err
+	}
+	_, err := s.DB.ExecContext(s.Ctx, `UPDATE comments SET content = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`, content, commentID)
+	if err != nil {
+		return models.Comment{}, err
+	}
+	return s.getComment(commentID)
+}
+
+// DeleteComment удаляет комментарий вместе с ответами на него. Доступно только автору.
+func (s *CommentService) DeleteComment(commentID, userID int) error {
+	if _, err := s.requireAuthor(commentID, userID); err != nil {
+		return err
+	}
+	_, err := s.DB.ExecContext(s.Ctx, `DELETE FROM comments WHERE id = $1`, commentID)
+	return err
+}
+
+// SetResolved закрывает или переоткрывает обсуждение. Доступно автору корневого комментария
+// и пользователям с правом редактирования заметки.
+func (s *CommentService) SetResolved(commentID, userID int, resolved bool) (models.Comment, error) {
+	comment, err := s.getComment(commentID)
+	if err != nil {
+		return comment, err
+	}
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	permission, err := noteService.NotePermission(comment.NoteID, userID)
+	if err != nil {
+		return comment, err
+	}
+	if permission == "" {
+		return comment, ErrCommentNotFound
+	}
+	if comment.UserID != userID && !hasPermission(permission, models.PermissionEditor) {
+		return comment, ErrCommentForbidden
+	}
+	if comment.ParentID != nil {
+		return comment, ErrInvalidParent
+	}
+	query := `UPDATE comments SET resolved_at = NULL, resolved_by = NULL WHERE id = $1`
+	args := []interface{}{commentID}
+	if resolved {
+		query = `UPDATE comments SET resolved_at = CURRENT_TIMESTAMP, resolved_by = $2 WHERE id = $1`
+		args = append(args, userID)
+	}
+	if _, err := s.DB.ExecContext(s.Ctx, query, args...); err != nil {
+		return comment, err
+	}
+	return s.getComment(commentID)
+}
+
+// requireAuthor возвращает комментарий, если пользователь - его автор и все еще имеет доступ к заметке
+func (s *CommentService) requireAuthor(commentID, userID int) (models.Comment, error) {
+	comment, err := s.getComment(commentID)
+	if err != nil {
+		return comment, err
+	}
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	permission, err := noteService.NotePermission(comment.NoteID, userID)
+	if err != nil {
+		return comment, err
+	}
+	if permission == "" {
+		return comment, ErrCommentNotFound
+	}
+	if comment.UserID != userID {
+		return comment, ErrCommentForbidden
+	}
+	return comment, nil
+}
+
+func (s *CommentService) getComment(commentID int) (models.Comment, error) {
+	comment, err := scanComment(s.DB.QueryRowContext(s.Ctx, `SELECT `+commentColumns+`
+		FROM comments c JOIN users u ON u.id = c.user_id WHERE c.id = $1`, commentID))
+	if err == sql.ErrNoRows {
+		return comment, ErrCommentNotFound
+	}
+	return comment, err
+}
@@ -0,0 +1,403 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+	"html"
+	"notes-api/internal/models"
+	"strconv"
+	"strings"
+)
+
+// Виды блоков документа
+const (
+	blockParagraph = iota
+	blockHeading
+	blockCode
+	blockRule
+	blockImage
+	blockTable
+)
+
+// docSpan - фрагмент текста абзаца с оформлением
+type docSpan struct {
+	text   string
+	bold   bool
+	italic bool
+	strike bool
+	code   bool
+	link   string // Внешняя ссылка
+}
+
+// docBlock - блок заметки, подготовленный к выводу в PDF или обычный текст
+type docBlock struct {
+	kind   int
+	level  int    // Уровень заголовка
+	indent int    // Уровень вложенности списков и цитат
+	quote  bool   // Блок внутри цитаты
+	marker string // Маркер пункта списка
+	spans  []docSpan
+	code   string
+	rows   [][]string // Ячейки таблицы, первая строка - заголовок
+	image  int        // ID вложения-изображения
+	alt    string
+}
+
+// docImage - изображение-вложение выгружаемой заметки
+type docImage struct {
+	name     string
+	mimeType string
+	data     []byte
+}
+
+// document - заметки, подготовленные к выгрузке. Изображения берутся только из вложений
+// выгружаемых заметок, поэтому ссылка на чужое вложение в тексте его не раскроет.
+type document struct {
+	title  string // Название блокнота; пусто при выгрузке одной заметки
+	notes  []models.Note
+	images map[int]docImage
+}
+
+// noteMeta возвращает строку с тегами и датами заметки
+func noteMeta(note models.Note) string {
+	parts := []string{"Изменено " + note.UpdatedAt.Format("02.01.2006 15:04")}
+	if len(note.Tags) > 0 {
+		tags := make([]string, len(note.Tags))
+		for i, tag := range note.Tags {
+			tags[i] = tag.Name
+		}
+		parts = append(parts, "Теги: "+strings.Join(tags, ", "))
+	}
+	if note.DueAt != nil {
+		parts = append(parts, "Срок "+note.DueAt.Format("02.01.2006 15:04"))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// attachmentID возвращает ID вложения по ссылке /attachments/ID
+func attachmentID(destination string) (int, bool) {
+	id, err := strconv.Atoi(strings.TrimPrefix(destination, "/attachments/"))
+	return id, err == nil && strings.HasPrefix(destination, "/attachments/")
+}
+
+// dataURI встраивает изображения-вложения в текст, заменяя ссылки на них data URI
+func (d *document) dataURI(content, prefix, suffix string) string {
+	for id, image := range d.images {
+		link := prefix + attachmentURL(id) + suffix
+		if strings.Contains(content, link) {
+			uri := "data:" + image.mimeType + ";base64," + base64.StdEncoding.EncodeToString(image.data)
+			content = strings.ReplaceAll(content, link, prefix+uri+suffix)
+		}
+	}
+	return content
+}
+
+// markdown выводит заметки в Markdown. Перед несколькими заметками выводится оглавление.
+func (d *document) markdown() []byte {
+	var buf strings.Builder
+	if d.title != "" {
+		fmt.Fprintf(&buf, "# %s\n\n", d.title)
+		for i, note := range d.notes {
+			fmt.Fprintf(&buf, "%d. %s\n", i+1, note.Title)
+		}
+	}
+	for i, note := range d.notes {
+		if d.title != "" || i > 0 {
+			buf.WriteString("\n---\n\n")
+		}
+		fmt.Fprintf(&buf, "# %s\n\n*%s*\n\n", note.Title, noteMeta(note))
+		buf.WriteString(strings.TrimSpace(d.dataURI(note.Content, "(", ")")) + "\n")
+	}
+	return []byte(buf.String())
+}
+
+// documentStyle - оформление выгрузки в HTML
+const documentStyle = `body{font-family:sans-serif;max-width:50em;margin:2em auto;padding:0 1em;line-height:1.5;color:#222}
+img{max-width:100%}pre{background:#f4f4f4;padding:.75em;overflow:auto}
+blockquote{margin-left:0;padding-left:1em;border-left:3px solid #ccc;color:#555}
+table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:.25em .5em}
+.meta{color:#777;font-size:.9em}article+article{break-before:page}`
+
+// documentPolicy запрещает выгрузке в HTML загружать внешние ресурсы: изображения по внешним адресам
+// из текста заметки не отображаются и не сообщают их серверам, что документ открыли
+const documentPolicy = `default-src 'none'; img-src data:; style-src 'unsafe-inline'`
+
+// html выводит заметки в самостоятельный HTML-документ со встроенными изображениями.
+// Показываются только изображения из вложений, встроенные в документ.
+func (d *document) html() ([]byte, error) {
+	title := d.title
+	if title == "" {
+		title = d.notes[0].Title
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "<!DOCTYPE html>\n<html lang=\"ru\">\n<head>\n<meta charset=\"utf-8\">\n"+
+		"<meta http-equiv=\"Content-Security-Policy\" content=\"%s\">\n<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n",
+		documentPolicy, html.EscapeString(title), documentStyle)
+	if d.title != "" {
+		fmt.Fprintf(&buf, "<h1>%s</h1>\n<nav>\n<h2>Содержание</h2>\n<ol>\n", html.EscapeString(d.title))
+		for _, note := range d.notes {
+			fmt.Fprintf(&buf, "<li><a href=\"#note-%d\">%s</a></li>\n", note.ID, html.EscapeString(note.Title))
+		}
+		buf.WriteString("</ol>\n</nav>\n")
+	}
+	for _, note := range d.notes {
+		body, err := RenderHTML(note.ContentFormat, note.Content)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "<article id=\"note-%d\">\n<h1>%s</h1>\n<p class=\"meta\">%s</p>\n%s</article>\n",
+			note.ID, html.EscapeString(note.Title), html.EscapeString(noteMeta(note)), d.dataURI(body, `src="`, `"`))
+	}
+	buf.WriteString("</body>\n</html>\n")
+	return []byte(buf.String()), nil
+}
+
+// text выводит заметки обычным текстом
+func (d *document) text() []byte {
+	var buf strings.Builder
+	if d.title != "" {
+		fmt.Fprintf(&buf, "%s\n\nСодержание\n", d.title)
+		for i, note := range d.notes {
+			fmt.Fprintf(&buf, "%d. %s\n", i+1, note.Title)
+		}
+	}
+	for i, note := range d.notes {
+		if d.title != "" || i > 0 {
+			buf.WriteString("\n" + strings.Repeat("=", 40) + "\n\n")
+		}
+		fmt.Fprintf(&buf, "%s\n%s\n\n", note.Title, noteMeta(note))
+		if note.ContentFormat != models.ContentMarkdown {
+			buf.WriteString(strings.TrimSpace(strings.ReplaceAll(note.Content, "\r\n", "\n")) + "\n")
+			continue
+		}
+		writeTextBlocks(&buf, d.blocks(note))
+	}
+	return []byte(buf.String())
+}
+
+// writeTextBlocks выводит блоки markdown-заметки обычным текстом
+func writeTextBlocks(buf *strings.Builder, blocks []docBlock) {
+	for i, block := range blocks {
+		// Соседние пункты списка не разделяются пустой строкой
+		if prev := blocks[max(i-1, 0)]; i > 0 && !(block.marker != "" && prev.kind == blockParagraph && prev.indent > 0 && !prev.quote) {
+			buf.WriteByte('\n')
+		}
+		depth, lead := block.indent, ""
+		if block.quote {
+			depth, lead = depth-1, "> "
+		}
+		prefix := strings.Repeat("   ", depth)
+		first := prefix
+		if block.marker != "" && depth > 0 {
+			first = prefix[:len(prefix)-3] + fmt.Sprintf("%-3s", block.marker+" ")
+		}
+		first, prefix = lead+first, lead+prefix
+		var lines []string
+		switch block.kind {
+		case blockHeading, blockParagraph:
+			var line strings.Builder
+			for j, span := range block.spans {
+				line.WriteString(span.text)
+				// Адрес ссылки выводится после ее последнего фрагмента
+				last := j == len(block.spans)-1 || block.spans[j+1].link != span.link
+				if span.link != "" && span.link != span.text && last {
+					line.WriteString(" (" + span.link + ")")
+				}
+			}
+			lines = strings.Split(strings.TrimSpace(line.String()), "\n")
+			if block.kind == blockHeading {
+				lines[0] = strings.ToUpper(lines[0])
+			}
+		case blockCode:
+			for _, line := range strings.Split(strings.TrimRight(block.code, "\n"), "\n") {
+				lines = append(lines, "    "+line)
+			}
+		case blockRule:
+			lines = []string{strings.Repeat("-", 20)}
+		case blockImage:
+			lines = []string{"[" + block.alt + "]"}
+		case blockTable:
+			for _, row := range block.rows {
+				lines = append(lines, strings.Join(row, " | "))
+			}
+		}
+		for j, line := range lines {
+			if j == 0 {
+				buf.WriteString(first + line + "\n")
+			} else {
+				buf.WriteString(prefix + line + "\n")
+			}
+		}
+	}
+}
+
+// blocks разбирает заметку на блоки. Обычный текст делится на абзацы по пустым строкам.
+func (d *document) blocks(note models.Note) []docBlock {
+	if note.ContentFormat != models.ContentMarkdown {
+		var blocks []docBlock
+		for _, paragraph := range strings.Split(strings.ReplaceAll(note.Content, "\r\n", "\n"), "\n\n") {
+			if paragraph = strings.Trim(paragraph, "\n"); strings.TrimSpace(paragraph) != "" {
+				blocks = append(blocks, docBlock{kind: blockParagraph, spans: []docSpan{{text: paragraph}}})
+			}
+		}
+		return blocks
+	}
+	b := blockBuilder{source: []byte(note.Content), images: d.images}
+	b.children(markdownRenderer.Parser().Parse(text.NewReader(b.source)))
+	return b.blocks
+}
+
+// blockBuilder собирает блоки документа из дерева markdown
+type blockBuilder struct {
+	source []byte
+	images map[int]docImage
+	blocks []docBlock
+	indent int
+	quote  bool
+	marker string // Маркер пункта списка для первого блока пункта
+}
+
+func (b *blockBuilder) children(n ast.Node) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		b.block(c)
+	}
+}
+
+func (b *blockBuilder) add(block docBlock) {
+	block.indent, block.quote = b.indent, b.quote
+	if block.marker == "" {
+		block.marker = b.marker
+	}
+	b.marker = ""
+	b.blocks = append(b.blocks, block)
+}
+
+func (b *blockBuilder) block(n ast.Node) {
+	switch n := n.(type) {
+	case *ast.Heading:
+		b.paragraph(n, docBlock{kind: blockHeading, level: n.Level})
+	case *ast.Paragraph, *ast.TextBlock:
+		b.paragraph(n, docBlock{kind: blockParagraph})
+	case *ast.ThematicBreak:
+		b.add(docBlock{kind: blockRule})
+	case *ast.CodeBlock, *ast.FencedCodeBlock:
+		var code strings.Builder
+		lines := n.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			segment := lines.At(i)
+			code.Write(segment.Value(b.source))
+		}
+		b.add(docBlock{kind: blockCode, code: strings.ReplaceAll(code.String(), "\t", "    ")})
+	case *ast.Blockquote:
+		quote := b.quote
+		b.quote = true
+		b.indent++
+		b.children(n)
+		b.indent--
+		b.quote = quote
+	case *ast.List:
+		b.indent++
+		number := n.Start
+		for item := n.FirstChild(); item != nil; item = item.NextSibling() {
+			b.marker = "•"
+			if n.IsOrdered() {
+				b.marker = strconv.Itoa(number) + "."
+				number++
+			}
+			b.children(item)
+		}
+		b.marker = ""
+		b.indent--
+	case *east.Table:
+		var rows [][]string
+		for row := n.FirstChild(); row != nil; row = row.NextSibling() {
+			var cells []string
+			for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+				cells = append(cells, nodeText(cell, b.source))
+			}
+			rows = append(rows, cells)
+		}
+		b.add(docBlock{kind: blockTable, rows: rows})
+	case *ast.HTMLBlock:
+	default:
+		b.children(n)
+	}
+}
+
+// paragraph собирает текст блока. Изображения выносятся в отдельные блоки между частями абзаца.
+func (b *blockBuilder) paragraph(n ast.Node, block docBlock) {
+	b.inline(n, docSpan{}, &block)
+	if len(block.spans) > 0 {
+		b.add(block)
+	}
+}
+
+func (b *blockBuilder) inline(n ast.Node, style docSpan, block *docBlock) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		span := style
+		switch c := c.(type) {
+		case *ast.Text:
+			span.text = string(c.Segment.Value(b.source))
+			if c.HardLineBreak() {
+				span.text += "\n"
+			} else if c.SoftLineBreak() {
+				span.text += " "
+			}
+			block.spans = append(block.spans, span)
+		case *ast.String:
+			span.text = string(c.Value)
+			block.spans = append(block.spans, span)
+		case *ast.Emphasis:
+			if c.Level == 2 {
+				span.bold = true
+			} else {
+				span.italic = true
+			}
+			b.inline(c, span, block)
+		case *east.Strikethrough:
+			span.strike = true
+			b.inline(c, span, block)
+		case *ast.CodeSpan:
+			span.code = true
+			b.inline(c, span, block)
+		case *ast.Link:
+			// Относительные ссылки, в том числе на вложения, вне сервиса не работают
+			if destination := string(c.Destination); strings.Contains(destination, ":") {
+				span.link = destination
+			}
+			b.inline(c, span, block)
+		case *ast.AutoLink:
+			span.text = string(c.Label(b.source))
+			span.link = string(c.URL(b.source))
+			block.spans = append(block.spans, span)
+		case *ast.Image:
+			alt := nodeText(c, b.source)
+			id, ok := attachmentID(string(c.Destination))
+			image, found := b.images[id]
+			if alt == "" {
+				alt = image.name
+			}
+			if !ok || !found {
+				span.text = "[" + alt + "]"
+				block.spans = append(block.spans, span)
+				continue
+			}
+			if len(block.spans) > 0 {
+				b.add(*block)
+			}
+			b.add(docBlock{kind: blockImage, image: id, alt: alt})
+			*block = docBlock{kind: block.kind, level: block.level}
+		case *east.TaskCheckBox:
+			block.marker = "[ ]"
+			if c.IsChecked {
+				block.marker = "[x]"
+			}
+		case *ast.RawHTML:
+		default:
+			b.inline(c, span, block)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"notes-api/internal/models"
+)
+
+// Форматы выгрузки заметок и блокнотов
+const (
+	DocumentPDF      = "pdf"
+	DocumentHTML     = "html"
+	DocumentMarkdown = "md"
+	DocumentText     = "txt"
+)
+
+var ErrInvalidDocumentFormat = errors.New("format должен быть pdf, html, md или txt")
+
+// documentTypes - MIME-типы файлов выгрузки
+var documentTypes = map[string]string{
+	DocumentPDF:      "application/pdf",
+	DocumentHTML:     "text/html; charset=utf-8",
+	DocumentMarkdown: "text/markdown; charset=utf-8",
+	DocumentText:     "text/plain; charset=utf-8",
+}
+
+// Document - файл с выгруженными заметками
+type Document struct {
+	FileName    string
+	ContentType string
+	Data        []byte
+}
+
+// DocumentService выгружает заметки и блокноты в файлы для передачи за пределы сервиса
+type DocumentService struct {
+	DB     *sql.DB
+	Client models.ClientInfo // Клиент, выполняющий запрос; записывается в журнал аудита
+	Ctx    context.Context   // Контекст запроса: его отмена прерывает запросы к базе данных
+}
+
+// ExportNote выгружает доступную пользователю заметку в PDF, HTML, Markdown или обычный текст
+func (s *DocumentService) ExportNote(noteID, userID int, format string) (Document, error) {
+	if documentTypes[format] == "" {
+		return Document{}, ErrInvalidDocumentFormat
+	}
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	note, err := noteService.requireNote(noteID, userID, models.PermissionViewer)
+	if err != nil {
+		return Document{}, err
+	}
+	file, err := s.export(document{notes: []models.Note{note}}, note.Title, format)
+	if err != nil {
+		return file, err
+	}
+	audit(s.Ctx, s.DB, s.Client, userID, models.AuditNoteExported, models.AuditTargetNote, noteID,
+		map[string]string{"format": format})
+	return file, nil
+}
+
+// ExportNotebook выгружает заметки блокнота в один файл с оглавлением, заметки упорядочены по названию
+func (s *DocumentService) ExportNotebook(notebookID, userID int, format string) (Document, error) {
+	if documentTypes[format] == "" {
+		return Document{}, ErrInvalidDocumentFormat
+	}
+	notebookService := NotebookService{DB: s.DB, Ctx: s.Ctx}
+	notebook, err := notebookService.requireNotebook(notebookID, userID, false)
+	if err != nil {
+		return Document{}, err
+	}
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+noteColumns+` FROM notes n WHERE n.notebook_id = $1
+		ORDER BY LOWER(n.title), n.id`, notebookID)
+	if err != nil {
+		return Document{}, err
+	}
+	notes, err := scanNotes(rows)
+	if err != nil {
+		return Document{}, err
+	}
+	file, err := s.export(document{title: notebook.Name, notes: notes}, notebook.Name, format)
+	if err != nil {
+		return file, err
+	}
+	audit(s.Ctx, s.DB, s.Client, userID, models.AuditNotebookExported, models.AuditTargetNotebook, notebookID,
+		map[string]interface{}{"format": format, "notes": len(notes)})
+	return file, nil
+}
+
+// export загружает теги и изображения заметок и выводит документ в нужном формате
+func (s *DocumentService) export(doc document, name, format string) (Document, error) {
+	file := Document{FileName: fileName(name) + "." + format, ContentType: documentTypes[format]}
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	ids := make([]int, len(doc.notes))
+	for i := range doc.notes {
+		ids[i] = doc.notes[i].ID
+		tags, err := noteService.GetTagsForNote(doc.notes[i].ID)
+		if err != nil {
+			return file, err
+		}
+		doc.notes[i].Tags = tags
+	}
+	images, err := s.noteImages(ids)
+	if err != nil {
+		return file, err
+	}
+	doc.images = images
+	switch format {
+	case DocumentPDF:
+		file.Data, err = doc.pdf()
+	case DocumentHTML:
+		file.Data, err = doc.html()
+	case DocumentMarkdown:
+		file.Data = doc.markdown()
+	case DocumentText:
+		file.Data = doc.text()
+	}
+	return file, err
+}
+
+// noteImages возвращает изображения, прикрепленные к заметкам
+func (s *DocumentService) noteImages(noteIDs []int) (map[int]docImage, error) {
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT id, filename, mime_type, data FROM note_attachments
+		WHERE note_id = ANY($1) AND mime_type LIKE 'image/%'`, pq.Array(noteIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	images := map[int]docImage{}
+	for rows.Next() {
+		var id int
+		var image docImage
+		if err := rows.Scan(&id, &image.name, &image.mimeType, &image.data); err != nil {
+			return nil, err
+		}
+		if IsInlineImage(image.mimeType) {
+			images[id] = image
+		}
+	}
+	return images, rows.Err()
+}
@@ -0,0 +1,475 @@
+package services
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"notes-api/internal/models"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var ErrInvalidENEX = errors.New("файл должен быть экспортом Evernote в формате ENEX")
+
+// enexNote - заметка в экспорте Evernote
+type enexNote struct {
+	Title     string         `xml:"title"`
+	Content   string         `xml:"content"`
+	Created   string         `xml:"created"`
+	Updated   string         `xml:"updated"`
+	Tags      []string       `xml:"tag"`
+	Resources []enexResource `xml:"resource"`
+}
+
+// enexResource - файл заметки Evernote. В тексте на него ссылается <en-media hash="MD5 содержимого">.
+type enexResource struct {
+	Data     string `xml:"data"`
+	Mime     string `xml:"mime"`
+	FileName string `xml:"resource-attributes>file-name"`
+}
+
+// enexMedia - вложение, на которое ссылается <en-media>
+type enexMedia struct {
+	index int
+	name  string
+	image bool
+}
+
+// parseENEX читает заметки из экспорта Evernote. Текст ENML преобразуется в Markdown,
+// файлы заметок становятся вложениями, на изображения в тексте остаются ссылки.
+func parseENEX(data []byte) ([]importEntry, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	var entries []importEntry
+	exported := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, ErrInvalidENEX
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "en-export":
+			exported = true
+		case "note":
+			var note enexNote
+			if err := decoder.DecodeElement(&note, &start); err != nil {
+				return nil, ErrInvalidENEX
+			}
+			if len(entries) == maxImportFiles {
+				return nil, ErrTooManyNotes
+			}
+			entries = append(entries, enexEntry(note, len(entries)+1))
+		}
+	}
+	if !exported {
+		return nil, ErrInvalidENEX
+	}
+	return entries, nil
+}
+
+// enexEntry преобразует заметку Evernote; number - номер заметки в файле для отчета
+func enexEntry(note enexNote, number int) importEntry {
+	entry := importEntry{
+		path:   fmt.Sprintf("note %d", number),
+		title:  note.Title,
+		tags:   note.Tags,
+		format: models.ContentMarkdown,
+	}
+	entry.created, entry.updated = parseENEXTime(note.Created), parseENEXTime(note.Updated)
+	media := map[string]enexMedia{}
+	for _, resource := range note.Resources {
+		data, err := base64.StdEncoding.DecodeString(strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, resource.Data))
+		if err != nil {
+			entry.err = fmt.Errorf("некорректное вложение: %w", err)
+			return entry
+		}
+		if len(data) > maxAttachmentSize {
+			entry.err = ErrAttachmentTooLarge
+			return entry
+		}
+		name := resource.FileName
+		if name == "" {
+			name = "attachment"
+			if extensions, _ := mime.ExtensionsByType(resource.Mime); len(extensions) > 0 {
+				name += extensions[0]
+			}
+		}
+		sum := md5.Sum(data)
+		media[hex.EncodeToString(sum[:])] = enexMedia{index: len(entry.attachments), name: attachmentName(name),
+			image: strings.HasPrefix(resource.Mime, "image/")}
+		entry.attachments = append(entry.attachments, importAttachment{name: name, mimeType: resource.Mime, data: data})
+	}
+	content, err := enmlToMarkdown(note.Content, media)
+	if err != nil {
+		entry.err = err
+		return entry
+	}
+	entry.content = content
+	return entry
+}
+
+// parseENEXTime разбирает дату Evernote вида 20240131T120000Z
+func parseENEXTime(value string) *time.Time {
+	t, err := time.Parse("20060102T150405Z", strings.TrimSpace(value))
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// enmlNode - элемент или текст (пустое name) документа ENML
+type enmlNode struct {
+	name     string
+	attrs    map[string]string
+	text     string
+	children []*enmlNode
+}
+
+// parseENML разбирает ENML нестрого: незакрытые теги закрываются, HTML-сущности распознаются
+func parseENML(content string) (*enmlNode, error) {
+	decoder := xml.NewDecoder(strings.NewReader(content))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+	root := &enmlNode{name: "root"}
+	stack := []*enmlNode{root}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return root, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("некорректный текст заметки Evernote: %w", err)
+		}
+		parent := stack[len(stack)-1]
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &enmlNode{name: strings.ToLower(t.Name.Local), attrs: map[string]string{}}
+			for _, attr := range t.Attr {
+				node.attrs[strings.ToLower(attr.Name.Local)] = attr.Value
+			}
+			parent.children = append(parent.children, node)
+			stack = append(stack, node)
+		case xml.EndElement:
+			// Закрываем ближайший открытый элемент с тем же именем
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].name == strings.ToLower(t.Name.Local) {
+					stack = stack[:i]
+					break
+				}
+			}
+		case xml.CharData:
+			parent.children = append(parent.children, &enmlNode{text: string(t)})
+		}
+	}
+}
+
+// enmlToMarkdown преобразует текст заметки Evernote в Markdown. Ссылки <en-media> заменяются
+// ссылками (attachment:N) на вложения из media, флажки <en-todo> - пунктами списка задач.
+func enmlToMarkdown(content string, media map[string]enexMedia) (string, error) {
+	root, err := parseENML(content)
+	if err != nil {
+		return "", err
+	}
+	r := enmlRenderer{w: &markdownWriter{}, media: media}
+	r.children(root)
+	r.w.flush()
+	return r.w.out.String(), nil
+}
+
+// markdownWriter собирает Markdown по строкам. Пустые строки между блоками не повторяются.
+type markdownWriter struct {
+	out         strings.Builder
+	line        strings.Builder
+	prefix      string // Префикс строк цитаты
+	blank       bool   // Перед следующей строкой нужна пустая строка
+	blankPrefix string // Префикс этой пустой строки: внутри цитаты или вне ее
+}
+
+// write добавляет текст в строку; пробелы в начале строки отбрасываются
+func (w *markdownWriter) write(text string) {
+	if w.line.Len() == 0 {
+		text = strings.TrimLeft(text, " ")
+	}
+	w.line.WriteString(text)
+}
+
+// flush завершает текущую строку
+func (w *markdownWriter) flush() {
+	line := strings.TrimRight(w.line.String(), " ")
+	w.line.Reset()
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	w.lines(line)
+}
+
+// paragraph завершает строку и отделяет следующий блок пустой строкой
+func (w *markdownWriter) paragraph() {
+	w.flush()
+	if !w.blank {
+		w.blank, w.blankPrefix = true, w.prefix
+	}
+}
+
+// block выводит многострочный текст как есть, отдельным блоком
+func (w *markdownWriter) block(text string) {
+	w.paragraph()
+	w.lines(text)
+	w.paragraph()
+}
+
+func (w *markdownWriter) lines(text string) {
+	if w.out.Len() > 0 {
+		w.out.WriteString("\n")
+		if w.blank {
+			w.out.WriteString(strings.TrimRight(w.blankPrefix, " ") + "\n")
+		}
+	}
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 {
+			w.out.WriteString("\n")
+		}
+		w.out.WriteString(w.prefix + line)
+	}
+	w.blank = false
+}
+
+type enmlList struct {
+	ordered bool
+	count   int
+}
+
+type enmlRenderer struct {
+	w     *markdownWriter
+	media map[string]enexMedia
+	lists []enmlList
+}
+
+var spaces = regexp.MustCompile(`\s+`)
+
+func (r *enmlRenderer) children(n *enmlNode) {
+	for _, child := range n.children {
+		r.node(child)
+	}
+}
+
+func (r *enmlRenderer) node(n *enmlNode) {
+	w := r.w
+	switch n.name {
+	case "":
+		w.write(spaces.ReplaceAllString(n.text, " "))
+	case "br":
+		w.flush()
+	case "hr":
+		w.block("---")
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		w.paragraph()
+		w.write(strings.Repeat("#", int(n.name[1]-'0')) + " " + strings.TrimSpace(r.inline(n)))
+		w.paragraph()
+	case "div", "p", "en-note", "section", "article", "header", "footer", "center":
+		if strings.Contains(n.attrs["style"], "-en-codeblock") {
+			w.block("```\n" + strings.TrimRight(plainText(n), "\n") + "\n```")
+			return
+		}
+		// Внутри пункта списка блок продолжает строку с маркером
+		if len(r.lists) > 0 {
+			r.children(n)
+			w.flush()
+			return
+		}
+		w.paragraph()
+		r.children(n)
+		w.paragraph()
+	case "pre":
+		w.block("```\n" + strings.TrimRight(plainText(n), "\n") + "\n```")
+	case "blockquote":
+		w.paragraph()
+		prefix := w.prefix
+		w.prefix += "> "
+		r.children(n)
+		w.paragraph()
+		w.prefix, w.blankPrefix = prefix, prefix
+	case "ul", "ol":
+		if len(r.lists) == 0 {
+			w.paragraph()
+		} else {
+			w.flush()
+		}
+		r.lists = append(r.lists, enmlList{ordered: n.name == "ol"})
+		r.children(n)
+		r.lists = r.lists[:len(r.lists)-1]
+		if len(r.lists) == 0 {
+			w.paragraph()
+		}
+	case "li":
+		w.flush()
+		marker := "- "
+		if len(r.lists) > 0 {
+			list := &r.lists[len(r.lists)-1]
+			list.count++
+			if list.ordered {
+				marker = fmt.Sprintf("%d. ", list.count)
+			}
+		}
+		w.line.WriteString(strings.Repeat("  ", max(len(r.lists)-1, 0)) + marker)
+		r.children(n)
+		w.flush()
+	case "table":
+		w.block(r.table(n))
+	case "b", "strong":
+		r.wrap(n, "**")
+	case "i", "em":
+		r.wrap(n, "*")
+	case "s", "strike", "del":
+		r.wrap(n, "~~")
+	case "code":
+		r.wrap(n, "`")
+	case "a":
+		text, href := strings.TrimSpace(r.inline(n)), n.attrs["href"]
+		switch {
+		case href == "":
+			w.write(text)
+		case text == "":
+			w.write("<" + href + ">")
+		default:
+			w.write("[" + text + "](" + href + ")")
+		}
+	case "img":
+		if src := n.attrs["src"]; src != "" && !strings.HasPrefix(src, "data:") {
+			w.write("![" + n.attrs["alt"] + "](" + src + ")")
+		}
+	case "en-media":
+		if m, ok := r.media[strings.ToLower(n.attrs["hash"])]; ok {
+			link := fmt.Sprintf("[%s](attachment:%d)", m.name, m.index)
+			if m.image {
+				link = "!" + link
+			}
+			w.write(link)
+		}
+	case "en-todo":
+		if w.line.Len() == 0 && len(r.lists) == 0 {
+			w.line.WriteString("- ")
+		}
+		if n.attrs["checked"] == "true" {
+			w.line.WriteString("[x] ")
+		} else {
+			w.line.WriteString("[ ] ")
+		}
+	case "en-crypt":
+		w.write("[зашифрованный текст]")
+	case "script", "style", "title", "head":
+	default:
+		r.children(n)
+	}
+}
+
+// inline возвращает содержимое элемента одной строкой
+func (r *enmlRenderer) inline(n *enmlNode) string {
+	w := r.w
+	r.w = &markdownWriter{}
+	r.children(n)
+	r.w.flush()
+	text := strings.ReplaceAll(r.w.out.String(), "\n", " ")
+	r.w = w
+	return text
+}
+
+// wrap выделяет содержимое элемента разметкой mark, сохраняя пробелы вокруг
+func (r *enmlRenderer) wrap(n *enmlNode, mark string) {
+	trimmed := strings.TrimSpace(r.inline(n))
+	if trimmed == "" {
+		return
+	}
+	text := plainText(n)
+	if strings.TrimLeftFunc(text, unicode.IsSpace) != text {
+		r.w.write(" ")
+	}
+	r.w.write(mark + trimmed + mark)
+	if strings.TrimRightFunc(text, unicode.IsSpace) != text {
+		r.w.write(" ")
+	}
+}
+
+// table преобразует таблицу в таблицу Markdown; первая строка считается заголовком
+func (r *enmlRenderer) table(n *enmlNode) string {
+	var rows [][]string
+	var collect func(n *enmlNode)
+	collect = func(n *enmlNode) {
+		for _, child := range n.children {
+			if child.name != "tr" {
+				collect(child)
+				continue
+			}
+			var cells []string
+			for _, cell := range child.children {
+				if cell.name == "td" || cell.name == "th" {
+					cells = append(cells, strings.ReplaceAll(strings.TrimSpace(r.inline(cell)), "|", `\|`))
+				}
+			}
+			rows = append(rows, cells)
+		}
+	}
+	collect(n)
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	if columns == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		b.WriteString("| " + strings.Join(row, " | ") + " |")
+		if i == 0 {
+			b.WriteString("\n|" + strings.Repeat(" --- |", columns))
+		}
+		if i < len(rows)-1 {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// plainText возвращает текст элемента без разметки, заменяя блоки и <br> переводами строк
+func plainText(n *enmlNode) string {
+	if n.name == "" {
+		return n.text
+	}
+	if n.name == "br" {
+		return "\n"
+	}
+	var b strings.Builder
+	for _, child := range n.children {
+		b.WriteString(plainText(child))
+	}
+	if n.name == "div" || n.name == "p" {
+		if text := b.String(); !strings.HasSuffix(text, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
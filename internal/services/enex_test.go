@@ -0,0 +1,131 @@
+package services
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"notes-api/internal/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestENMLToMarkdown(t *testing.T) {
+	media := map[string]enexMedia{
+		"abc": {index: 0, name: "cat.png", image: true},
+		"def": {index: 1, name: "doc.pdf"},
+	}
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"абзацы", `<en-note><div>Привет, <b>мир</b>!</div><div><br/></div><div>Второй абзац</div></en-note>`,
+			"Привет, **мир**!\n\nВторой абзац"},
+		{"заголовок и выделение", `<en-note><h2>Заголовок</h2><p>текст <i>курсив</i> <s>зачеркнуто</s> <code>x</code></p></en-note>`,
+			"## Заголовок\n\nтекст *курсив* ~~зачеркнуто~~ `x`"},
+		{"вложенные списки", `<en-note><ul><li>один</li><li>два<ol><li>а</li><li>б</li></ol></li></ul></en-note>`,
+			"- один\n- два\n  1. а\n  2. б"},
+		{"флажки в списке", `<en-note><ul><li><en-todo checked="true"/>купить</li><li><en-todo/>продать</li></ul></en-note>`,
+			"- [x] купить\n- [ ] продать"},
+		{"ссылки", `<en-note><a href="https://e.com">сайт</a> <a href="https://x.com"></a> <a>текст</a></en-note>`,
+			"[сайт](https://e.com) <https://x.com> текст"},
+		{"вложения", `<en-note><en-media hash="ABC" type="image/png"/> <en-media hash="def"/><en-media hash="zzz"/></en-note>`,
+			"![cat.png](attachment:0) [doc.pdf](attachment:1)"},
+		{"цитата", `<en-note><blockquote><div>цитата</div><div>вторая</div></blockquote><hr/><div>после</div></en-note>`,
+			"> цитата\n>\n> вторая\n\n---\n\nпосле"},
+		{"таблица", `<en-note><table><tr><th>a</th><th>b|c</th></tr><tr><td>1</td></tr></table></en-note>`,
+			"| a | b\\|c |\n| --- | --- |\n| 1 |  |"},
+		{"блок кода", `<en-note><div style="-en-codeblock:true"><div>x := 1</div><div>y</div></div></en-note>`,
+			"```\nx := 1\ny\n```"},
+		{"незакрытые теги", `<en-note><p>незакрытый <b>тег</en-note>`, "незакрытый **тег**"},
+		{"HTML-сущности", `<en-note>a&nbsp;&mdash;&amp;&lt;b&gt;</en-note>`, "a —&<b>"},
+		{"служебные элементы", `<en-note><script>alert(1)</script><en-crypt>xyz</en-crypt></en-note>`,
+			"[зашифрованный текст]"},
+		{"изображение data:", `<en-note><img src="data:image/png;base64,AA=="/><img src="https://e.com/a.png" alt="a"/></en-note>`,
+			"![a](https://e.com/a.png)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := enmlToMarkdown(tt.content, media)
+			if err != nil {
+				t.Fatalf("enmlToMarkdown() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("enmlToMarkdown() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseENEX(t *testing.T) {
+	sum := md5.Sum([]byte("PNG"))
+	hash := hex.EncodeToString(sum[:])
+	created := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+	updated := time.Date(2024, 2, 1, 8, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		data    string
+		want    []importEntry
+		wantErr error
+	}{
+		{
+			name: "заметки",
+			data: `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-export SYSTEM "http://xml.evernote.com/pub/evernote-export4.dtd">
+<en-export application="Evernote">
+  <note>
+    <title>Кот</title>
+    <created>20240131T120000Z</created>
+    <updated>20240201T083000Z</updated>
+    <tag>животные</tag><tag>дом</tag>
+    <content><![CDATA[<?xml version="1.0" encoding="UTF-8"?><en-note><div>Фото:</div><en-media hash="` + hash + `" type="image/png"/></en-note>]]></content>
+    <resource>
+      <data encoding="base64">
+        UE5H
+      </data>
+      <mime>image/png</mime>
+      <resource-attributes><file-name>cat.png</file-name></resource-attributes>
+    </resource>
+    <resource><data encoding="base64">UERG</data><mime>application/pdf</mime></resource>
+  </note>
+  <note><title>Пустая</title><created>не дата</created><content></content></note>
+</en-export>`,
+			want: []importEntry{
+				{path: "note 1", title: "Кот", tags: []string{"животные", "дом"}, format: models.ContentMarkdown,
+					content: "Фото:\n\n![cat.png](attachment:0)", created: &created, updated: &updated,
+					attachments: []importAttachment{
+						{name: "cat.png", mimeType: "image/png", data: []byte("PNG")},
+						{name: "attachment.pdf", mimeType: "application/pdf", data: []byte("PDF")},
+					}},
+				{path: "note 2", title: "Пустая", format: models.ContentMarkdown},
+			},
+		},
+		{name: "пустой экспорт", data: `<en-export></en-export>`},
+		{name: "не ENEX", data: `<html><body>note</body></html>`, wantErr: ErrInvalidENEX},
+		{name: "обрезанный файл", data: `<en-export><note><title>Кот`, wantErr: ErrInvalidENEX},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseENEX([]byte(tt.data))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseENEX() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseENEX() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseENEXInvalidResource(t *testing.T) {
+	entries, err := parseENEX([]byte(`<en-export><note><title>Кот</title><content><![CDATA[<en-note/>]]></content>` +
+		`<resource><data>не base64</data></resource></note></en-export>`))
+	if err != nil {
+		t.Fatalf("parseENEX() error = %v", err)
+	}
+	// Ошибка вложения относится к заметке, остальные заметки файла импортируются
+	if len(entries) != 1 || entries[0].err == nil {
+		t.Errorf("parseENEX() = %+v, want one entry with error", entries)
+	}
+}
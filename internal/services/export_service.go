@@ -0,0 +1,482 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"notes-api/internal/models"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ExportRetention - срок хранения готовой выгрузки данных пользователя
+const ExportRetention = 7 * 24 * time.Hour
+
+// Статусы выгрузки данных
+const (
+	ExportPending   = "pending"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+)
+
+var ErrExportNotReady = errors.New("выгрузка еще не готова")
+
+// ExportService предоставляет методы для выгрузки всех данных пользователя
+type ExportService struct {
+	DB     *sql.DB
+	Client models.ClientInfo // Клиент, выполняющий запрос; записывается в журнал аудита
+	Ctx    context.Context   // Контекст запроса: его отмена прерывает запросы к базе данных
+}
+
+// exportShare - запись о доступе к заметке в выгрузке
+type exportShare struct {
+	NoteID   int    `json:"note_id"`
+	Title    string `json:"title"`
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// StartExport создает запись о выгрузке и ставит ее формирование в очередь задач
+func (s *ExportService) StartExport(userID int) (models.UserExport, error) {
+	export := models.UserExport{UserID: userID, Status: ExportPending}
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return export, err
+	}
+	defer tx.Rollback()
+	query := `INSERT INTO user_exports (user_id, status, expires_at) VALUES ($1, $2, $3) RETURNING id, created_at, expires_at`
+	err = tx.QueryRowContext(s.Ctx, query, userID, ExportPending, time.Now().Add(ExportRetention)).
+		Scan(&export.ID, &export.CreatedAt, &export.ExpiresAt)
+	if err != nil {
+		return export, err
+	}
+	export.JobID, err = enqueueJob(s.Ctx, tx, JobExport, &userID, jobRef{ID: export.ID, Client: s.Client}, 0)
+	if err != nil {
+		return export, err
+	}
+	if err := tx.Commit(); err != nil {
+		return export, err
+	}
+	audit(s.Ctx, s.DB, s.Client, userID, models.AuditUserExportRequested, models.AuditTargetUser, userID,
+		map[string]int{"export_id": export.ID})
+	return export, nil
+}
+
+// GetExport возвращает состояние выгрузки пользователя
+func (s *ExportService) GetExport(exportID, userID int) (models.UserExport, error) {
+	var export models.UserExport
+	query := `SELECT id, user_id, status, error, created_at, completed_at, expires_at
+		FROM user_exports WHERE id = $1 AND user_id = $2`
+	err := s.DB.QueryRowContext(s.Ctx, query, exportID, userID).Scan(&export.ID, &export.UserID, &export.Status,
+		&export.Error, &export.CreatedAt, &export.CompletedAt, &export.ExpiresAt)
+	return export, err
+}
+
+// GetExportArchive возвращает готовый ZIP-архив выгрузки
+func (s *ExportService) GetExportArchive(exportID, userID int) ([]byte, error) {
+	var status string
+	var archive []byte
+	query := `SELECT status, archive FROM user_exports WHERE id = $1 AND user_id = $2 AND expires_at > CURRENT_TIMESTAMP`
+	if err := s.DB.QueryRowContext(s.Ctx, query, exportID, userID).Scan(&status, &archive); err != nil {
+		return nil, err
+	}
+	if status != ExportCompleted {
+		return nil, ErrExportNotReady
+	}
+	return archive, nil
+}
+
+// PurgeExpiredExports удаляет выгрузки с истекшим сроком хранения
+func (s *ExportService) PurgeExpiredExports() error {
+	_, err := s.DB.ExecContext(s.Ctx, `DELETE FROM user_exports WHERE expires_at <= CURRENT_TIMESTAMP`)
+	return err
+}
+
+// runExportJob формирует архив выгрузки. Ошибка оставляет выгрузку в ожидании до следующей попытки.
+func runExportJob(ctx context.Context, db *sql.DB, job models.Job) (interface{}, error) {
+	ref, err := jobTarget(job)
+	if err != nil {
+		return nil, err
+	}
+	var userID int
+	var status string
+	err = db.QueryRowContext(ctx, `SELECT user_id, status FROM user_exports WHERE id = $1`, ref.ID).Scan(&userID, &status)
+	if err == sql.ErrNoRows {
+		return nil, permanentJobError{errJobTargetGone}
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]string{"download_url": fmt.Sprintf("/profile/export/%d/download", ref.ID)}
+	if status == ExportCompleted {
+		return result, nil
+	}
+	s := ExportService{DB: db, Ctx: ctx, Client: ref.Client}
+	archive, err := s.buildArchive(userID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.ExecContext(ctx, `UPDATE user_exports SET status = $1, archive = $2, completed_at = CURRENT_TIMESTAMP WHERE id = $3`,
+		ExportCompleted, archive, ref.ID)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// failExportJob отмечает выгрузку неудавшейся, когда задача исчерпала попытки
+func failExportJob(db *sql.DB, job models.Job, err error) error {
+	ref, refErr := jobTarget(job)
+	if refErr != nil {
+		return nil
+	}
+	_, err = db.Exec(`UPDATE user_exports SET status = $1, error = $2, completed_at = CURRENT_TIMESTAMP WHERE id = $3`,
+		ExportFailed, err.Error(), ref.ID)
+	return err
+}
+
+// buildArchive собирает ZIP-архив со всеми данными пользователя: профилем, заметками и их тегами,
+// блокнотами, комментариями, списками задач, вложениями, напоминаниями, шаблонами, вебхуками,
+// избранным и доступами. Каждая заметка сохраняется в JSON и отдельным Markdown-файлом,
+// вложения - файлами в папке attachments.
+func (s *ExportService) buildArchive(userID int) ([]byte, error) {
+	userService := UserService{DB: s.DB, Ctx: s.Ctx}
+	profile, err := userService.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	notes, err := s.ownedNotes(userID)
+	if err != nil {
+		return nil, err
+	}
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	tagSet := map[string]bool{}
+	for i := range notes {
+		if notes[i].Tags, err = noteService.GetTagsForNote(notes[i].ID); err != nil {
+			return nil, err
+		}
+		for _, tag := range notes[i].Tags {
+			tagSet[tag.Name] = true
+		}
+	}
+	tags := make([]string, 0, len(tagSet))
+	for name := range tagSet {
+		tags = append(tags, name)
+	}
+	granted, err := s.shares(`
+		SELECT n.id, n.title, u.id, u.username
+		FROM note_access na
+		JOIN notes n ON n.id = na.note_id
+		JOIN users u ON u.id = na.user_id
+		WHERE n.user_id = $1 ORDER BY n.id, u.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	received, err := s.shares(`
+		SELECT n.id, n.title, u.id, u.username
+		FROM note_access na
+		JOIN notes n ON n.id = na.note_id
+		JOIN users u ON u.id = n.user_id
+		WHERE na.user_id = $1 ORDER BY n.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	notebooks, err := s.notebooks(userID)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := s.comments(userID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+checklistColumns+checklistJoins+`
+		WHERE n.user_id = $1 ORDER BY ci.note_id, ci.position, ci.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	checklist, err := scanChecklistItems(rows)
+	if err != nil {
+		return nil, err
+	}
+	rows, err = s.DB.QueryContext(s.Ctx, `SELECT `+reminderColumns+reminderJoins+` WHERE r.user_id = $1 ORDER BY r.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	reminders, err := scanReminders(rows)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := s.templates(userID)
+	if err != nil {
+		return nil, err
+	}
+	webhooks, err := s.webhooks(userID)
+	if err != nil {
+		return nil, err
+	}
+	stars, err := s.stars(userID)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := s.attachments(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := map[string]interface{}{
+		"profile.json":     profile,
+		"notes.json":       notes,
+		"tags.json":        tags,
+		"shares.json":      map[string][]exportShare{"granted": granted, "received": received},
+		"notebooks.json":   notebooks,
+		"comments.json":    comments,
+		"checklist.json":   checklist,
+		"reminders.json":   reminders,
+		"templates.json":   templates,
+		"webhooks.json":    webhooks,
+		"stars.json":       stars,
+		"attachments.json": attachments,
+	}
+	for name, data := range files {
+		if err := writeZipJSON(zw, name, data); err != nil {
+			return nil, err
+		}
+	}
+	for _, note := range notes {
+		w, err := zw.Create(fmt.Sprintf("notes/%d-%s.md", note.ID, slugify(note.Title)))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(noteMarkdown(note))); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.writeAttachments(zw, attachments); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *ExportService) ownedNotes(userID int) ([]models.Note, error) {
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+noteColumns+` FROM notes n WHERE n.user_id = $1 ORDER BY n.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	notes := []models.Note{}
+	for rows.Next() {
+		note, err := scanNote(rows)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+	return notes, rows.Err()
+}
+
+// notebooks возвращает личные блокноты пользователя
+func (s *ExportService) notebooks(userID int) ([]models.Notebook, error) {
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT id, name, COALESCE(user_id, 0), team_id, created_at
+		FROM notebooks WHERE user_id = $1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	notebooks := []models.Notebook{}
+	for rows.Next() {
+		var notebook models.Notebook
+		if err := rows.Scan(&notebook.ID, &notebook.Name, &notebook.UserID, &notebook.TeamID, &notebook.CreatedAt); err != nil {
+			return nil, err
+		}
+		notebooks = append(notebooks, notebook)
+	}
+	return notebooks, rows.Err()
+}
+
+// comments возвращает комментарии пользователя ко всем заметкам и все комментарии к его заметкам
+func (s *ExportService) comments(userID int) ([]models.Comment, error) {
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+commentColumns+`
+		FROM comments c JOIN users u ON u.id = c.user_id
+		WHERE c.user_id = $1 OR c.note_id IN (SELECT id FROM notes WHERE user_id = $1)
+		ORDER BY c.note_id, c.created_at, c.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	comments := []models.Comment{}
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// templates возвращает личные шаблоны пользователя
+func (s *ExportService) templates(userID int) ([]models.NoteTemplate, error) {
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+templateColumns+` FROM note_templates WHERE user_id = $1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	templates := []models.NoteTemplate{}
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	return templates, rows.Err()
+}
+
+// webhooks возвращает личные вебхуки пользователя. Секреты подписи в выгрузку не попадают.
+func (s *ExportService) webhooks(userID int) ([]models.Webhook, error) {
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE user_id = $1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// stars возвращает ID избранных заметок пользователя
+func (s *ExportService) stars(userID int) ([]int, error) {
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT note_id FROM note_stars WHERE user_id = $1 ORDER BY created_at, note_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stars := []int{}
+	for rows.Next() {
+		var noteID int
+		if err := rows.Scan(&noteID); err != nil {
+			return nil, err
+		}
+		stars = append(stars, noteID)
+	}
+	return stars, rows.Err()
+}
+
+// attachments возвращает сведения о вложениях заметок пользователя. URL указывает на файл внутри архива.
+func (s *ExportService) attachments(userID int) ([]models.Attachment, error) {
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT a.id, a.note_id, a.filename, a.mime_type, a.size, a.created_at
+		FROM note_attachments a JOIN notes n ON n.id = a.note_id
+		WHERE n.user_id = $1 ORDER BY a.note_id, a.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	attachments := []models.Attachment{}
+	for rows.Next() {
+		var attachment models.Attachment
+		if err := rows.Scan(&attachment.ID, &attachment.NoteID, &attachment.FileName, &attachment.MimeType,
+			&attachment.Size, &attachment.CreatedAt); err != nil {
+			return nil, err
+		}
+		attachment.URL = fmt.Sprintf("attachments/%d-%s", attachment.ID, path.Base(attachment.FileName))
+		attachments = append(attachments, attachment)
+	}
+	return attachments, rows.Err()
+}
+
+// writeAttachments записывает содержимое вложений в архив. Содержимое читается по одному файлу,
+// чтобы не держать в памяти все вложения сразу.
+func (s *ExportService) writeAttachments(zw *zip.Writer, attachments []models.Attachment) error {
+	for _, attachment := range attachments {
+		var data []byte
+		err := s.DB.QueryRowContext(s.Ctx, `SELECT data FROM note_attachments WHERE id = $1`, attachment.ID).Scan(&data)
+		if err == sql.ErrNoRows {
+			continue // Вложение удалено во время выгрузки
+		}
+		if err != nil {
+			return err
+		}
+		w, err := zw.Create(attachment.URL)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ExportService) shares(query string, userID int) ([]exportShare, error) {
+	rows, err := s.DB.QueryContext(s.Ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	shares := []exportShare{}
+	for rows.Next() {
+		var share exportShare
+		if err := rows.Scan(&share.NoteID, &share.Title, &share.UserID, &share.Username); err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+func writeZipJSON(zw *zip.Writer, name string, data interface{}) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+// noteMarkdown представляет заметку в виде Markdown-документа
+func noteMarkdown(note models.Note) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", note.Title)
+	if len(note.Tags) > 0 {
+		names := make([]string, len(note.Tags))
+		for i, tag := range note.Tags {
+			names[i] = "#" + tag.Name
+		}
+		fmt.Fprintf(&b, "%s\n\n", strings.Join(names, " "))
+	}
+	b.WriteString(note.Content)
+	b.WriteString("\n")
+	return b.String()
+}
+
+var slugInvalid = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// slugify готовит заголовок заметки для использования в имени файла
+func slugify(title string) string {
+	slug := strings.Trim(slugInvalid.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if r := []rune(slug); len(r) > 50 {
+		slug = strings.Trim(string(r[:50]), "-")
+	}
+	if slug == "" {
+		slug = "note"
+	}
+	return slug
+}
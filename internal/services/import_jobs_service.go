@@ -0,0 +1,168 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"notes-api/internal/models"
+)
+
+var ErrImportJobNotFound = errors.New("импорт не найден")
+
+// importProgressStep - через сколько заметок обновляется прогресс импорта
+const importProgressStep = 20
+
+// Статусы фонового импорта
+const (
+	ImportPending   = "pending"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// StartImport проверяет файл и ставит в очередь задач импорт заметок из Evernote или Google Keep
+func (s *VaultService) StartImport(userID int, source string, data []byte, options models.ImportOptions) (models.ImportJob, error) {
+	job := models.ImportJob{Source: source, Status: ImportPending}
+	options, err := validImportOptions(options)
+	if err != nil {
+		return job, err
+	}
+	switch source {
+	case models.ImportSourceENEX:
+		if !bytes.Contains(data[:min(len(data), 4096)], []byte("<en-export")) {
+			return job, ErrInvalidENEX
+		}
+	case models.ImportSourceKeep:
+		if !bytes.HasPrefix(data, []byte("PK")) {
+			return job, ErrInvalidArchive
+		}
+	}
+	payload, err := json.Marshal(options)
+	if err != nil {
+		return job, err
+	}
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return job, err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(s.Ctx, `INSERT INTO import_jobs (user_id, source, status, options, data) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`, userID, source, ImportPending, payload, data).Scan(&job.ID, &job.CreatedAt)
+	if err != nil {
+		return job, err
+	}
+	job.JobID, err = enqueueJob(s.Ctx, tx, JobImport, &userID, jobRef{ID: job.ID, Client: s.Client}, 0)
+	if err != nil {
+		return job, err
+	}
+	return job, tx.Commit()
+}
+
+// GetImportJob возвращает состояние фонового импорта пользователя
+func (s *VaultService) GetImportJob(jobID, userID int) (models.ImportJob, error) {
+	var job models.ImportJob
+	var report []byte
+	err := s.DB.QueryRowContext(s.Ctx, `SELECT id, source, status, total, processed, error, report, created_at, completed_at
+		FROM import_jobs WHERE id = $1 AND user_id = $2`, jobID, userID).
+		Scan(&job.ID, &job.Source, &job.Status, &job.Total, &job.Processed, &job.Error, &report, &job.CreatedAt, &job.CompletedAt)
+	if err == sql.ErrNoRows {
+		return job, ErrImportJobNotFound
+	}
+	if err != nil {
+		return job, err
+	}
+	if report != nil {
+		job.Report = &models.ImportReport{}
+		if err := json.Unmarshal(report, job.Report); err != nil {
+			return job, err
+		}
+	}
+	return job, nil
+}
+
+// runImportJob импортирует заметки из сохраненного файла. Данные файла удаляются после импорта.
+func runImportJob(ctx context.Context, db *sql.DB, job models.Job) (interface{}, error) {
+	ref, err := jobTarget(job)
+	if err != nil {
+		return nil, err
+	}
+	var userID int
+	var source, status string
+	var options, data []byte
+	err = db.QueryRowContext(ctx, `SELECT user_id, source, status, options, data FROM import_jobs WHERE id = $1`, ref.ID).
+		Scan(&userID, &source, &status, &options, &data)
+	if err == sql.ErrNoRows {
+		return nil, permanentJobError{errJobTargetGone}
+	}
+	if err != nil || status == ImportCompleted {
+		return nil, err
+	}
+	var importOptions models.ImportOptions
+	if err := json.Unmarshal(options, &importOptions); err != nil {
+		return nil, permanentJobError{err}
+	}
+	s := VaultService{DB: db, Ctx: ctx, Client: ref.Client}
+	report, err := s.importEntries(ctx, ref.ID, userID, source, data, importOptions)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.ExecContext(ctx, `UPDATE import_jobs SET status = $1, report = $2, processed = total, data = NULL,
+		completed_at = CURRENT_TIMESTAMP WHERE id = $3`, ImportCompleted, payload, ref.ID)
+	return map[string]int{"created": report.Created, "updated": report.Updated, "skipped": report.Skipped,
+		"failed": report.Failed}, err
+}
+
+// failImportJob отмечает импорт неудавшимся и удаляет данные файла, когда задача исчерпала попытки
+func failImportJob(db *sql.DB, job models.Job, err error) error {
+	ref, refErr := jobTarget(job)
+	if refErr != nil {
+		return nil
+	}
+	_, err = db.Exec(`UPDATE import_jobs SET status = $1, error = $2, data = NULL, completed_at = CURRENT_TIMESTAMP
+		WHERE id = $3`, ImportFailed, err.Error(), ref.ID)
+	return err
+}
+
+// importEntries разбирает файл источника и импортирует заметки, сохраняя прогресс
+func (s *VaultService) importEntries(ctx context.Context, jobID, userID int, source string, data []byte, options models.ImportOptions) (models.ImportReport, error) {
+	var entries []importEntry
+	var ignored []string
+	var err error
+	switch source {
+	case models.ImportSourceENEX:
+		entries, err = parseENEX(data)
+	case models.ImportSourceKeep:
+		entries, ignored, err = parseKeep(data)
+	}
+	if err != nil {
+		return models.ImportReport{}, err
+	}
+	if _, err := s.DB.ExecContext(s.Ctx, `UPDATE import_jobs SET total = $1 WHERE id = $2`, len(entries), jobID); err != nil {
+		return models.ImportReport{}, err
+	}
+	imp, err := newImporter(s.Ctx, s.DB, s.Client, userID, options)
+	if err != nil {
+		return models.ImportReport{}, err
+	}
+	if ignored != nil {
+		imp.report.Ignored = ignored
+	}
+	for i, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return imp.finish(), err
+		}
+		imp.add(entry)
+		if (i+1)%importProgressStep == 0 {
+			if _, err := s.DB.ExecContext(s.Ctx, `UPDATE import_jobs SET processed = $1 WHERE id = $2`, i+1, jobID); err != nil {
+				slog.ErrorContext(s.Ctx, "Ошибка при сохранении прогресса импорта", "import_id", jobID, "error", err)
+			}
+		}
+	}
+	return imp.finish(), nil
+}
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"notes-api/internal/models"
+	"strings"
+	"time"
+)
+
+// importEntry - заметка, прочитанная из архива заметок или из выгрузки другого сервиса
+type importEntry struct {
+	path        string
+	id          int // ID заметки из заголовка собственного архива
+	title       string
+	notebook    string
+	tags        []string
+	format      string
+	content     string // Ссылки на вложения имеют вид (attachment:N), где N - индекс в attachments
+	created     *time.Time
+	updated     *time.Time
+	due         *time.Time
+	pinned      bool
+	archived    bool
+	checklist   []importChecklistItem
+	attachments []importAttachment
+	skip        string // Причина, по которой заметка не импортируется
+	err         error  // Ошибка чтения заметки
+}
+
+type importChecklistItem struct {
+	text    string
+	checked bool
+}
+
+type importAttachment struct {
+	name     string
+	mimeType string
+	data     []byte
+}
+
+// importedNote - заметка пользователя, с которой сравниваются импортируемые заметки
+type importedNote struct {
+	ID      int
+	Title   string
+	Content string
+}
+
+// importer создает заметки пользователя из прочитанных записей и составляет отчет.
+// Заметка считается дубликатом, если у пользователя уже есть заметка с тем же ID
+// или с тем же заголовком в том же блокноте.
+type importer struct {
+	db        *sql.DB
+	client    models.ClientInfo
+	ctx       context.Context
+	userID    int
+	options   models.ImportOptions
+	notebooks map[string]int // Личные блокноты по именам; 0 - блокнот будет создан
+	byID      map[int]importedNote
+	byKey     map[string]importedNote
+	report    models.ImportReport
+}
+
+// validImportOptions проверяет параметры импорта, подставляя значения по умолчанию
+func validImportOptions(options models.ImportOptions) (models.ImportOptions, error) {
+	switch options.OnDuplicate {
+	case "":
+		options.OnDuplicate = models.ImportSkip
+	case models.ImportSkip, models.ImportOverwrite, models.ImportKeep:
+	default:
+		return options, ErrInvalidDuplicateMode
+	}
+	options.Notebook = truncateRunes(strings.TrimSpace(options.Notebook), 254)
+	return options, nil
+}
+
+func newImporter(ctx context.Context, db *sql.DB, client models.ClientInfo, userID int, options models.ImportOptions) (*importer, error) {
+	options, err := validImportOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	imp := &importer{db: db, client: client, ctx: ctx, userID: userID, options: options, report: models.ImportReport{
+		DryRun: options.DryRun, NotebooksCreated: []string{}, Ignored: []string{}, Items: []models.ImportItem{}}}
+	if imp.notebooks, err = personalNotebooks(ctx, db, userID); err != nil {
+		return nil, err
+	}
+	if err := imp.loadNotes(); err != nil {
+		return nil, err
+	}
+	return imp, nil
+}
+
+// add импортирует одну заметку. Ошибка заметки записывается в отчет и не прерывает импорт остальных.
+func (imp *importer) add(entry importEntry) {
+	item := models.ImportItem{Path: entry.path, Notebook: entry.notebook, Tags: normalizeTags(entry.tags)}
+	item.Title = truncateRunes(strings.TrimSpace(entry.title), 254)
+	if item.Title == "" {
+		item.Title = "Без названия"
+	}
+	if item.Notebook == "" {
+		item.Notebook = imp.options.Notebook
+	}
+	item.Notebook = truncateRunes(strings.TrimSpace(item.Notebook), 254)
+	format, err := validContentFormat(entry.format)
+	if entry.err != nil {
+		err = entry.err
+	}
+	if err != nil {
+		item.Action, item.Error = models.ImportActionError, err.Error()
+		imp.report.Failed++
+		imp.report.Items = append(imp.report.Items, item)
+		return
+	}
+
+	key := importKey(item.Title, item.Notebook)
+	existing, duplicate := imp.byID[entry.id]
+	if !duplicate {
+		existing, duplicate = imp.byKey[key]
+	}
+	item.Action = models.ImportActionCreate
+	switch {
+	case entry.skip != "":
+		item.Action, item.Error = models.ImportActionSkip, entry.skip
+	case duplicate:
+		item.Duplicate, item.NoteID = true, existing.ID
+		switch {
+		case imp.options.OnDuplicate == models.ImportSkip:
+			item.Action, item.Error = models.ImportActionSkip, "заметка уже существует"
+		case imp.options.OnDuplicate == models.ImportOverwrite && existing.Title == item.Title && existing.Content == entry.content:
+			item.Action, item.Error = models.ImportActionSkip, "заметка не изменилась"
+		case imp.options.OnDuplicate == models.ImportOverwrite:
+			item.Action = models.ImportActionUpdate
+		}
+	}
+	if item.Action != models.ImportActionSkip && !imp.options.DryRun {
+		err = imp.save(&item, entry, format)
+	} else if item.Action == models.ImportActionCreate && item.Notebook != "" {
+		if _, ok := imp.notebooks[item.Notebook]; !ok {
+			imp.notebooks[item.Notebook] = 0
+			imp.report.NotebooksCreated = append(imp.report.NotebooksCreated, item.Notebook)
+		}
+	}
+	switch {
+	case err != nil:
+		item.Action, item.Error = models.ImportActionError, err.Error()
+		imp.report.Failed++
+	case item.Action == models.ImportActionCreate:
+		imp.report.Created++
+	case item.Action == models.ImportActionUpdate:
+		imp.report.Updated++
+	default:
+		imp.report.Skipped++
+	}
+	if err == nil && item.Action != models.ImportActionSkip {
+		// Повторные заметки в самом архиве тоже считаются дубликатами
+		imported := importedNote{ID: item.NoteID, Title: item.Title, Content: entry.content}
+		imp.byKey[key] = imported
+		if item.NoteID != 0 {
+			imp.byID[item.NoteID] = imported
+		}
+	}
+	imp.report.Items = append(imp.report.Items, item)
+}
+
+// save создает или обновляет заметку, при необходимости создавая блокнот. При обновлении вложения
+// и список задач заменяются, только если они есть в импортируемой заметке.
+func (imp *importer) save(item *models.ImportItem, entry importEntry, format string) error {
+	noteService := NoteService{DB: imp.db, Client: imp.client, Ctx: imp.ctx}
+	note := models.Note{Title: item.Title, Content: entry.content, ContentFormat: format, UserID: imp.userID}
+	var existingNote models.Note
+	var createdAt *time.Time
+	if item.Action == models.ImportActionUpdate {
+		var err error
+		if existingNote, err = noteService.requireNote(item.NoteID, imp.userID, models.PermissionEditor); err != nil {
+			return err
+		}
+		note.ID = item.NoteID
+	} else {
+		if item.Notebook != "" {
+			notebookID, ok := imp.notebooks[item.Notebook]
+			if !ok {
+				notebook := models.Notebook{Name: item.Notebook}
+				notebookService := NotebookService{DB: imp.db, Ctx: imp.ctx}
+				if err := notebookService.CreateNotebook(&notebook, imp.userID); err != nil {
+					return err
+				}
+				notebookID = notebook.ID
+				imp.notebooks[item.Notebook] = notebookID
+				imp.report.NotebooksCreated = append(imp.report.NotebooksCreated, item.Notebook)
+			}
+			note.NotebookID = &notebookID
+		}
+		createdAt = entry.created
+	}
+	// Заметка с тегами, вложениями и списком задач записывается одной транзакцией:
+	// при ошибке не остается заметки, импортированной наполовину
+	tx, err := imp.db.BeginTx(imp.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if item.Action == models.ImportActionUpdate {
+		if err := noteService.updateNote(tx, &note, existingNote); err != nil {
+			return err
+		}
+		if len(entry.attachments) > 0 {
+			if _, err := tx.ExecContext(imp.ctx, `DELETE FROM note_attachments WHERE note_id = $1`, note.ID); err != nil {
+				return err
+			}
+		}
+		if len(entry.checklist) > 0 {
+			if _, err := tx.ExecContext(imp.ctx, `DELETE FROM checklist_items WHERE note_id = $1`, note.ID); err != nil {
+				return err
+			}
+		}
+	} else if err := noteService.insertNote(tx, &note, nil); err != nil {
+		return err
+	}
+	tags := make([]models.Tag, len(item.Tags))
+	for i, name := range item.Tags {
+		tags[i] = models.Tag{Name: name}
+	}
+	if err := addNoteTags(imp.ctx, tx, note.ID, note.TeamID, tags); err != nil {
+		return err
+	}
+	for i, file := range entry.attachments {
+		attachment, err := addAttachment(imp.ctx, tx, note.ID, file.name, file.mimeType, file.data)
+		if err != nil {
+			return err
+		}
+		note.Content = strings.ReplaceAll(note.Content, fmt.Sprintf("(attachment:%d)", i), "("+attachment.URL+")")
+	}
+	for i, task := range entry.checklist {
+		_, err := tx.ExecContext(imp.ctx, `INSERT INTO checklist_items (note_id, text, checked, position, created_by, checked_at)
+			VALUES ($1, $2, $3, $4, $5, CASE WHEN $3 THEN CURRENT_TIMESTAMP END)`, note.ID, task.text, task.checked, i, imp.userID)
+		if err != nil {
+			return err
+		}
+	}
+	// Явно заданное время изменения сохраняется триггером, без него ставится текущее
+	err = tx.QueryRowContext(imp.ctx, `UPDATE notes SET content = $1, created_at = COALESCE($2, created_at),
+		updated_at = COALESCE($3, updated_at), due_at = $4, pinned = $5, archived = $6 WHERE id = $7
+		RETURNING created_at, updated_at`,
+		note.Content, createdAt, entry.updated, entry.due, entry.pinned, entry.archived, note.ID).Scan(&note.CreatedAt, &note.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	item.NoteID = note.ID
+	note.DueAt, note.Pinned, note.Archived = entry.due, entry.pinned, entry.archived
+	if item.Action == models.ImportActionUpdate {
+		noteService.noteUpdated(note, existingNote, imp.userID)
+	} else {
+		noteService.noteCreated(note)
+	}
+	if len(tags) > 0 {
+		dispatchEvent(imp.ctx, imp.db, models.EventTagAdded, note, map[string]interface{}{"note_id": note.ID, "tags": tags})
+	}
+	return nil
+}
+
+// finish записывает импорт в журнал аудита и возвращает отчет
+func (imp *importer) finish() models.ImportReport {
+	if !imp.options.DryRun {
+		audit(imp.ctx, imp.db, imp.client, imp.userID, models.AuditNotesImported, models.AuditTargetUser, imp.userID, map[string]int{
+			"created": imp.report.Created, "updated": imp.report.Updated, "skipped": imp.report.Skipped, "failed": imp.report.Failed})
+	}
+	return imp.report
+}
+
+// loadNotes загружает личные заметки пользователя для поиска дубликатов
+func (imp *importer) loadNotes() error {
+	rows, err := imp.db.QueryContext(imp.ctx, `
+		SELECT n.id, n.title, n.content, COALESCE(nb.name, '')
+		FROM notes n LEFT JOIN notebooks nb ON nb.id = n.notebook_id
+		WHERE n.user_id = $1 AND n.team_id IS NULL`, imp.userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	imp.byID, imp.byKey = map[int]importedNote{}, map[string]importedNote{}
+	for rows.Next() {
+		var note importedNote
+		var notebook string
+		if err := rows.Scan(&note.ID, &note.Title, &note.Content, &notebook); err != nil {
+			return err
+		}
+		imp.byID[note.ID] = note
+		imp.byKey[importKey(note.Title, notebook)] = note
+	}
+	return rows.Err()
+}
+
+// personalNotebooks возвращает личные блокноты пользователя по именам
+func personalNotebooks(ctx context.Context, db *sql.DB, userID int) (map[string]int, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id, name FROM notebooks WHERE user_id = $1 AND team_id IS NULL ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	notebooks := map[string]int{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		if _, ok := notebooks[name]; !ok {
+			notebooks[name] = id
+		}
+	}
+	return notebooks, rows.Err()
+}
+
+// normalizeTags убирает у тегов # и пробелы, отбрасывая пустые и повторяющиеся
+func normalizeTags(names []string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(name), "#"))
+		if r := []rune(name); len(r) > 50 {
+			name = string(r[:50])
+		}
+		if name != "" && !seen[name] {
+			seen[name] = true
+			tags = append(tags, name)
+		}
+	}
+	return tags
+}
+
+func importKey(title, notebook string) string {
+	return strings.ToLower(title) + "\x00" + notebook
+}
+
+// parseImportTime разбирает дату из заголовка. Нераспознанная дата игнорируется.
+func parseImportTime(value string) *time.Time {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			t = t.UTC()
+			return &t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"notes-api/internal/metrics"
+	"notes-api/internal/models"
+)
+
+var (
+	ErrInvitationNotFound = errors.New("приглашение не найдено")
+	ErrShareWithOwner     = errors.New("вы не можете передавать доступ к своей заметке")
+	ErrRecipientRequired  = errors.New("укажите user_id, username или email получателя")
+	ErrTeamNoteShare      = errors.New("доступ к заметке команды выдается только командам")
+)
+
+// invitationColumns - список столбцов приглашения для запросов с псевдонимами i, n, inviter, invitee
+const invitationColumns = `i.id, i.note_id, n.title, COALESCE(i.inviter_id, 0), COALESCE(inviter.username, ''),
+	i.invitee_id, COALESCE(invitee.username, ''), COALESCE(i.email, ''), i.permission, i.status, i.created_at, i.responded_at`
+
+const invitationJoins = `
+	FROM note_invitations i
+	JOIN notes n ON n.id = i.note_id
+	LEFT JOIN users inviter ON inviter.id = i.inviter_id
+	LEFT JOIN users invitee ON invitee.id = i.invitee_id`
+
+func scanInvitation(row rowScanner) (models.NoteInvitation, error) {
+	var inv models.NoteInvitation
+	err := row.Scan(&inv.ID, &inv.NoteID, &inv.NoteTitle, &inv.InviterID, &inv.InviterName, &inv.InviteeID,
+		&inv.InviteeName, &inv.Email, &inv.Permission, &inv.Status, &inv.CreatedAt, &inv.RespondedAt)
+	return inv, err
+}
+
+func scanInvitations(rows *sql.Rows) ([]models.NoteInvitation, error) {
+	defer rows.Close()
+	invitations := []models.NoteInvitation{}
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, rows.Err()
+}
+
+// InvitationService предоставляет методы для приглашений к совместной работе над заметками
+type InvitationService struct {
+	DB     *sql.DB
+	Client models.ClientInfo // Клиент, выполняющий запрос; записывается в журнал аудита
+	Ctx    context.Context   // Контекст запроса: его отмена прерывает запросы к базе данных
+}
+
+// Invite приглашает пользователя к заметке по ID, имени или email. Если пользователь с таким email
+// не зарегистрирован, приглашение ждет его регистрации. Повторное приглашение обновляет уровень доступа
+// в уже отправленном.
+func (s *InvitationService) Invite(noteID, ownerID int, request models.ShareNoteRequest) (models.NoteInvitation, error) {
+	var invitation models.NoteInvitation
+	permission, err := validSharePermission(request.Permission)
+	if err != nil {
+		return invitation, err
+	}
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	note, err := noteService.requireNote(noteID, ownerID, models.PermissionOwner)
+	if err != nil {
+		return invitation, err
+	}
+	if note.TeamID != nil {
+		return invitation, ErrTeamNoteShare
+	}
+	inviteeID, email, err := s.resolveRecipient(request)
+	if err != nil {
+		return invitation, err
+	}
+	if inviteeID != nil && *inviteeID == note.UserID {
+		return invitation, ErrShareWithOwner
+	}
+	invitationID, err := upsertInvitation(s.Ctx, s.DB, noteID, ownerID, inviteeID, email, permission)
+	if err != nil {
+		return invitation, err
+	}
+	s.invited(note, ownerID, invitationID, inviteeID, email, permission)
+	return s.getInvitation(invitationID)
+}
+
+// upsertInvitation создает приглашение или обновляет уровень доступа в ожидающем приглашении того же получателя
+func upsertInvitation(ctx context.Context, q dbtx, noteID, ownerID int, inviteeID *int, email, permission string) (int, error) {
+	var invitationID int
+	err := q.QueryRowContext(ctx, `
+		UPDATE note_invitations SET permission = $1, inviter_id = $2
+		WHERE note_id = $3 AND status = $4
+			AND (invitee_id = $5 OR (invitee_id IS NULL AND LOWER(email) = $6))
+		RETURNING id`, permission, ownerID, noteID, models.InvitationPending, inviteeID, email).Scan(&invitationID)
+	if err == sql.ErrNoRows {
+		err = q.QueryRowContext(ctx, `
+			INSERT INTO note_invitations (note_id, inviter_id, invitee_id, email, permission)
+			VALUES ($1, $2, $3, NULLIF($4, ''), $5) RETURNING id`,
+			noteID, ownerID, inviteeID, email, permission).Scan(&invitationID)
+	}
+	return invitationID, err
+}
+
+// invited записывает приглашение в журнал аудита и уведомляет зарегистрированного получателя
+func (s *InvitationService) invited(note models.Note, ownerID, invitationID int, inviteeID *int, email, permission string) {
+	metrics.Shares.WithLabelValues("invited").Inc()
+	audit(s.Ctx, s.DB, s.Client, ownerID, models.AuditNoteShared, models.AuditTargetNote, note.ID,
+		map[string]interface{}{"invitation_id": invitationID, "invitee_id": inviteeID, "email": email, "permission": permission})
+	if inviteeID != nil {
+		notify(s.Ctx, s.DB, []int{*inviteeID}, models.Notification{
+			Type:    models.NotificationInvitationReceived,
+			ActorID: &ownerID,
+			NoteID:  &note.ID,
+			Message: fmt.Sprintf("Вас пригласили к заметке «%s»", note.Title),
+		})
+	}
+}
+
+// resolveRecipient находит получателя приглашения. Для email, который никто не подтвердил, возвращается
+// только email: приглашение перейдет к пользователю, когда он подтвердит этот адрес.
+func (s *InvitationService) resolveRecipient(request models.ShareNoteRequest) (*int, string, error) {
+	var userID int
+	var err error
+	email := normalizeEmail(request.Email)
+	switch {
+	case request.UserID != 0:
+		err = s.DB.QueryRowContext(s.Ctx, `SELECT id FROM users WHERE id = $1`, request.UserID).Scan(&userID)
+	case request.Username != "":
+		err = s.DB.QueryRowContext(s.Ctx, `SELECT id FROM users WHERE username = $1`, request.Username).Scan(&userID)
+	case email != "":
+		err = s.DB.QueryRowContext(s.Ctx, `SELECT id FROM users WHERE LOWER(email) = $1 AND email_verified_at IS NOT NULL`,
+			email).Scan(&userID)
+		if err == sql.ErrNoRows {
+			return nil, email, nil
+		}
+	default:
+		return nil, "", ErrRecipientRequired
+	}
+	if err == sql.ErrNoRows {
+		return nil, "", ErrUserNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return &userID, "", nil
+}
+
+// AttachEmailInvitations передает пользователю приглашения, отправленные на его email.
+// Вызывается только после подтверждения адреса.
+func (s *InvitationService) AttachEmailInvitations(userID int, email string) error {
+	_, err := s.DB.ExecContext(s.Ctx, `UPDATE note_invitations SET invitee_id = $1
+		WHERE invitee_id IS NULL AND LOWER(email) = $2 AND status = $3`, userID, normalizeEmail(email), models.InvitationPending)
+	return err
+}
+
+// GetPendingInvitations возвращает ожидающие ответа приглашения пользователя
+func (s *InvitationService) GetPendingInvitations(userID int) ([]models.NoteInvitation, error) {
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+invitationColumns+invitationJoins+`
+		WHERE i.invitee_id = $1 AND i.status = $2 ORDER BY i.created_at DESC`, userID, models.InvitationPending)
+	if err != nil {
+		return nil, err
+	}
+	return scanInvitations(rows)
+}
+
+// Respond принимает или отклоняет приглашение. При принятии пользователь получает доступ к заметке,
+// если пригласивший все еще ее владелец: иначе приглашение выдало бы доступ, которого не одобрял
+// новый владелец.
+func (s *InvitationService) Respond(invitationID, userID int, accept bool) (models.NoteInvitation, error) {
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return models.NoteInvitation{}, err
+	}
+	defer tx.Rollback()
+	var noteID int
+	var permission string
+	var inviterOwns bool
+	err = tx.QueryRowContext(s.Ctx, `SELECT i.note_id, i.permission, COALESCE(n.user_id = i.inviter_id AND n.team_id IS NULL, false)
+		FROM note_invitations i JOIN notes n ON n.id = i.note_id
+		WHERE i.id = $1 AND i.invitee_id = $2 AND i.status = $3 FOR UPDATE OF i`, invitationID, userID, models.InvitationPending).
+		Scan(&noteID, &permission, &inviterOwns)
+	if err == sql.ErrNoRows {
+		return models.NoteInvitation{}, ErrInvitationNotFound
+	}
+	if err != nil {
+		return models.NoteInvitation{}, err
+	}
+	status := models.InvitationDeclined
+	if accept {
+		if !inviterOwns {
+			return models.NoteInvitation{}, ErrInvitationNotFound
+		}
+		status = models.InvitationAccepted
+		_, err = tx.ExecContext(s.Ctx, `INSERT INTO note_access (note_id, user_id, permission) VALUES ($1, $2, $3)
+			ON CONFLICT (note_id, user_id) DO UPDATE SET permission = EXCLUDED.permission`, noteID, userID, permission)
+		if err != nil {
+			return models.NoteInvitation{}, err
+		}
+	}
+	_, err = tx.ExecContext(s.Ctx, `UPDATE note_invitations SET status = $1, responded_at = CURRENT_TIMESTAMP WHERE id = $2`, status, invitationID)
+	if err != nil {
+		return models.NoteInvitation{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.NoteInvitation{}, err
+	}
+	action := models.AuditInvitationDeclined
+	if accept {
+		action = models.AuditInvitationAccepted
+	}
+	audit(s.Ctx, s.DB, s.Client, userID, action, models.AuditTargetInvitation, invitationID,
+		map[string]interface{}{"note_id": noteID, "permission": permission})
+	if accept {
+		metrics.Shares.WithLabelValues("accepted").Inc()
+		noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+		if note, err := noteService.requireNote(noteID, userID, models.PermissionViewer); err == nil {
+			dispatchEvent(s.Ctx, s.DB, models.EventNoteShared, note,
+				map[string]interface{}{"note": note, "user_id": userID, "permission": permission})
+		}
+	}
+	return s.getInvitation(invitationID)
+}
+
+// Cancel отзывает отправленное приглашение, пока на него не ответили
+func (s *InvitationService) Cancel(invitationID, userID int) error {
+	var noteID int
+	err := s.DB.QueryRowContext(s.Ctx, `SELECT note_id FROM note_invitations WHERE id = $1 AND status = $2`,
+		invitationID, models.InvitationPending).Scan(&noteID)
+	if err == sql.ErrNoRows {
+		return ErrInvitationNotFound
+	}
+	if err != nil {
+		return err
+	}
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	if _, err := noteService.requireNote(noteID, userID, models.PermissionOwner); err != nil {
+		return ErrInvitationNotFound
+	}
+	_, err = s.DB.ExecContext(s.Ctx, `UPDATE note_invitations SET status = $1, responded_at = CURRENT_TIMESTAMP WHERE id = $2`,
+		models.InvitationCancelled, invitationID)
+	if err != nil {
+		return err
+	}
+	audit(s.Ctx, s.DB, s.Client, userID, models.AuditInvitationCancelled, models.AuditTargetInvitation, invitationID,
+		map[string]int{"note_id": noteID})
+	return nil
+}
+
+// GetNoteAccess возвращает владельцу список всех, у кого есть доступ к заметке или приглашение к ней
+func (s *InvitationService) GetNoteAccess(noteID, userID int) (models.NoteAccessList, error) {
+	var list models.NoteAccessList
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	note, err := noteService.requireNote(noteID, userID, models.PermissionOwner)
+	if err != nil {
+		return list, err
+	}
+	list.Owner = models.NoteAccessUser{UserID: note.UserID, Permission: models.PermissionOwner}
+	if err := s.DB.QueryRowContext(s.Ctx, `SELECT username FROM users WHERE id = $1`, note.UserID).Scan(&list.Owner.Username); err != nil {
+		return list, err
+	}
+	if note.TeamID != nil {
+		team := models.NoteAccessTeam{TeamID: *note.TeamID, Permission: models.PermissionOwner}
+		if err := s.DB.QueryRowContext(s.Ctx, `SELECT name FROM teams WHERE id = $1`, team.TeamID).Scan(&team.Name); err != nil {
+			return list, err
+		}
+		list.OwnerTeam = &team
+	}
+	rows, err := s.DB.QueryContext(s.Ctx, `
+		SELECT u.id, u.username, na.permission
+		FROM note_access na JOIN users u ON u.id = na.user_id
+		WHERE na.note_id = $1 ORDER BY u.username`, noteID)
+	if err != nil {
+		return list, err
+	}
+	list.Users = []models.NoteAccessUser{}
+	for rows.Next() {
+		var user models.NoteAccessUser
+		if err := rows.Scan(&user.UserID, &user.Username, &user.Permission); err != nil {
+			rows.Close()
+			return list, err
+		}
+		list.Users = append(list.Users, user)
+	}
+	rows.Close()
+	rows, err = s.DB.QueryContext(s.Ctx, `
+		SELECT t.id, t.name, tna.permission
+		FROM team_note_access tna JOIN teams t ON t.id = tna.team_id
+		WHERE tna.note_id = $1 ORDER BY t.name`, noteID)
+	if err != nil {
+		return list, err
+	}
+	list.Teams = []models.NoteAccessTeam{}
+	for rows.Next() {
+		var team models.NoteAccessTeam
+		if err := rows.Scan(&team.TeamID, &team.Name, &team.Permission); err != nil {
+			rows.Close()
+			return list, err
+		}
+		list.Teams = append(list.Teams, team)
+	}
+	rows.Close()
+	rows, err = s.DB.QueryContext(s.Ctx, `SELECT `+invitationColumns+invitationJoins+`
+		WHERE i.note_id = $1 AND i.status = $2 ORDER BY i.created_at`, noteID, models.InvitationPending)
+	if err != nil {
+		return list, err
+	}
+	list.Invitations, err = scanInvitations(rows)
+	return list, err
+}
+
+// RevokeAccess отзывает личный доступ пользователя к заметке
+func (s *InvitationService) RevokeAccess(noteID, ownerID, userID int) error {
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	if _, err := noteService.requireNote(noteID, ownerID, models.PermissionOwner); err != nil {
+		return err
+	}
+	res, err := s.DB.ExecContext(s.Ctx, `DELETE FROM note_access WHERE note_id = $1 AND user_id = $2`, noteID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	if err := deleteStaleFollows(s.Ctx, s.DB, noteID, userID); err != nil {
+		return err
+	}
+	audit(s.Ctx, s.DB, s.Client, ownerID, models.AuditNoteAccessRevoked, models.AuditTargetNote, noteID,
+		map[string]int{"user_id": userID})
+	return nil
+}
+
+func (s *InvitationService) getInvitation(invitationID int) (models.NoteInvitation, error) {
+	return scanInvitation(s.DB.QueryRowContext(s.Ctx, `SELECT `+invitationColumns+invitationJoins+` WHERE i.id = $1`, invitationID))
+}
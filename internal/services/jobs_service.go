@@ -0,0 +1,417 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"notes-api/internal/config"
+	"notes-api/internal/logging"
+	"notes-api/internal/models"
+	"notes-api/internal/tracing"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Типы задач очереди
+const (
+	JobExport    = "export"    // Выгрузка всех данных пользователя
+	JobBatch     = "batch"     // Фоновая групповая обработка заметок
+	JobImport    = "import"    // Импорт из Evernote и Google Keep
+	JobPurge     = "purge"     // Удаление аккаунтов, устаревших выгрузок и завершенных задач
+	JobWebhooks  = "webhooks"  // Доставка вебхуков из очереди доставки
+	JobReminders = "reminders" // Доставка наступивших напоминаний
+)
+
+// Статусы задач очереди
+const (
+	JobPending   = "pending"   // Ожидает запуска, в том числе повторного после ошибки
+	JobRunning   = "running"   // Выполняется
+	JobCompleted = "completed" // Выполнена
+	JobDead      = "dead"      // Исчерпала попытки и ждет решения администратора
+)
+
+const (
+	// jobLease - на сколько задача закрепляется за рабочим процессом. Выполняемая задача продлевает
+	// закрепление; задачу остановившегося процесса после истечения срока забирает другой.
+	jobLease = 5 * time.Minute
+	// jobTimeout - наибольшее время выполнения задачи
+	jobTimeout = 2 * time.Hour
+	// jobBaseBackoff и jobMaxBackoff - задержка перед повтором задачи, удваивается с каждой попыткой
+	jobBaseBackoff = 30 * time.Second
+	jobMaxBackoff  = time.Hour
+	// JobRetention - срок хранения выполненных и исчерпавших попытки задач
+	JobRetention = 7 * 24 * time.Hour
+)
+
+var (
+	ErrJobNotFound    = errors.New("задача не найдена")
+	ErrJobNotDead     = errors.New("повторить можно только задачу, исчерпавшую попытки")
+	ErrInvalidJobKind = errors.New("неизвестный тип задачи")
+	errJobAbandoned   = errors.New("задача прервана: рабочий процесс остановился во время выполнения")
+	errJobTargetGone  = errors.New("запись, которую обрабатывает задача, удалена")
+	errJobReclaimed   = errors.New("закрепление задачи истекло, и ее забрал другой рабочий процесс")
+)
+
+// jobHandler описывает выполнение задачи одного типа
+type jobHandler struct {
+	// run выполняет задачу и возвращает результат, который сохраняется в задаче
+	run         func(ctx context.Context, db *sql.DB, job models.Job) (interface{}, error)
+	maxAttempts int
+	every       time.Duration // Интервал периодической задачи
+	// dead вызывается, когда задача исчерпала попытки
+	dead func(db *sql.DB, job models.Job, err error) error
+}
+
+// jobRef - данные задачи, которая обрабатывает запись другой таблицы
+type jobRef struct {
+	ID     int               `json:"id"`
+	Client models.ClientInfo `json:"client"` // Клиент, запустивший задачу; записывается в журнал аудита
+}
+
+// permanentJobError - ошибка, после которой задача не повторяется
+type permanentJobError struct {
+	err error
+}
+
+func (e permanentJobError) Error() string { return e.err.Error() }
+
+func (e permanentJobError) Unwrap() error { return e.err }
+
+// periodicJobs - служебные задачи, которые рабочие процессы выполняют с интервалом
+var periodicJobs = []string{JobPurge, JobWebhooks, JobReminders}
+
+// jobHandlerFor возвращает обработчик задачи по ее типу. smtp - SMTP-сервер для писем, которые отправляют
+// задачи; для постановки задачи в очередь он не нужен.
+func jobHandlerFor(kind string, smtp config.SMTPConfig) (jobHandler, bool) {
+	switch kind {
+	case JobExport:
+		return jobHandler{run: runExportJob, maxAttempts: 3, dead: failExportJob}, true
+	case JobBatch:
+		return jobHandler{run: runBatchJob, maxAttempts: 3, dead: failBatchJob}, true
+	case JobImport:
+		// Импорт создает заметки по одной, поэтому повтор после сбоя создал бы дубликаты
+		return jobHandler{run: runImportJob, maxAttempts: 1, dead: failImportJob}, true
+	case JobPurge:
+		return jobHandler{run: runPurgeJob, maxAttempts: 1, every: time.Hour}, true
+	case JobWebhooks:
+		return jobHandler{run: runWebhooksJob, maxAttempts: 1, every: 5 * time.Second}, true
+	case JobReminders:
+		return jobHandler{run: remindersJob(smtp), maxAttempts: 1, every: 15 * time.Second}, true
+	}
+	return jobHandler{}, false
+}
+
+const jobColumns = `id, kind, status, attempts, max_attempts, run_at, last_error, result, created_at,
+	started_at, completed_at, user_id, payload`
+
+func scanJob(row rowScanner) (models.Job, error) {
+	var job models.Job
+	var result, payload []byte
+	err := row.Scan(&job.ID, &job.Kind, &job.Status, &job.Attempts, &job.MaxAttempts, &job.RunAt, &job.LastError,
+		&result, &job.CreatedAt, &job.StartedAt, &job.CompletedAt, &job.UserID, &payload)
+	job.Result, job.Payload = result, payload
+	return job, err
+}
+
+// enqueueJob ставит задачу в очередь; задача запускается не раньше чем через delay
+func enqueueJob(ctx context.Context, q dbtx, kind string, userID *int, payload interface{}, delay time.Duration) (int, error) {
+	handler, ok := jobHandlerFor(kind, config.SMTPConfig{})
+	if !ok {
+		return 0, ErrInvalidJobKind
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	var jobID int
+	err = q.QueryRowContext(ctx, `INSERT INTO jobs (kind, user_id, payload, max_attempts, run_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP + $5::int * INTERVAL '1 second') RETURNING id`,
+		kind, userID, data, handler.maxAttempts, int(delay.Seconds())).Scan(&jobID)
+	return jobID, err
+}
+
+// JobService предоставляет методы для просмотра задач очереди
+type JobService struct {
+	DB  *sql.DB
+	Ctx context.Context // Контекст запроса: его отмена прерывает запросы к базе данных
+}
+
+// GetJob возвращает задачу пользователя
+func (s *JobService) GetJob(jobID, userID int) (models.Job, error) {
+	job, err := scanJob(s.DB.QueryRowContext(s.Ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1 AND user_id = $2`, jobID, userID))
+	if err == sql.ErrNoRows {
+		return job, ErrJobNotFound
+	}
+	return job, err
+}
+
+// Worker - пул рабочих процессов, выполняющих задачи очереди
+type Worker struct {
+	DB           *sql.DB
+	Concurrency  int               // Число одновременно выполняемых задач
+	PollInterval time.Duration     // Пауза между проверками пустой очереди
+	SMTP         config.SMTPConfig // SMTP-сервер для напоминаний по email
+
+	running atomic.Bool
+}
+
+// Running сообщает, разбирает ли пул очередь задач
+func (w *Worker) Running() bool {
+	return w.running.Load()
+}
+
+// Run ставит в очередь периодические задачи и выполняет задачи, пока не отменен ctx.
+// После отмены новые задачи не берутся, а выполняемые доводятся до конца.
+func (w *Worker) Run(ctx context.Context) error {
+	for _, kind := range periodicJobs {
+		_, err := w.DB.Exec(`INSERT INTO jobs (kind, max_attempts, unique_key) VALUES ($1, 1, $1)
+			ON CONFLICT (unique_key) WHERE unique_key IS NOT NULL DO NOTHING`, kind)
+		if err != nil {
+			return err
+		}
+	}
+	w.running.Store(true)
+	defer w.running.Store(false)
+	var wg sync.WaitGroup
+	for i := 0; i < w.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+func (w *Worker) loop(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, lock, err := w.claim()
+		if err == nil {
+			w.process(job, lock)
+			continue
+		}
+		if err != sql.ErrNoRows {
+			slog.ErrorContext(ctx, "Ошибка при получении задачи из очереди", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(w.PollInterval):
+		}
+	}
+}
+
+// claim забирает готовую к запуску задачу или задачу, закрепление которой истекло, и возвращает ее
+// вместе с меткой закрепления. SKIP LOCKED позволяет нескольким процессам разбирать очередь,
+// не дожидаясь друг друга.
+func (w *Worker) claim() (models.Job, string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return models.Job{}, "", err
+	}
+	lock := hex.EncodeToString(buf)
+	job, err := scanJob(w.DB.QueryRow(`UPDATE jobs SET status = $1, attempts = attempts + 1, started_at = CURRENT_TIMESTAMP,
+		locked_until = CURRENT_TIMESTAMP + $2::int * INTERVAL '1 second', locked_by = $4
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE (status = $3 AND run_at <= CURRENT_TIMESTAMP) OR (status = $1 AND locked_until < CURRENT_TIMESTAMP)
+			ORDER BY run_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING `+jobColumns, JobRunning, int(jobLease.Seconds()), JobPending, lock))
+	return job, lock, err
+}
+
+// process выполняет задачу, закрепленную меткой lock
+func (w *Worker) process(job models.Job, lock string) {
+	// Записи журнала, сделанные при выполнении задачи, получают ее номер и вид
+	ctx := logging.With(context.Background(), slog.Int("job_id", job.ID), slog.String("job_kind", job.Kind))
+	// Спан задачи объединяет спаны ее запросов к базе данных
+	ctx, span := tracing.Start(ctx, "job "+job.Kind, trace.WithAttributes(
+		attribute.Int("job.id", job.ID), attribute.Int("job.attempt", job.Attempts)))
+	defer span.End()
+	handler, ok := jobHandlerFor(job.Kind, w.SMTP)
+	var result interface{}
+	var err error
+	switch {
+	case !ok:
+		err = permanentJobError{ErrInvalidJobKind}
+	case job.Attempts > job.MaxAttempts && handler.every == 0:
+		// Задачу забрали после истечения закрепления, а попыток больше не осталось
+		err = permanentJobError{errJobAbandoned}
+	default:
+		done := make(chan struct{})
+		go w.heartbeat(job.ID, lock, done)
+		result, err = w.run(ctx, handler, job)
+		close(done)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Ошибка при выполнении задачи", "attempt", job.Attempts, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	if err := w.finish(job, lock, handler, result, err); err != nil {
+		slog.ErrorContext(ctx, "Ошибка при сохранении результата задачи", "error", err)
+	}
+}
+
+// run выполняет задачу; паника обработчика считается ошибкой задачи
+func (w *Worker) run(ctx context.Context, handler jobHandler, job models.Job) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("паника при выполнении задачи: %v", r)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(ctx, jobTimeout)
+	defer cancel()
+	return handler.run(ctx, w.DB, job)
+}
+
+// heartbeat продлевает закрепление выполняемой задачи, пока не закрыт done. Если задачу после истечения
+// закрепления забрал другой процесс, ее закрепление с новой меткой не продлевается.
+func (w *Worker) heartbeat(jobID int, lock string, done <-chan struct{}) {
+	ticker := time.NewTicker(jobLease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			_, err := w.DB.Exec(`UPDATE jobs SET locked_until = CURRENT_TIMESTAMP + $1::int * INTERVAL '1 second'
+				WHERE id = $2 AND status = $3 AND locked_by = $4`, int(jobLease.Seconds()), jobID, JobRunning, lock)
+			if err != nil {
+				slog.Error("Ошибка при продлении задачи", "job_id", jobID, "error", err)
+			}
+		}
+	}
+}
+
+// finish сохраняет итог задачи. Периодическая задача планируется заново, задача с ошибкой повторяется
+// с растущей задержкой, а исчерпав попытки получает статус dead. Итог не сохраняется, если после
+// истечения закрепления задачу забрал другой процесс: она принадлежит уже его запуску.
+func (w *Worker) finish(job models.Job, lock string, handler jobHandler, result interface{}, runErr error) error {
+	message := ""
+	if runErr != nil {
+		message = runErr.Error()
+	}
+	var permanent permanentJobError
+	switch {
+	case handler.every > 0:
+		return w.release(`UPDATE jobs SET status = $3, attempts = 0, locked_until = NULL, locked_by = NULL, last_error = $4,
+			completed_at = CURRENT_TIMESTAMP, run_at = CURRENT_TIMESTAMP + $5::int * INTERVAL '1 second'
+			WHERE id = $1 AND locked_by = $2`, job.ID, lock, JobPending, message, int(handler.every.Seconds()))
+	case runErr == nil:
+		var payload []byte
+		if result != nil {
+			var err error
+			if payload, err = json.Marshal(result); err != nil {
+				return err
+			}
+		}
+		return w.release(`UPDATE jobs SET status = $3, locked_until = NULL, locked_by = NULL, last_error = '', result = $4,
+			completed_at = CURRENT_TIMESTAMP WHERE id = $1 AND locked_by = $2`, job.ID, lock, JobCompleted, payload)
+	case job.Attempts < job.MaxAttempts && !errors.As(runErr, &permanent):
+		return w.release(`UPDATE jobs SET status = $3, locked_until = NULL, locked_by = NULL, last_error = $4,
+			run_at = CURRENT_TIMESTAMP + $5::int * INTERVAL '1 second' WHERE id = $1 AND locked_by = $2`,
+			job.ID, lock, JobPending, message, int(jobBackoff(job.Attempts).Seconds()))
+	}
+	err := w.release(`UPDATE jobs SET status = $3, locked_until = NULL, locked_by = NULL, last_error = $4,
+		completed_at = CURRENT_TIMESTAMP WHERE id = $1 AND locked_by = $2`, job.ID, lock, JobDead, message)
+	if err == nil && handler.dead != nil {
+		err = handler.dead(w.DB, job, runErr)
+	}
+	return err
+}
+
+// release выполняет запрос, снимающий закрепление задачи. Первые два параметра запроса - ID задачи
+// и метка закрепления; если метка уже другая, возвращается errJobReclaimed.
+func (w *Worker) release(query string, args ...interface{}) error {
+	res, err := w.DB.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errJobReclaimed
+	}
+	return nil
+}
+
+// jobBackoff возвращает задержку перед следующей попыткой задачи после attempts неудачных
+func jobBackoff(attempts int) time.Duration {
+	return backoff(attempts, jobBaseBackoff, jobMaxBackoff)
+}
+
+// backoff возвращает задержку перед следующей попыткой после attempts неудачных: base,
+// удваиваемую с каждой попыткой, но не больше limit
+func backoff(attempts int, base, limit time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < limit; i++ {
+		delay *= 2
+	}
+	return min(delay, limit)
+}
+
+// jobTarget разбирает данные задачи, которая обрабатывает запись другой таблицы
+func jobTarget(job models.Job) (jobRef, error) {
+	var ref jobRef
+	if err := json.Unmarshal(job.Payload, &ref); err != nil {
+		return ref, permanentJobError{err}
+	}
+	return ref, nil
+}
+
+// runPurgeJob удаляет аккаунты с истекшим сроком отмены удаления, устаревшие выгрузки
+// и завершенные задачи старше JobRetention
+func runPurgeJob(ctx context.Context, db *sql.DB, job models.Job) (interface{}, error) {
+	userService := UserService{DB: db, Ctx: ctx}
+	n, err := userService.PurgeDeletedAccounts()
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		slog.InfoContext(ctx, "Удалены аккаунты после срока восстановления", "count", n)
+	}
+	exportService := ExportService{DB: db, Ctx: ctx}
+	if err := exportService.PurgeExpiredExports(); err != nil {
+		return nil, err
+	}
+	_, err = db.ExecContext(ctx, `DELETE FROM jobs WHERE status IN ($1, $2) AND unique_key IS NULL
+		AND completed_at < CURRENT_TIMESTAMP - $3::int * INTERVAL '1 second'`,
+		JobCompleted, JobDead, int(JobRetention.Seconds()))
+	return nil, err
+}
+
+// runWebhooksJob отправляет события из очереди доставки пачками, пока в ней есть готовые к отправке
+func runWebhooksJob(ctx context.Context, db *sql.DB, job models.Job) (interface{}, error) {
+	webhookService := WebhookService{DB: db, Ctx: ctx}
+	for ctx.Err() == nil {
+		n, err := webhookService.DeliverPending(webhookBatch)
+		if err != nil || n == 0 {
+			return nil, err
+		}
+	}
+	return nil, ctx.Err()
+}
+
+// remindersJob возвращает задачу, которая доставляет наступившие напоминания, отправляя письма через smtp
+func remindersJob(smtp config.SMTPConfig) func(ctx context.Context, db *sql.DB, job models.Job) (interface{}, error) {
+	return func(ctx context.Context, db *sql.DB, job models.Job) (interface{}, error) {
+		reminderService := ReminderService{DB: db, Ctx: ctx, SMTP: smtp}
+		for ctx.Err() == nil {
+			n, err := reminderService.FirePending(100)
+			if err != nil || n < 100 {
+				return nil, err
+			}
+		}
+		return nil, ctx.Err()
+	}
+}
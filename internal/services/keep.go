@@ -0,0 +1,171 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"notes-api/internal/models"
+	"path"
+	"strings"
+	"time"
+)
+
+// keepNote - заметка Google Keep в выгрузке Google Takeout
+type keepNote struct {
+	Title                   string           `json:"title"`
+	TextContent             string           `json:"textContent"`
+	ListContent             []keepListItem   `json:"listContent"`
+	Labels                  []keepLabel      `json:"labels"`
+	Attachments             []keepAttachment `json:"attachments"`
+	Annotations             []keepAnnotation `json:"annotations"`
+	IsPinned                bool             `json:"isPinned"`
+	IsArchived              bool             `json:"isArchived"`
+	IsTrashed               bool             `json:"isTrashed"`
+	CreatedTimestampUsec    int64            `json:"createdTimestampUsec"`
+	UserEditedTimestampUsec int64            `json:"userEditedTimestampUsec"`
+}
+
+type keepListItem struct {
+	Text      string `json:"text"`
+	IsChecked bool   `json:"isChecked"`
+}
+
+type keepLabel struct {
+	Name string `json:"name"`
+}
+
+type keepAttachment struct {
+	FilePath string `json:"filePath"`
+	Mimetype string `json:"mimetype"`
+}
+
+// keepAnnotation - ссылка, которую Keep нашел в тексте заметки
+type keepAnnotation struct {
+	URL   string `json:"url"`
+	Title string `json:"title"`
+}
+
+// parseKeep читает заметки из ZIP-архива Google Takeout с папкой Keep. Ярлыки становятся тегами,
+// списки - пунктами списка задач, файлы - вложениями; заметки из корзины пропускаются.
+// HTML-копии заметок, которые Takeout кладет рядом с JSON, не читаются.
+func parseKeep(archive []byte) ([]importEntry, []string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, nil, ErrInvalidArchive
+	}
+	unpack := newZipUnpacker()
+	files := map[string]*zip.File{}
+	byStem := map[string]string{} // Takeout иногда меняет расширение файла, например .jpeg на .jpg
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		files[f.Name] = f
+		byStem[strings.TrimSuffix(f.Name, path.Ext(f.Name))] = f.Name
+	}
+	var entries []importEntry
+	notes := map[string]bool{}
+	attached := map[string]bool{}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !strings.EqualFold(path.Ext(f.Name), ".json") {
+			continue
+		}
+		data, err := unpack.read(f, maxImportFileSize)
+		if unpack.exhausted {
+			return nil, nil, ErrArchiveTooLarge
+		}
+		if err != nil {
+			continue
+		}
+		var note keepNote
+		if json.Unmarshal(data, &note) != nil || (note.CreatedTimestampUsec == 0 && note.UserEditedTimestampUsec == 0) {
+			continue
+		}
+		if len(entries) == maxImportFiles {
+			return nil, nil, ErrTooManyNotes
+		}
+		notes[f.Name] = true
+		entry := keepEntry(f.Name, note)
+		for _, attachment := range note.Attachments {
+			filePath := path.Join(path.Dir(f.Name), attachment.FilePath)
+			if files[filePath] == nil {
+				filePath = byStem[strings.TrimSuffix(filePath, path.Ext(filePath))]
+			}
+			if files[filePath] == nil {
+				continue
+			}
+			data, err := unpack.read(files[filePath], maxAttachmentSize)
+			if unpack.exhausted {
+				return nil, nil, ErrArchiveTooLarge
+			}
+			if err != nil {
+				entry.err = err
+				break
+			}
+			attached[filePath] = true
+			entry.attachments = append(entry.attachments, importAttachment{
+				name: path.Base(filePath), mimeType: attachment.Mimetype, data: data})
+		}
+		entries = append(entries, entry)
+	}
+	ignored := []string{}
+	for _, f := range zr.File {
+		if !f.FileInfo().IsDir() && !notes[f.Name] && !attached[f.Name] && !strings.EqualFold(path.Ext(f.Name), ".html") {
+			ignored = append(ignored, f.Name)
+		}
+	}
+	return entries, ignored, nil
+}
+
+// keepEntry преобразует заметку Keep. Текст Keep не содержит разметки и импортируется как обычный текст.
+func keepEntry(name string, note keepNote) importEntry {
+	entry := importEntry{
+		path:     name,
+		title:    note.Title,
+		format:   models.ContentPlain,
+		content:  note.TextContent,
+		pinned:   note.IsPinned,
+		archived: note.IsArchived,
+	}
+	if entry.title == "" {
+		// У заметок Keep часто нет заголовка: берем первую строку текста или списка
+		first := strings.TrimSpace(note.TextContent)
+		if first == "" && len(note.ListContent) > 0 {
+			first = note.ListContent[0].Text
+		}
+		first, _, _ = strings.Cut(first, "\n")
+		entry.title = truncateRunes(strings.TrimSpace(first), 60)
+	}
+	if entry.title == "" {
+		entry.title = strings.TrimSuffix(path.Base(name), path.Ext(name))
+	}
+	for _, label := range note.Labels {
+		entry.tags = append(entry.tags, label.Name)
+	}
+	for _, item := range note.ListContent {
+		if text := strings.TrimSpace(item.Text); text != "" {
+			entry.checklist = append(entry.checklist, importChecklistItem{text: text, checked: item.IsChecked})
+		}
+	}
+	var links []string
+	for _, annotation := range note.Annotations {
+		if annotation.URL != "" && !strings.Contains(note.TextContent, annotation.URL) {
+			links = append(links, strings.TrimSpace(annotation.Title+" "+annotation.URL))
+		}
+	}
+	if len(links) > 0 {
+		entry.content = strings.TrimSpace(entry.content + "\n\n" + strings.Join(links, "\n"))
+	}
+	if note.CreatedTimestampUsec > 0 {
+		created := time.UnixMicro(note.CreatedTimestampUsec).UTC()
+		entry.created = &created
+	}
+	if note.UserEditedTimestampUsec > 0 {
+		updated := time.UnixMicro(note.UserEditedTimestampUsec).UTC()
+		entry.updated = &updated
+	}
+	if note.IsTrashed {
+		entry.skip = "заметка в корзине"
+	}
+	return entry
+}
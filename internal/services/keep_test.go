@@ -0,0 +1,82 @@
+package services
+
+import (
+	"errors"
+	"notes-api/internal/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseKeep(t *testing.T) {
+	created := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+	updated := created.Add(1500 * time.Millisecond)
+	tests := []struct {
+		name        string
+		archive     []byte
+		want        []importEntry
+		wantIgnored []string
+		wantErr     error
+	}{
+		{
+			name: "текстовая заметка",
+			archive: zipArchive(t,
+				archiveFile{"Takeout/archive_browser.html", "<html></html>"},
+				archiveFile{"Takeout/Keep/Покупки.json", `{"title": "Покупки", "textContent": "молоко https://shop.example",
+					"labels": [{"name": "дом"}, {"name": "еда"}], "isPinned": true, "isArchived": true,
+					"annotations": [{"url": "https://shop.example", "title": "Магазин"}, {"url": "https://other.example", "title": "Другой"}],
+					"createdTimestampUsec": 1700000000000000, "userEditedTimestampUsec": 1700000001500000}`},
+				archiveFile{"Takeout/Keep/Покупки.html", "<html></html>"},
+				archiveFile{"Takeout/Keep/Labels.txt", "дом\nеда"},
+			),
+			want: []importEntry{{path: "Takeout/Keep/Покупки.json", title: "Покупки", tags: []string{"дом", "еда"},
+				format: models.ContentPlain, content: "молоко https://shop.example\n\nДругой https://other.example",
+				created: &created, updated: &updated, pinned: true, archived: true}},
+			wantIgnored: []string{"Takeout/Keep/Labels.txt"},
+		},
+		{
+			name: "список без заголовка",
+			archive: zipArchive(t, archiveFile{"Keep/1.json", `{"listContent": [{"text": "  хлеб\nчерный ", "isChecked": true},
+				{"text": " "}, {"text": "сыр"}], "userEditedTimestampUsec": 1700000001500000}`}),
+			want: []importEntry{{path: "Keep/1.json", title: "хлеб", format: models.ContentPlain, updated: &updated,
+				checklist: []importChecklistItem{{text: "хлеб\nчерный", checked: true}, {text: "сыр"}}}},
+			wantIgnored: []string{},
+		},
+		{
+			name: "заметка в корзине",
+			archive: zipArchive(t, archiveFile{"Keep/Пустая.json",
+				`{"isTrashed": true, "createdTimestampUsec": 1700000000000000}`}),
+			want: []importEntry{{path: "Keep/Пустая.json", title: "Пустая", format: models.ContentPlain, created: &created,
+				skip: "заметка в корзине"}},
+			wantIgnored: []string{},
+		},
+		{
+			name: "вложения",
+			archive: zipArchive(t,
+				archiveFile{"Keep/Фото.json", `{"title": "Фото", "createdTimestampUsec": 1700000000000000,
+					"attachments": [{"filePath": "cat.jpeg", "mimetype": "image/jpeg"}, {"filePath": "missing.png", "mimetype": "image/png"}]}`},
+				archiveFile{"Keep/cat.jpg", "JPEG"},
+				archiveFile{"Keep/settings.json", `{"theme": "dark"}`},
+				archiveFile{"Keep/broken.json", `{"title": `},
+			),
+			want: []importEntry{{path: "Keep/Фото.json", title: "Фото", format: models.ContentPlain, created: &created,
+				attachments: []importAttachment{{name: "cat.jpg", mimeType: "image/jpeg", data: []byte("JPEG")}}}},
+			wantIgnored: []string{"Keep/settings.json", "Keep/broken.json"},
+		},
+		{name: "не ZIP", archive: []byte("not a zip archive"), wantErr: ErrInvalidArchive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, ignored, err := parseKeep(tt.archive)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseKeep() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(entries, tt.want) {
+				t.Errorf("parseKeep() entries = %+v, want %+v", entries, tt.want)
+			}
+			if !reflect.DeepEqual(ignored, tt.wantIgnored) {
+				t.Errorf("parseKeep() ignored = %q, want %q", ignored, tt.wantIgnored)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"notes-api/internal/models"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// wikiLinkPattern находит ссылки вида [[Название заметки]] и [[id:123]]
+var wikiLinkPattern = regexp.MustCompile(`\[\[([^\[\]\n]+)\]\]`)
+
+// idLinkPattern - ссылка на заметку по ID
+var idLinkPattern = regexp.MustCompile(`^(?i)id:\s*(\d+)$`)
+
+// extractWikiLinks возвращает тексты ссылок из содержимого без повторов (без учета регистра) в порядке появления
+func extractWikiLinks(content string) []string {
+	var links []string
+	seen := map[string]bool{}
+	for _, match := range wikiLinkPattern.FindAllStringSubmatch(content, -1) {
+		text := strings.TrimSpace(match[1])
+		key := strings.ToLower(text)
+		if text == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		links = append(links, text)
+	}
+	return links
+}
+
+// LinkService предоставляет методы для работы со ссылками между заметками
+type LinkService struct {
+	DB     *sql.DB
+	Client models.ClientInfo // Клиент, выполняющий запрос; записывается в журнал аудита
+	Ctx    context.Context   // Контекст запроса: его отмена прерывает запросы к базе данных
+}
+
+// SyncLinks пересобирает ссылки заметки по ее содержимому. Ссылка разрешается только в заметку,
+// доступную владельцу исходной заметки; при совпадении названий предпочитаются его собственные заметки.
+func (s *LinkService) SyncLinks(note models.Note) error {
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(s.Ctx, `DELETE FROM note_links WHERE source_id = $1`, note.ID); err != nil {
+		return err
+	}
+	for position, text := range extractWikiLinks(note.Content) {
+		var targetID *int
+		var id int
+		var err error
+		if match := idLinkPattern.FindStringSubmatch(text); match != nil {
+			id, _ = strconv.Atoi(match[1])
+			err = tx.QueryRowContext(s.Ctx, `SELECT id FROM notes WHERE id = $1 AND id <> $3 AND id IN (`+accessibleNoteIDs("$2")+`)`,
+				id, note.UserID, note.ID).Scan(&id)
+		} else {
+			err = tx.QueryRowContext(s.Ctx, `SELECT n.id FROM notes n
+				WHERE LOWER(n.title) = LOWER($1) AND n.id <> $3 AND n.id IN (`+accessibleNoteIDs("$2")+`)
+				ORDER BY (n.user_id = $2) DESC, n.updated_at DESC
+				LIMIT 1`, text, note.UserID, note.ID).Scan(&id)
+		}
+		if err == nil {
+			targetID = &id
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+		_, err = tx.ExecContext(s.Ctx, `INSERT INTO note_links (source_id, target_id, link_text, position) VALUES ($1, $2, $3, $4)`,
+			note.ID, targetID, text, position)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ResolveBroken связывает битые ссылки с текстом, совпадающим с названием заметки,
+// если она доступна владельцу исходной заметки
+func (s *LinkService) ResolveBroken(note models.Note) error {
+	_, err := s.DB.ExecContext(s.Ctx, `UPDATE note_links l SET target_id = $1
+		FROM notes src
+		WHERE src.id = l.source_id AND l.target_id IS NULL AND l.source_id <> $1
+			AND LOWER(l.link_text) = LOWER($2)
+			AND $1 IN (`+accessibleNoteIDs("src.user_id")+`)`, note.ID, note.Title)
+	return err
+}
+
+// PropagateRename заменяет текст ссылок на переименованную заметку в содержимом ссылающихся на нее заметок,
+// которые пользователь actorID может редактировать. Такая замена - обычное изменение заметки от его имени:
+// с уведомлением подписчиков, событием вебхука и записью в журнале аудита. Остальные заметки не меняются,
+// их ссылки со старым текстом перестанут вести на заметку при следующем изменении ссылающейся заметки.
+// Ссылки по ID не меняются; название со скобками или переводом строки не может быть текстом ссылки.
+func (s *LinkService) PropagateRename(noteID, actorID int, oldTitle, newTitle string) error {
+	if strings.ContainsAny(newTitle, "[]\n") || strings.TrimSpace(newTitle) == "" {
+		return nil
+	}
+	pattern := regexp.MustCompile(`(?i)\[\[\s*` + regexp.QuoteMeta(strings.TrimSpace(oldTitle)) + `\s*\]\]`)
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+noteColumns+` FROM notes n
+		WHERE n.id IN (SELECT source_id FROM note_links WHERE target_id = $1 AND LOWER(link_text) = LOWER($2))`,
+		noteID, strings.TrimSpace(oldTitle))
+	if err != nil {
+		return err
+	}
+	sources, err := scanNotes(rows)
+	if err != nil {
+		return err
+	}
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	for _, source := range sources {
+		permission, err := noteService.NotePermission(source.ID, actorID)
+		if err != nil {
+			return err
+		}
+		if !hasPermission(permission, models.PermissionEditor) {
+			continue
+		}
+		before := source
+		source.Content = pattern.ReplaceAllLiteralString(source.Content, "[["+newTitle+"]]")
+		err = s.DB.QueryRowContext(s.Ctx, `UPDATE notes SET content = $1 WHERE id = $2 RETURNING updated_at`,
+			source.Content, source.ID).Scan(&source.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		if err := s.SyncLinks(source); err != nil {
+			return err
+		}
+		source.Permission = permission
+		if source.Tags, err = noteService.GetTagsForNote(source.ID); err != nil {
+			return err
+		}
+		notifyNoteUpdated(s.Ctx, s.DB, source, actorID)
+		dispatchEvent(s.Ctx, s.DB, models.EventNoteUpdated, source, source)
+		audit(s.Ctx, s.DB, s.Client, actorID, models.AuditNoteUpdated, models.AuditTargetNote, source.ID,
+			map[string]interface{}{"before": noteSummary(before), "after": noteSummary(source), "renamed_link": noteID})
+	}
+	return nil
+}
+
+// GetLinks возвращает исходящие ссылки заметки. Заметки, к которым у пользователя нет доступа,
+// не раскрываются: у таких ссылок нет target_id и названия.
+func (s *LinkService) GetLinks(noteID, userID int) ([]models.NoteLink, error) {
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	if _, err := noteService.requireNote(noteID, userID, models.PermissionViewer); err != nil {
+		return nil, err
+	}
+	rows, err := s.DB.QueryContext(s.Ctx, `
+		SELECT l.source_id, src.title, t.id, COALESCE(t.title, ''), l.link_text, l.target_id IS NULL
+		FROM note_links l
+		JOIN notes src ON src.id = l.source_id
+		LEFT JOIN notes t ON t.id = l.target_id AND t.id IN (`+accessibleNoteIDs("$2")+`)
+		WHERE l.source_id = $1
+		ORDER BY l.position`, noteID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanLinks(rows)
+}
+
+// GetBacklinks возвращает ссылки на заметку из доступных пользователю заметок
+func (s *LinkService) GetBacklinks(noteID, userID int) ([]models.NoteLink, error) {
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	if _, err := noteService.requireNote(noteID, userID, models.PermissionViewer); err != nil {
+		return nil, err
+	}
+	rows, err := s.DB.QueryContext(s.Ctx, `
+		SELECT l.source_id, src.title, t.id, t.title, l.link_text, FALSE
+		FROM note_links l
+		JOIN notes src ON src.id = l.source_id
+		JOIN notes t ON t.id = l.target_id
+		WHERE l.target_id = $1 AND l.source_id IN (`+accessibleNoteIDs("$2")+`)
+		ORDER BY src.updated_at DESC, l.source_id`, noteID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanLinks(rows)
+}
+
+// GetBroken возвращает битые ссылки в доступных пользователю заметках
+func (s *LinkService) GetBroken(userID int) ([]models.NoteLink, error) {
+	rows, err := s.DB.QueryContext(s.Ctx, `
+		SELECT l.source_id, src.title, NULL::int, '', l.link_text, TRUE
+		FROM note_links l
+		JOIN notes src ON src.id = l.source_id
+		WHERE l.target_id IS NULL AND l.source_id IN (`+accessibleNoteIDs("$1")+`)
+		ORDER BY l.source_id, l.position`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanLinks(rows)
+}
+
+// GetGraph возвращает доступные пользователю заметки и ссылки между ними
+func (s *LinkService) GetGraph(userID int) (models.NoteGraph, error) {
+	graph := models.NoteGraph{Nodes: []models.GraphNode{}, Edges: []models.GraphEdge{}}
+	accessible := `WITH accessible AS (` + accessibleNoteIDs("$1") + `) `
+	rows, err := s.DB.QueryContext(s.Ctx, accessible+`SELECT id, title FROM notes WHERE id IN (SELECT id FROM accessible) ORDER BY id`, userID)
+	if err != nil {
+		return graph, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var node models.GraphNode
+		if err := rows.Scan(&node.ID, &node.Title); err != nil {
+			return graph, err
+		}
+		graph.Nodes = append(graph.Nodes, node)
+	}
+	if err := rows.Err(); err != nil {
+		return graph, err
+	}
+	edges, err := s.DB.QueryContext(s.Ctx, accessible+`SELECT source_id, target_id FROM note_links
+		WHERE source_id IN (SELECT id FROM accessible) AND target_id IN (SELECT id FROM accessible)
+		ORDER BY source_id, position`, userID)
+	if err != nil {
+		return graph, err
+	}
+	defer edges.Close()
+	for edges.Next() {
+		var edge models.GraphEdge
+		if err := edges.Scan(&edge.Source, &edge.Target); err != nil {
+			return graph, err
+		}
+		graph.Edges = append(graph.Edges, edge)
+	}
+	return graph, edges.Err()
+}
+
+func scanLinks(rows *sql.Rows) ([]models.NoteLink, error) {
+	defer rows.Close()
+	links := []models.NoteLink{}
+	for rows.Next() {
+		var link models.NoteLink
+		if err := rows.Scan(&link.SourceID, &link.SourceTitle, &link.TargetID, &link.TargetTitle, &link.Text,
+			&link.Broken); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// linkNote обновляет ссылки созданной или измененной заметки, не прерывая основное действие.
+// При смене названия ссылки на заметку в других заметках, которые может редактировать actorID,
+// получают новое название.
+func linkNote(ctx context.Context, db *sql.DB, client models.ClientInfo, note models.Note, actorID int, previousTitle string) {
+	linkService := LinkService{DB: db, Ctx: ctx, Client: client}
+	if err := linkService.SyncLinks(note); err != nil {
+		slog.ErrorContext(ctx, "Ошибка при обновлении ссылок заметки", "note_id", note.ID, "error", err)
+	}
+	if previousTitle == note.Title {
+		return
+	}
+	if previousTitle != "" {
+		if err := linkService.PropagateRename(note.ID, actorID, previousTitle, note.Title); err != nil {
+			slog.ErrorContext(ctx, "Ошибка при переименовании ссылок на заметку", "note_id", note.ID, "error", err)
+		}
+	}
+	if err := linkService.ResolveBroken(note); err != nil {
+		slog.ErrorContext(ctx, "Ошибка при восстановлении ссылок на заметку", "note_id", note.ID, "error", err)
+	}
+}
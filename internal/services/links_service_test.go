@@ -0,0 +1,30 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractWikiLinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"без ссылок", "обычный текст [ссылка](https://example.com)", nil},
+		{"порядок появления", "см. [[План]] и [[Итоги]]", []string{"План", "Итоги"}},
+		{"повтор без учета регистра", "[[План]] [[план]] [[ПЛАН]]", []string{"План"}},
+		{"пробелы обрезаются", "[[  Итоги недели ]]", []string{"Итоги недели"}},
+		{"пустая ссылка", "[[ ]] [[]]", nil},
+		{"ссылка по ID", "[[id: 42]]", []string{"id: 42"}},
+		{"перенос строки", "[[начало\nконец]]", nil},
+		{"вложенные скобки", "[[[[Заметка]]]]", []string{"Заметка"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractWikiLinks(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractWikiLinks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
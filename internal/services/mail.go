@@ -0,0 +1,40 @@
+package services
+
+import (
+	"errors"
+	"mime"
+	"net"
+	"net/smtp"
+	"notes-api/internal/config"
+	"strconv"
+	"strings"
+)
+
+// ErrMailNotConfigured возвращается, если не задан SMTP-сервер
+var ErrMailNotConfigured = errors.New("отправка email не настроена")
+
+// sendMail отправляет письмо через SMTP-сервер из настроек server
+func sendMail(server config.SMTPConfig, to, subject, body string) error {
+	if server.Host == "" {
+		return ErrMailNotConfigured
+	}
+	from := server.From
+	if from == "" {
+		from = server.Username
+	}
+	var auth smtp.Auth
+	if server.Username != "" {
+		auth = smtp.PlainAuth("", server.Username, server.Password, server.Host)
+	}
+	// Переводы строк в заголовках позволили бы подставить чужие заголовки
+	if strings.ContainsAny(to+from, "\r\n") {
+		return errors.New("недопустимый адрес email")
+	}
+	message := "From: " + from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" + body
+	return smtp.SendMail(net.JoinHostPort(server.Host, strconv.Itoa(server.Port)), auth, from, []string{to}, []byte(message))
+}
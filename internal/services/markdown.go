@@ -0,0 +1,139 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/text"
+	"html"
+	"notes-api/internal/models"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var ErrInvalidContentFormat = errors.New("формат содержимого должен быть plain или markdown")
+
+// excerptLength - длина отрывка заметки в символах
+const excerptLength = 200
+
+// markdownRenderer преобразует CommonMark с расширениями GFM (таблицы, зачеркивание, списки задач,
+// автоссылки). Сырой HTML и опасные ссылки goldmark не выводит, а результат дополнительно очищается.
+var markdownRenderer = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// htmlPolicy - строгая политика очистки HTML для заметок, которые могут просматривать другие пользователи
+var htmlPolicy = newHTMLPolicy()
+
+func newHTMLPolicy() *bluemonday.Policy {
+	policy := bluemonday.UGCPolicy()
+	policy.RequireNoReferrerOnLinks(true)
+	policy.AddTargetBlankToFullyQualifiedLinks(true)
+	// Флажки списков задач GFM
+	policy.AllowElements("input")
+	policy.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	policy.AllowAttrs("checked", "disabled").OnElements("input")
+	return policy
+}
+
+// validContentFormat возвращает формат содержимого, по умолчанию plain
+func validContentFormat(format string) (string, error) {
+	switch format {
+	case "":
+		return models.ContentPlain, nil
+	case models.ContentPlain, models.ContentMarkdown:
+		return format, nil
+	}
+	return "", ErrInvalidContentFormat
+}
+
+// RenderHTML преобразует содержимое заметки в очищенный HTML. Обычный текст экранируется,
+// абзацы разделяются пустыми строками.
+func RenderHTML(format, content string) (string, error) {
+	if format != models.ContentMarkdown {
+		var buf strings.Builder
+		for _, paragraph := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n\n") {
+			if strings.TrimSpace(paragraph) == "" {
+				continue
+			}
+			lines := strings.Split(strings.Trim(paragraph, "\n"), "\n")
+			for i, line := range lines {
+				lines[i] = html.EscapeString(line)
+			}
+			buf.WriteString("<p>" + strings.Join(lines, "<br>\n") + "</p>\n")
+		}
+		return buf.String(), nil
+	}
+	var buf bytes.Buffer
+	if err := markdownRenderer.Convert([]byte(content), &buf); err != nil {
+		return "", err
+	}
+	return htmlPolicy.Sanitize(buf.String()), nil
+}
+
+// summarizeNote заполняет отрывок и оглавление заметки для списков
+func summarizeNote(note *models.Note) {
+	if note.ContentFormat != models.ContentMarkdown {
+		note.Excerpt = truncateRunes(strings.Join(strings.Fields(note.Content), " "), excerptLength)
+		return
+	}
+	source := []byte(note.Content)
+	document := markdownRenderer.Parser().Parse(text.NewReader(source))
+	var plain []string
+	for block := document.FirstChild(); block != nil; block = block.NextSibling() {
+		if heading, ok := block.(*ast.Heading); ok {
+			note.Outline = append(note.Outline, models.Heading{Level: heading.Level, Text: nodeText(heading, source)})
+		}
+		if t := nodeText(block, source); t != "" {
+			plain = append(plain, t)
+		}
+	}
+	note.Excerpt = truncateRunes(strings.Join(plain, " "), excerptLength)
+}
+
+// nodeText собирает текст узла markdown без разметки
+func nodeText(node ast.Node, source []byte) string {
+	var buf strings.Builder
+	ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			// Текст соседних блоков (абзацев, ячеек, пунктов списка) разделяется пробелом
+			if n.Type() == ast.TypeBlock {
+				buf.WriteByte(' ')
+			}
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Text:
+			buf.Write(n.Segment.Value(source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			buf.Write(n.Value)
+		case *ast.AutoLink:
+			buf.Write(n.Label(source))
+		case *ast.CodeBlock, *ast.FencedCodeBlock:
+			lines := n.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				segment := lines.At(i)
+				buf.Write(segment.Value(source))
+			}
+			return ast.WalkSkipChildren, nil
+		case *ast.RawHTML, *ast.HTMLBlock:
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+// truncateRunes обрезает строку до limit символов, добавляя многоточие
+func truncateRunes(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:limit])) + "…"
+}
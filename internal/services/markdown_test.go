@@ -0,0 +1,77 @@
+package services
+
+import (
+	"notes-api/internal/models"
+	"strings"
+	"testing"
+)
+
+func TestRenderHTML(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		want    []string // Фрагменты, которые должны быть в результате
+		reject  []string // Фрагменты, которых в результате быть не должно
+	}{
+		{
+			name: "текст экранируется", format: models.ContentPlain, content: "<b>x</b>\nline2\n\n\npara",
+			want: []string{"<p>&lt;b&gt;x&lt;/b&gt;<br>\nline2</p>", "<p>para</p>"}, reject: []string{"<b>"},
+		},
+		{
+			name: "скрипт удаляется", format: models.ContentMarkdown, content: "<script>alert(1)</script>",
+			reject: []string{"<script", "alert"},
+		},
+		{
+			name: "обработчик событий удаляется", format: models.ContentMarkdown, content: `<img src=x onerror=alert(1)>`,
+			reject: []string{"onerror", "<img"},
+		},
+		{
+			name: "сырая ссылка с onclick", format: models.ContentMarkdown, content: `<a href="https://e.com" onclick="x">l</a>`,
+			want: []string{"l"}, reject: []string{"onclick", "<a"},
+		},
+		{
+			name: "javascript-ссылка", format: models.ContentMarkdown, content: "[x](javascript:alert(1))",
+			want: []string{"<p>x</p>"}, reject: []string{"javascript:"},
+		},
+		{
+			name: "data-ссылка", format: models.ContentMarkdown, content: "[x](data:text/html,hi)",
+			want: []string{"<p>x</p>"}, reject: []string{"data:"},
+		},
+		{
+			name: "внешняя ссылка", format: models.ContentMarkdown, content: "https://example.com",
+			want: []string{`href="https://example.com"`, `rel="nofollow noreferrer noopener"`, `target="_blank"`},
+		},
+		{
+			name: "вложение", format: models.ContentMarkdown, content: "![схема](/attachments/7)",
+			want: []string{`<img src="/attachments/7" alt="схема">`},
+		},
+		{
+			name: "разметка GFM", format: models.ContentMarkdown, content: "**b** ~~s~~\n\n- [x] done\n\n| a |\n|---|\n| b |",
+			want: []string{"<strong>b</strong>", "<del>s</del>", `<input checked="" disabled="" type="checkbox">`,
+				"<th>a</th>", "<td>b</td>"},
+		},
+		{
+			name: "текстовое поле удаляется", format: models.ContentMarkdown, content: `<input type="text" value="x">`,
+			reject: []string{`type="text"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderHTML(tt.format, tt.content)
+			if err != nil {
+				t.Fatalf("RenderHTML() error = %v", err)
+			}
+			for _, fragment := range tt.want {
+				if !strings.Contains(got, fragment) {
+					t.Errorf("RenderHTML() = %q, want it to contain %q", got, fragment)
+				}
+			}
+			for _, fragment := range tt.reject {
+				if strings.Contains(got, fragment) {
+					t.Errorf("RenderHTML() = %q, must not contain %q", got, fragment)
+				}
+			}
+		})
+	}
+}
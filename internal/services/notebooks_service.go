@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"notes-api/internal/models"
+)
+
+var (
+	ErrNotebookNotFound = errors.New("блокнот не найден")
+	ErrNotebookMismatch = errors.New("заметка и блокнот должны принадлежать одному владельцу")
+)
+
+// NotebookService предоставляет методы для работы с блокнотами
+type NotebookService struct {
+	DB  *sql.DB
+	Ctx context.Context // Контекст запроса: его отмена прерывает запросы к базе данных
+}
+
+// requireNotebook возвращает блокнот, доступный пользователю. Личный блокнот доступен только владельцу,
+// блокнот команды - ее участникам; для изменения (write) гостей команды недостаточно.
+func (s *NotebookService) requireNotebook(notebookID, userID int, write bool) (models.Notebook, error) {
+	var notebook models.Notebook
+	err := s.DB.QueryRowContext(s.Ctx, `SELECT id, name, COALESCE(user_id, 0), team_id, created_at FROM notebooks WHERE id = $1`, notebookID).
+		Scan(&notebook.ID, &notebook.Name, &notebook.UserID, &notebook.TeamID, &notebook.CreatedAt)
+	if err == sql.ErrNoRows {
+		return notebook, ErrNotebookNotFound
+	}
+	if err != nil {
+		return notebook, err
+	}
+	if notebook.TeamID == nil {
+		if notebook.UserID != userID {
+			return notebook, ErrNotebookNotFound
+		}
+		return notebook, nil
+	}
+	required := models.TeamRoleGuest
+	if write {
+		required = models.TeamRoleMember
+	}
+	teamService := TeamService{DB: s.DB, Ctx: s.Ctx}
+	if _, err := teamService.requireRole(*notebook.TeamID, userID, required); err != nil {
+		if errors.Is(err, ErrTeamNotFound) {
+			return notebook, ErrNotebookNotFound
+		}
+		return notebook, err
+	}
+	return notebook, nil
+}
+
+// CreateNotebook создает личный блокнот или блокнот команды
+func (s *NotebookService) CreateNotebook(notebook *models.Notebook, userID int) error {
+	if notebook.TeamID != nil {
+		teamService := TeamService{DB: s.DB, Ctx: s.Ctx}
+		if _, err := teamService.requireRole(*notebook.TeamID, userID, models.TeamRoleMember); err != nil {
+			return err
+		}
+	}
+	notebook.UserID = userID
+	query := `INSERT INTO notebooks (name, user_id, team_id) VALUES ($1, $2, $3) RETURNING id, created_at`
+	return s.DB.QueryRowContext(s.Ctx, query, notebook.Name, userID, notebook.TeamID).Scan(&notebook.ID, &notebook.CreatedAt)
+}
+
+// GetNotebooks возвращает личные блокноты пользователя и блокноты его команд
+func (s *NotebookService) GetNotebooks(userID int) ([]models.Notebook, error) {
+	rows, err := s.DB.QueryContext(s.Ctx, `
+		SELECT id, name, COALESCE(user_id, 0), team_id, created_at
+		FROM notebooks
+		WHERE (team_id IS NULL AND user_id = $1)
+			OR team_id IN (SELECT team_id FROM team_members WHERE user_id = $1)
+		ORDER BY name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	notebooks := []models.Notebook{}
+	for rows.Next() {
+		var notebook models.Notebook
+		if err := rows.Scan(&notebook.ID, &notebook.Name, &notebook.UserID, &notebook.TeamID, &notebook.CreatedAt); err != nil {
+			return nil, err
+		}
+		notebooks = append(notebooks, notebook)
+	}
+	return notebooks, rows.Err()
+}
+
+// RenameNotebook меняет название блокнота
+func (s *NotebookService) RenameNotebook(notebookID, userID int, name string) (models.Notebook, error) {
+	notebook, err := s.requireNotebook(notebookID, userID, true)
+	if err != nil {
+		return notebook, err
+	}
+	if _, err := s.DB.ExecContext(s.Ctx, `UPDATE notebooks SET name = $1 WHERE id = $2`, name, notebookID); err != nil {
+		return notebook, err
+	}
+	notebook.Name = name
+	return notebook, nil
+}
+
+// DeleteNotebook удаляет блокнот, заметки из него остаются без блокнота
+func (s *NotebookService) DeleteNotebook(notebookID, userID int) error {
+	if _, err := s.requireNotebook(notebookID, userID, true); err != nil {
+		return err
+	}
+	_, err := s.DB.ExecContext(s.Ctx, `DELETE FROM notebooks WHERE id = $1`, notebookID)
+	return err
+}
+
+// GetNotebookNotes возвращает заметки блокнота
+func (s *NotebookService) GetNotebookNotes(notebookID, userID, page, limit int) ([]models.Note, error) {
+	if _, err := s.requireNotebook(notebookID, userID, false); err != nil {
+		return nil, err
+	}
+	offset := (page - 1) * limit
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+noteColumns+` FROM notes n WHERE n.notebook_id = $1
+		ORDER BY n.created_at DESC LIMIT $2 OFFSET $3`, notebookID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanNotes(rows)
+}
@@ -1,64 +1,201 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/lib/pq"
+	"notes-api/internal/metrics"
 	"notes-api/internal/models"
+	"strings"
+	"time"
 )
 
-// NoteService предоставляет методы для работы с заметками
-type NoteService struct {
-	DB *sql.DB
+// maxBulkNotes - наибольшее число заметок в одной синхронной групповой операции
+const maxBulkNotes = 500
+
+var (
+	ErrTooManyNotes = errors.New("слишком много заметок в одной операции")
+	ErrTagNotFound  = errors.New("тег не найден")
+)
+
+// noteColumns - список столбцов заметки для запросов с псевдонимом n
+const noteColumns = `n.id, n.title, n.content, n.content_format, n.user_id, n.team_id, n.notebook_id, n.created_at,
+	n.updated_at, (SELECT COUNT(*) FROM comments c WHERE c.note_id = n.id),
+	(SELECT COUNT(*) FROM checklist_items ci WHERE ci.note_id = n.id),
+	(SELECT COUNT(*) FROM checklist_items ci WHERE ci.note_id = n.id AND ci.checked), n.due_at, n.pinned, n.archived`
+
+// rowScanner - общий интерфейс *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
 }
 
-func (s *NoteService) CreateNote(note *models.Note) error {
-	query := `INSERT INTO notes (title, content, user_id) VALUES ($1, $2, $3) RETURNING id`
-	err := s.DB.QueryRow(query, note.Title, note.Content, note.UserID).Scan(&note.ID)
-	return err
+// dbtx - общий интерфейс *sql.DB и *sql.Tx для запросов, которые выполняются как отдельно, так и в транзакции
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
-func (s *NoteService) GetNotes(userID, page, limit int) ([]models.Note, error) {
-	offset := (page - 1) * limit
-	query := `SELECT id, title, content, user_id, created_at, updated_at FROM notes WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`
-	rows, err := s.DB.Query(query, userID, limit, offset)
-	if err != nil {
-		return nil, err
+// scanNote считывает заметку, выбранную с помощью noteColumns
+func scanNote(row rowScanner) (models.Note, error) {
+	var note models.Note
+	err := row.Scan(&note.ID, &note.Title, &note.Content, &note.ContentFormat, &note.UserID, &note.TeamID, &note.NotebookID,
+		&note.CreatedAt, &note.UpdatedAt, &note.CommentCount, &note.ChecklistTotal, &note.ChecklistDone,
+		&note.DueAt, &note.Pinned, &note.Archived)
+	if note.ChecklistTotal > 0 {
+		note.Completion = note.ChecklistDone * 100 / note.ChecklistTotal
 	}
+	return note, err
+}
+
+// scanNotes считывает список заметок, выбранных с помощью noteColumns, дополняя их отрывком и оглавлением
+func scanNotes(rows *sql.Rows) ([]models.Note, error) {
 	defer rows.Close()
 	var notes []models.Note
 	for rows.Next() {
-		var note models.Note
-		if err := rows.Scan(&note.ID, &note.Title, &note.Content, &note.UserID, &note.CreatedAt, &note.UpdatedAt); err != nil {
+		note, err := scanNote(rows)
+		if err != nil {
 			return nil, err
 		}
+		summarizeNote(&note)
 		notes = append(notes, note)
 	}
-	return notes, nil
+	return notes, rows.Err()
 }
 
+// NoteService предоставляет методы для работы с заметками
+type NoteService struct {
+	DB     *sql.DB
+	Client models.ClientInfo // Клиент, выполняющий запрос; записывается в журнал аудита
+	Ctx    context.Context   // Контекст запроса: его отмена прерывает запросы к базе данных
+}
+
+func (s *NoteService) CreateNote(note *models.Note) error {
+	defer traceMethod(&s.Ctx, "NoteService.CreateNote")()
+	if err := s.insertNote(s.DB, note, nil); err != nil {
+		return err
+	}
+	s.noteCreated(*note)
+	return nil
+}
+
+// insertNote проверяет блокнот и команду заметки и записывает ее через q. dailyDate, если задана,
+// отмечает заметку как ежедневную за эту дату. Уведомления и события о заметке отправляет noteCreated,
+// которую в транзакции вызывают после ее фиксации.
+func (s *NoteService) insertNote(q dbtx, note *models.Note, dailyDate *string) error {
+	// Заметка в блокноте команды принадлежит этой команде
+	if note.NotebookID != nil {
+		notebookService := NotebookService{DB: s.DB, Ctx: s.Ctx}
+		notebook, err := notebookService.requireNotebook(*note.NotebookID, note.UserID, true)
+		if err != nil {
+			return err
+		}
+		if note.TeamID == nil {
+			note.TeamID = notebook.TeamID
+		} else if notebook.TeamID == nil || *notebook.TeamID != *note.TeamID {
+			return ErrNotebookMismatch
+		}
+	}
+	if note.TeamID != nil {
+		teamService := TeamService{DB: s.DB, Ctx: s.Ctx}
+		if _, err := teamService.requireRole(*note.TeamID, note.UserID, models.TeamRoleMember); err != nil {
+			return err
+		}
+	}
+	format, err := validContentFormat(note.ContentFormat)
+	if err != nil {
+		return err
+	}
+	note.ContentFormat = format
+	query := `INSERT INTO notes (title, content, content_format, user_id, team_id, notebook_id, daily_date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at, updated_at`
+	err = q.QueryRowContext(s.Ctx, query, note.Title, note.Content, note.ContentFormat, note.UserID, note.TeamID, note.NotebookID,
+		dailyDate).Scan(&note.ID, &note.CreatedAt, &note.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	note.Permission = models.PermissionOwner
+	return nil
+}
+
+// noteCreated учитывает созданную заметку в метриках, уведомляет упомянутых в ней пользователей,
+// обновляет ссылки и отправляет событие вебхуков
+func (s *NoteService) noteCreated(note models.Note) {
+	metrics.NotesCreated.Inc()
+	notifyNoteMentions(s.Ctx, s.DB, note, note.UserID, "")
+	linkNote(s.Ctx, s.DB, s.Client, note, note.UserID, "")
+	dispatchEvent(s.Ctx, s.DB, models.EventNoteCreated, note, &note)
+	audit(s.Ctx, s.DB, s.Client, note.UserID, models.AuditNoteCreated, models.AuditTargetNote, note.ID, noteSummary(note))
+}
+
+// GetNotes возвращает заметки пользователя, закрепленные первыми. Архивные заметки по умолчанию скрыты;
+// в избранном и при поиске они возвращаются, если filter.Archived не задан.
+func (s *NoteService) GetNotes(userID int, filter models.NoteFilter, page, limit int) ([]models.Note, error) {
+	defer traceMethod(&s.Ctx, "NoteService.GetNotes")()
+	// Заметки команд не входят в личный список, даже если пользователь - их автор
+	conditions := []string{"n.user_id = $1", "n.team_id IS NULL"}
+	if filter.Starred {
+		conditions = []string{"n.id IN (SELECT note_id FROM note_stars WHERE user_id = $1)",
+			"n.id IN (" + accessibleNoteIDs("$1") + ")"}
+	}
+	args := []interface{}{userID}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.Archived != nil {
+		add("n.archived = $%d", *filter.Archived)
+	} else if !filter.Starred && filter.Query == "" {
+		conditions = append(conditions, "NOT n.archived")
+	}
+	if filter.Tag != "" {
+		add("n.id IN (SELECT nt.note_id FROM note_tags nt JOIN tags t ON t.id = nt.tag_id WHERE t.name = $%d)", filter.Tag)
+	}
+	if filter.NotebookID != nil {
+		add("n.notebook_id = $%d", *filter.NotebookID)
+	}
+	if filter.Query != "" {
+		add("(n.title ILIKE '%%' || $%[1]d || '%%' OR n.content ILIKE '%%' || $%[1]d || '%%')", filter.Query)
+	}
+	args = append(args, limit, (page-1)*limit)
+	if filter.Query != "" {
+		start := time.Now()
+		defer func() { metrics.SearchDuration.Observe(time.Since(start).Seconds()) }()
+	}
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+noteColumns+` FROM notes n WHERE `+strings.Join(conditions, " AND ")+
+		fmt.Sprintf(` ORDER BY n.pinned DESC, n.created_at DESC LIMIT $%d OFFSET $%d`, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	notes, err := scanNotes(rows)
+	if err != nil {
+		return nil, err
+	}
+	return notes, s.markStarred(userID, notes)
+}
+
+// GetNoteByID возвращает заметку, доступную пользователю: свою, выданную ему или его команде
 func (s *NoteService) GetNoteByID(noteID, userID int) (models.Note, error) {
-	var note models.Note
-	query := `SELECT id, title, content, user_id, created_at, updated_at FROM notes WHERE id = $1 AND user_id = $2`
-	err := s.DB.QueryRow(query, noteID, userID).Scan(&note.ID, &note.Title, &note.Content, &note.UserID, &note.CreatedAt, &note.UpdatedAt)
+	defer traceMethod(&s.Ctx, "NoteService.GetNoteByID")()
+	note, err := s.requireNote(noteID, userID, models.PermissionViewer)
 	if err != nil {
 		return note, err
 	}
-	return note, nil
+	notes := []models.Note{note}
+	err = s.markStarred(userID, notes)
+	return notes[0], err
 }
 
 func (s *NoteService) UpdateNote(note *models.Note, userID int) (models.Note, error) {
-	// Проверка, что пользователь является владельцем заметки
-	existingNote, err := s.GetNoteByID(note.ID, userID)
+	defer traceMethod(&s.Ctx, "NoteService.UpdateNote")()
+	// Проверка, что пользователь может редактировать заметку
+	existingNote, err := s.requireNote(note.ID, userID, models.PermissionEditor)
 	if err != nil {
 		return existingNote, err
 	}
-	if existingNote.UserID != userID {
-		return existingNote, errors.New("вы не можете редактировать эту заметку")
-	}
-	query := `UPDATE notes SET title = $1, content = $2 WHERE id = $3`
-	_, err = s.DB.Exec(query, note.Title, note.Content, note.ID)
-	if err != nil {
+	if err := s.updateNote(s.DB, note, existingNote); err != nil {
 		return existingNote, err
 	}
 	// Получаем теги для обновленной заметки
@@ -67,59 +204,104 @@ func (s *NoteService) UpdateNote(note *models.Note, userID int) (models.Note, er
 		return existingNote, err
 	}
 	note.Tags = tags
+	s.noteUpdated(*note, existingNote, userID)
 	return *note, nil
 }
 
-func (s *NoteService) DeleteNote(noteID, userID int) error {
-	// Проверка, что пользователь является владельцем заметки
-	existingNote, err := s.GetNoteByID(noteID, userID)
+// updateNote записывает через q заголовок, текст и формат заметки existingNote, доступ к которой уже проверен.
+// Уведомления и события об изменении отправляет noteUpdated.
+func (s *NoteService) updateNote(q dbtx, note *models.Note, existingNote models.Note) error {
+	// Без content_format формат заметки не меняется
+	if note.ContentFormat == "" {
+		note.ContentFormat = existingNote.ContentFormat
+	}
+	format, err := validContentFormat(note.ContentFormat)
 	if err != nil {
 		return err
 	}
-	if existingNote.UserID != userID {
-		return errors.New("вы не можете удалить эту заметку")
+	note.ContentFormat = format
+	query := `UPDATE notes SET title = $1, content = $2, content_format = $3 WHERE id = $4
+		RETURNING user_id, team_id, notebook_id, created_at, updated_at`
+	err = q.QueryRowContext(s.Ctx, query, note.Title, note.Content, note.ContentFormat, note.ID).
+		Scan(&note.UserID, &note.TeamID, &note.NotebookID, &note.CreatedAt, &note.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	note.Permission = existingNote.Permission
+	note.CommentCount = existingNote.CommentCount
+	note.ChecklistTotal, note.ChecklistDone, note.Completion =
+		existingNote.ChecklistTotal, existingNote.ChecklistDone, existingNote.Completion
+	note.DueAt, note.Pinned, note.Archived = existingNote.DueAt, existingNote.Pinned, existingNote.Archived
+	return nil
+}
+
+// noteUpdated уведомляет упомянутых и подписанных на заметку пользователей, обновляет ссылки,
+// отправляет событие вебхуков и записывает изменение в журнал аудита
+func (s *NoteService) noteUpdated(note, existingNote models.Note, userID int) {
+	notifyNoteMentions(s.Ctx, s.DB, note, userID, existingNote.Content)
+	linkNote(s.Ctx, s.DB, s.Client, note, userID, existingNote.Title)
+	notifyNoteUpdated(s.Ctx, s.DB, note, userID)
+	dispatchEvent(s.Ctx, s.DB, models.EventNoteUpdated, note, &note)
+	audit(s.Ctx, s.DB, s.Client, userID, models.AuditNoteUpdated, models.AuditTargetNote, note.ID,
+		map[string]interface{}{"before": noteSummary(existingNote), "after": noteSummary(note)})
+}
+
+func (s *NoteService) DeleteNote(noteID, userID int) error {
+	defer traceMethod(&s.Ctx, "NoteService.DeleteNote")()
+	// Проверка, что пользователь является владельцем заметки или администратором команды-владельца
+	note, err := s.requireNote(noteID, userID, models.PermissionOwner)
+	if err != nil {
+		return err
 	}
 	query := `DELETE FROM notes WHERE id = $1`
-	_, err = s.DB.Exec(query, noteID)
-	return err
+	if _, err := s.DB.ExecContext(s.Ctx, query, noteID); err != nil {
+		return err
+	}
+	dispatchEvent(s.Ctx, s.DB, models.EventNoteDeleted, note, note)
+	audit(s.Ctx, s.DB, s.Client, userID, models.AuditNoteDeleted, models.AuditTargetNote, noteID, noteSummary(note))
+	return nil
 }
 
 func (s *NoteService) AddTags(noteID int, tags []models.Tag, userID int) error {
-	// Проверка, что пользователь является владельцем заметки
-	existingNote, err := s.GetNoteByID(noteID, userID)
+	defer traceMethod(&s.Ctx, "NoteService.AddTags")()
+	// Проверка, что пользователь может редактировать заметку
+	existingNote, err := s.requireNote(noteID, userID, models.PermissionEditor)
 	if err != nil {
 		return err
 	}
-	if existingNote.UserID != userID {
-		return errors.New("вы не можете добавлять теги к этой заметке")
+	if err := addNoteTags(s.Ctx, s.DB, noteID, existingNote.TeamID, tags); err != nil {
+		return err
 	}
+	dispatchEvent(s.Ctx, s.DB, models.EventTagAdded, existingNote, map[string]interface{}{"note_id": noteID, "tags": tags})
+	return nil
+}
+
+// addNoteTags добавляет заметке теги, создавая недостающие. Теги заметок команды создаются в пространстве имен команды.
+func addNoteTags(ctx context.Context, q dbtx, noteID int, teamID *int, tags []models.Tag) error {
 	for _, tag := range tags {
-		query := `INSERT INTO tags (name) VALUES ($1) ON CONFLICT (name) DO NOTHING RETURNING id`
+		query := `INSERT INTO tags (name, team_id) VALUES ($1, $2)
+			ON CONFLICT ((COALESCE(team_id, 0)), name) DO UPDATE SET name = EXCLUDED.name RETURNING id`
 		var tagID int
-		err := s.DB.QueryRow(query, tag.Name).Scan(&tagID)
-		if err != nil {
+		if err := q.QueryRowContext(ctx, query, tag.Name, teamID).Scan(&tagID); err != nil {
 			return err
 		}
 		// Связываем заметку с тегом
-		if tagID > 0 {
-			_, err = s.DB.Exec(`INSERT INTO note_tags (note_id, tag_id) VALUES ($1, $2)`, noteID, tagID)
-			if err != nil {
-				return err
-			}
+		_, err := q.ExecContext(ctx, `INSERT INTO note_tags (note_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, noteID, tagID)
+		if err != nil {
+			return err
 		}
 	}
-	// Получаем теги для обновленной заметки
-	existingNote.Tags, err = s.GetTagsForNote(noteID)
-	return err
+	return nil
 }
 
 func (s *NoteService) GetTagsForNote(noteID int) ([]models.Tag, error) {
+	defer traceMethod(&s.Ctx, "NoteService.GetTagsForNote")()
 	query := `
 		SELECT t.id, t.name
 		FROM tags t
 		JOIN note_tags nt ON t.id = nt.tag_id
 		WHERE nt.note_id = $1`
-	rows, err := s.DB.Query(query, noteID)
+	rows, err := s.DB.QueryContext(s.Ctx, query, noteID)
 	if err != nil {
 		return nil, err
 	}
@@ -135,72 +317,183 @@ func (s *NoteService) GetTagsForNote(noteID int) ([]models.Tag, error) {
 	return tags, nil
 }
 
-func (s *NoteService) GetNotesByTag(tag string) ([]models.Note, error) {
+// GetNotesByTag возвращает доступные пользователю заметки с тегом. Теги команд и личные теги - разные
+// пространства имен: с teamID ищется тег команды, участником которой должен быть пользователь, без него - личный тег.
+func (s *NoteService) GetNotesByTag(tag string, teamID *int, userID int) ([]models.Note, error) {
+	defer traceMethod(&s.Ctx, "NoteService.GetNotesByTag")()
+	if teamID != nil {
+		teamService := TeamService{DB: s.DB, Ctx: s.Ctx}
+		if _, err := teamService.requireRole(*teamID, userID, models.TeamRoleGuest); err != nil {
+			return nil, err
+		}
+	}
 	query := `
-		SELECT n.id, n.title, n.content, n.user_id, n.created_at, n.updated_at
+		SELECT ` + noteColumns + `
 		FROM notes n
 		JOIN note_tags nt ON n.id = nt.note_id
 		JOIN tags t ON nt.tag_id = t.id
-		WHERE t.name = $1`
-	rows, err := s.DB.Query(query, tag)
+		WHERE t.name = $1 AND t.team_id IS NOT DISTINCT FROM $2 AND n.id IN (` + accessibleNoteIDs("$3") + `)
+		ORDER BY n.id`
+	rows, err := s.DB.QueryContext(s.Ctx, query, tag, teamID, userID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	var notes []models.Note
-	for rows.Next() {
-		var note models.Note
-		if err := rows.Scan(&note.ID, &note.Title, &note.Content, &note.UserID, &note.CreatedAt, &note.UpdatedAt); err != nil {
-			return nil, err
-		}
-		notes = append(notes, note)
+	notes, err := scanNotes(rows)
+	if err != nil {
+		return nil, err
 	}
-	// Если заметок не найдено, можно вернуть ошибку
 	if len(notes) == 0 {
-		return nil, fmt.Errorf("тег не найден")
+		return nil, ErrTagNotFound
 	}
 	return notes, nil
 }
 
-func (s *NoteService) ShareNote(noteID, ownerID, userID int) error {
-	// Проверка, что заметка принадлежит владельцу
-	var owner int
-	err := s.DB.QueryRow("SELECT user_id FROM notes WHERE id = $1", noteID).Scan(&owner)
+// GetSharedNotes возвращает чужие заметки, доступ к которым выдан пользователю лично или его командам.
+// Лично выдается доступ только к личным заметкам: к заметкам команды он открывается через команды.
+func (s *NoteService) GetSharedNotes(userID int) ([]models.Note, error) {
+	defer traceMethod(&s.Ctx, "NoteService.GetSharedNotes")()
+	rows, err := s.DB.QueryContext(s.Ctx, `
+		SELECT `+noteColumns+`
+		FROM notes n
+		WHERE (n.user_id <> $1 OR n.team_id IS NOT NULL) AND n.id IN (
+			SELECT na.note_id FROM note_access na JOIN notes pn ON pn.id = na.note_id
+			WHERE na.user_id = $1 AND pn.team_id IS NULL
+			UNION
+			SELECT tna.note_id FROM team_note_access tna
+			JOIN team_members tm ON tm.team_id = tna.team_id
+			WHERE tm.user_id = $1
+		)
+		ORDER BY n.created_at DESC`, userID)
 	if err != nil {
-		return fmt.Errorf("не удалось найти заметку: %w", err)
+		return nil, fmt.Errorf("не удалось получить доступные заметки: %w", err)
 	}
-	if owner != ownerID {
-		return fmt.Errorf("вы не являетесь владельцем этой заметки")
+	return scanNotes(rows)
+}
+
+// MoveToNotebook перемещает заметку в блокнот того же владельца или убирает ее из блокнота
+func (s *NoteService) MoveToNotebook(noteID, userID int, notebookID *int) error {
+	defer traceMethod(&s.Ctx, "NoteService.MoveToNotebook")()
+	note, err := s.requireNote(noteID, userID, models.PermissionEditor)
+	if err != nil {
+		return err
 	}
-	// Проверка, что пользователь, которому передается доступ, не является владельцем
-	if userID == owner {
-		return fmt.Errorf("вы не можете передавать доступ к своей заметке")
+	if notebookID != nil {
+		notebookService := NotebookService{DB: s.DB, Ctx: s.Ctx}
+		notebook, err := notebookService.requireNotebook(*notebookID, userID, true)
+		if err != nil {
+			return err
+		}
+		// Личная заметка может лежать только в блокноте своего владельца, заметка команды - в блокноте команды
+		if !sameOwner(note, notebook) {
+			return ErrNotebookMismatch
+		}
 	}
-	// Передача доступа
-	_, err = s.DB.Exec("INSERT INTO note_access (note_id, user_id) VALUES ($1, $2)", noteID, userID)
-	if err != nil {
-		return fmt.Errorf("не удалось передать доступ: %w", err)
+	_, err = s.DB.ExecContext(s.Ctx, `UPDATE notes SET notebook_id = $1 WHERE id = $2`, notebookID, noteID)
+	return err
+}
+
+// SetState закрепляет, архивирует и добавляет заметку в избранное пользователя.
+// Закрепление и архивация действуют для всех и требуют доступа editor, избранное - личное.
+func (s *NoteService) SetState(noteID, userID int, request models.NoteStateRequest) (models.Note, error) {
+	defer traceMethod(&s.Ctx, "NoteService.SetState")()
+	required := models.PermissionViewer
+	if request.Pinned != nil || request.Archived != nil {
+		required = models.PermissionEditor
 	}
-	return nil
+	if _, err := s.requireNote(noteID, userID, required); err != nil {
+		return models.Note{}, err
+	}
+	if request.Pinned != nil || request.Archived != nil {
+		_, err := s.DB.ExecContext(s.Ctx, `UPDATE notes SET pinned = COALESCE($1, pinned), archived = COALESCE($2, archived) WHERE id = $3`,
+			request.Pinned, request.Archived, noteID)
+		if err != nil {
+			return models.Note{}, err
+		}
+	}
+	if request.Starred != nil {
+		query := `DELETE FROM note_stars WHERE user_id = $1 AND note_id = $2`
+		if *request.Starred {
+			query = `INSERT INTO note_stars (user_id, note_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+		}
+		if _, err := s.DB.ExecContext(s.Ctx, query, userID, noteID); err != nil {
+			return models.Note{}, err
+		}
+	}
+	return s.GetNoteByID(noteID, userID)
 }
 
-func (s *NoteService) GetSharedNotes(userID int) ([]models.Note, error) {
-	rows, err := s.DB.Query(`
-		SELECT n.id, n.title, n.content, n.user_id, n.created_at, n.updated_at 
-		FROM notes n 
-		INNER JOIN note_access na ON n.id = na.note_id 
-		WHERE na.user_id = $1`, userID)
+// SetStateBulk меняет состояние нескольких заметок. Заметки обрабатываются независимо:
+// ошибка для одной заметки не отменяет изменения остальных.
+func (s *NoteService) SetStateBulk(userID int, noteIDs []int, request models.NoteStateRequest) ([]models.BulkNoteResult, error) {
+	defer traceMethod(&s.Ctx, "NoteService.SetStateBulk")()
+	if len(noteIDs) > maxBulkNotes {
+		return nil, ErrTooManyNotes
+	}
+	results := make([]models.BulkNoteResult, 0, len(noteIDs))
+	for _, noteID := range noteIDs {
+		result := models.BulkNoteResult{NoteID: noteID, OK: true}
+		if _, err := s.SetState(noteID, userID, request); err != nil {
+			if !errors.Is(err, ErrNoteNotFound) && !errors.Is(err, ErrNoteForbidden) {
+				return nil, err
+			}
+			result.OK, result.Error = false, err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// markStarred отмечает заметки, которые пользователь добавил в избранное
+func (s *NoteService) markStarred(userID int, notes []models.Note) error {
+	if len(notes) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(notes))
+	for i, note := range notes {
+		ids[i] = int64(note.ID)
+	}
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT note_id FROM note_stars WHERE user_id = $1 AND note_id = ANY($2)`, userID, pq.Array(ids))
 	if err != nil {
-		return nil, fmt.Errorf("не удалось получить доступные заметки: %w", err)
+		return err
 	}
 	defer rows.Close()
-	var notes []models.Note
+	starred := map[int]bool{}
 	for rows.Next() {
-		var note models.Note
-		if err := rows.Scan(&note.ID, &note.Title, &note.Content, &note.UserID, &note.CreatedAt, &note.UpdatedAt); err != nil {
-			return nil, err
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return err
 		}
-		notes = append(notes, note)
+		starred[id] = true
+	}
+	for i := range notes {
+		notes[i].Starred = starred[notes[i].ID]
+	}
+	return rows.Err()
+}
+
+// SetDue устанавливает или снимает срок заметки
+func (s *NoteService) SetDue(noteID, userID int, dueAt *time.Time) error {
+	defer traceMethod(&s.Ctx, "NoteService.SetDue")()
+	if _, err := s.requireNote(noteID, userID, models.PermissionEditor); err != nil {
+		return err
+	}
+	_, err := s.DB.ExecContext(s.Ctx, `UPDATE notes SET due_at = $1 WHERE id = $2`, dueAt, noteID)
+	return err
+}
+
+func sameOwner(note models.Note, notebook models.Notebook) bool {
+	if note.TeamID != nil || notebook.TeamID != nil {
+		return note.TeamID != nil && notebook.TeamID != nil && *note.TeamID == *notebook.TeamID
+	}
+	return note.UserID == notebook.UserID
+}
+
+// noteSummary - сводка заметки для журнала аудита: без содержимого, только его размер
+func noteSummary(note models.Note) map[string]interface{} {
+	return map[string]interface{}{
+		"title":          note.Title,
+		"content_length": len([]rune(note.Content)),
+		"owner_id":       note.UserID,
+		"team_id":        note.TeamID,
 	}
-	return notes, nil
 }
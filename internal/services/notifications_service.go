@@ -0,0 +1,345 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"log/slog"
+	"notes-api/internal/models"
+	"regexp"
+)
+
+var (
+	ErrNotificationNotFound    = errors.New("уведомление не найдено")
+	ErrInvalidNotificationType = errors.New("неизвестный тип уведомления")
+)
+
+// mentionPattern находит упоминания вида @username, не являющиеся частью email
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@.])@([\p{L}\p{N}_.-]*[\p{L}\p{N}_])`)
+
+// NotificationService предоставляет методы для работы с уведомлениями пользователей
+type NotificationService struct {
+	DB  *sql.DB
+	Ctx context.Context // Контекст запроса: его отмена прерывает запросы к базе данных
+}
+
+// Notify создает уведомление для каждого получателя, кроме автора события
+// и пользователей, отключивших уведомления этого типа
+func (s *NotificationService) Notify(recipients []int, notification models.Notification) error {
+	ids := make([]int64, 0, len(recipients))
+	seen := map[int]bool{}
+	for _, id := range recipients {
+		if seen[id] || (notification.ActorID != nil && *notification.ActorID == id) {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, int64(id))
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := s.DB.ExecContext(s.Ctx, `
+		INSERT INTO notifications (user_id, type, actor_id, note_id, comment_id, message)
+		SELECT r.id, $2, $3, $4, $5, $6
+		FROM UNNEST($1::int[]) AS r(id)
+		WHERE NOT EXISTS (
+			SELECT 1 FROM notification_preferences p
+			WHERE p.user_id = r.id AND p.type = $2 AND NOT p.enabled
+		)`, pq.Array(ids), notification.Type, notification.ActorID, notification.NoteID, notification.CommentID,
+		notification.Message)
+	return err
+}
+
+// notify создает уведомления, не прерывая основное действие: ошибка только записывается в лог
+func notify(ctx context.Context, db *sql.DB, recipients []int, notification models.Notification) {
+	notificationService := NotificationService{DB: db, Ctx: ctx}
+	if err := notificationService.Notify(recipients, notification); err != nil {
+		slog.ErrorContext(ctx, "Ошибка при создании уведомления", "type", notification.Type, "error", err)
+	}
+}
+
+// GetNotifications возвращает уведомления пользователя, новые первыми
+func (s *NotificationService) GetNotifications(userID int, unreadOnly bool, page, limit int) (models.NotificationList, error) {
+	list := models.NotificationList{Notifications: []models.Notification{}}
+	err := s.DB.QueryRowContext(s.Ctx, `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, userID).Scan(&list.UnreadCount)
+	if err != nil {
+		return list, err
+	}
+	offset := (page - 1) * limit
+	rows, err := s.DB.QueryContext(s.Ctx, `
+		SELECT nf.id, nf.type, nf.actor_id, COALESCE(u.username, ''), nf.note_id, nf.comment_id, nf.message,
+			nf.read_at, nf.created_at
+		FROM notifications nf
+		LEFT JOIN users u ON u.id = nf.actor_id
+		WHERE nf.user_id = $1 AND (NOT $2 OR nf.read_at IS NULL)
+		ORDER BY nf.created_at DESC, nf.id DESC
+		LIMIT $3 OFFSET $4`, userID, unreadOnly, limit, offset)
+	if err != nil {
+		return list, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var n models.Notification
+		if err := rows.Scan(&n.ID, &n.Type, &n.ActorID, &n.ActorName, &n.NoteID, &n.CommentID, &n.Message,
+			&n.ReadAt, &n.CreatedAt); err != nil {
+			return list, err
+		}
+		list.Notifications = append(list.Notifications, n)
+	}
+	return list, rows.Err()
+}
+
+// MarkRead отмечает уведомление прочитанным
+func (s *NotificationService) MarkRead(notificationID, userID int) error {
+	res, err := s.DB.ExecContext(s.Ctx, `UPDATE notifications SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+		WHERE id = $1 AND user_id = $2`, notificationID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+// MarkAllRead отмечает прочитанными все уведомления пользователя
+func (s *NotificationService) MarkAllRead(userID int) (int64, error) {
+	res, err := s.DB.ExecContext(s.Ctx, `UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND read_at IS NULL`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetPreferences возвращает настройки уведомлений; по умолчанию все типы включены
+func (s *NotificationService) GetPreferences(userID int) (models.NotificationPreferences, error) {
+	preferences := models.NotificationPreferences{}
+	for _, t := range models.NotificationTypes {
+		preferences[t] = true
+	}
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT type, enabled FROM notification_preferences WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t string
+		var enabled bool
+		if err := rows.Scan(&t, &enabled); err != nil {
+			return nil, err
+		}
+		preferences[t] = enabled
+	}
+	return preferences, rows.Err()
+}
+
+// UpdatePreferences включает или отключает уведомления указанных типов
+func (s *NotificationService) UpdatePreferences(userID int, preferences models.NotificationPreferences) (models.NotificationPreferences, error) {
+	for t := range preferences {
+		if !isNotificationType(t) {
+			return nil, ErrInvalidNotificationType
+		}
+	}
+	for t, enabled := range preferences {
+		_, err := s.DB.ExecContext(s.Ctx, `INSERT INTO notification_preferences (user_id, type, enabled) VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, type) DO UPDATE SET enabled = EXCLUDED.enabled`, userID, t, enabled)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.GetPreferences(userID)
+}
+
+// Follow подписывает пользователя на изменения заметки
+func (s *NotificationService) Follow(noteID, userID int) error {
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	if _, err := noteService.requireNote(noteID, userID, models.PermissionViewer); err != nil {
+		return err
+	}
+	_, err := s.DB.ExecContext(s.Ctx, `INSERT INTO note_follows (note_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, noteID, userID)
+	return err
+}
+
+// Unfollow отменяет подписку на изменения заметки
+func (s *NotificationService) Unfollow(noteID, userID int) error {
+	_, err := s.DB.ExecContext(s.Ctx, `DELETE FROM note_follows WHERE note_id = $1 AND user_id = $2`, noteID, userID)
+	return err
+}
+
+func isNotificationType(t string) bool {
+	for _, known := range models.NotificationTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// extractMentions возвращает имена пользователей, упомянутых в тексте через @
+func extractMentions(text string) map[string]bool {
+	mentions := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		mentions[match[1]] = true
+	}
+	return mentions
+}
+
+// mentionedUsers возвращает пользователей с доступом к заметке, упомянутых в text, но не в previous
+func mentionedUsers(ctx context.Context, db *sql.DB, noteID int, text, previous string) ([]int, error) {
+	before := extractMentions(previous)
+	var usernames []string
+	for name := range extractMentions(text) {
+		if !before[name] {
+			usernames = append(usernames, name)
+		}
+	}
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+	rows, err := db.QueryContext(ctx, `SELECT id FROM users WHERE username = ANY($1)`, pq.Array(usernames))
+	if err != nil {
+		return nil, err
+	}
+	var candidates []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, id)
+	}
+	rows.Close()
+	// Упоминание не должно раскрывать заметку тем, у кого нет к ней доступа
+	return usersWithAccess(ctx, db, noteID, candidates)
+}
+
+// usersWithAccess оставляет из users тех, у кого есть доступ к заметке. Уведомление содержит название
+// заметки, поэтому получатели проверяются на момент отправки, а не на момент подписки или участия в обсуждении.
+func usersWithAccess(ctx context.Context, db *sql.DB, noteID int, users []int) ([]int, error) {
+	noteService := NoteService{DB: db, Ctx: ctx}
+	var allowed []int
+	for _, id := range users {
+		permission, err := noteService.NotePermission(noteID, id)
+		if err != nil {
+			return nil, err
+		}
+		if permission != "" {
+			allowed = append(allowed, id)
+		}
+	}
+	return allowed, nil
+}
+
+// deleteStaleFollows удаляет подписки тех, кто потерял доступ к заметке. Нулевой noteID или userID
+// означает проверку подписок на все заметки или всех подписчиков соответственно.
+func deleteStaleFollows(ctx context.Context, db dbtx, noteID, userID int) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM note_follows f
+		WHERE ($1 = 0 OR f.note_id = $1) AND ($2 = 0 OR f.user_id = $2)
+			AND f.note_id NOT IN (`+accessibleNoteIDs("f.user_id")+`)`, noteID, userID)
+	return err
+}
+
+// noteFollowers возвращает подписчиков заметки, у которых есть к ней доступ
+func noteFollowers(ctx context.Context, db *sql.DB, noteID int) ([]int, error) {
+	rows, err := db.QueryContext(ctx, `SELECT user_id FROM note_follows WHERE note_id = $1`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	var users []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		users = append(users, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return usersWithAccess(ctx, db, noteID, users)
+}
+
+// notifyNoteMentions уведомляет пользователей, впервые упомянутых в тексте заметки
+func notifyNoteMentions(ctx context.Context, db *sql.DB, note models.Note, actorID int, previousContent string) {
+	users, err := mentionedUsers(ctx, db, note.ID, note.Content, previousContent)
+	if err != nil {
+		slog.ErrorContext(ctx, "Ошибка при поиске упоминаний в заметке", "note_id", note.ID, "error", err)
+		return
+	}
+	notify(ctx, db, users, models.Notification{
+		Type:    models.NotificationMention,
+		ActorID: &actorID,
+		NoteID:  &note.ID,
+		Message: fmt.Sprintf("Вас упомянули в заметке «%s»", note.Title),
+	})
+}
+
+// notifyNoteUpdated уведомляет подписчиков об изменении заметки
+func notifyNoteUpdated(ctx context.Context, db *sql.DB, note models.Note, actorID int) {
+	followers, err := noteFollowers(ctx, db, note.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Ошибка при получении подписчиков заметки", "note_id", note.ID, "error", err)
+		return
+	}
+	notify(ctx, db, followers, models.Notification{
+		Type:    models.NotificationNoteUpdated,
+		ActorID: &actorID,
+		NoteID:  &note.ID,
+		Message: fmt.Sprintf("Заметка «%s» изменена", note.Title),
+	})
+}
+
+// notifyCommentAdded уведомляет владельца заметки, участников обсуждения и подписчиков о новом комментарии,
+// а упомянутых в нем пользователей - об упоминании
+func notifyCommentAdded(ctx context.Context, db *sql.DB, note models.Note, comment models.Comment) {
+	recipients, err := noteFollowers(ctx, db, note.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Ошибка при получении подписчиков заметки", "note_id", note.ID, "error", err)
+		return
+	}
+	recipients = append(recipients, note.UserID)
+	if comment.ParentID != nil {
+		rows, err := db.QueryContext(ctx, `SELECT DISTINCT user_id FROM comments WHERE id = $1 OR parent_id = $1`, *comment.ParentID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Ошибка при получении участников обсуждения", "comment_id", *comment.ParentID, "error", err)
+			return
+		}
+		for rows.Next() {
+			var id int
+			if rows.Scan(&id) == nil {
+				recipients = append(recipients, id)
+			}
+		}
+		rows.Close()
+	}
+	// Автор заметки команды и участники обсуждения могли потерять доступ к заметке
+	recipients, err = usersWithAccess(ctx, db, note.ID, recipients)
+	if err != nil {
+		slog.ErrorContext(ctx, "Ошибка при проверке доступа получателей уведомления", "note_id", note.ID, "error", err)
+		return
+	}
+	notify(ctx, db, recipients, models.Notification{
+		Type:      models.NotificationCommentAdded,
+		ActorID:   &comment.UserID,
+		NoteID:    &note.ID,
+		CommentID: &comment.ID,
+		Message:   fmt.Sprintf("Новый комментарий к заметке «%s»", note.Title),
+	})
+	mentioned, err := mentionedUsers(ctx, db, note.ID, comment.Content, "")
+	if err != nil {
+		slog.ErrorContext(ctx, "Ошибка при поиске упоминаний в комментарии", "comment_id", comment.ID, "error", err)
+		return
+	}
+	notify(ctx, db, mentioned, models.Notification{
+		Type:      models.NotificationMention,
+		ActorID:   &comment.UserID,
+		NoteID:    &note.ID,
+		CommentID: &comment.ID,
+		Message:   fmt.Sprintf("Вас упомянули в комментарии к заметке «%s»", note.Title),
+	})
+}
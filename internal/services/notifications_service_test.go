@@ -0,0 +1,30 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want map[string]bool
+	}{
+		{"без упоминаний", "просто текст", map[string]bool{}},
+		{"в начале строки", "@alice посмотри", map[string]bool{"alice": true}},
+		{"несколько", "для @alice и @bob_2, @alice", map[string]bool{"alice": true, "bob_2": true}},
+		{"кириллица", "спасибо, @иван!", map[string]bool{"иван": true}},
+		{"точка в конце не входит в имя", "пишите @john.doe.", map[string]bool{"john.doe": true}},
+		{"email не упоминание", "почта bob@example.com", map[string]bool{}},
+		{"двойной @", "@@alice", map[string]bool{}},
+		{"пустое имя", "@ и @.", map[string]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractMentions(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractMentions(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
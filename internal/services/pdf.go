@@ -0,0 +1,370 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+	_ "golang.org/x/image/webp"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Разметка страницы PDF: поля и отступы в миллиметрах, размер шрифта в пунктах
+const (
+	pdfMargin     = 20.0
+	pdfIndent     = 7.0
+	pdfFontSize   = 11.0
+	pdfLineHeight = 5.5
+	pdfCodeSize   = 9.0
+	pdfCodeHeight = 4.5
+	// pdfMaxTableLines ограничивает высоту ячейки таблицы, чтобы строка помещалась на страницу
+	pdfMaxTableLines = 40
+	// pdfMaxImagePixels ограничивает размер встраиваемого изображения: небольшой файл
+	// может распаковаться в гигабайты памяти
+	pdfMaxImagePixels = 40_000_000
+)
+
+// pdfHeadingSizes - размеры шрифта заголовков markdown по уровням
+var pdfHeadingSizes = map[int]float64{1: 16, 2: 14, 3: 12.5}
+
+// pdfImage - изображение в формате, который встраивается в PDF
+type pdfImage struct {
+	data      []byte
+	imageType string
+}
+
+// pdfWriter выводит документ в PDF шрифтами Go. В них есть латиница, кириллица и греческий,
+// символы других алфавитов в PDF не отображаются.
+type pdfWriter struct {
+	pdf    *fpdf.Fpdf
+	images map[int]pdfImage
+	pages  []int // Номера страниц, с которых начинаются заметки
+}
+
+// pdf выводит заметки в PDF. Оглавление блокнота содержит номера страниц, поэтому документ собирается
+// дважды: первый проход определяет, с какой страницы начинается каждая заметка.
+func (d *document) pdf() ([]byte, error) {
+	images := pdfImages(d.images)
+	w := d.renderPDF(images, nil)
+	if d.title != "" {
+		w = d.renderPDF(images, w.pages)
+	}
+	var buf bytes.Buffer
+	if err := w.pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *document) renderPDF(images map[int]pdfImage, tocPages []int) *pdfWriter {
+	title := d.title
+	if title == "" {
+		title = d.notes[0].Title
+	}
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.AddUTF8FontFromBytes("go", "", goregular.TTF)
+	pdf.AddUTF8FontFromBytes("go", "B", gobold.TTF)
+	pdf.AddUTF8FontFromBytes("go", "I", goitalic.TTF)
+	pdf.AddUTF8FontFromBytes("go", "BI", gobolditalic.TTF)
+	pdf.AddUTF8FontFromBytes("gomono", "", gomono.TTF)
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfMargin)
+	pdf.SetTitle(title, true)
+	pdf.SetCreator("notes-api", true)
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-pdfMargin + 5)
+		pdf.SetFont("go", "", 8)
+		pdf.SetTextColor(128, 128, 128)
+		pdf.CellFormat(0, 5, fmt.Sprintf("%d / {nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	w := &pdfWriter{pdf: pdf, images: images}
+	var links []int
+	if d.title != "" {
+		pdf.AddPage()
+		pdf.SetFont("go", "B", 20)
+		pdf.MultiCell(0, 9, pdfText(d.title), "", "L", false)
+		pdf.Ln(4)
+		pdf.SetFont("go", "B", 14)
+		pdf.CellFormat(0, 8, "Содержание", "", 1, "L", false, 0, "")
+		pdf.SetFont("go", "", pdfFontSize)
+		width := w.contentWidth(pdfMargin) - 15
+		for i, note := range d.notes {
+			links = append(links, pdf.AddLink())
+			page := ""
+			if tocPages != nil {
+				page = strconv.Itoa(tocPages[i])
+			}
+			pdf.CellFormat(width, 7, w.fit(pdfText(fmt.Sprintf("%d. %s", i+1, note.Title)), width), "", 0, "L", false, links[i], "")
+			pdf.CellFormat(15, 7, page, "", 1, "R", false, links[i], "")
+		}
+	}
+	for i, note := range d.notes {
+		pdf.AddPage()
+		w.pages = append(w.pages, pdf.PageNo())
+		if links != nil {
+			pdf.SetLink(links[i], 0, pdf.PageNo())
+		}
+		pdf.Bookmark(pdfText(note.Title), 0, -1)
+		pdf.SetFont("go", "B", 18)
+		pdf.MultiCell(0, 8, pdfText(note.Title), "", "L", false)
+		pdf.SetFont("go", "", 9)
+		pdf.SetTextColor(110, 110, 110)
+		pdf.MultiCell(0, 5, pdfText(noteMeta(note)), "", "L", false)
+		pdf.SetTextColor(0, 0, 0)
+		pdf.Ln(4)
+		for _, block := range d.blocks(note) {
+			w.block(block)
+		}
+	}
+	return w
+}
+
+// contentWidth возвращает ширину текста от отступа left до правого поля
+func (w *pdfWriter) contentWidth(left float64) float64 {
+	pageWidth, _ := w.pdf.GetPageSize()
+	return pageWidth - pdfMargin - left
+}
+
+// fit обрезает строку, чтобы она поместилась в ширину width текущим шрифтом
+func (w *pdfWriter) fit(s string, width float64) string {
+	if w.pdf.GetStringWidth(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && w.pdf.GetStringWidth(string(runes)+"…") > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
+
+func (w *pdfWriter) block(block docBlock) {
+	pdf := w.pdf
+	left := pdfMargin + float64(block.indent)*pdfIndent
+	pdf.SetLeftMargin(left)
+	pdf.SetX(left)
+	top, page := pdf.GetY(), pdf.PageNo()
+	switch block.kind {
+	case blockHeading:
+		size, ok := pdfHeadingSizes[block.level]
+		if !ok {
+			size = pdfFontSize + 0.5
+		}
+		pdf.Ln(2)
+		w.spans(block.spans, size, true, size*0.5)
+	case blockParagraph:
+		if block.marker != "" {
+			pdf.SetFont("go", "", pdfFontSize)
+			pdf.SetX(left - pdfIndent)
+			pdf.CellFormat(pdfIndent, pdfLineHeight, pdfText(block.marker), "", 0, "L", false, 0, "")
+		}
+		w.spans(block.spans, pdfFontSize, false, pdfLineHeight)
+	case blockCode:
+		pdf.SetFont("gomono", "", pdfCodeSize)
+		pdf.SetFillColor(244, 244, 244)
+		pdf.MultiCell(0, pdfCodeHeight, pdfText(strings.TrimRight(block.code, "\n")), "", "L", true)
+	case blockRule:
+		y := pdf.GetY() + 2
+		pdf.SetDrawColor(200, 200, 200)
+		pdf.Line(left, y, left+w.contentWidth(left), y)
+		pdf.SetY(y + 2)
+	case blockImage:
+		w.image(block, left)
+	case blockTable:
+		w.table(block.rows, left)
+	}
+	// Черта слева от цитаты рисуется, если цитата не перешла на следующую страницу
+	if block.quote && pdf.PageNo() == page {
+		pdf.SetDrawColor(200, 200, 200)
+		pdf.SetLineWidth(0.8)
+		x := pdfMargin + float64(block.indent-1)*pdfIndent + 2
+		pdf.Line(x, top, x, pdf.GetY())
+		pdf.SetLineWidth(0.2)
+	}
+	pdf.Ln(2)
+	pdf.SetLeftMargin(pdfMargin)
+}
+
+// spans выводит текст абзаца с оформлением фрагментов и переносом строк
+func (w *pdfWriter) spans(spans []docSpan, size float64, bold bool, height float64) {
+	pdf := w.pdf
+	for _, span := range spans {
+		family, style := "go", ""
+		if span.code {
+			family = "gomono"
+		} else {
+			if bold || span.bold {
+				style += "B"
+			}
+			if span.italic {
+				style += "I"
+			}
+		}
+		if span.strike {
+			style += "S"
+		}
+		if span.link != "" {
+			style += "U"
+			pdf.SetTextColor(30, 80, 180)
+		}
+		pdf.SetFont(family, style, size)
+		if span.link != "" {
+			pdf.WriteLinkString(height, pdfText(span.text), span.link)
+		} else {
+			pdf.Write(height, pdfText(span.text))
+		}
+		pdf.SetTextColor(0, 0, 0)
+	}
+	pdf.Ln(height)
+}
+
+// image вписывает изображение в ширину страницы, переносит его на новую страницу, если оно не помещается
+func (w *pdfWriter) image(block docBlock, left float64) {
+	pdf := w.pdf
+	img, ok := w.images[block.image]
+	if !ok {
+		w.spans([]docSpan{{text: "[" + block.alt + "]", italic: true}}, pdfFontSize, false, pdfLineHeight)
+		return
+	}
+	name := "attachment-" + strconv.Itoa(block.image)
+	options := fpdf.ImageOptions{ImageType: img.imageType}
+	info := pdf.RegisterImageOptionsReader(name, options, bytes.NewReader(img.data))
+	if info == nil {
+		return
+	}
+	// Размер изображения считается при 96 точках на дюйм
+	width, height := info.Width()*72/96, info.Height()*72/96
+	_, pageHeight := pdf.GetPageSize()
+	maxWidth, maxHeight := w.contentWidth(left), pageHeight-2*pdfMargin-10
+	if width > maxWidth {
+		width, height = maxWidth, height*maxWidth/width
+	}
+	if height > maxHeight {
+		width, height = width*maxHeight/height, maxHeight
+	}
+	if pdf.GetY()+height > pageHeight-pdfMargin {
+		pdf.AddPage()
+	}
+	y := pdf.GetY()
+	pdf.ImageOptions(name, left, y, width, height, false, options, 0, "")
+	pdf.SetY(y + height)
+}
+
+// table выводит таблицу с равными столбцами; строка целиком переносится на новую страницу
+func (w *pdfWriter) table(rows [][]string, left float64) {
+	pdf := w.pdf
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	if columns == 0 {
+		return
+	}
+	_, pageHeight := pdf.GetPageSize()
+	width := w.contentWidth(left) / float64(columns)
+	pdf.SetDrawColor(180, 180, 180)
+	for r, row := range rows {
+		style := ""
+		if r == 0 {
+			style = "B"
+		}
+		pdf.SetFont("go", style, pdfCodeSize+0.5)
+		cells := make([][]string, columns)
+		lines := 1
+		for c := range cells {
+			if c < len(row) {
+				cells[c] = pdf.SplitText(pdfText(row[c]), width)
+			}
+			if len(cells[c]) > pdfMaxTableLines {
+				cells[c] = append(cells[c][:pdfMaxTableLines-1], "…")
+			}
+			lines = max(lines, len(cells[c]))
+		}
+		height := float64(lines)*pdfCodeHeight + 2
+		if pdf.GetY()+height > pageHeight-pdfMargin {
+			pdf.AddPage()
+		}
+		y := pdf.GetY()
+		for c, cell := range cells {
+			x := left + float64(c)*width
+			pdf.Rect(x, y, width, height, "D")
+			for i, line := range cell {
+				pdf.SetXY(x, y+1+float64(i)*pdfCodeHeight)
+				pdf.CellFormat(width, pdfCodeHeight, line, "", 0, "L", false, 0, "")
+			}
+		}
+		pdf.SetY(y + height)
+	}
+}
+
+// pdfFont - обычный шрифт Go, по которому проверяется наличие символов
+var pdfFont = sync.OnceValue(func() *sfnt.Font {
+	font, _ := sfnt.Parse(goregular.TTF)
+	return font
+})
+
+// pdfText заменяет символы, которых нет в шрифтах Go, вопросительным знаком: библиотека PDF
+// не выводит символы за пределами базовой плоскости Unicode, а остальные отсутствующие показывает пустыми.
+func pdfText(s string) string {
+	var buf sfnt.Buffer
+	font := pdfFont()
+	return strings.Map(func(r rune) rune {
+		if r == '\n' {
+			return r
+		}
+		if r < ' ' {
+			return -1
+		}
+		if index, err := font.GlyphIndex(&buf, r); err != nil || index == 0 {
+			return '?'
+		}
+		return r
+	}, s)
+}
+
+// pdfImages готовит изображения-вложения к встраиванию; изображения, которые не удалось разобрать, пропускаются
+func pdfImages(images map[int]docImage) map[int]pdfImage {
+	result := map[int]pdfImage{}
+	for id, img := range images {
+		if converted, ok := convertPDFImage(img.data); ok {
+			result[id] = converted
+		}
+	}
+	return result
+}
+
+// convertPDFImage встраивает JPEG как есть, остальные изображения перекодирует в PNG
+// с 8 битами на канал: библиотека PDF не поддерживает WebP, чересстрочный PNG и 16-битные цвета.
+func convertPDFImage(data []byte) (pdfImage, bool) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width == 0 || config.Height == 0 || config.Width*config.Height > pdfMaxImagePixels {
+		return pdfImage{}, false
+	}
+	if format == "jpeg" && (config.ColorModel == color.YCbCrModel || config.ColorModel == color.GrayModel) {
+		return pdfImage{data: data, imageType: "JPG"}, true
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return pdfImage{}, false
+	}
+	rgba := image.NewNRGBA(decoded.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, rgba); err != nil {
+		return pdfImage{}, false
+	}
+	return pdfImage{data: buf.Bytes(), imageType: "PNG"}, true
+}
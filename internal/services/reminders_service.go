@@ -0,0 +1,418 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/teambition/rrule-go"
+	"log/slog"
+	"notes-api/internal/config"
+	"notes-api/internal/models"
+	"time"
+)
+
+var (
+	ErrReminderNotFound       = errors.New("напоминание не найдено")
+	ErrInvalidRRule           = errors.New("некорректное правило повторения")
+	ErrInvalidReminderChannel = errors.New("канал напоминания должен быть notification, email или webhook")
+	ErrInvalidSnooze          = errors.New("укажите minutes больше нуля или until в будущем")
+	ErrRRuleTooFrequent       = errors.New("напоминание не может повторяться чаще раза в час")
+	ErrReminderWebhookOwner   = errors.New("канал webhook доступен только владельцу заметки")
+)
+
+const reminderColumns = `r.id, r.user_id, r.note_id, n.title, r.checklist_item_id, COALESCE(ci.text, ''), r.message,
+	r.remind_at, r.rrule, r.channels, r.next_at, r.last_fired_at, r.created_at`
+
+const reminderJoins = ` FROM reminders r
+	JOIN notes n ON n.id = r.note_id
+	LEFT JOIN checklist_items ci ON ci.id = r.checklist_item_id`
+
+func scanReminder(row rowScanner) (models.Reminder, error) {
+	var reminder models.Reminder
+	err := row.Scan(&reminder.ID, &reminder.UserID, &reminder.NoteID, &reminder.NoteTitle, &reminder.ChecklistItemID,
+		&reminder.ItemText, &reminder.Message, &reminder.RemindAt, &reminder.RRule, pq.Array(&reminder.Channels),
+		&reminder.NextAt, &reminder.LastFiredAt, &reminder.CreatedAt)
+	return reminder, err
+}
+
+func scanReminders(rows *sql.Rows) ([]models.Reminder, error) {
+	defer rows.Close()
+	reminders := []models.Reminder{}
+	for rows.Next() {
+		reminder, err := scanReminder(rows)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, reminder)
+	}
+	return reminders, rows.Err()
+}
+
+// ReminderService предоставляет методы для работы с напоминаниями
+type ReminderService struct {
+	DB   *sql.DB
+	Ctx  context.Context   // Контекст запроса: его отмена прерывает запросы к базе данных
+	SMTP config.SMTPConfig // SMTP-сервер для напоминаний по email; нужен только FirePending
+}
+
+// GetNoteReminders возвращает напоминания пользователя о заметке
+func (s *ReminderService) GetNoteReminders(noteID, userID int) ([]models.Reminder, error) {
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	if _, err := noteService.requireNote(noteID, userID, models.PermissionViewer); err != nil {
+		return nil, err
+	}
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+reminderColumns+reminderJoins+`
+		WHERE r.note_id = $1 AND r.user_id = $2 ORDER BY r.next_at NULLS LAST, r.id`, noteID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanReminders(rows)
+}
+
+// CreateReminder создает напоминание о заметке или пункте ее списка задач. Напоминание видит и получает
+// только его автор, поэтому достаточно доступа к заметке на просмотр.
+func (s *ReminderService) CreateReminder(noteID, userID int, request models.CreateReminderRequest) (models.Reminder, error) {
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	note, err := noteService.requireNote(noteID, userID, models.PermissionViewer)
+	if err != nil {
+		return models.Reminder{}, err
+	}
+	if request.ChecklistItemID != nil {
+		checklistService := ChecklistService{DB: s.DB, Ctx: s.Ctx}
+		item, err := checklistService.getItem(*request.ChecklistItemID)
+		if err != nil {
+			return models.Reminder{}, err
+		}
+		if item.NoteID != noteID {
+			return models.Reminder{}, ErrChecklistItemNotFound
+		}
+	}
+	channels, err := validReminderChannels(request.Channels, note.Permission)
+	if err != nil {
+		return models.Reminder{}, err
+	}
+	next, err := nextReminder(request.RemindAt, request.RRule, time.Now(), true)
+	if err != nil {
+		return models.Reminder{}, err
+	}
+	var id int
+	err = s.DB.QueryRowContext(s.Ctx, `INSERT INTO reminders (user_id, note_id, checklist_item_id, message, remind_at, rrule, channels, next_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+		userID, noteID, request.ChecklistItemID, request.Message, request.RemindAt, request.RRule, pq.Array(channels), next).
+		Scan(&id)
+	if err != nil {
+		return models.Reminder{}, err
+	}
+	return s.requireReminder(id, userID)
+}
+
+// UpdateReminder меняет время, повторение, текст или каналы напоминания и пересчитывает ближайшее срабатывание
+func (s *ReminderService) UpdateReminder(reminderID, userID int, request models.UpdateReminderRequest) (models.Reminder, error) {
+	reminder, err := s.requireReminder(reminderID, userID)
+	if err != nil {
+		return reminder, err
+	}
+	if request.RemindAt != nil {
+		reminder.RemindAt = *request.RemindAt
+	}
+	if request.RRule != nil {
+		reminder.RRule = *request.RRule
+	}
+	if request.Message != nil {
+		reminder.Message = *request.Message
+	}
+	if request.Channels != nil {
+		noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+		permission, err := noteService.NotePermission(reminder.NoteID, userID)
+		if err != nil {
+			return reminder, err
+		}
+		if reminder.Channels, err = validReminderChannels(request.Channels, permission); err != nil {
+			return reminder, err
+		}
+	}
+	next := reminder.NextAt
+	if request.RemindAt != nil || request.RRule != nil {
+		if next, err = nextReminder(reminder.RemindAt, reminder.RRule, time.Now(), true); err != nil {
+			return reminder, err
+		}
+	}
+	_, err = s.DB.ExecContext(s.Ctx, `UPDATE reminders SET remind_at = $1, rrule = $2, message = $3, channels = $4, next_at = $5
+		WHERE id = $6`, reminder.RemindAt, reminder.RRule, reminder.Message, pq.Array(reminder.Channels), next, reminderID)
+	if err != nil {
+		return reminder, err
+	}
+	return s.requireReminder(reminderID, userID)
+}
+
+// DeleteReminder удаляет напоминание пользователя
+func (s *ReminderService) DeleteReminder(reminderID, userID int) error {
+	res, err := s.DB.ExecContext(s.Ctx, `DELETE FROM reminders WHERE id = $1 AND user_id = $2`, reminderID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrReminderNotFound
+	}
+	return nil
+}
+
+// Snooze откладывает ближайшее срабатывание напоминания. Сработавшее напоминание без повторения
+// снова становится активным; у повторяющегося после отложенного срабатывания расписание продолжается.
+func (s *ReminderService) Snooze(reminderID, userID int, request models.SnoozeReminderRequest) (models.Reminder, error) {
+	until := time.Now().Add(time.Duration(request.Minutes) * time.Minute)
+	if request.Until != nil {
+		until = *request.Until
+	}
+	if !until.After(time.Now()) {
+		return models.Reminder{}, ErrInvalidSnooze
+	}
+	res, err := s.DB.ExecContext(s.Ctx, `UPDATE reminders SET next_at = $1 WHERE id = $2 AND user_id = $3`, until, reminderID, userID)
+	if err != nil {
+		return models.Reminder{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.Reminder{}, ErrReminderNotFound
+	}
+	return s.requireReminder(reminderID, userID)
+}
+
+// Upcoming возвращает напоминания пользователя, которые сработают до until,
+// и доступные ему заметки со сроком до until
+func (s *ReminderService) Upcoming(userID int, until time.Time) (models.UpcomingReminders, error) {
+	upcoming := models.UpcomingReminders{DueNotes: []models.Note{}}
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+reminderColumns+reminderJoins+`
+		WHERE r.user_id = $1 AND r.next_at <= $2 ORDER BY r.next_at, r.id`, userID, until)
+	if err != nil {
+		return upcoming, err
+	}
+	if upcoming.Reminders, err = scanReminders(rows); err != nil {
+		return upcoming, err
+	}
+	rows, err = s.DB.QueryContext(s.Ctx, `SELECT `+noteColumns+` FROM notes n
+		WHERE n.id IN (`+accessibleNoteIDs("$1")+`) AND n.due_at BETWEEN CURRENT_TIMESTAMP AND $2
+		ORDER BY n.due_at, n.id`, userID, until)
+	if err != nil {
+		return upcoming, err
+	}
+	notes, err := scanNotes(rows)
+	if notes != nil {
+		upcoming.DueNotes = notes
+	}
+	return upcoming, err
+}
+
+// FirePending доставляет наступившие напоминания и возвращает их количество.
+// Напоминания выбираются через FOR UPDATE SKIP LOCKED в одной транзакции с переносом next_at,
+// поэтому планировщики на нескольких экземплярах сервиса не отправляют одно напоминание дважды.
+// Доставка начинается после фиксации транзакции: медленная отправка почты не держит блокировки,
+// а сбой фиксации не приводит к повторной отправке уже доставленных напоминаний.
+func (s *ReminderService) FirePending(limit int) (int, error) {
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(s.Ctx, `SELECT `+reminderColumns+`, COALESCE(ci.checked, FALSE)`+reminderJoins+`
+		WHERE r.next_at <= CURRENT_TIMESTAMP
+		ORDER BY r.next_at
+		LIMIT $1
+		FOR UPDATE OF r SKIP LOCKED`, limit)
+	if err != nil {
+		return 0, err
+	}
+	type due struct {
+		reminder models.Reminder
+		checked  bool
+	}
+	var batch []due
+	for rows.Next() {
+		var d due
+		r := &d.reminder
+		if err := rows.Scan(&r.ID, &r.UserID, &r.NoteID, &r.NoteTitle, &r.ChecklistItemID, &r.ItemText, &r.Message,
+			&r.RemindAt, &r.RRule, pq.Array(&r.Channels), &r.NextAt, &r.LastFiredAt, &r.CreatedAt, &d.checked); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	type delivery struct {
+		reminder   models.Reminder
+		permission string
+	}
+	var deliveries []delivery
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	now := time.Now()
+	for _, d := range batch {
+		var next *time.Time
+		// Напоминание о выполненной задаче или заметке, к которой у пользователя нет доступа, больше не срабатывает
+		if !d.checked {
+			permission, err := noteService.NotePermission(d.reminder.NoteID, d.reminder.UserID)
+			if err != nil {
+				// next_at не меняется, и напоминание будет доставлено при следующей проверке
+				slog.ErrorContext(s.Ctx, "Ошибка при проверке доступа для напоминания", "reminder_id", d.reminder.ID, "error", err)
+				continue
+			}
+			if permission != "" {
+				deliveries = append(deliveries, delivery{reminder: d.reminder, permission: permission})
+				next, _ = nextReminder(d.reminder.RemindAt, d.reminder.RRule, now, false)
+			}
+		}
+		if _, err := tx.ExecContext(s.Ctx, `UPDATE reminders SET next_at = $1, last_fired_at = CURRENT_TIMESTAMP WHERE id = $2`,
+			next, d.reminder.ID); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	for _, d := range deliveries {
+		s.deliver(d.reminder, d.permission)
+	}
+	return len(batch), nil
+}
+
+// deliver отправляет напоминание по его каналам. Ошибки доставки только записываются в лог.
+// Вебхуки получают только напоминания владельца заметки: вебхуки принадлежат владельцу, а не автору напоминания.
+func (s *ReminderService) deliver(reminder models.Reminder, permission string) {
+	message := reminder.Message
+	if message == "" {
+		message = fmt.Sprintf("Напоминание о заметке «%s»", reminder.NoteTitle)
+		if reminder.ChecklistItemID != nil {
+			message = fmt.Sprintf("Напоминание о задаче «%s» в заметке «%s»", reminder.ItemText, reminder.NoteTitle)
+		}
+	}
+	for _, channel := range reminder.Channels {
+		switch channel {
+		case models.ReminderChannelNotification:
+			notify(s.Ctx, s.DB, []int{reminder.UserID}, models.Notification{
+				Type:    models.NotificationReminder,
+				NoteID:  &reminder.NoteID,
+				Message: message,
+			})
+		case models.ReminderChannelEmail:
+			var email sql.NullString
+			if err := s.DB.QueryRowContext(s.Ctx, `SELECT email FROM users WHERE id = $1`, reminder.UserID).Scan(&email); err != nil {
+				slog.ErrorContext(s.Ctx, "Ошибка при получении email для напоминания", "reminder_id", reminder.ID, "error", err)
+				continue
+			}
+			if !email.Valid || email.String == "" {
+				continue
+			}
+			err := sendMail(s.SMTP, email.String, message, message+"\n")
+			if err != nil && !errors.Is(err, ErrMailNotConfigured) {
+				slog.ErrorContext(s.Ctx, "Ошибка при отправке напоминания на email", "reminder_id", reminder.ID, "error", err)
+			}
+		case models.ReminderChannelWebhook:
+			if permission != models.PermissionOwner {
+				continue
+			}
+			note, err := scanNote(s.DB.QueryRowContext(s.Ctx, `SELECT `+noteColumns+` FROM notes n WHERE n.id = $1`, reminder.NoteID))
+			if err != nil {
+				slog.ErrorContext(s.Ctx, "Ошибка при получении заметки для напоминания", "reminder_id", reminder.ID, "error", err)
+				continue
+			}
+			dispatchEvent(s.Ctx, s.DB, models.EventReminder, note, reminder)
+		}
+	}
+}
+
+func (s *ReminderService) requireReminder(reminderID, userID int) (models.Reminder, error) {
+	reminder, err := scanReminder(s.DB.QueryRowContext(s.Ctx, `SELECT `+reminderColumns+reminderJoins+`
+		WHERE r.id = $1 AND r.user_id = $2`, reminderID, userID))
+	if err == sql.ErrNoRows {
+		return reminder, ErrReminderNotFound
+	}
+	return reminder, err
+}
+
+// nextReminder вычисляет срабатывание напоминания после момента after (включительно, если inclusive).
+// Напоминание без повторения срабатывает один раз: при создании - в remindAt, даже если оно уже прошло.
+func nextReminder(remindAt time.Time, rule string, after time.Time, inclusive bool) (*time.Time, error) {
+	if rule == "" {
+		if !inclusive {
+			return nil, nil
+		}
+		return &remindAt, nil
+	}
+	option, err := rrule.StrToROption(rule)
+	if err != nil {
+		return nil, ErrInvalidRRule
+	}
+	option.Dtstart = remindAt
+	r, err := rrule.NewRRule(*option)
+	if err != nil {
+		return nil, ErrInvalidRRule
+	}
+	if tooFrequent(r, option) {
+		return nil, ErrRRuleTooFrequent
+	}
+	next := r.After(after, inclusive)
+	if next.IsZero() {
+		return nil, nil
+	}
+	return &next, nil
+}
+
+// minReminderGap - наименьший промежуток между срабатываниями повторяющегося напоминания. Напоминания
+// проверяются планировщиком раз в несколько секунд, а каждое срабатывание - это письмо или событие вебхука.
+const minReminderGap = time.Hour
+
+// reminderGapChecks - сколько первых срабатываний правила сравнивается с minReminderGap
+const reminderGapChecks = 100
+
+// tooFrequent сообщает, срабатывает ли правило чаще minReminderGap. Период частоты с интервалом
+// проверяется сразу, а срабатывания, которые BYSECOND, BYMINUTE и другие уточнения добавляют внутри периода, -
+// по первым reminderGapChecks срабатываниям.
+func tooFrequent(r *rrule.RRule, option *rrule.ROption) bool {
+	interval := time.Duration(max(option.Interval, 1))
+	switch option.Freq {
+	case rrule.SECONDLY:
+		if interval*time.Second < minReminderGap {
+			return true
+		}
+	case rrule.MINUTELY:
+		if interval*time.Minute < minReminderGap {
+			return true
+		}
+	}
+	next := r.Iterator()
+	previous, ok := next()
+	for i := 0; ok && i < reminderGapChecks; i++ {
+		var current time.Time
+		if current, ok = next(); ok && current.Sub(previous) < minReminderGap {
+			return true
+		}
+		previous = current
+	}
+	return false
+}
+
+// validReminderChannels проверяет каналы напоминания. Канал webhook доступен только пользователю
+// с правами владельца заметки (permission), потому что событие уходит вебхукам владельца.
+func validReminderChannels(channels []string, permission string) ([]string, error) {
+	if len(channels) == 0 {
+		return []string{models.ReminderChannelNotification}, nil
+	}
+	for _, channel := range channels {
+		known := false
+		for _, c := range models.ReminderChannels {
+			if channel == c {
+				known = true
+			}
+		}
+		if !known {
+			return nil, ErrInvalidReminderChannel
+		}
+		if channel == models.ReminderChannelWebhook && permission != models.PermissionOwner {
+			return nil, ErrReminderWebhookOwner
+		}
+	}
+	return channels, nil
+}
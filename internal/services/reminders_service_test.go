@@ -0,0 +1,58 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNextReminder(t *testing.T) {
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	at := func(month time.Month, day, hour int) *time.Time {
+		value := time.Date(2024, month, day, hour, 0, 0, 0, time.UTC)
+		return &value
+	}
+	afterStart := func(d time.Duration) *time.Time {
+		value := start.Add(d)
+		return &value
+	}
+	tests := []struct {
+		name      string
+		rule      string
+		after     time.Time
+		inclusive bool
+		want      *time.Time
+		wantErr   error
+	}{
+		{"разовое при создании", "", start.AddDate(0, 0, 7), true, &start, nil},
+		{"разовое после срабатывания", "", start, false, nil, nil},
+		{"ежедневно с начала", "FREQ=DAILY", start, true, &start, nil},
+		{"ежедневно после срабатывания", "FREQ=DAILY", start, false, at(time.January, 2, 9), nil},
+		{"ежедневно после простоя", "FREQ=DAILY", start.AddDate(0, 0, 3).Add(time.Hour), false, at(time.January, 5, 9), nil},
+		{"по понедельникам и пятницам", "FREQ=WEEKLY;BYDAY=MO,FR", start.AddDate(0, 0, 1), false, at(time.January, 5, 9), nil},
+		{"ежечасно", "FREQ=HOURLY;INTERVAL=2", start, false, at(time.January, 1, 11), nil},
+		{"количество исчерпано", "FREQ=DAILY;COUNT=2", start.AddDate(0, 0, 1), false, nil, nil},
+		{"до даты", "FREQ=DAILY;UNTIL=20240103T090000Z", start.AddDate(0, 0, 2), true, at(time.January, 3, 9), nil},
+		{"ежеминутно", "FREQ=MINUTELY", start, true, nil, ErrRRuleTooFrequent},
+		{"ежесекундно", "FREQ=SECONDLY;INTERVAL=1800", start, true, nil, ErrRRuleTooFrequent},
+		{"раз в час в секундах", "FREQ=SECONDLY;INTERVAL=3600", start, false, at(time.January, 1, 10), nil},
+		{"раз в полтора часа", "FREQ=MINUTELY;INTERVAL=90", start, false, afterStart(90 * time.Minute), nil},
+		{"дважды в час", "FREQ=HOURLY;BYMINUTE=0,30", start, true, nil, ErrRRuleTooFrequent},
+		{"дважды в день подряд", "FREQ=DAILY;BYHOUR=9;BYMINUTE=0,15", start, true, nil, ErrRRuleTooFrequent},
+		{"некорректное правило", "FREQ=SOMETIMES", start, true, nil, ErrInvalidRRule},
+		{"мусор", "не правило", start, true, nil, ErrInvalidRRule},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := nextReminder(start, tt.rule, tt.after, tt.inclusive)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("nextReminder() error = %v, want %v", err, tt.wantErr)
+			}
+			switch {
+			case got == nil && tt.want == nil:
+			case got == nil || tt.want == nil || !got.Equal(*tt.want):
+				t.Errorf("nextReminder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
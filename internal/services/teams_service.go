@@ -0,0 +1,421 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"notes-api/internal/models"
+)
+
+var (
+	ErrTeamNotFound      = errors.New("команда не найдена")
+	ErrTeamForbidden     = errors.New("недостаточно прав в команде")
+	ErrInvalidTeamRole   = errors.New("роль должна быть owner, admin, member или guest")
+	ErrLastTeamOwner     = errors.New("в команде должен остаться хотя бы один владелец")
+	ErrMemberNotFound    = errors.New("участник команды не найден")
+	ErrAlreadyTeamMember = errors.New("пользователь уже состоит в команде")
+)
+
+// teamRoleRank упорядочивает роли участников команды
+var teamRoleRank = map[string]int{
+	models.TeamRoleGuest:  1,
+	models.TeamRoleMember: 2,
+	models.TeamRoleAdmin:  3,
+	models.TeamRoleOwner:  4,
+}
+
+// TeamService предоставляет методы для работы с командами и их участниками
+type TeamService struct {
+	DB     *sql.DB
+	Client models.ClientInfo // Клиент, выполняющий запрос; записывается в журнал аудита
+	Ctx    context.Context   // Контекст запроса: его отмена прерывает запросы к базе данных
+}
+
+// requireRole возвращает роль пользователя в команде, если она не ниже required.
+// Не участникам команды возвращается ErrTeamNotFound, чтобы не раскрывать ее существование.
+func (s *TeamService) requireRole(teamID, userID int, required string) (string, error) {
+	var role string
+	err := s.DB.QueryRowContext(s.Ctx, `SELECT role FROM team_members WHERE team_id = $1 AND user_id = $2`, teamID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", ErrTeamNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if teamRoleRank[role] < teamRoleRank[required] {
+		return role, ErrTeamForbidden
+	}
+	return role, nil
+}
+
+// CreateTeam создает команду, создатель становится ее владельцем
+func (s *TeamService) CreateTeam(team *models.Team, userID int) error {
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(s.Ctx, `INSERT INTO teams (name, created_by) VALUES ($1, $2) RETURNING id, created_at`, team.Name, userID).
+		Scan(&team.ID, &team.CreatedAt)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(s.Ctx, `INSERT INTO team_members (team_id, user_id, role) VALUES ($1, $2, $3)`, team.ID, userID, models.TeamRoleOwner)
+	if err != nil {
+		return err
+	}
+	team.CreatedBy = userID
+	team.Role = models.TeamRoleOwner
+	return tx.Commit()
+}
+
+// GetTeams возвращает команды, в которых состоит пользователь
+func (s *TeamService) GetTeams(userID int) ([]models.Team, error) {
+	rows, err := s.DB.QueryContext(s.Ctx, `
+		SELECT t.id, t.name, COALESCE(t.created_by, 0), t.created_at, tm.role
+		FROM teams t
+		JOIN team_members tm ON tm.team_id = t.id
+		WHERE tm.user_id = $1
+		ORDER BY t.name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	teams := []models.Team{}
+	for rows.Next() {
+		var team models.Team
+		if err := rows.Scan(&team.ID, &team.Name, &team.CreatedBy, &team.CreatedAt, &team.Role); err != nil {
+			return nil, err
+		}
+		teams = append(teams, team)
+	}
+	return teams, rows.Err()
+}
+
+// GetTeam возвращает команду со списком участников
+func (s *TeamService) GetTeam(teamID, userID int) (models.Team, error) {
+	var team models.Team
+	role, err := s.requireRole(teamID, userID, models.TeamRoleGuest)
+	if err != nil {
+		return team, err
+	}
+	err = s.DB.QueryRowContext(s.Ctx, `SELECT id, name, COALESCE(created_by, 0), created_at FROM teams WHERE id = $1`, teamID).
+		Scan(&team.ID, &team.Name, &team.CreatedBy, &team.CreatedAt)
+	if err != nil {
+		return team, err
+	}
+	team.Role = role
+	rows, err := s.DB.QueryContext(s.Ctx, `
+		SELECT u.id, u.username, tm.role, tm.created_at
+		FROM team_members tm
+		JOIN users u ON u.id = tm.user_id
+		WHERE tm.team_id = $1
+		ORDER BY u.username`, teamID)
+	if err != nil {
+		return team, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var member models.TeamMember
+		if err := rows.Scan(&member.UserID, &member.Username, &member.Role, &member.CreatedAt); err != nil {
+			return team, err
+		}
+		team.Members = append(team.Members, member)
+	}
+	return team, rows.Err()
+}
+
+// RenameTeam меняет название команды
+func (s *TeamService) RenameTeam(teamID, userID int, name string) error {
+	if _, err := s.requireRole(teamID, userID, models.TeamRoleAdmin); err != nil {
+		return err
+	}
+	_, err := s.DB.ExecContext(s.Ctx, `UPDATE teams SET name = $1 WHERE id = $2`, name, teamID)
+	return err
+}
+
+// DeleteTeam удаляет команду вместе с ее заметками, блокнотами и тегами
+func (s *TeamService) DeleteTeam(teamID, userID int) error {
+	if _, err := s.requireRole(teamID, userID, models.TeamRoleOwner); err != nil {
+		return err
+	}
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Участники теряют доступ к заметкам, выданным команде, поэтому их подписки на эти заметки удаляются
+	rows, err := tx.QueryContext(s.Ctx, `SELECT user_id FROM team_members WHERE team_id = $1`, teamID)
+	if err != nil {
+		return err
+	}
+	var members []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		members = append(members, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(s.Ctx, `DELETE FROM teams WHERE id = $1`, teamID); err != nil {
+		return err
+	}
+	for _, id := range members {
+		if err := deleteStaleFollows(s.Ctx, tx, 0, id); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	audit(s.Ctx, s.DB, s.Client, userID, models.AuditTeamDeleted, models.AuditTargetTeam, teamID, nil)
+	return nil
+}
+
+// AddMember добавляет пользователя в команду. Назначить владельца может только владелец.
+func (s *TeamService) AddMember(teamID, actorID int, request models.AddTeamMemberRequest) (models.TeamMember, error) {
+	member := models.TeamMember{UserID: request.UserID, Role: request.Role}
+	if member.Role == "" {
+		member.Role = models.TeamRoleMember
+	}
+	if _, ok := teamRoleRank[member.Role]; !ok {
+		return member, ErrInvalidTeamRole
+	}
+	actorRole, err := s.requireRole(teamID, actorID, models.TeamRoleAdmin)
+	if err != nil {
+		return member, err
+	}
+	if teamRoleRank[member.Role] > teamRoleRank[actorRole] {
+		return member, ErrTeamForbidden
+	}
+	query := `SELECT id, username FROM users WHERE id = $1`
+	lookup := interface{}(member.UserID)
+	if member.UserID == 0 {
+		query = `SELECT id, username FROM users WHERE username = $1`
+		lookup = request.Username
+	}
+	if err := s.DB.QueryRowContext(s.Ctx, query, lookup).Scan(&member.UserID, &member.Username); err != nil {
+		if err == sql.ErrNoRows {
+			return member, ErrUserNotFound
+		}
+		return member, err
+	}
+	err = s.DB.QueryRowContext(s.Ctx, `INSERT INTO team_members (team_id, user_id, role) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING RETURNING created_at`, teamID, member.UserID, member.Role).Scan(&member.CreatedAt)
+	if err == sql.ErrNoRows {
+		return member, ErrAlreadyTeamMember
+	}
+	if err != nil {
+		return member, err
+	}
+	audit(s.Ctx, s.DB, s.Client, actorID, models.AuditTeamMemberAdded, models.AuditTargetTeam, teamID,
+		map[string]interface{}{"user_id": member.UserID, "role": member.Role})
+	return member, nil
+}
+
+// UpdateMemberRole меняет роль участника. Администратор не может менять роли владельцев и других администраторов.
+func (s *TeamService) UpdateMemberRole(teamID, actorID, userID int, role string) error {
+	if _, ok := teamRoleRank[role]; !ok {
+		return ErrInvalidTeamRole
+	}
+	var before string
+	err := s.changeMember(teamID, actorID, userID, func(tx *sql.Tx, actorRole, currentRole string) error {
+		if teamRoleRank[role] > teamRoleRank[actorRole] {
+			return ErrTeamForbidden
+		}
+		before = currentRole
+		_, err := tx.ExecContext(s.Ctx, `UPDATE team_members SET role = $1 WHERE team_id = $2 AND user_id = $3`, role, teamID, userID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	audit(s.Ctx, s.DB, s.Client, actorID, models.AuditTeamMemberRole, models.AuditTargetTeam, teamID,
+		map[string]interface{}{"user_id": userID, "before": before, "after": role})
+	return nil
+}
+
+// RemoveMember исключает участника из команды. Любой участник может покинуть команду сам.
+func (s *TeamService) RemoveMember(teamID, actorID, userID int) error {
+	var before string
+	err := s.changeMember(teamID, actorID, userID, func(tx *sql.Tx, actorRole, currentRole string) error {
+		before = currentRole
+		if _, err := tx.ExecContext(s.Ctx, `DELETE FROM team_members WHERE team_id = $1 AND user_id = $2`, teamID, userID); err != nil {
+			return err
+		}
+		return deleteStaleFollows(s.Ctx, tx, 0, userID)
+	})
+	if err != nil {
+		return err
+	}
+	audit(s.Ctx, s.DB, s.Client, actorID, models.AuditTeamMemberRemoved, models.AuditTargetTeam, teamID,
+		map[string]interface{}{"user_id": userID, "role": before})
+	return nil
+}
+
+// changeMember проверяет права на изменение участника и выполняет change в транзакции,
+// следя за тем, чтобы в команде остался хотя бы один владелец
+func (s *TeamService) changeMember(teamID, actorID, userID int, change func(tx *sql.Tx, actorRole, currentRole string) error) error {
+	required := models.TeamRoleAdmin
+	if actorID == userID {
+		required = models.TeamRoleGuest
+	}
+	actorRole, err := s.requireRole(teamID, actorID, required)
+	if err != nil {
+		return err
+	}
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Блокируем состав команды, чтобы параллельные изменения не оставили ее без владельца
+	var currentRole string
+	err = tx.QueryRowContext(s.Ctx, `SELECT role FROM team_members WHERE team_id = $1 AND user_id = $2 FOR UPDATE`, teamID, userID).Scan(&currentRole)
+	if err == sql.ErrNoRows {
+		return ErrMemberNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if actorID != userID && actorRole != models.TeamRoleOwner && teamRoleRank[currentRole] >= teamRoleRank[actorRole] {
+		return ErrTeamForbidden
+	}
+	if err := change(tx, actorRole, currentRole); err != nil {
+		return err
+	}
+	var owners int
+	err = tx.QueryRowContext(s.Ctx, `SELECT COUNT(*) FROM team_members WHERE team_id = $1 AND role = $2`, teamID, models.TeamRoleOwner).Scan(&owners)
+	if err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastTeamOwner
+	}
+	return tx.Commit()
+}
+
+// GetTeamNotes возвращает заметки команды и заметки, к которым команде выдан доступ
+func (s *TeamService) GetTeamNotes(teamID, userID, page, limit int) ([]models.Note, error) {
+	if _, err := s.requireRole(teamID, userID, models.TeamRoleGuest); err != nil {
+		return nil, err
+	}
+	offset := (page - 1) * limit
+	rows, err := s.DB.QueryContext(s.Ctx, `
+		SELECT `+noteColumns+`
+		FROM notes n
+		WHERE n.team_id = $1 OR n.id IN (SELECT note_id FROM team_note_access WHERE team_id = $1)
+		ORDER BY n.created_at DESC LIMIT $2 OFFSET $3`, teamID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanNotes(rows)
+}
+
+// GetTeamTags возвращает теги из пространства имен команды
+func (s *TeamService) GetTeamTags(teamID, userID int) ([]models.Tag, error) {
+	if _, err := s.requireRole(teamID, userID, models.TeamRoleGuest); err != nil {
+		return nil, err
+	}
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT id, name FROM tags WHERE team_id = $1 ORDER BY name`, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := []models.Tag{}
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.ID, &tag.Name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// ShareNoteWithTeam выдает доступ к заметке всем участникам команды одним запросом.
+// Делиться может владелец заметки, состоящий в этой команде.
+func (s *TeamService) ShareNoteWithTeam(noteID, userID int, request models.ShareNoteWithTeamRequest) error {
+	permission, err := validSharePermission(request.Permission)
+	if err != nil {
+		return err
+	}
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	note, err := noteService.requireNote(noteID, userID, models.PermissionOwner)
+	if err != nil {
+		return err
+	}
+	if _, err := s.requireRole(request.TeamID, userID, models.TeamRoleGuest); err != nil {
+		return err
+	}
+	if note.TeamID != nil && *note.TeamID == request.TeamID {
+		// Участники команды-владельца уже имеют доступ по своей роли
+		return nil
+	}
+	_, err = s.DB.ExecContext(s.Ctx, `INSERT INTO team_note_access (note_id, team_id, permission) VALUES ($1, $2, $3)
+		ON CONFLICT (note_id, team_id) DO UPDATE SET permission = EXCLUDED.permission`, noteID, request.TeamID, permission)
+	if err != nil {
+		return err
+	}
+	dispatchEvent(s.Ctx, s.DB, models.EventNoteShared, note,
+		map[string]interface{}{"note": note, "team_id": request.TeamID, "permission": permission})
+	audit(s.Ctx, s.DB, s.Client, userID, models.AuditNoteTeamShared, models.AuditTargetNote, noteID,
+		map[string]interface{}{"team_id": request.TeamID, "permission": permission})
+	members, err := s.memberIDs(request.TeamID)
+	if err != nil {
+		slog.ErrorContext(s.Ctx, "Ошибка при получении участников команды", "team_id", request.TeamID, "error", err)
+		return nil
+	}
+	notify(s.Ctx, s.DB, members, models.Notification{
+		Type:    models.NotificationShareGranted,
+		ActorID: &userID,
+		NoteID:  &note.ID,
+		Message: fmt.Sprintf("Вашей команде открыт доступ к заметке «%s»", note.Title),
+	})
+	return nil
+}
+
+// memberIDs возвращает идентификаторы участников команды
+func (s *TeamService) memberIDs(teamID int) ([]int, error) {
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT user_id FROM team_members WHERE team_id = $1`, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// UnshareNoteWithTeam отзывает доступ команды к заметке
+func (s *TeamService) UnshareNoteWithTeam(noteID, teamID, userID int) error {
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	if _, err := noteService.requireNote(noteID, userID, models.PermissionOwner); err != nil {
+		return err
+	}
+	res, err := s.DB.ExecContext(s.Ctx, `DELETE FROM team_note_access WHERE note_id = $1 AND team_id = $2`, noteID, teamID)
+	if err != nil {
+		return err
+	}
+	if err := deleteStaleFollows(s.Ctx, s.DB, noteID, 0); err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		audit(s.Ctx, s.DB, s.Client, userID, models.AuditNoteTeamUnshared, models.AuditTargetNote, noteID,
+			map[string]int{"team_id": teamID})
+	}
+	return nil
+}
@@ -0,0 +1,389 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"notes-api/internal/database"
+	"notes-api/internal/models"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTemplateNotFound     = errors.New("шаблон не найден")
+	ErrMissingTemplateValue = errors.New("не передано значение переменной шаблона")
+	ErrInvalidTimezone      = errors.New("неизвестный часовой пояс")
+)
+
+// templateVariablePattern находит переменные {{имя}} и {{prompt:Имя}}
+var templateVariablePattern = regexp.MustCompile(`\{\{\s*(\w+)(?:\s*:\s*([^{}]+?))?\s*\}\}`)
+
+const templateColumns = `id, name, COALESCE(user_id, 0), team_id, title, content, content_format, tags, notebook_id,
+	created_by, created_at, updated_at`
+
+func scanTemplate(row rowScanner) (models.NoteTemplate, error) {
+	var template models.NoteTemplate
+	err := row.Scan(&template.ID, &template.Name, &template.UserID, &template.TeamID, &template.Title, &template.Content,
+		&template.ContentFormat, pq.Array(&template.Tags), &template.NotebookID, &template.CreatedBy,
+		&template.CreatedAt, &template.UpdatedAt)
+	if template.Tags == nil {
+		template.Tags = []string{}
+	}
+	template.Prompts = templatePrompts(template.Title + "\n" + template.Content)
+	return template, err
+}
+
+// TemplateService предоставляет методы для работы с шаблонами заметок
+type TemplateService struct {
+	DB     *sql.DB
+	Client models.ClientInfo // Клиент, выполняющий запрос; записывается в журнал аудита
+	Ctx    context.Context   // Контекст запроса: его отмена прерывает запросы к базе данных
+}
+
+// GetTemplates возвращает личные шаблоны пользователя и шаблоны его команд
+func (s *TemplateService) GetTemplates(userID int) ([]models.NoteTemplate, error) {
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+templateColumns+` FROM note_templates
+		WHERE user_id = $1 OR team_id IN (SELECT team_id FROM team_members WHERE user_id = $1)
+		ORDER BY team_id NULLS FIRST, name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	templates := []models.NoteTemplate{}
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	return templates, rows.Err()
+}
+
+// GetTemplate возвращает шаблон, доступный пользователю
+func (s *TemplateService) GetTemplate(templateID, userID int) (models.NoteTemplate, error) {
+	return s.requireTemplate(templateID, userID, false)
+}
+
+// CreateTemplate создает личный шаблон или, если указан team_id, шаблон команды
+func (s *TemplateService) CreateTemplate(userID int, request models.CreateTemplateRequest) (models.NoteTemplate, error) {
+	template := models.NoteTemplate{TeamID: request.TeamID, NotebookID: request.NotebookID}
+	var ownerID *int
+	if request.TeamID != nil {
+		teamService := TeamService{DB: s.DB, Ctx: s.Ctx}
+		if _, err := teamService.requireRole(*request.TeamID, userID, models.TeamRoleMember); err != nil {
+			return template, err
+		}
+	} else {
+		ownerID = &userID
+		template.UserID = userID
+	}
+	format, err := validContentFormat(request.ContentFormat)
+	if err != nil {
+		return template, err
+	}
+	if err := s.checkNotebook(template, userID); err != nil {
+		return template, err
+	}
+	if request.Tags == nil {
+		request.Tags = []string{}
+	}
+	row := s.DB.QueryRowContext(s.Ctx, `INSERT INTO note_templates (name, user_id, team_id, title, content, content_format, tags,
+			notebook_id, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING `+templateColumns,
+		request.Name, ownerID, request.TeamID, request.Title, request.Content, format, pq.Array(request.Tags),
+		request.NotebookID, userID)
+	return scanTemplate(row)
+}
+
+// UpdateTemplate меняет шаблон. Шаблон команды могут менять ее участники, кроме гостей.
+func (s *TemplateService) UpdateTemplate(templateID, userID int, request models.UpdateTemplateRequest) (models.NoteTemplate, error) {
+	template, err := s.requireTemplate(templateID, userID, true)
+	if err != nil {
+		return template, err
+	}
+	if request.Name != nil {
+		template.Name = *request.Name
+	}
+	if request.Title != nil {
+		template.Title = *request.Title
+	}
+	if request.Content != nil {
+		template.Content = *request.Content
+	}
+	if request.ContentFormat != nil {
+		if template.ContentFormat, err = validContentFormat(*request.ContentFormat); err != nil {
+			return template, err
+		}
+	}
+	if request.Tags != nil {
+		template.Tags = request.Tags
+	}
+	if request.NotebookID != nil {
+		template.NotebookID = request.NotebookID
+		if *request.NotebookID == 0 {
+			template.NotebookID = nil
+		}
+		if err := s.checkNotebook(template, userID); err != nil {
+			return template, err
+		}
+	}
+	row := s.DB.QueryRowContext(s.Ctx, `UPDATE note_templates SET name = $1, title = $2, content = $3, content_format = $4, tags = $5,
+			notebook_id = $6, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $7 RETURNING `+templateColumns,
+		template.Name, template.Title, template.Content, template.ContentFormat, pq.Array(template.Tags),
+		template.NotebookID, templateID)
+	return scanTemplate(row)
+}
+
+// DeleteTemplate удаляет шаблон; созданные по нему заметки остаются
+func (s *TemplateService) DeleteTemplate(templateID, userID int) error {
+	if _, err := s.requireTemplate(templateID, userID, true); err != nil {
+		return err
+	}
+	_, err := s.DB.ExecContext(s.Ctx, `DELETE FROM note_templates WHERE id = $1`, templateID)
+	return err
+}
+
+// Instantiate создает заметку по шаблону, подставляя значения переменных.
+// Заметка по шаблону команды принадлежит команде.
+func (s *TemplateService) Instantiate(templateID, userID int, request models.InstantiateTemplateRequest) (models.Note, error) {
+	template, err := s.requireTemplate(templateID, userID, false)
+	if err != nil {
+		return models.Note{}, err
+	}
+	now, err := localNow(request.Timezone)
+	if err != nil {
+		return models.Note{}, err
+	}
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return models.Note{}, err
+	}
+	defer tx.Rollback()
+	note := models.Note{UserID: userID, TeamID: template.TeamID, NotebookID: template.NotebookID}
+	if note, err = s.createFromTemplate(tx, template, note, now, request.Values, nil); err != nil {
+		return note, err
+	}
+	if err := tx.Commit(); err != nil {
+		return note, err
+	}
+	return s.noteCreated(template, note)
+}
+
+// DailyNote возвращает ежедневную заметку пользователя за текущую дату в его часовом поясе,
+// создавая ее при первом обращении (по шаблону, если он указан). created сообщает, была ли заметка создана.
+// Заметка создается в транзакции под рекомендательной блокировкой пользователя: параллельный запрос дожидается ее
+// и получает уже созданную заметку, поэтому уведомления и события вебхуков не отправляются о заметке,
+// которая затем удаляется.
+func (s *TemplateService) DailyNote(userID int, request models.DailyNoteRequest) (note models.Note, created bool, err error) {
+	now, err := localNow(request.Timezone)
+	if err != nil {
+		return note, false, err
+	}
+	date := now.Format("2006-01-02")
+	if note, err = s.findDailyNote(userID, date); err != sql.ErrNoRows {
+		return note, false, err
+	}
+	template := models.NoteTemplate{Title: date}
+	if request.TemplateID != nil {
+		if template, err = s.requireTemplate(*request.TemplateID, userID, false); err != nil {
+			return note, false, err
+		}
+		if strings.TrimSpace(template.Title) == "" {
+			template.Title = date
+		}
+	}
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return note, false, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(s.Ctx, `SELECT pg_advisory_xact_lock($1, $2)`, database.DailyNoteLock, userID); err != nil {
+		return note, false, err
+	}
+	if note, err = s.findDailyNote(userID, date); err != sql.ErrNoRows {
+		return note, false, err
+	}
+	// Ежедневная заметка всегда личная; блокнот команды из шаблона не используется
+	note = models.Note{UserID: userID}
+	if template.TeamID == nil {
+		note.NotebookID = template.NotebookID
+	}
+	if note, err = s.createFromTemplate(tx, template, note, now, nil, &date); err != nil {
+		return note, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return note, false, err
+	}
+	note, err = s.noteCreated(template, note)
+	return note, true, err
+}
+
+func (s *TemplateService) findDailyNote(userID int, date string) (models.Note, error) {
+	note, err := scanNote(s.DB.QueryRowContext(s.Ctx, `SELECT `+noteColumns+` FROM notes n WHERE n.user_id = $1 AND n.daily_date = $2`,
+		userID, date))
+	if err != nil {
+		return note, err
+	}
+	note.Permission = models.PermissionOwner
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	note.Tags, err = noteService.GetTagsForNote(note.ID)
+	return note, err
+}
+
+// createFromTemplate заполняет заметку по шаблону и создает ее с тегами шаблона в транзакции tx.
+// dailyDate, если задана, отмечает заметку как ежедневную. После фиксации tx вызывается noteCreated.
+func (s *TemplateService) createFromTemplate(tx *sql.Tx, template models.NoteTemplate, note models.Note, now time.Time,
+	values map[string]string, dailyDate *string) (models.Note, error) {
+	username, err := s.username(note.UserID)
+	if err != nil {
+		return note, err
+	}
+	if note.Title, err = renderTemplate(template.Title, now, username, values); err != nil {
+		return note, err
+	}
+	if note.Content, err = renderTemplate(template.Content, now, username, values); err != nil {
+		return note, err
+	}
+	if strings.TrimSpace(note.Title) == "" {
+		note.Title = template.Name + " " + now.Format("2006-01-02")
+	}
+	note.ContentFormat = template.ContentFormat
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx, Client: s.Client}
+	if err := noteService.insertNote(tx, &note, dailyDate); err != nil {
+		return note, err
+	}
+	return note, addNoteTags(s.Ctx, tx, note.ID, note.TeamID, templateTags(template))
+}
+
+// noteCreated отправляет уведомления и события о заметке, созданной по шаблону, и возвращает ее с тегами
+func (s *TemplateService) noteCreated(template models.NoteTemplate, note models.Note) (models.Note, error) {
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx, Client: s.Client}
+	noteService.noteCreated(note)
+	tags := templateTags(template)
+	if len(tags) == 0 {
+		return note, nil
+	}
+	dispatchEvent(s.Ctx, s.DB, models.EventTagAdded, note, map[string]interface{}{"note_id": note.ID, "tags": tags})
+	var err error
+	note.Tags, err = noteService.GetTagsForNote(note.ID)
+	return note, err
+}
+
+// templateTags возвращает теги шаблона для добавления к заметке
+func templateTags(template models.NoteTemplate) []models.Tag {
+	tags := make([]models.Tag, 0, len(template.Tags))
+	for _, name := range template.Tags {
+		tags = append(tags, models.Tag{Name: name})
+	}
+	return tags
+}
+
+func (s *TemplateService) username(userID int) (string, error) {
+	var username string
+	err := s.DB.QueryRowContext(s.Ctx, `SELECT username FROM users WHERE id = $1`, userID).Scan(&username)
+	return username, err
+}
+
+// requireTemplate возвращает шаблон, если пользователь - владелец личного шаблона или участник команды шаблона.
+// Для изменения шаблона команды нужна роль не ниже member.
+func (s *TemplateService) requireTemplate(templateID, userID int, write bool) (models.NoteTemplate, error) {
+	template, err := scanTemplate(s.DB.QueryRowContext(s.Ctx, `SELECT `+templateColumns+` FROM note_templates WHERE id = $1`, templateID))
+	if err == sql.ErrNoRows {
+		return template, ErrTemplateNotFound
+	}
+	if err != nil {
+		return template, err
+	}
+	if template.TeamID == nil {
+		if template.UserID != userID {
+			return template, ErrTemplateNotFound
+		}
+		return template, nil
+	}
+	required := models.TeamRoleGuest
+	if write {
+		required = models.TeamRoleMember
+	}
+	teamService := TeamService{DB: s.DB, Ctx: s.Ctx}
+	if _, err := teamService.requireRole(*template.TeamID, userID, required); err != nil {
+		if errors.Is(err, ErrTeamNotFound) {
+			return template, ErrTemplateNotFound
+		}
+		return template, err
+	}
+	return template, nil
+}
+
+// checkNotebook проверяет, что блокнот по умолчанию принадлежит владельцу шаблона
+func (s *TemplateService) checkNotebook(template models.NoteTemplate, userID int) error {
+	if template.NotebookID == nil {
+		return nil
+	}
+	notebookService := NotebookService{DB: s.DB, Ctx: s.Ctx}
+	notebook, err := notebookService.requireNotebook(*template.NotebookID, userID, true)
+	if err != nil {
+		return err
+	}
+	if !sameOwner(models.Note{UserID: template.UserID, TeamID: template.TeamID}, notebook) {
+		return ErrNotebookMismatch
+	}
+	return nil
+}
+
+// renderTemplate подставляет в текст значения переменных. Неизвестные переменные остаются как есть.
+func renderTemplate(text string, now time.Time, username string, values map[string]string) (string, error) {
+	var missing error
+	result := templateVariablePattern.ReplaceAllStringFunc(text, func(match string) string {
+		parts := templateVariablePattern.FindStringSubmatch(match)
+		name, arg := strings.ToLower(parts[1]), parts[2]
+		switch {
+		case name == "date" && arg == "":
+			return now.Format("2006-01-02")
+		case name == "time" && arg == "":
+			return now.Format("15:04")
+		case name == "datetime" && arg == "":
+			return now.Format("2006-01-02 15:04")
+		case name == "user" && arg == "":
+			return username
+		case name == "prompt" && arg != "":
+			value, ok := values[arg]
+			if !ok && missing == nil {
+				missing = fmt.Errorf("%w: %s", ErrMissingTemplateValue, arg)
+			}
+			return value
+		}
+		return match
+	})
+	return result, missing
+}
+
+// templatePrompts возвращает имена переменных {{prompt:Имя}} без повторов
+func templatePrompts(text string) []string {
+	prompts := []string{}
+	seen := map[string]bool{}
+	for _, parts := range templateVariablePattern.FindAllStringSubmatch(text, -1) {
+		if strings.ToLower(parts[1]) == "prompt" && parts[2] != "" && !seen[parts[2]] {
+			seen[parts[2]] = true
+			prompts = append(prompts, parts[2])
+		}
+	}
+	return prompts
+}
+
+// localNow возвращает текущее время в часовом поясе timezone (по умолчанию UTC)
+func localNow(timezone string) (time.Time, error) {
+	if timezone == "" {
+		return time.Now().UTC(), nil
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, ErrInvalidTimezone
+	}
+	return time.Now().In(location), nil
+}
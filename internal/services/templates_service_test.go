@@ -0,0 +1,59 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	now := time.Date(2024, 3, 5, 9, 7, 0, 0, time.UTC)
+	values := map[string]string{"Тема": "Релиз", "Пусто": ""}
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr error
+	}{
+		{"без переменных", "Обычный текст", "Обычный текст", nil},
+		{"дата и время", "{{date}} {{time}} / {{datetime}}", "2024-03-05 09:07 / 2024-03-05 09:07", nil},
+		{"регистр и пробелы", "{{ DATE }} от {{User}}", "2024-03-05 от alice", nil},
+		{"prompt", "Встреча: {{prompt:Тема}}", "Встреча: Релиз", nil},
+		{"пробелы вокруг prompt", "{{ prompt : Тема }}", "Релиз", nil},
+		{"пустое значение", "[{{prompt:Пусто}}]", "[]", nil},
+		{"нет значения", "{{prompt:Место}} и {{prompt:Тема}}", " и Релиз", ErrMissingTemplateValue},
+		{"неизвестная переменная", "{{unknown}} {{date:x}}", "{{unknown}} {{date:x}}", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderTemplate(tt.text, now, "alice", values)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("renderTemplate() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("renderTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplatePrompts(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"без переменных", "{{date}} {{user}}", []string{}},
+		{"порядок появления", "{{prompt:Тема}}\n{{prompt:Место}}", []string{"Тема", "Место"}},
+		{"без повторов", "{{prompt:Тема}} {{ PROMPT : Тема }}", []string{"Тема"}},
+		{"prompt без имени", "{{prompt}}", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := templatePrompts(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("templatePrompts() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
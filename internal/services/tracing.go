@@ -0,0 +1,19 @@
+package services
+
+import (
+	"context"
+	"notes-api/internal/tracing"
+)
+
+// traceMethod начинает спан метода сервиса и на время метода подменяет ctx контекстом спана,
+// чтобы спаны запросов метода к базе данных и вложенных методов оказались внутри него.
+// Использование: defer traceMethod(&s.Ctx, "NoteService.GetNotes")()
+func traceMethod(ctx *context.Context, name string) func() {
+	parent := *ctx
+	spanCtx, span := tracing.Start(parent, name)
+	*ctx = spanCtx
+	return func() {
+		span.End()
+		*ctx = parent
+	}
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"notes-api/internal/models"
+)
+
+var (
+	ErrTransferNotFound = errors.New("предложение передачи не найдено")
+	ErrTeamNoteTransfer = errors.New("заметки команды нельзя передать пользователю")
+	ErrNotNoteOwner     = errors.New("передать заметку может только ее владелец")
+)
+
+const transferColumns = `t.id, t.note_id, n.title, t.from_user_id, fu.username, t.to_user_id, tu.username,
+	t.status, t.created_at, t.responded_at`
+
+const transferJoins = `
+	FROM note_transfers t
+	JOIN notes n ON n.id = t.note_id
+	JOIN users fu ON fu.id = t.from_user_id
+	JOIN users tu ON tu.id = t.to_user_id`
+
+func scanTransfer(row rowScanner) (models.NoteTransfer, error) {
+	var transfer models.NoteTransfer
+	err := row.Scan(&transfer.ID, &transfer.NoteID, &transfer.NoteTitle, &transfer.FromUserID, &transfer.FromUsername,
+		&transfer.ToUserID, &transfer.ToUsername, &transfer.Status, &transfer.CreatedAt, &transfer.RespondedAt)
+	return transfer, err
+}
+
+// TransferService предоставляет методы для передачи права владения заметками
+type TransferService struct {
+	DB     *sql.DB
+	Client models.ClientInfo // Клиент, выполняющий запрос; записывается в журнал аудита
+	Ctx    context.Context   // Контекст запроса: его отмена прерывает запросы к базе данных
+}
+
+// OfferTransfer предлагает пользователю стать владельцем заметки. Новое предложение заменяет
+// ожидающее ответа предложение по этой заметке.
+func (s *TransferService) OfferTransfer(noteID, ownerID int, request models.TransferNoteRequest) (models.NoteTransfer, error) {
+	var transfer models.NoteTransfer
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	note, err := noteService.requireNote(noteID, ownerID, models.PermissionOwner)
+	if err != nil {
+		return transfer, err
+	}
+	if note.TeamID != nil {
+		return transfer, ErrTeamNoteTransfer
+	}
+	if note.UserID != ownerID {
+		return transfer, ErrNotNoteOwner
+	}
+	invitationService := InvitationService{DB: s.DB, Ctx: s.Ctx}
+	recipientID, _, err := invitationService.resolveRecipient(models.ShareNoteRequest{UserID: request.UserID, Username: request.Username})
+	if err != nil {
+		return transfer, err
+	}
+	if recipientID == nil {
+		return transfer, ErrRecipientRequired
+	}
+	if *recipientID == ownerID {
+		return transfer, ErrShareWithOwner
+	}
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return transfer, err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(s.Ctx, `UPDATE note_transfers SET status = $1, responded_at = CURRENT_TIMESTAMP
+		WHERE note_id = $2 AND status = $3`, models.InvitationCancelled, noteID, models.InvitationPending)
+	if err != nil {
+		return transfer, err
+	}
+	var transferID int
+	err = tx.QueryRowContext(s.Ctx, `INSERT INTO note_transfers (note_id, from_user_id, to_user_id) VALUES ($1, $2, $3) RETURNING id`,
+		noteID, ownerID, *recipientID).Scan(&transferID)
+	if err != nil {
+		return transfer, err
+	}
+	if err := tx.Commit(); err != nil {
+		return transfer, err
+	}
+	audit(s.Ctx, s.DB, s.Client, ownerID, models.AuditNoteTransferOffered, models.AuditTargetNote, noteID,
+		map[string]int{"transfer_id": transferID, "to_user_id": *recipientID})
+	return s.getTransfer(transferID)
+}
+
+// GetTransfers возвращает входящие и исходящие предложения передачи, ожидающие ответа
+func (s *TransferService) GetTransfers(userID int) ([]models.NoteTransfer, error) {
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+transferColumns+transferJoins+`
+		WHERE (t.to_user_id = $1 OR t.from_user_id = $1) AND t.status = $2
+		ORDER BY t.created_at DESC`, userID, models.InvitationPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	transfers := []models.NoteTransfer{}
+	for rows.Next() {
+		transfer, err := scanTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, rows.Err()
+}
+
+// Respond принимает или отклоняет предложение. При принятии получатель становится владельцем,
+// а прежний владелец сохраняет доступ к заметке как редактор. Приглашения, которые прежний владелец
+// отправил и на которые еще не ответили, отменяются: новый владелец их не одобрял.
+func (s *TransferService) Respond(transferID, userID int, accept bool) (models.NoteTransfer, error) {
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return models.NoteTransfer{}, err
+	}
+	defer tx.Rollback()
+	var noteID, fromUserID int
+	err = tx.QueryRowContext(s.Ctx, `SELECT note_id, from_user_id FROM note_transfers
+		WHERE id = $1 AND to_user_id = $2 AND status = $3 FOR UPDATE`, transferID, userID, models.InvitationPending).
+		Scan(&noteID, &fromUserID)
+	if err == sql.ErrNoRows {
+		return models.NoteTransfer{}, ErrTransferNotFound
+	}
+	if err != nil {
+		return models.NoteTransfer{}, err
+	}
+	status := models.InvitationDeclined
+	if accept {
+		status = models.InvitationAccepted
+		// Заметка могла сменить владельца или перейти в команду после отправки предложения
+		res, err := tx.ExecContext(s.Ctx, `UPDATE notes SET user_id = $1, notebook_id = NULL
+			WHERE id = $2 AND user_id = $3 AND team_id IS NULL`, userID, noteID, fromUserID)
+		if err != nil {
+			return models.NoteTransfer{}, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return models.NoteTransfer{}, ErrTransferNotFound
+		}
+		if _, err := tx.ExecContext(s.Ctx, `DELETE FROM note_access WHERE note_id = $1 AND user_id = $2`, noteID, userID); err != nil {
+			return models.NoteTransfer{}, err
+		}
+		_, err = tx.ExecContext(s.Ctx, `INSERT INTO note_access (note_id, user_id, permission) VALUES ($1, $2, $3)
+			ON CONFLICT (note_id, user_id) DO UPDATE SET permission = EXCLUDED.permission`,
+			noteID, fromUserID, models.PermissionEditor)
+		if err != nil {
+			return models.NoteTransfer{}, err
+		}
+		_, err = tx.ExecContext(s.Ctx, `UPDATE note_invitations SET status = $1, responded_at = CURRENT_TIMESTAMP
+			WHERE note_id = $2 AND status = $3`, models.InvitationCancelled, noteID, models.InvitationPending)
+		if err != nil {
+			return models.NoteTransfer{}, err
+		}
+	}
+	_, err = tx.ExecContext(s.Ctx, `UPDATE note_transfers SET status = $1, responded_at = CURRENT_TIMESTAMP WHERE id = $2`, status, transferID)
+	if err != nil {
+		return models.NoteTransfer{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.NoteTransfer{}, err
+	}
+	action := models.AuditNoteTransferDeclined
+	if accept {
+		action = models.AuditNoteTransferAccepted
+	}
+	audit(s.Ctx, s.DB, s.Client, userID, action, models.AuditTargetNote, noteID,
+		map[string]int{"transfer_id": transferID, "from_user_id": fromUserID})
+	return s.getTransfer(transferID)
+}
+
+// Cancel отзывает предложение, пока получатель на него не ответил
+func (s *TransferService) Cancel(transferID, userID int) error {
+	res, err := s.DB.ExecContext(s.Ctx, `UPDATE note_transfers SET status = $1, responded_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND from_user_id = $3 AND status = $4`,
+		models.InvitationCancelled, transferID, userID, models.InvitationPending)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTransferNotFound
+	}
+	return nil
+}
+
+func (s *TransferService) getTransfer(transferID int) (models.NoteTransfer, error) {
+	return scanTransfer(s.DB.QueryRowContext(s.Ctx, `SELECT `+transferColumns+transferJoins+` WHERE t.id = $1`, transferID))
+}
@@ -1,28 +1,62 @@
 package services
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	_ "github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"notes-api/internal/config"
+	"notes-api/internal/metrics"
 	"notes-api/internal/models"
-	"os"
 	"strings"
 	"time"
 )
 
+// AccountDeletionGracePeriod - срок, в течение которого удаление аккаунта можно отменить
+const AccountDeletionGracePeriod = 30 * 24 * time.Hour
+
+// Политики для заметок, доступ к которым есть у других пользователей, при удалении аккаунта
+const (
+	SharedNotesTransfer = "transfer"
+	SharedNotesDelete   = "delete"
+)
+
+var (
+	ErrInvalidPassword          = errors.New("неверный пароль")
+	ErrInvalidSharedNotesPolicy = errors.New("политика для общих заметок должна быть transfer или delete")
+	ErrDeletionNotRequested     = errors.New("удаление аккаунта не запрошено")
+	ErrUserDisabled             = errors.New("учетная запись заблокирована")
+	ErrSessionRevoked           = errors.New("сессия завершена, войдите заново")
+	ErrEmailTaken               = errors.New("пользователь с таким email уже существует")
+	ErrNoEmail                  = errors.New("у аккаунта не указан email")
+	ErrEmailAlreadyVerified     = errors.New("email уже подтвержден")
+	ErrInvalidVerificationToken = errors.New("код подтверждения неверен или устарел")
+)
+
+// EmailVerificationTTL - срок действия кода подтверждения email
+const EmailVerificationTTL = 24 * time.Hour
+
 // UserService предоставляет методы для работы с пользователями
 type UserService struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Client models.ClientInfo // Клиент, выполняющий запрос; записывается в журнал аудита
+	Ctx    context.Context   // Контекст запроса: его отмена прерывает запросы к базе данных
+	SMTP   config.SMTPConfig // SMTP-сервер для писем с кодом подтверждения email
 }
 
 func (s *UserService) RegisterUser(user *models.User) error {
+	defer traceMethod(&s.Ctx, "UserService.RegisterUser")()
 	// Проверяем, существует ли уже пользователь с таким именем
 	var existingUser models.User
 	query := `SELECT id FROM users WHERE username = $1`
-	err := s.DB.QueryRow(query, user.Username).Scan(&existingUser.ID)
+	err := s.DB.QueryRowContext(s.Ctx, query, user.Username).Scan(&existingUser.ID)
 
 	if err == nil {
 		// Если err == nil, значит, пользователь с таким именем уже существует
@@ -32,6 +66,16 @@ func (s *UserService) RegisterUser(user *models.User) error {
 		return err
 	}
 
+	user.Email = normalizeEmail(user.Email)
+	if user.Email != "" {
+		err = s.DB.QueryRowContext(s.Ctx, `SELECT id FROM users WHERE LOWER(email) = $1`, user.Email).Scan(&existingUser.ID)
+		if err == nil {
+			return ErrEmailTaken
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+	}
+
 	// Если пользователя с таким именем не существует, продолжаем регистрацию
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -39,53 +83,351 @@ func (s *UserService) RegisterUser(user *models.User) error {
 	}
 	user.Password = string(hashedPassword)
 
-	query = `INSERT INTO users (username, password) VALUES ($1, $2) RETURNING id, created_at`
-	err = s.DB.QueryRow(query, user.Username, user.Password).Scan(&user.ID, &user.CreatedAt)
-	return err
+	query = `INSERT INTO users (username, password, email) VALUES ($1, $2, NULLIF($3, '')) RETURNING id, created_at`
+	err = s.DB.QueryRowContext(s.Ctx, query, user.Username, user.Password, user.Email).Scan(&user.ID, &user.CreatedAt)
+	if err != nil {
+		return err
+	}
+	audit(s.Ctx, s.DB, s.Client, user.ID, models.AuditUserRegistered, models.AuditTargetUser, user.ID, nil)
+	if user.Email == "" {
+		return nil
+	}
+	// Приглашения, отправленные на email до регистрации, переходят к пользователю только после подтверждения
+	// адреса: иначе чужие приглашения получил бы любой, кто зарегистрировался с этим email
+	if err := s.SendEmailVerification(user.ID); err != nil {
+		slog.WarnContext(s.Ctx, "Не удалось отправить письмо с подтверждением email", "error", err)
+	}
+	return nil
 }
 
-func (s *UserService) LoginUser(user *models.User) (string, error) {
+// SendEmailVerification отправляет на email пользователя код подтверждения. Прежние коды перестают действовать.
+func (s *UserService) SendEmailVerification(userID int) error {
+	defer traceMethod(&s.Ctx, "UserService.SendEmailVerification")()
+	var email string
+	var verified bool
+	err := s.DB.QueryRowContext(s.Ctx, `SELECT COALESCE(email, ''), email_verified_at IS NOT NULL FROM users WHERE id = $1`,
+		userID).Scan(&email, &verified)
+	if err != nil {
+		return err
+	}
+	if email == "" {
+		return ErrNoEmail
+	}
+	if verified {
+		return ErrEmailAlreadyVerified
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(buf)
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(s.Ctx, `DELETE FROM email_verifications WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(s.Ctx, `INSERT INTO email_verifications (token_hash, user_id, email, expires_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP + $4::int * INTERVAL '1 second')`,
+		hashVerificationToken(token), userID, email, int(EmailVerificationTTL.Seconds()))
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	body := "Чтобы подтвердить адрес, передайте этот код в POST /verify-email:\n\n" + token +
+		"\n\nКод действует 24 часа. Если вы не регистрировались, просто удалите это письмо.\n"
+	return sendMail(s.SMTP, email, "Подтверждение email", body)
+}
+
+// VerifyEmail подтверждает email по коду из письма и передает пользователю приглашения,
+// отправленные на этот адрес. Код действует, только пока email пользователя не изменился.
+func (s *UserService) VerifyEmail(token string) error {
+	defer traceMethod(&s.Ctx, "UserService.VerifyEmail")()
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var userID int
+	var email string
+	err = tx.QueryRowContext(s.Ctx, `DELETE FROM email_verifications
+		WHERE token_hash = $1 AND expires_at > CURRENT_TIMESTAMP RETURNING user_id, email`,
+		hashVerificationToken(token)).Scan(&userID, &email)
+	if err == sql.ErrNoRows {
+		return ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(s.Ctx, `UPDATE users SET email_verified_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND LOWER(email) = LOWER($2) AND email_verified_at IS NULL`, userID, email)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInvalidVerificationToken
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	audit(s.Ctx, s.DB, s.Client, userID, models.AuditUserEmailVerified, models.AuditTargetUser, userID, nil)
+	invitationService := InvitationService{DB: s.DB, Ctx: s.Ctx}
+	return invitationService.AttachEmailInvitations(userID, email)
+}
+
+// hashVerificationToken возвращает хеш кода подтверждения, под которым он хранится в базе данных
+func hashVerificationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoginUser проверяет учетные данные и возвращает токен, подписанный ключом secret
+func (s *UserService) LoginUser(user *models.User, secret []byte) (string, error) {
+	defer traceMethod(&s.Ctx, "UserService.LoginUser")()
 	user.Username = strings.TrimSpace(user.Username)
 	user.Password = strings.TrimSpace(user.Password)
 	if user.Username == "" || user.Password == "" {
 		return "", errors.New("имя пользователя и пароль не могут быть пустыми")
 	}
 	var storedUser models.User
-	query := `SELECT id, password, created_at FROM users WHERE username = $1`
-	err := s.DB.QueryRow(query, user.Username).Scan(&storedUser.ID, &storedUser.Password, &storedUser.CreatedAt)
+	var disabledAt *time.Time
+	var tokenVersion int
+	query := `SELECT id, password, created_at, disabled_at, token_version FROM users WHERE username = $1`
+	err := s.DB.QueryRowContext(s.Ctx, query, user.Username).Scan(&storedUser.ID, &storedUser.Password, &storedUser.CreatedAt,
+		&disabledAt, &tokenVersion)
 	if err != nil {
 		if err == sql.ErrNoRows {
+			metrics.Logins.WithLabelValues("failure").Inc()
+			audit(s.Ctx, s.DB, s.Client, 0, models.AuditUserLoginFailed, models.AuditTargetUser, 0,
+				map[string]string{"username": user.Username, "reason": "unknown_user"})
 			return "", errors.New("неверные учетные данные")
 		}
 		return "", err
 	}
 	if err := bcrypt.CompareHashAndPassword([]byte(storedUser.Password), []byte(user.Password)); err != nil {
-		fmt.Printf("Error comparing passwords: %v\n", err)
+		metrics.Logins.WithLabelValues("failure").Inc()
+		audit(s.Ctx, s.DB, s.Client, 0, models.AuditUserLoginFailed, models.AuditTargetUser, storedUser.ID,
+			map[string]string{"username": user.Username, "reason": "invalid_password"})
 		return "", errors.New("неверные пароль")
 	}
-	token, err := generateJWT(storedUser.ID)
+	if disabledAt != nil {
+		metrics.Logins.WithLabelValues("failure").Inc()
+		audit(s.Ctx, s.DB, s.Client, 0, models.AuditUserLoginFailed, models.AuditTargetUser, storedUser.ID,
+			map[string]string{"username": user.Username, "reason": "disabled"})
+		return "", ErrUserDisabled
+	}
+	token, err := generateJWT(secret, storedUser.ID, tokenVersion)
 	if err != nil {
 		return "", err
 	}
+	metrics.Logins.WithLabelValues("success").Inc()
+	audit(s.Ctx, s.DB, s.Client, storedUser.ID, models.AuditUserLogin, models.AuditTargetUser, storedUser.ID, nil)
 	return token, nil
 }
 
 func (s *UserService) GetUserByID(userID int) (models.UserProfile, error) {
+	defer traceMethod(&s.Ctx, "UserService.GetUserByID")()
 	var user models.UserProfile
-	query := `SELECT id, username, created_at FROM users WHERE id = $1`
-	err := s.DB.QueryRow(query, userID).Scan(&user.ID, &user.Username, &user.CreatedAt)
+	query := `SELECT id, username, COALESCE(email, ''), email_verified_at IS NOT NULL, created_at, deletion_scheduled_at
+		FROM users WHERE id = $1`
+	err := s.DB.QueryRowContext(s.Ctx, query, userID).Scan(&user.ID, &user.Username, &user.Email, &user.EmailVerified,
+		&user.CreatedAt, &user.DeletionScheduledAt)
 	if err != nil {
 		return user, err
 	}
 	return user, nil
 }
 
-// generateJWT генерирует JWT для пользователя
-func generateJWT(userID int) (string, error) {
+// ValidateSession проверяет, что пользователь существует, не заблокирован и токен поколения tokenVersion
+// не был отозван: принудительный выход и сброс пароля увеличивают номер поколения пользователя
+func (s *UserService) ValidateSession(userID, tokenVersion int) error {
+	defer traceMethod(&s.Ctx, "UserService.ValidateSession")()
+	var disabled, revoked bool
+	query := `SELECT disabled_at IS NOT NULL, token_version <> $2 FROM users WHERE id = $1`
+	err := s.DB.QueryRowContext(s.Ctx, query, userID, tokenVersion).Scan(&disabled, &revoked)
+	if err == sql.ErrNoRows {
+		return ErrSessionRevoked
+	}
+	if err != nil {
+		return err
+	}
+	if disabled {
+		return ErrUserDisabled
+	}
+	if revoked {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+// CheckPassword сверяет пароль с сохраненным хешем пользователя
+func (s *UserService) CheckPassword(userID int, password string) error {
+	defer traceMethod(&s.Ctx, "UserService.CheckPassword")()
+	var hash string
+	err := s.DB.QueryRowContext(s.Ctx, `SELECT password FROM users WHERE id = $1`, userID).Scan(&hash)
+	if err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+// RequestAccountDeletion планирует удаление аккаунта по истечении AccountDeletionGracePeriod
+func (s *UserService) RequestAccountDeletion(userID int, password, sharedNotesPolicy string) (time.Time, error) {
+	defer traceMethod(&s.Ctx, "UserService.RequestAccountDeletion")()
+	if sharedNotesPolicy == "" {
+		sharedNotesPolicy = SharedNotesTransfer
+	}
+	if sharedNotesPolicy != SharedNotesTransfer && sharedNotesPolicy != SharedNotesDelete {
+		return time.Time{}, ErrInvalidSharedNotesPolicy
+	}
+	if err := s.CheckPassword(userID, password); err != nil {
+		return time.Time{}, err
+	}
+	scheduledAt := time.Now().Add(AccountDeletionGracePeriod)
+	query := `UPDATE users SET deletion_scheduled_at = $1, deletion_shared_policy = $2 WHERE id = $3`
+	if _, err := s.DB.ExecContext(s.Ctx, query, scheduledAt, sharedNotesPolicy, userID); err != nil {
+		return time.Time{}, err
+	}
+	audit(s.Ctx, s.DB, s.Client, userID, models.AuditUserDeletionRequest, models.AuditTargetUser, userID,
+		map[string]interface{}{"shared_notes_policy": sharedNotesPolicy, "scheduled_at": scheduledAt})
+	return scheduledAt, nil
+}
+
+// CancelAccountDeletion отменяет запрошенное удаление аккаунта
+func (s *UserService) CancelAccountDeletion(userID int) error {
+	defer traceMethod(&s.Ctx, "UserService.CancelAccountDeletion")()
+	query := `UPDATE users SET deletion_scheduled_at = NULL, deletion_shared_policy = NULL
+		WHERE id = $1 AND deletion_scheduled_at IS NOT NULL`
+	res, err := s.DB.ExecContext(s.Ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDeletionNotRequested
+	}
+	audit(s.Ctx, s.DB, s.Client, userID, models.AuditUserDeletionCancel, models.AuditTargetUser, userID, nil)
+	return nil
+}
+
+// PurgeDeletedAccounts окончательно удаляет аккаунты, срок отмены удаления которых истек
+func (s *UserService) PurgeDeletedAccounts() (int, error) {
+	defer traceMethod(&s.Ctx, "UserService.PurgeDeletedAccounts")()
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT id, deletion_shared_policy FROM users
+		WHERE deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= CURRENT_TIMESTAMP`)
+	if err != nil {
+		return 0, err
+	}
+	type pending struct {
+		userID int
+		policy string
+	}
+	var users []pending
+	for rows.Next() {
+		var p pending
+		var policy sql.NullString
+		if err := rows.Scan(&p.userID, &policy); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		p.policy = policy.String
+		users = append(users, p)
+	}
+	rows.Close()
+	purged := 0
+	for _, p := range users {
+		if err := s.purgeAccount(p.userID, p.policy); err != nil {
+			return purged, fmt.Errorf("не удалось удалить аккаунт %d: %w", p.userID, err)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// purgeAccount удаляет пользователя, предварительно передав общие заметки другим пользователям,
+// если выбрана политика transfer. Новым владельцем становится первый из пользователей с доступом.
+// Заметки и блокноты команд остаются команде при любой политике.
+func (s *UserService) purgeAccount(userID int, policy string) error {
+	tx, err := s.DB.BeginTx(s.Ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := reassignTeamContent(s.Ctx, tx, userID); err != nil {
+		return err
+	}
+	if policy != SharedNotesDelete {
+		// Передаем заметки наследникам; новому владельцу отдельная запись о доступе больше не нужна
+		_, err = tx.ExecContext(s.Ctx, `
+			WITH heirs AS (
+				SELECT na.note_id, MIN(na.user_id) AS user_id
+				FROM note_access na
+				JOIN notes n ON n.id = na.note_id
+				WHERE n.user_id = $1 AND n.team_id IS NULL
+				GROUP BY na.note_id
+			), moved AS (
+				UPDATE notes n SET user_id = h.user_id
+				FROM heirs h
+				WHERE n.id = h.note_id
+				RETURNING n.id, n.user_id
+			)
+			DELETE FROM note_access na USING moved m
+			WHERE na.note_id = m.id AND na.user_id = m.user_id`, userID)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(s.Ctx, `DELETE FROM users WHERE id = $1`, userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	audit(s.Ctx, s.DB, s.Client, 0, models.AuditUserPurged, models.AuditTargetUser, userID,
+		map[string]string{"shared_notes_policy": policy})
+	return nil
+}
+
+// reassignTeamContent записывает заметки и блокноты команд, созданные пользователем, на другого участника
+// команды - владельца, затем администратора, затем участника, - чтобы удаление пользователя не удалило их
+// каскадом. Доступ к ним от этого не меняется: он определяется ролями в команде. Заметки команд,
+// в которых кроме пользователя никого нет, удаляются вместе с ним.
+func reassignTeamContent(ctx context.Context, tx *sql.Tx, userID int) error {
+	heirs := `
+		SELECT DISTINCT ON (tm.team_id) tm.team_id, tm.user_id
+		FROM team_members tm
+		WHERE tm.user_id <> $1
+		ORDER BY tm.team_id, CASE tm.role WHEN $2 THEN 0 WHEN $3 THEN 1 WHEN $4 THEN 2 ELSE 3 END, tm.created_at`
+	for _, table := range []string{"notes", "notebooks"} {
+		_, err := tx.ExecContext(ctx, `UPDATE `+table+` t SET user_id = h.user_id FROM (`+heirs+`) h
+			WHERE t.user_id = $1 AND t.team_id = h.team_id`,
+			userID, models.TeamRoleOwner, models.TeamRoleAdmin, models.TeamRoleMember)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeEmail приводит email к виду, в котором он хранится и сравнивается
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// generateJWT генерирует JWT для пользователя, подписанный ключом secret; tokenVersion - текущее поколение его токенов
+func generateJWT(secret []byte, userID, tokenVersion int) (string, error) {
 	claims := jwt.MapClaims{
 		"sub": userID,
+		"ver": tokenVersion,
+		"iat": time.Now().Unix(),
 		"exp": time.Now().Add(time.Hour * 24).Unix(), // Токен действителен 24 часа
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return token.SignedString(secret)
 }
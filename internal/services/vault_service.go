@@ -0,0 +1,487 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/url"
+	"notes-api/internal/models"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Ограничения импорта архива с заметками
+const (
+	MaxImportSize     = 50 << 20 // Наибольший размер загружаемого архива
+	maxImportFiles    = 5000     // Наибольшее число заметок в архиве
+	maxImportFileSize = 5 << 20  // Наибольший размер одного файла заметки
+	// Наибольший объем распакованных данных всего архива: сильно сжатые файлы не должны занять всю память
+	maxImportUnpackedSize = 200 << 20
+)
+
+var (
+	ErrInvalidArchive       = errors.New("файл должен быть ZIP-архивом")
+	ErrArchiveTooLarge      = errors.New("слишком большой архив")
+	ErrInvalidDuplicateMode = errors.New("on_duplicate должен быть skip, overwrite или keep")
+)
+
+// VaultService выгружает заметки пользователя в ZIP-архив Markdown-файлов и загружает их обратно.
+// Импорт понимает как собственные архивы, так и хранилища Obsidian.
+type VaultService struct {
+	DB     *sql.DB
+	Client models.ClientInfo // Клиент, выполняющий запрос; записывается в журнал аудита
+	Ctx    context.Context   // Контекст запроса: его отмена прерывает запросы к базе данных
+}
+
+// frontMatter - YAML-заголовок Markdown-файла заметки
+type frontMatter struct {
+	ID          int             `yaml:"id,omitempty"`
+	Title       string          `yaml:"title"`
+	Tags        frontMatterTags `yaml:"tags"`
+	Notebook    string          `yaml:"notebook,omitempty"`
+	Format      string          `yaml:"format,omitempty"`
+	Created     string          `yaml:"created,omitempty"`
+	Updated     string          `yaml:"updated,omitempty"`
+	Due         string          `yaml:"due,omitempty"`
+	Pinned      bool            `yaml:"pinned,omitempty"`
+	Archived    bool            `yaml:"archived,omitempty"`
+	Attachments []string        `yaml:"attachments,omitempty"` // Пути вложений от корня архива
+}
+
+// frontMatterTags - теги из заголовка. Obsidian допускает как список, так и строку через запятую или пробел.
+// nil означает, что ключа tags в заголовке нет.
+type frontMatterTags []string
+
+func (t *frontMatterTags) UnmarshalYAML(value *yaml.Node) error {
+	var tags []string
+	switch value.Kind {
+	case yaml.SequenceNode:
+		if err := value.Decode(&tags); err != nil {
+			return err
+		}
+	case yaml.ScalarNode:
+		tags = strings.FieldsFunc(value.Value, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	default:
+		return errors.New("tags должен быть списком или строкой")
+	}
+	*t = append(frontMatterTags{}, tags...)
+	return nil
+}
+
+// Export собирает ZIP-архив с личными заметками пользователя: по Markdown-файлу на заметку
+// с YAML-заголовком, заметки блокнотов - в папках с именами блокнотов. Вложения сохраняются
+// в папку attachments, ссылки на них в тексте заменяются путями внутри архива. Архив записывается в w
+// по мере чтения заметок и целиком в памяти не хранится.
+func (s *VaultService) Export(userID int, w io.Writer) error {
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT `+noteColumns+` FROM notes n WHERE n.user_id = $1 AND n.team_id IS NULL ORDER BY n.id`, userID)
+	if err != nil {
+		return err
+	}
+	notes, err := scanNotes(rows)
+	if err != nil {
+		return err
+	}
+	notebooks, err := personalNotebooks(s.Ctx, s.DB, userID)
+	if err != nil {
+		return err
+	}
+	notebookNames := map[int]string{}
+	for name, id := range notebooks {
+		notebookNames[id] = name
+	}
+	noteService := NoteService{DB: s.DB, Ctx: s.Ctx}
+	zw := zip.NewWriter(w)
+	used := map[string]bool{}
+	for _, note := range notes {
+		if note.Tags, err = noteService.GetTagsForNote(note.ID); err != nil {
+			return err
+		}
+		meta := frontMatter{
+			ID: note.ID, Title: note.Title, Tags: frontMatterTags{}, Format: note.ContentFormat,
+			Created: note.CreatedAt.Format(time.RFC3339), Updated: note.UpdatedAt.Format(time.RFC3339),
+			Pinned: note.Pinned, Archived: note.Archived,
+		}
+		for _, tag := range note.Tags {
+			meta.Tags = append(meta.Tags, tag.Name)
+		}
+		if note.DueAt != nil {
+			meta.Due = note.DueAt.Format(time.RFC3339)
+		}
+		dir := ""
+		if note.NotebookID != nil && notebookNames[*note.NotebookID] != "" {
+			meta.Notebook = notebookNames[*note.NotebookID]
+			dir = fileName(meta.Notebook) + "/"
+		}
+		content, err := s.exportAttachments(zw, note, &meta)
+		if err != nil {
+			return err
+		}
+		header, err := yaml.Marshal(meta)
+		if err != nil {
+			return err
+		}
+		file, err := zw.Create(uniqueFileName(used, dir, fileName(note.Title), ".md"))
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(file, "---\n%s---\n\n%s", header, content); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	audit(s.Ctx, s.DB, s.Client, userID, models.AuditNotesExported, models.AuditTargetUser, userID,
+		map[string]int{"notes": len(notes)})
+	return nil
+}
+
+// exportAttachments записывает вложения заметки в архив и возвращает текст со ссылками на них
+func (s *VaultService) exportAttachments(zw *zip.Writer, note models.Note, meta *frontMatter) (string, error) {
+	rows, err := s.DB.QueryContext(s.Ctx, `SELECT id, filename, data FROM note_attachments WHERE note_id = $1 ORDER BY id`, note.ID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	content := note.Content
+	for rows.Next() {
+		var id int
+		var name string
+		var data []byte
+		if err := rows.Scan(&id, &name, &data); err != nil {
+			return "", err
+		}
+		filePath := fmt.Sprintf("attachments/%d-%s", id, fileName(name))
+		w, err := zw.Create(filePath)
+		if err != nil {
+			return "", err
+		}
+		if _, err := w.Write(data); err != nil {
+			return "", err
+		}
+		meta.Attachments = append(meta.Attachments, filePath)
+		content = strings.ReplaceAll(content, "("+attachmentURL(id)+")", "("+(&url.URL{Path: filePath}).EscapedPath()+")")
+	}
+	return content, rows.Err()
+}
+
+// Import загружает заметки из ZIP-архива. Блокноты восстанавливаются по заголовку notebook или по папкам,
+// теги - по заголовку tags или, если его нет, по #тегам в тексте, вложения - по заголовку attachments
+// и ссылкам на файлы архива.
+func (s *VaultService) Import(userID int, archive []byte, options models.ImportOptions) (models.ImportReport, error) {
+	if _, err := validImportOptions(options); err != nil {
+		return models.ImportReport{}, err
+	}
+	entries, ignored, err := parseVault(archive)
+	if err != nil {
+		return models.ImportReport{}, err
+	}
+	imp, err := newImporter(s.Ctx, s.DB, s.Client, userID, options)
+	if err != nil {
+		return models.ImportReport{}, err
+	}
+	imp.report.Ignored = ignored
+	for _, entry := range entries {
+		imp.add(entry)
+	}
+	return imp.finish(), nil
+}
+
+var (
+	markdownLinkPattern = regexp.MustCompile(`(!?\[[^\]]*\]\()([^)\s]+)\)`)
+	wikiEmbedPattern    = regexp.MustCompile(`!\[\[([^\]|#]+)(?:\|[^\]]*)?\]\]`)
+)
+
+// parseVault читает заметки из собственного архива или хранилища Obsidian. Возвращает также
+// файлы архива, которые не являются заметками и не прикреплены ни к одной из них.
+func parseVault(archive []byte) ([]importEntry, []string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, nil, ErrInvalidArchive
+	}
+	unpack := newZipUnpacker()
+	root := vaultRoot(zr.File)
+	files := map[string]*zip.File{}
+	byBase := map[string]string{}
+	var notes []string
+	for _, f := range zr.File {
+		name := strings.TrimPrefix(f.Name, root)
+		if f.FileInfo().IsDir() || !strings.HasPrefix(f.Name, root) || hiddenPath(name) {
+			continue
+		}
+		files[name] = f
+		if isNoteFile(name) {
+			notes = append(notes, name)
+		} else if _, ok := byBase[path.Base(name)]; !ok {
+			byBase[path.Base(name)] = name
+		}
+	}
+	if len(notes) > maxImportFiles {
+		return nil, nil, ErrTooManyNotes
+	}
+	attached := map[string]bool{}
+	entries := make([]importEntry, 0, len(notes))
+	for _, name := range notes {
+		entry := importEntry{path: root + name}
+		meta, content, err := readNoteFile(unpack, files[name])
+		if unpack.exhausted {
+			return nil, nil, ErrArchiveTooLarge
+		}
+		if err != nil {
+			entry.err = err
+			entries = append(entries, entry)
+			continue
+		}
+		entry.id, entry.title, entry.notebook = meta.ID, meta.Title, meta.Notebook
+		if entry.title == "" {
+			entry.title = strings.TrimSuffix(path.Base(name), path.Ext(name))
+		}
+		if entry.notebook == "" && path.Dir(name) != "." {
+			entry.notebook = path.Dir(name)
+		}
+		if meta.Tags != nil {
+			entry.tags = meta.Tags
+		} else {
+			entry.tags = inlineTags(content)
+		}
+		entry.format = meta.Format
+		if entry.format == "" {
+			entry.format = models.ContentMarkdown
+			if strings.EqualFold(path.Ext(name), ".txt") {
+				entry.format = models.ContentPlain
+			}
+		}
+		entry.created, entry.updated, entry.due = parseImportTime(meta.Created), parseImportTime(meta.Updated), parseImportTime(meta.Due)
+		entry.pinned, entry.archived = meta.Pinned, meta.Archived
+
+		// Вложения нумеруются в порядке появления, ссылки на них заменяются на (attachment:N)
+		indexes := map[string]int{}
+		attach := func(filePath string) string {
+			index, ok := indexes[filePath]
+			if !ok {
+				index = len(entry.attachments)
+				indexes[filePath] = index
+				data, err := unpack.read(files[filePath], maxAttachmentSize)
+				if err != nil && entry.err == nil {
+					entry.err = err
+				}
+				entry.attachments = append(entry.attachments, importAttachment{name: path.Base(filePath), data: data})
+				attached[filePath] = true
+			}
+			return fmt.Sprintf("attachment:%d", index)
+		}
+		content = markdownLinkPattern.ReplaceAllStringFunc(content, func(link string) string {
+			match := markdownLinkPattern.FindStringSubmatch(link)
+			filePath, ok := resolveVaultPath(files, path.Dir(name), match[2])
+			if !ok {
+				return link
+			}
+			return match[1] + attach(filePath) + ")"
+		})
+		content = wikiEmbedPattern.ReplaceAllStringFunc(content, func(embed string) string {
+			target := strings.TrimSpace(wikiEmbedPattern.FindStringSubmatch(embed)[1])
+			filePath, ok := target, files[target] != nil && !isNoteFile(target)
+			if !ok {
+				filePath, ok = byBase[path.Base(target)]
+			}
+			if !ok {
+				return embed
+			}
+			return "![" + path.Base(filePath) + "](" + attach(filePath) + ")"
+		})
+		for _, filePath := range meta.Attachments {
+			if files[filePath] != nil && !isNoteFile(filePath) {
+				attach(filePath)
+			}
+		}
+		if unpack.exhausted {
+			return nil, nil, ErrArchiveTooLarge
+		}
+		entry.content = content
+		entries = append(entries, entry)
+	}
+	ignored := []string{}
+	for _, f := range zr.File {
+		name := strings.TrimPrefix(f.Name, root)
+		if files[name] == f && !isNoteFile(name) && !attached[name] {
+			ignored = append(ignored, f.Name)
+		}
+	}
+	return entries, ignored, nil
+}
+
+// resolveVaultPath ищет файл архива, на который ссылается Markdown-ссылка: путь от корня архива
+// или от папки заметки. Внешние ссылки и ссылки на другие заметки не считаются вложениями.
+func resolveVaultPath(files map[string]*zip.File, dir, target string) (string, bool) {
+	if strings.Contains(target, "://") || strings.HasPrefix(target, "/") || strings.HasPrefix(target, "#") {
+		return "", false
+	}
+	if unescaped, err := url.PathUnescape(target); err == nil {
+		target = unescaped
+	}
+	for _, candidate := range []string{path.Clean(target), path.Join(dir, target)} {
+		if files[candidate] != nil && !isNoteFile(candidate) {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+func isNoteFile(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md", ".markdown", ".txt":
+		return true
+	}
+	return false
+}
+
+// zipUnpacker распаковывает файлы импортируемого архива. Каждый файл распаковывается один раз,
+// даже если на него ссылаются несколько заметок, а общий объем распакованных данных не превышает
+// maxImportUnpackedSize. После превышения exhausted становится true и импорт архива прерывается.
+type zipUnpacker struct {
+	remaining int64
+	exhausted bool
+	files     map[string]unpackedFile
+}
+
+type unpackedFile struct {
+	data []byte
+	err  error
+}
+
+func newZipUnpacker() *zipUnpacker {
+	return &zipUnpacker{remaining: maxImportUnpackedSize, files: map[string]unpackedFile{}}
+}
+
+// read возвращает содержимое файла архива, если его размер не превышает limit
+func (u *zipUnpacker) read(f *zip.File, limit int) ([]byte, error) {
+	if file, ok := u.files[f.Name]; ok {
+		return file.data, file.err
+	}
+	data, err := u.unpack(f, limit)
+	u.files[f.Name] = unpackedFile{data: data, err: err}
+	return data, err
+}
+
+func (u *zipUnpacker) unpack(f *zip.File, limit int) ([]byte, error) {
+	if u.exhausted {
+		return nil, ErrArchiveTooLarge
+	}
+	if f.UncompressedSize64 > uint64(limit) {
+		return nil, ErrArchiveTooLarge
+	}
+	// Размер из заголовка архива может быть занижен, поэтому читается не больше, чем осталось в бюджете
+	readLimit := min(int64(limit), u.remaining)
+	r, err := f.Open()
+	if err != nil {
+		return nil, ErrInvalidArchive
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, readLimit+1))
+	u.remaining -= int64(len(data))
+	if err != nil {
+		return nil, ErrInvalidArchive
+	}
+	if int64(len(data)) > readLimit {
+		if readLimit < int64(limit) {
+			u.exhausted = true
+		}
+		return nil, ErrArchiveTooLarge
+	}
+	return data, nil
+}
+
+// readNoteFile читает файл заметки из архива и отделяет YAML-заголовок от текста
+func readNoteFile(unpack *zipUnpacker, f *zip.File) (frontMatter, string, error) {
+	var meta frontMatter
+	data, err := unpack.read(f, maxImportFileSize)
+	if err != nil {
+		return meta, "", err
+	}
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	lines := strings.SplitAfter(text, "\n")
+	if strings.TrimRight(lines[0], "\r\n") != "---" {
+		return meta, text, nil
+	}
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimRight(lines[i], "\r\n") != "---" {
+			continue
+		}
+		if err := yaml.Unmarshal([]byte(strings.Join(lines[1:i], "")), &meta); err != nil {
+			return meta, "", fmt.Errorf("некорректный YAML-заголовок: %w", err)
+		}
+		body := strings.Join(lines[i+1:], "")
+		if strings.HasPrefix(body, "\r\n") {
+			return meta, body[2:], nil
+		}
+		return meta, strings.TrimPrefix(body, "\n"), nil
+	}
+	// Незакрытый заголовок считаем частью текста
+	return meta, text, nil
+}
+
+// vaultRoot возвращает папку хранилища Obsidian внутри архива (по папке .obsidian) или пустую строку
+func vaultRoot(files []*zip.File) string {
+	for _, f := range files {
+		if i := strings.Index(f.Name, ".obsidian/"); i >= 0 && (i == 0 || f.Name[i-1] == '/') {
+			return f.Name[:i]
+		}
+	}
+	return ""
+}
+
+// hiddenPath проверяет, что файл лежит в служебной папке: .obsidian, .trash, __MACOSX и т.п.
+func hiddenPath(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+var inlineTagPattern = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_][\p{L}\p{N}_/-]*)`)
+
+// inlineTags возвращает #теги из текста заметки. Как и в Obsidian, тег из одних цифр тегом не считается.
+func inlineTags(content string) []string {
+	var tags []string
+	for _, match := range inlineTagPattern.FindAllStringSubmatch(content, -1) {
+		if strings.IndexFunc(match[1], func(r rune) bool { return !unicode.IsDigit(r) }) >= 0 {
+			tags = append(tags, match[1])
+		}
+	}
+	return tags
+}
+
+var fileNameInvalid = regexp.MustCompile(`[/\\:*?"<>|\x00-\x1f]+`)
+
+// fileName готовит заголовок заметки или имя блокнота для использования в качестве имени файла.
+// В отличие от slugify сохраняет регистр и пробелы, чтобы ссылки [[Заголовок]] работали в Obsidian.
+func fileName(title string) string {
+	name := strings.Trim(fileNameInvalid.ReplaceAllString(title, "-"), " .")
+	if r := []rune(name); len(r) > 100 {
+		name = strings.TrimSpace(string(r[:100]))
+	}
+	if name == "" {
+		name = "note"
+	}
+	return name
+}
+
+// uniqueFileName добавляет к имени номер, если файл с таким именем в архиве уже есть
+func uniqueFileName(used map[string]bool, dir, name, ext string) string {
+	candidate := dir + name + ext
+	for i := 2; used[strings.ToLower(candidate)]; i++ {
+		candidate = fmt.Sprintf("%s%s (%d)%s", dir, name, i, ext)
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"notes-api/internal/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// archiveFile - файл тестового архива
+type archiveFile struct {
+	name string
+	body string
+}
+
+// zipArchive собирает ZIP-архив из файлов в заданном порядке
+func zipArchive(t *testing.T, files ...archiveFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := zw.Create(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(file.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// writeRawFile добавляет в архив файл из size нулевых байт, указывая в заголовке размер headerSize.
+// Сжатые данные передаются готовыми, чтобы не сжимать одно и то же содержимое много раз.
+func writeRawFile(t *testing.T, zw *zip.Writer, name string, compressed []byte, size, headerSize int) {
+	t.Helper()
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               name,
+		Method:             zip.Deflate,
+		CRC32:              crc32.ChecksumIEEE(make([]byte, size)),
+		CompressedSize64:   uint64(len(compressed)),
+		UncompressedSize64: uint64(headerSize),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(compressed); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// deflateZeros сжимает size нулевых байт
+func deflateZeros(t *testing.T, size int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write(make([]byte, size)); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseVault(t *testing.T) {
+	date := func(year int, month time.Month, day, hour, minute, second int) *time.Time {
+		value := time.Date(year, month, day, hour, minute, second, 0, time.UTC)
+		return &value
+	}
+	tests := []struct {
+		name        string
+		files       []archiveFile
+		want        []importEntry
+		wantIgnored []string
+	}{
+		{
+			name: "собственный архив",
+			files: []archiveFile{{"Работа/План.md", "---\nid: 7\ntitle: План на квартал\ntags: [work, q1]\nnotebook: Проекты\n" +
+				"format: markdown\ncreated: 2024-01-02T03:04:05Z\nupdated: 2024-01-03\ndue: 2024-02-01 10:00\n" +
+				"pinned: true\narchived: true\n---\nТекст #ignored\n"}},
+			want: []importEntry{{
+				path: "Работа/План.md", id: 7, title: "План на квартал", notebook: "Проекты", tags: []string{"work", "q1"},
+				format: models.ContentMarkdown, content: "Текст #ignored\n", created: date(2024, 1, 2, 3, 4, 5),
+				updated: date(2024, 1, 3, 0, 0, 0), due: date(2024, 2, 1, 10, 0, 0), pinned: true, archived: true,
+			}},
+			wantIgnored: []string{},
+		},
+		{
+			name: "хранилище Obsidian",
+			files: []archiveFile{
+				{"vault/.obsidian/app.json", "{}"},
+				{"vault/.trash/Старое.md", "удалено"},
+				{"__MACOSX/vault/._Покупки.md", "служебный файл"},
+				{"vault/Дом/Покупки.md", "молоко #дом #дела/срочно #2024\n"},
+				{"vault/заметка.txt", "просто текст"},
+				{"vault/readme.pdf", "%PDF"},
+			},
+			want: []importEntry{
+				{path: "vault/Дом/Покупки.md", title: "Покупки", notebook: "Дом", tags: []string{"дом", "дела/срочно"},
+					format: models.ContentMarkdown, content: "молоко #дом #дела/срочно #2024\n"},
+				{path: "vault/заметка.txt", title: "заметка", format: models.ContentPlain, content: "просто текст"},
+			},
+			wantIgnored: []string{"vault/readme.pdf"},
+		},
+		{
+			name:  "теги строкой, BOM и CRLF",
+			files: []archiveFile{{"a.md", "\ufeff---\r\ntitle: A\r\ntags: a, b c\r\n---\r\n\r\nтекст"}},
+			want: []importEntry{{path: "a.md", title: "A", tags: []string{"a", "b", "c"}, format: models.ContentMarkdown,
+				content: "текст"}},
+			wantIgnored: []string{},
+		},
+		{
+			name:  "незакрытый заголовок",
+			files: []archiveFile{{"a.md", "---\ntitle: A\n"}},
+			want: []importEntry{{path: "a.md", title: "a", format: models.ContentMarkdown,
+				content: "---\ntitle: A\n"}},
+			wantIgnored: []string{},
+		},
+		{
+			name: "вложения",
+			files: []archiveFile{
+				{"img/cat.png", "PNG"},
+				{"Заметки/a.md", "![кот](../img/cat.png) ![[cat.png]] ![[cat.png|100]] [док](https://example.com/doc.pdf) [[b]]"},
+				{"b.md", "---\nattachments:\n  - files/doc%.pdf\n  - b.md\n  - missing.png\n---\n![](img/cat.png)"},
+				{"files/doc%.pdf", "PDF"},
+				{"files/unused.bin", "BIN"},
+			},
+			want: []importEntry{
+				{path: "Заметки/a.md", title: "a", notebook: "Заметки", format: models.ContentMarkdown,
+					content: "![кот](attachment:0) ![cat.png](attachment:0) ![cat.png](attachment:0) " +
+						"[док](https://example.com/doc.pdf) [[b]]",
+					attachments: []importAttachment{{name: "cat.png", data: []byte("PNG")}}},
+				{path: "b.md", title: "b", format: models.ContentMarkdown, content: "![](attachment:0)",
+					attachments: []importAttachment{{name: "cat.png", data: []byte("PNG")}, {name: "doc%.pdf", data: []byte("PDF")}}},
+			},
+			wantIgnored: []string{"files/unused.bin"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, ignored, err := parseVault(zipArchive(t, tt.files...))
+			if err != nil {
+				t.Fatalf("parseVault() error = %v", err)
+			}
+			if !reflect.DeepEqual(entries, tt.want) {
+				t.Errorf("parseVault() entries = %+v, want %+v", entries, tt.want)
+			}
+			if !reflect.DeepEqual(ignored, tt.wantIgnored) {
+				t.Errorf("parseVault() ignored = %q, want %q", ignored, tt.wantIgnored)
+			}
+		})
+	}
+}
+
+func TestParseVaultErrors(t *testing.T) {
+	notes := make([]archiveFile, maxImportFiles+1)
+	for i := range notes {
+		notes[i] = archiveFile{fmt.Sprintf("%d.md", i), "x"}
+	}
+	noteSize := maxImportFileSize
+	compressed := deflateZeros(t, noteSize+1)
+	tests := []struct {
+		name         string
+		archive      func(t *testing.T, zw *zip.Writer)
+		raw          []byte // Архив целиком, если archive не задан
+		wantErr      error
+		wantEntryErr error
+	}{
+		{name: "не ZIP", raw: []byte("not a zip archive"), wantErr: ErrInvalidArchive},
+		{
+			name: "слишком много заметок",
+			raw:  zipArchive(t, notes...),
+			// Проверяется до распаковки заметок
+			wantErr: ErrTooManyNotes,
+		},
+		{
+			name: "заметка больше предела",
+			archive: func(t *testing.T, zw *zip.Writer) {
+				writeRawFile(t, zw, "big.md", compressed, noteSize+1, noteSize+1)
+			},
+			wantEntryErr: ErrArchiveTooLarge,
+		},
+		{
+			name: "заниженный размер в заголовке",
+			archive: func(t *testing.T, zw *zip.Writer) {
+				writeRawFile(t, zw, "big.md", compressed, noteSize+1, 10)
+			},
+			// Распаковка прерывается, как только данных оказывается больше, чем указано в заголовке
+			wantEntryErr: ErrInvalidArchive,
+		},
+		{
+			name: "превышен общий объем распаковки",
+			archive: func(t *testing.T, zw *zip.Writer) {
+				// Вложения не разбираются регулярными выражениями, поэтому бюджет быстрее исчерпать ими
+				count := maxImportUnpackedSize/maxAttachmentSize + 1
+				var content bytes.Buffer
+				for i := 0; i < count; i++ {
+					fmt.Fprintf(&content, "![](%d.bin)\n", i)
+				}
+				w, err := zw.Create("a.md")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := w.Write(content.Bytes()); err != nil {
+					t.Fatal(err)
+				}
+				attachment := deflateZeros(t, maxAttachmentSize)
+				for i := 0; i < count; i++ {
+					writeRawFile(t, zw, fmt.Sprintf("%d.bin", i), attachment, maxAttachmentSize, maxAttachmentSize)
+				}
+			},
+			wantErr: ErrArchiveTooLarge,
+		},
+		{
+			name: "вложение больше предела",
+			archive: func(t *testing.T, zw *zip.Writer) {
+				w, err := zw.Create("a.md")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := w.Write([]byte("![](big.png)")); err != nil {
+					t.Fatal(err)
+				}
+				writeRawFile(t, zw, "big.png", deflateZeros(t, maxAttachmentSize+1), maxAttachmentSize+1, maxAttachmentSize+1)
+			},
+			wantEntryErr: ErrArchiveTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := tt.raw
+			if tt.archive != nil {
+				var buf bytes.Buffer
+				zw := zip.NewWriter(&buf)
+				tt.archive(t, zw)
+				if err := zw.Close(); err != nil {
+					t.Fatal(err)
+				}
+				archive = buf.Bytes()
+			}
+			entries, _, err := parseVault(archive)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseVault() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantEntryErr == nil {
+				return
+			}
+			if len(entries) == 0 || !errors.Is(entries[0].err, tt.wantEntryErr) {
+				t.Errorf("parseVault() entries = %+v, want entry error %v", entries, tt.wantEntryErr)
+			}
+		})
+	}
+}
+
+func TestZipUnpackerCache(t *testing.T) {
+	archive := zipArchive(t, archiveFile{"cat.png", "PNG"})
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unpack := newZipUnpacker()
+	first, err := unpack.read(zr.File[0], maxAttachmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := unpack.read(zr.File[0], maxAttachmentSize)
+	// Повторное чтение не распаковывает файл заново и не расходует бюджет
+	if &first[0] != &second[0] {
+		t.Error("zipUnpacker.read() unpacked the same file twice")
+	}
+	if want := int64(maxImportUnpackedSize - len(first)); unpack.remaining != want {
+		t.Errorf("zipUnpacker.remaining = %d, want %d", unpack.remaining, want)
+	}
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"notes-api/internal/models"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// allowPrivateWebhooks разрешает на время теста вебхуки на внутренние адреса, в том числе на httptest
+func allowPrivateWebhooks(t *testing.T) {
+	t.Helper()
+	allowed := webhookAddressAllowed
+	webhookAddressAllowed = func(net.IP) bool { return true }
+	t.Cleanup(func() { webhookAddressAllowed = allowed })
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, 6 * time.Hour}, // 512 минут ограничиваются шестью часами
+		{1000, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := webhookBackoff(tt.attempts); got != tt.want {
+			t.Errorf("webhookBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		payload   string
+		want      string
+	}{
+		{"подпись", "secret", 1700000000, `{"event":"note.created"}`,
+			"11e3e930d1f3c99c147eac9fe7cef7a07dbf05fddf8388764801864c9fd4ff6d"},
+		{"другое время", "secret", 1700000001, `{"event":"note.created"}`,
+			"8d37b8042b5c2ebf54c83cd3643d2b057bea11af338a2408f3842ecefb98da98"},
+		{"пустое тело", "other", 0, "",
+			"fc69bf3e3a37584ed5fc571115235b76935fa4ef696ea33e03d42cc35f9989ca"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SignWebhookPayload(tt.secret, tt.timestamp, []byte(tt.payload)); got != tt.want {
+				t.Errorf("SignWebhookPayload() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false}, // Метаданные облачных провайдеров
+		{"100.64.0.1", false},      // CGNAT
+		{"198.18.0.1", false},
+		{"0.0.0.0", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"64:ff9b::7f00:1", false}, // NAT64 к 127.0.0.1
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := publicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("publicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestValidateWebhook(t *testing.T) {
+	events := []string{models.WebhookEvents[0]}
+	tests := []struct {
+		name         string
+		url          string
+		events       []string
+		allowPrivate bool
+		want         error
+	}{
+		{"внутренний адрес", "http://127.0.0.1:8080/hook", events, false, ErrWebhookAddress},
+		{"внутренний адрес разрешен", "http://127.0.0.1:8080/hook", events, true, nil},
+		{"не http", "ftp://127.0.0.1/hook", events, true, ErrInvalidWebhookURL},
+		{"относительный адрес", "/hook", events, true, ErrInvalidWebhookURL},
+		{"без событий", "http://127.0.0.1/hook", nil, true, ErrInvalidWebhookEvent},
+		{"неизвестное событие", "http://127.0.0.1/hook", []string{"note.exploded"}, true, ErrInvalidWebhookEvent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.allowPrivate {
+				allowPrivateWebhooks(t)
+			}
+			if err := validateWebhook(context.Background(), tt.url, tt.events); !errors.Is(err, tt.want) {
+				t.Errorf("validateWebhook() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendWebhook(t *testing.T) {
+	const secret = "secret"
+	payload := []byte(`{"event":"note.created"}`)
+	tests := []struct {
+		name       string
+		status     int
+		attempts   int
+		wantStatus string
+		wantRetry  time.Duration
+	}{
+		{"доставлено", http.StatusOK, 1, models.DeliveryDelivered, 0},
+		{"принято без тела", http.StatusNoContent, 3, models.DeliveryDelivered, 0},
+		{"ошибка получателя", http.StatusInternalServerError, 3, models.DeliveryPending, webhookBackoff(3)},
+		{"перенаправление не считается доставкой", http.StatusFound, 1, models.DeliveryPending, webhookBackoff(1)},
+		{"попытки исчерпаны", http.StatusServiceUnavailable, webhookMaxAttempts, models.DeliveryFailed, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowPrivateWebhooks(t)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				timestamp, err := strconv.ParseInt(r.Header.Get("X-Webhook-Timestamp"), 10, 64)
+				if err != nil || time.Since(time.Unix(timestamp, 0)).Abs() > time.Minute {
+					t.Errorf("X-Webhook-Timestamp = %q", r.Header.Get("X-Webhook-Timestamp"))
+				}
+				if got, want := r.Header.Get("X-Webhook-Signature"), "sha256="+SignWebhookPayload(secret, timestamp, body); got != want {
+					t.Errorf("X-Webhook-Signature = %q, want %q", got, want)
+				}
+				if got := r.Header.Get("X-Webhook-Event"); got != "note.created" {
+					t.Errorf("X-Webhook-Event = %q, want note.created", got)
+				}
+				if got := r.Header.Get("X-Webhook-Delivery"); got != "42" {
+					t.Errorf("X-Webhook-Delivery = %q, want 42", got)
+				}
+				if string(body) != string(payload) {
+					t.Errorf("body = %s, want %s", body, payload)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+			statusCode, err := sendWebhook(context.Background(), server.URL, secret, 42, "note.created", payload)
+			if statusCode != tt.status {
+				t.Errorf("sendWebhook() status = %d, want %d", statusCode, tt.status)
+			}
+			status, retryIn := attemptOutcome(tt.attempts, err)
+			if status != tt.wantStatus || retryIn != tt.wantRetry {
+				t.Errorf("attemptOutcome() = %s, %v, want %s, %v (error %v)", status, retryIn, tt.wantStatus, tt.wantRetry, err)
+			}
+		})
+	}
+}
+
+func TestSendWebhookBlocksPrivateAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached a private address")
+	}))
+	defer server.Close()
+	if _, err := sendWebhook(context.Background(), server.URL, "secret", 1, "note.created", nil); !errors.Is(err, ErrWebhookAddress) {
+		t.Errorf("sendWebhook() error = %v, want %v", err, ErrWebhookAddress)
+	}
+}
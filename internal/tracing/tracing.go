@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// instrumentationName - имя, под которым сервис создает свои спаны
+const instrumentationName = "notes-api"
+
+// Setup включает трассировку с отправкой спанов по OTLP/HTTP на endpoint, например http://localhost:4318.
+// Без endpoint трассировка не настраивается: спаны не записываются, заголовок traceparent не разбирается.
+// Возвращаемая функция отправляет накопленные спаны и останавливает трассировку.
+func Setup(ctx context.Context, endpoint, serviceName string) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	endpointURL, err := tracesURL(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	// Заголовки, сжатие и таймаут экспортер берет из стандартных переменных OTEL_EXPORTER_OTLP_*
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpointURL))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания экспортера трассировки: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(),
+		resource.NewSchemaless(attribute.String("service.name", serviceName)))
+	if err != nil {
+		return nil, err
+	}
+	// Выборка задается стандартными OTEL_TRACES_SAMPLER и OTEL_TRACES_SAMPLER_ARG, по умолчанию записываются все запросы
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Warn("Ошибка трассировки", "error", err)
+	}))
+	return provider.Shutdown, nil
+}
+
+// tracesURL дополняет базовый адрес коллектора путем /v1/traces, как это делает OTEL_EXPORTER_OTLP_ENDPOINT
+func tracesURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("недопустимый адрес коллектора трассировки %q: ожидается http(s)://host:port", endpoint)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/v1/traces"
+	return u.String(), nil
+}
+
+// Start начинает спан с родителем из ctx. Без настроенной трассировки спан ничего не записывает.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// Литералы в тексте SQL: строки в кавычках и числа вне идентификаторов и параметров $1
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numericLiteral = regexp.MustCompile(`(^|[^\w$.])\d+(?:\.\d+)?\b`)
+	whitespace     = regexp.MustCompile(`\s+`)
+)
+
+// SanitizeQuery заменяет литералы в запросе на ? и сводит пробелы и переводы строк к одному пробелу.
+// Значения передаются параметрами, но литералы в самом тексте тоже не должны попадать в спаны.
+func SanitizeQuery(query string) string {
+	query = stringLiteral.ReplaceAllString(query, "?")
+	query = numericLiteral.ReplaceAllString(query, "${1}?")
+	return strings.TrimSpace(whitespace.ReplaceAllString(query, " "))
+}
@@ -0,0 +1,25 @@
+package tracing
+
+import "testing"
+
+func TestSanitizeQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"параметры сохраняются", "SELECT id FROM notes WHERE user_id = $1 AND id = $2", "SELECT id FROM notes WHERE user_id = $1 AND id = $2"},
+		{"строки", "SELECT 1 FROM users WHERE email = 'a@b.c' AND role <> 'it''s'", "SELECT ? FROM users WHERE email = ? AND role <> ?"},
+		{"числа", "UPDATE jobs SET attempts = attempts+1, weight = 0.5 LIMIT 100", "UPDATE jobs SET attempts = attempts+?, weight = ? LIMIT ?"},
+		{"идентификаторы с цифрами", "SELECT t1.col2, md5(x) FROM t1", "SELECT t1.col2, md5(x) FROM t1"},
+		{"пробелы и переводы строк", "\n\tSELECT id\n\t\tFROM notes\n", "SELECT id FROM notes"},
+		{"интервал", "DELETE FROM sessions WHERE created_at < NOW() - INTERVAL '30 days'", "DELETE FROM sessions WHERE created_at < NOW() - INTERVAL ?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeQuery(tt.query); got != tt.want {
+				t.Errorf("SanitizeQuery() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}